@@ -40,6 +40,7 @@ import (
 	"github.com/IBM/multicloud-operators-subscription/pkg/controller"
 	"github.com/IBM/multicloud-operators-subscription/pkg/subscriber"
 	"github.com/IBM/multicloud-operators-subscription/pkg/synchronizer"
+	"github.com/IBM/multicloud-operators-subscription/pkg/webhook"
 )
 
 // Change below variables to serve metrics on different host or port.
@@ -84,6 +85,8 @@ func RunManager(sig <-chan struct{}) {
 		Namespace:          namespace,
 		MapperProvider:     restmapper.NewDynamicRESTMapper,
 		MetricsBindAddress: fmt.Sprintf("%s:%d", metricsHost, metricsPort),
+		Port:               Options.WebhookPort,
+		CertDir:            Options.WebhookCertDir,
 	})
 	if err != nil {
 		klog.Error(err, "")
@@ -133,6 +136,14 @@ func RunManager(sig <-chan struct{}) {
 		os.Exit(1)
 	}
 
+	// Setup Webhooks
+	if Options.WebhookPort > 0 {
+		if err := webhook.AddToManager(mgr); err != nil {
+			klog.Error("Failed to initialize webhooks with error:", err)
+			os.Exit(1)
+		}
+	}
+
 	if err = serveCRMetrics(cfg); err != nil {
 		klog.Info("Could not generate and serve custom resource metrics", "error", err.Error())
 	}
@@ -25,6 +25,8 @@ type PlacementRuleCMDOptions struct {
 	ClusterNamespace      string
 	HubConfigFilePathName string
 	SyncInterval          int
+	WebhookPort           int
+	WebhookCertDir        string
 }
 
 var Options = PlacementRuleCMDOptions{
@@ -70,4 +72,18 @@ func ProcessFlags() {
 		Options.SyncInterval,
 		"The interval of housekeeping in seconds.",
 	)
+
+	flag.IntVar(
+		&Options.WebhookPort,
+		"webhook-port",
+		Options.WebhookPort,
+		"The port the subscription admission webhooks serve on, 0 disables the webhooks.",
+	)
+
+	flag.StringVar(
+		&Options.WebhookCertDir,
+		"webhook-cert-dir",
+		Options.WebhookCertDir,
+		"The directory of tls.crt and tls.key for the subscription admission webhooks.",
+	)
 }
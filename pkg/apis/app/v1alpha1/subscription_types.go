@@ -15,10 +15,13 @@
 package v1alpha1
 
 import (
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 
 	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
 	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
@@ -36,11 +39,46 @@ var (
 	AnnotationHosting = SchemeGroupVersion.Group + "/hosting-subscription"
 	// AnnotationChannelGeneration defines the channel generation
 	AnnotationChannelGeneration = SchemeGroupVersion.Group + "/channel-generation"
+	// AnnotationRollingUpdateMaxUnavailable defines the max number or percentage of clusters updated at the same time
+	AnnotationRollingUpdateMaxUnavailable = SchemeGroupVersion.Group + "/rollingupdate-maxunavailable"
+	// AnnotationRollingUpdatePaused pauses the rolling update of the subscription when it is "true"
+	AnnotationRollingUpdatePaused = SchemeGroupVersion.Group + "/rollingupdate-paused"
+	// AnnotationRollbackRevision defines the revision of the hub subscription to re-propagate to all clusters
+	AnnotationRollbackRevision = SchemeGroupVersion.Group + "/rollback-revision"
+	// AnnotationTemplateHash defines the hash of the subscription deployable template kept in a revision
+	AnnotationTemplateHash = SchemeGroupVersion.Group + "/template-hash"
+	// AnnotationApprovedChannelGeneration approves the channel generation to propagate to clusters
+	AnnotationApprovedChannelGeneration = SchemeGroupVersion.Group + "/approved-channel-generation"
+	// AnnotationApprovedPackages defines the package versions approved on hub, the subscriptions propagated to clusters
+	// carry it when approval is required and hold off while the channel content differs from it
+	AnnotationApprovedPackages = SchemeGroupVersion.Group + "/approved-packages"
+	// AnnotationStatusReport moves the per-cluster statuses of the hub subscription to a SubscriptionReport when it is "true"
+	AnnotationStatusReport = SchemeGroupVersion.Group + "/status-report"
+	// AnnotationDryRun resolves the clusters and packages of the hub subscription into status.preview without propagating when it is "true"
+	AnnotationDryRun = SchemeGroupVersion.Group + "/dry-run"
+	// AnnotationChannelPrecedence defines the position of the channel in the channel list of the subscription
+	AnnotationChannelPrecedence = SchemeGroupVersion.Group + "/channel-precedence"
+	// AnnotationCalendarGeneration defines the resource version of the calendar of the subscription propagated from hub
+	AnnotationCalendarGeneration = SchemeGroupVersion.Group + "/calendar-generation"
+	// AnnotationValueFromOverrides carries the valueFrom package overrides of a template to the synchronizer, which resolves them
+	AnnotationValueFromOverrides = SchemeGroupVersion.Group + "/value-from-overrides"
+	// AnnotationHelmValuesHash defines the hash of the merged helm values of a HelmRelease
+	AnnotationHelmValuesHash = SchemeGroupVersion.Group + "/helm-values-hash"
+	// AnnotationDeployableGroup defines the version group of the deployable a resource is deployed from
+	AnnotationDeployableGroup = SchemeGroupVersion.Group + "/deployable-group"
+	// LabelChannelOf defines the subscription with a channel list a per-channel subscription belongs to
+	LabelChannelOf = SchemeGroupVersion.Group + "/channel-of"
+	// LabelRevisionOf defines the hub subscription a revision belongs to
+	LabelRevisionOf = SchemeGroupVersion.Group + "/revision-of"
 )
 
 const (
 	// DefaultRollingUpdateMaxUnavailablePercentage defines the percentage for rolling update
 	DefaultRollingUpdateMaxUnavailablePercentage = 25
+	// DefaultCanaryBakeTime defines how long the canary clusters run a change before it is promoted
+	DefaultCanaryBakeTime = 5 * time.Minute
+	// DefaultRevisionHistoryLimit defines how many revisions of a hub subscription are kept
+	DefaultRevisionHistoryLimit = 10
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -53,8 +91,27 @@ type PackageFilter struct {
 	// +kubebuilder:validation:Pattern=([0-9]+)((\.[0-9]+)(\.[0-9]+)|(\.[0-9]+)?(\.[xX]))$
 	Version   string                       `json:"version,omitempty"`
 	FilterRef *corev1.LocalObjectReference `json:"filterRef,omitempty"`
+	// how a version is picked among the versions matching version, default Highest
+	// +kubebuilder:validation:Enum=Highest;LatestPatch;Pinned
+	VersionPolicy VersionPolicy `json:"versionPolicy,omitempty"`
+	// pre-release versions are skipped unless included
+	IncludePrereleases bool `json:"includePrereleases,omitempty"`
+	// a version is picked only after it is created for at least this long, versions without created time are not held
+	MinSoakAge *metav1.Duration `json:"minSoakAge,omitempty"`
 }
 
+// VersionPolicy defines how a subscription picks a version of a package among the matching versions
+type VersionPolicy string
+
+const (
+	// VersionPolicyHighest picks the highest matching version
+	VersionPolicyHighest VersionPolicy = "Highest"
+	// VersionPolicyLatestPatch picks the highest patch within the major.minor of the deployed version
+	VersionPolicyLatestPatch VersionPolicy = "LatestPatch"
+	// VersionPolicyPinned keeps the deployed version as long as the channel has it, the package is dropped once it is gone
+	VersionPolicyPinned VersionPolicy = "Pinned"
+)
+
 // PackageOverride describes rules for override
 type PackageOverride struct {
 	runtime.RawExtension `json:",inline"`
@@ -76,6 +133,12 @@ type TimeWindow struct {
 	// weekdays defined the day of the week for this time window https://golang.org/pkg/time/#Weekday
 	Weekdays []string    `json:"weekdays,omitempty"`
 	Hours    []HourRange `json:"hours,omitempty"`
+	// recurring windows starting at the cron schedules, combined with the weekdays and hours
+	Crons []CronWindow `json:"crons,omitempty"`
+	// absolute date ranges, e.g. a change freeze, combined with the weekdays and hours
+	Dates []DateRange `json:"dates,omitempty"`
+	// shared maintenance calendar, its windows are combined with the ones above and its blackouts are never run
+	Calendar *CalendarReference `json:"calendar,omitempty"`
 }
 
 //Time format for each time will be Kitchen format, defined at https://golang.org/pkg/time/#pkg-constants
@@ -84,9 +147,63 @@ type HourRange struct {
 	End   string `json:"end,omitempty"`
 }
 
+// CronWindow defines a window opening at each trigger of a cron schedule, in the location of the time window
+type CronWindow struct {
+	// 5-field cron expression, e.g. "0 2 * * SUN#1" for 2:00AM of the first Sunday of each month
+	Schedule string `json:"schedule"`
+	// how long the window stays open after each trigger, e.g. 2h
+	Duration metav1.Duration `json:"duration"`
+}
+
+// DateRange defines an absolute window in the location of the time window, start and end are dates in
+// 2006-01-02 format, which cover the whole day, or times in 2006-01-02T15:04 format
+type DateRange struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// CalendarReference refers to a maintenance calendar ConfigMap in the namespace of the subscription.
+// The ConfigMap keeps a yaml list of named windows in data.windows, a yaml list of blackout date ranges
+// in data.blackouts, and the location of both in data.location
+type CalendarReference struct {
+	Name string `json:"name"`
+	// names of the calendar windows to use, all of them if empty
+	Windows []string `json:"windows,omitempty"`
+}
+
+// RollingUpdate defines how the hub moves clusters to the rolling update target
+type RollingUpdate struct {
+	// max number (e.g. 2) or percentage (e.g. "25%") of clusters moved to the target in one batch
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+	// stop moving more clusters to the target, the batch in progress is still watched
+	Paused bool `json:"paused,omitempty"`
+}
+
+// DependencyReference refers to a subscription which must be healthy before this subscription applies,
+// namespace defaults to the namespace of this subscription
+type DependencyReference struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// Canary defines the clusters receiving a change of the subscription before the rest of the placement
+type Canary struct {
+	// names of the canary clusters
+	Clusters []string `json:"clusters,omitempty"`
+	// labels of the canary clusters
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+	// how long the canary clusters run the change before it is promoted, default 5m
+	BakeTime *metav1.Duration `json:"bakeTime,omitempty"`
+	// max number of failed canary clusters tolerated, the change is reverted beyond it
+	FailureThreshold int `json:"failureThreshold,omitempty"`
+}
+
 // SubscriptionSpec defines the desired state of Subscription
 type SubscriptionSpec struct {
 	Channel string `json:"channel"`
+	// more channels in namespace/name format, subscribed after channel in increasing precedence:
+	// a package in a later channel replaces the package of the same name in the channels before
+	Channels []string `json:"channels,omitempty"`
 	// To specify 1 package in channel
 	Package string `json:"name,omitempty"`
 	// To specify more than 1 package in channel
@@ -99,6 +216,26 @@ type SubscriptionSpec struct {
 	Overrides []dplv1alpha1.Overrides `json:"overrides,omitempty"`
 	// help user control when the subscription will take affect
 	TimeWindow *TimeWindow `json:"timewindow,omitempty"`
+	// subscriptions which must be healthy before this subscription applies, on hub and on managed clusters
+	DependsOn []DependencyReference `json:"dependsOn,omitempty"`
+	// freeze the subscription, the hub stops updating the deployable and the subscribers stop syncing,
+	// resources deployed before stay in place
+	Suspend bool `json:"suspend,omitempty"`
+	// for hub use only, to control the rolling update to the rollingupdate-target subscription
+	RollingUpdate *RollingUpdate `json:"rollingUpdate,omitempty"`
+	// for hub use only, to deploy a change to the canary clusters first
+	Canary *Canary `json:"canary,omitempty"`
+	// for hub use only, number of revisions kept for rollback, default 10
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+	// for hub use only, re-propagate the revision to all clusters instead of the current subscription
+	RollbackRevision int64 `json:"rollbackRevision,omitempty"`
+	// for hub use only, a new channel generation is propagated only after the approved-channel-generation annotation names it.
+	// The gate is on hub only: it holds the channel generation of the propagated template, which triggers the subscribers
+	// to resync. Subscribers still sync the current channel content on their own resync, it is not pinned to a generation
+	ApprovalRequired bool `json:"approvalRequired,omitempty"`
+	// ConfigMap in the namespace of the subscription on the managed cluster, carrying the helm values of the cluster:
+	// values for all packages, <package name>.values for one package. It is the highest precedence helm values layer
+	HelmValuesRef *corev1.LocalObjectReference `json:"helmValuesRef,omitempty"`
 }
 
 // SubscriptionPhase defines the phasing of a Subscription
@@ -113,8 +250,154 @@ const (
 	SubscriptionSubscribed SubscriptionPhase = "Subscribed"
 	// SubscriptionFailed means this subscription is the "parent" sitting in hub
 	SubscriptionFailed SubscriptionPhase = "Failed"
+	// SubscriptionWaitingForDependency means a subscription in dependsOn is not healthy yet
+	SubscriptionWaitingForDependency SubscriptionPhase = "WaitingForDependency"
+	// SubscriptionSuspended means the subscription is frozen by spec.suspend
+	SubscriptionSuspended SubscriptionPhase = "Suspended"
+)
+
+// RollingUpdatePhase defines the phasing of a rolling update on hub
+type RollingUpdatePhase string
+
+const (
+	// RollingUpdateProgressing means clusters are being moved to the target in batches
+	RollingUpdateProgressing RollingUpdatePhase = "Progressing"
+	// RollingUpdatePaused means no new batch will be started until the rolling update is resumed
+	RollingUpdatePaused RollingUpdatePhase = "Paused"
+	// RollingUpdateCompleted means all clusters are running the target
+	RollingUpdateCompleted RollingUpdatePhase = "Completed"
+)
+
+// RollingUpdateStatus defines the progress of a rolling update on hub
+type RollingUpdateStatus struct {
+	// name of the rollingupdate-target subscription
+	Target string             `json:"target"`
+	Phase  RollingUpdatePhase `json:"phase,omitempty"`
+	// all clusters in the scope of the rolling update, resolved from the placement at every reconcile
+	Clusters []string `json:"clusters,omitempty"`
+	// clusters running the target and reported healthy
+	UpdatedClusters []string `json:"updatedClusters,omitempty"`
+	// clusters moved to the target and waiting to report healthy
+	CurrentBatch []string `json:"currentBatch,omitempty"`
+	// when the clusters of the current batch are moved to the target, older cluster statuses do not count
+	CurrentBatchStartTime metav1.Time `json:"currentBatchStartTime,omitempty"`
+	LastTransitionTime    metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// CanaryPhase defines the phasing of a canary stage on hub
+type CanaryPhase string
+
+const (
+	// CanaryBaking means the change is running on the canary clusters only
+	CanaryBaking CanaryPhase = "Baking"
+	// CanaryPromoted means the change is deployed to all clusters
+	CanaryPromoted CanaryPhase = "Promoted"
+	// CanaryAborted means the change failed on the canary clusters and they are reverted to the previous template
+	CanaryAborted CanaryPhase = "Aborted"
+)
+
+// CanaryStatus defines the progress of a canary stage on hub
+type CanaryStatus struct {
+	Phase CanaryPhase `json:"phase,omitempty"`
+	// channel generation of the change
+	ChannelGeneration string `json:"channelGeneration,omitempty"`
+	// hash of the subscription deployable template of the change
+	TemplateHash string `json:"templateHash,omitempty"`
+	// clusters receiving the change
+	Clusters []string `json:"clusters,omitempty"`
+	// canary clusters failing the change
+	FailedClusters     []string    `json:"failedClusters,omitempty"`
+	StartTime          metav1.Time `json:"startTime,omitempty"`
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+}
+
+// SubscriptionRevision defines a rendered subscription deployable template kept on hub
+type SubscriptionRevision struct {
+	Revision int64 `json:"revision"`
+	// name of the ControllerRevision keeping the template
+	Name              string      `json:"name"`
+	ChannelGeneration string      `json:"channelGeneration,omitempty"`
+	CreationTime      metav1.Time `json:"creationTime,omitempty"`
+}
+
+// RollbackStatus defines the revision re-propagated to all clusters on hub
+type RollbackStatus struct {
+	Revision int64 `json:"revision"`
+	// hash of the subscription template replaced by the rollback, a rollback by annotation is over once the
+	// subscription renders another template, e.g. for a new channel generation
+	TemplateHash string      `json:"templateHash,omitempty"`
+	AppliedTime  metav1.Time `json:"appliedTime,omitempty"`
+}
+
+// PackageVersionChange defines the version change of a package in the channel, empty From means added, empty To means removed
+type PackageVersionChange struct {
+	Name string `json:"name"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// PendingChange defines a channel generation waiting for approval
+type PendingChange struct {
+	ChannelGeneration string                 `json:"channelGeneration"`
+	Packages          []PackageVersionChange `json:"packages,omitempty"`
+	DetectedTime      metav1.Time            `json:"detectedTime,omitempty"`
+}
+
+// ApprovalStatus defines the channel generation propagated to clusters and the one waiting for approval
+type ApprovalStatus struct {
+	ApprovedChannelGeneration string `json:"approvedChannelGeneration,omitempty"`
+	// package versions of the approved channel generation, key is package name
+	ApprovedPackages map[string]string `json:"approvedPackages,omitempty"`
+	Pending          *PendingChange    `json:"pending,omitempty"`
+}
+
+// SubscriptionSummary defines the counts of clusters by subscription state on hub
+type SubscriptionSummary struct {
+	Subscribed int `json:"subscribed"`
+	Failed     int `json:"failed"`
+	Pending    int `json:"pending"`
+	Unknown    int `json:"unknown"`
+	// number of clusters failing each package, key is package name
+	PackageFailures map[string]int `json:"packageFailures,omitempty"`
+	// name of the SubscriptionReport keeping the per-cluster statuses, when the status-report annotation is set
+	Report string `json:"report,omitempty"`
+}
+
+// SubscriptionConditionType defines the type of a hub subscription condition
+type SubscriptionConditionType string
+
+const (
+	// SubscriptionReady means all clusters are subscribed without failed packages
+	SubscriptionReady SubscriptionConditionType = "Ready"
+	// SubscriptionPropagatedCondition means the subscription is propagated to the clusters
+	SubscriptionPropagatedCondition SubscriptionConditionType = "Propagated"
+	// SubscriptionDegraded means some clusters failed the subscription
+	SubscriptionDegraded SubscriptionConditionType = "Degraded"
 )
 
+// SubscriptionCondition defines an observation of the hub subscription state
+type SubscriptionCondition struct {
+	Type               SubscriptionConditionType `json:"type"`
+	Status             corev1.ConditionStatus    `json:"status"`
+	Reason             string                    `json:"reason,omitempty"`
+	Message            string                    `json:"message,omitempty"`
+	LastTransitionTime metav1.Time               `json:"lastTransitionTime,omitempty"`
+}
+
+// PackagePreview defines whether a deployable in the channel passes the package filter of the subscription
+type PackagePreview struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	Passed  bool   `json:"passed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// SubscriptionPreview defines the clusters and packages a hub subscription would be propagated to
+type SubscriptionPreview struct {
+	Clusters []string         `json:"clusters,omitempty"`
+	Packages []PackagePreview `json:"packages,omitempty"`
+}
+
 // SubscriptionUnitStatus defines status of a unit (subscription or package)
 type SubscriptionUnitStatus struct {
 	// Phase are Propagated if it is in hub or Subscribed if it is in endpoint
@@ -124,11 +407,40 @@ type SubscriptionUnitStatus struct {
 	LastUpdateTime metav1.Time       `json:"lastUpdateTime"`
 
 	ResourceStatus *runtime.RawExtension `json:"resourceStatus,omitempty"`
+
+	// ValuesHash is the hash of the merged helm values of the package
+	ValuesHash string `json:"valuesHash,omitempty"`
+
+	// Group and Version are the version group and the version of the deployable deployed for the package,
+	// the version policies keep to them after the deployable is gone from the channel
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// TimeWindowState defines whether the time window of a subscription lets the subscribers sync
+type TimeWindowState string
+
+const (
+	// TimeWindowOpen means the subscribers sync the channel
+	TimeWindowOpen TimeWindowState = "Open"
+	// TimeWindowBlocked means the subscribers hold off until the time window opens
+	TimeWindowBlocked TimeWindowState = "Blocked"
+)
+
+// TimeWindowStatus defines the state of the time window of a subscription in a cluster
+type TimeWindowStatus struct {
+	State TimeWindowState `json:"state"`
+	// when the state changes next, empty if it does not change within a year
+	NextTransitionTime *metav1.Time `json:"nextTransitionTime,omitempty"`
+	// the subscribers held off a sync that changes the subscription because of the time window, cleared once synced
+	PendingChanges bool `json:"pendingChanges,omitempty"`
 }
 
 // SubscriptionPerClusterStatus defines status for subscription in each cluster, key is package name
 type SubscriptionPerClusterStatus struct {
 	SubscriptionPackageStatus map[string]*SubscriptionUnitStatus `json:"packages,omitempty"`
+	// For hub, the time window state reported by the cluster
+	TimeWindow *TimeWindowStatus `json:"timeWindow,omitempty"`
 }
 
 // SubscriptionClusterStatusMap defines per cluster status, key is cluster name
@@ -164,8 +476,34 @@ type SubscriptionStatus struct {
 	LastUpdateTime metav1.Time       `json:"lastUpdateTime"`
 
 	// For endpoint, it is the status of subscription, key is packagename,
-	// For hub, it aggregates all status, key is cluster name
+	// For hub, it aggregates all status, key is cluster name. It is kept in the SubscriptionReport
+	// of the same name instead if the status-report annotation is "true"
 	Statuses SubscriptionClusterStatusMap `json:"statuses,omitempty"`
+
+	// For endpoint, the state of the time window of the subscription
+	TimeWindow *TimeWindowStatus `json:"timeWindow,omitempty"`
+
+	// For hub, the counts of clusters by state and the conditions of the subscription
+	Summary    *SubscriptionSummary    `json:"summary,omitempty"`
+	Conditions []SubscriptionCondition `json:"conditions,omitempty"`
+
+	// For hub, the progress of the rolling update to the rollingupdate-target subscription
+	RollingUpdate *RollingUpdateStatus `json:"rollingUpdate,omitempty"`
+
+	// For hub, the progress of the canary stage of the latest change
+	Canary *CanaryStatus `json:"canary,omitempty"`
+
+	// For hub, the approval of channel generations
+	Approval *ApprovalStatus `json:"approval,omitempty"`
+
+	// For hub, the revision propagated to clusters and the revisions kept for rollback, newest first
+	CurrentRevision int64                  `json:"currentRevision,omitempty"`
+	Revisions       []SubscriptionRevision `json:"revisions,omitempty"`
+	// For hub, the rollback applied by the rollback-revision annotation or spec.rollbackRevision
+	Rollback *RollbackStatus `json:"rollback,omitempty"`
+
+	// For hub, the clusters and packages resolved by the dry-run annotation
+	Preview *SubscriptionPreview `json:"preview,omitempty"`
 }
 
 // +genclient
@@ -175,6 +513,7 @@ type SubscriptionStatus struct {
 // +k8s:openapi-gen=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.phase",description="subscription status"
+// +kubebuilder:printcolumn:name="Window",type="string",JSONPath=".status.timeWindow.state",description="time window state",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 // +kubebuilder:resource:scope=Namespaced
 type Subscription struct {
@@ -202,6 +541,7 @@ type SubscriberItem struct {
 	Channel               *chnv1alpha1.Channel
 	ChannelSecret         *corev1.Secret
 	ChannelConfigMap      *corev1.ConfigMap
+	HelmValuesConfigMap   *corev1.ConfigMap
 }
 
 // Subsriber defines common interface of different channel types
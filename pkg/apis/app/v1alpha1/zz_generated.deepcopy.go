@@ -22,12 +22,170 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
 
 	appv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
 	pkgapisappv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
 	apisappv1alpha1 "github.com/IBM/multicloud-operators-placementrule/pkg/apis/app/v1alpha1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApprovalStatus) DeepCopyInto(out *ApprovalStatus) {
+	*out = *in
+	if in.ApprovedPackages != nil {
+		in, out := &in.ApprovedPackages, &out.ApprovedPackages
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Pending != nil {
+		in, out := &in.Pending, &out.Pending
+		*out = new(PendingChange)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApprovalStatus.
+func (in *ApprovalStatus) DeepCopy() *ApprovalStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ApprovalStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CalendarReference) DeepCopyInto(out *CalendarReference) {
+	*out = *in
+	if in.Windows != nil {
+		in, out := &in.Windows, &out.Windows
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CalendarReference.
+func (in *CalendarReference) DeepCopy() *CalendarReference {
+	if in == nil {
+		return nil
+	}
+	out := new(CalendarReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Canary) DeepCopyInto(out *Canary) {
+	*out = *in
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ClusterSelector != nil {
+		in, out := &in.ClusterSelector, &out.ClusterSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.BakeTime != nil {
+		in, out := &in.BakeTime, &out.BakeTime
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Canary.
+func (in *Canary) DeepCopy() *Canary {
+	if in == nil {
+		return nil
+	}
+	out := new(Canary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CanaryStatus) DeepCopyInto(out *CanaryStatus) {
+	*out = *in
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FailedClusters != nil {
+		in, out := &in.FailedClusters, &out.FailedClusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CanaryStatus.
+func (in *CanaryStatus) DeepCopy() *CanaryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CanaryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronWindow) DeepCopyInto(out *CronWindow) {
+	*out = *in
+	out.Duration = in.Duration
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronWindow.
+func (in *CronWindow) DeepCopy() *CronWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(CronWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DateRange) DeepCopyInto(out *DateRange) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DateRange.
+func (in *DateRange) DeepCopy() *DateRange {
+	if in == nil {
+		return nil
+	}
+	out := new(DateRange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DependencyReference) DeepCopyInto(out *DependencyReference) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DependencyReference.
+func (in *DependencyReference) DeepCopy() *DependencyReference {
+	if in == nil {
+		return nil
+	}
+	out := new(DependencyReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HourRange) DeepCopyInto(out *HourRange) {
 	*out = *in
@@ -87,6 +245,11 @@ func (in *PackageFilter) DeepCopyInto(out *PackageFilter) {
 		*out = new(corev1.LocalObjectReference)
 		**out = **in
 	}
+	if in.MinSoakAge != nil {
+		in, out := &in.MinSoakAge, &out.MinSoakAge
+		*out = new(v1.Duration)
+		**out = **in
+	}
 	return
 }
 
@@ -117,6 +280,131 @@ func (in *PackageOverride) DeepCopy() *PackageOverride {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PackageVersionChange) DeepCopyInto(out *PackageVersionChange) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PackageVersionChange.
+func (in *PackageVersionChange) DeepCopy() *PackageVersionChange {
+	if in == nil {
+		return nil
+	}
+	out := new(PackageVersionChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PackagePreview) DeepCopyInto(out *PackagePreview) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PackagePreview.
+func (in *PackagePreview) DeepCopy() *PackagePreview {
+	if in == nil {
+		return nil
+	}
+	out := new(PackagePreview)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PendingChange) DeepCopyInto(out *PendingChange) {
+	*out = *in
+	if in.Packages != nil {
+		in, out := &in.Packages, &out.Packages
+		*out = make([]PackageVersionChange, len(*in))
+		copy(*out, *in)
+	}
+	in.DetectedTime.DeepCopyInto(&out.DetectedTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PendingChange.
+func (in *PendingChange) DeepCopy() *PendingChange {
+	if in == nil {
+		return nil
+	}
+	out := new(PendingChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RollbackStatus) DeepCopyInto(out *RollbackStatus) {
+	*out = *in
+	in.AppliedTime.DeepCopyInto(&out.AppliedTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RollbackStatus.
+func (in *RollbackStatus) DeepCopy() *RollbackStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RollbackStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RollingUpdate) DeepCopyInto(out *RollingUpdate) {
+	*out = *in
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RollingUpdate.
+func (in *RollingUpdate) DeepCopy() *RollingUpdate {
+	if in == nil {
+		return nil
+	}
+	out := new(RollingUpdate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RollingUpdateStatus) DeepCopyInto(out *RollingUpdateStatus) {
+	*out = *in
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.UpdatedClusters != nil {
+		in, out := &in.UpdatedClusters, &out.UpdatedClusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CurrentBatch != nil {
+		in, out := &in.CurrentBatch, &out.CurrentBatch
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.CurrentBatchStartTime.DeepCopyInto(&out.CurrentBatchStartTime)
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RollingUpdateStatus.
+func (in *RollingUpdateStatus) DeepCopy() *RollingUpdateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RollingUpdateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SubscriberItem) DeepCopyInto(out *SubscriberItem) {
 	*out = *in
@@ -145,6 +433,11 @@ func (in *SubscriberItem) DeepCopyInto(out *SubscriberItem) {
 		*out = new(corev1.ConfigMap)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.HelmValuesConfigMap != nil {
+		in, out := &in.HelmValuesConfigMap, &out.HelmValuesConfigMap
+		*out = new(corev1.ConfigMap)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -216,6 +509,23 @@ func (in SubscriptionClusterStatusMap) DeepCopy() SubscriptionClusterStatusMap {
 	return *out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubscriptionCondition) DeepCopyInto(out *SubscriptionCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubscriptionCondition.
+func (in *SubscriptionCondition) DeepCopy() *SubscriptionCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(SubscriptionCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SubscriptionList) DeepCopyInto(out *SubscriptionList) {
 	*out = *in
@@ -267,6 +577,11 @@ func (in *SubscriptionPerClusterStatus) DeepCopyInto(out *SubscriptionPerCluster
 			(*out)[key] = outVal
 		}
 	}
+	if in.TimeWindow != nil {
+		in, out := &in.TimeWindow, &out.TimeWindow
+		*out = new(TimeWindowStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -280,9 +595,131 @@ func (in *SubscriptionPerClusterStatus) DeepCopy() *SubscriptionPerClusterStatus
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubscriptionReport) DeepCopyInto(out *SubscriptionReport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Statuses != nil {
+		in, out := &in.Statuses, &out.Statuses
+		*out = make(SubscriptionClusterStatusMap, len(*in))
+		for key, val := range *in {
+			var outVal *SubscriptionPerClusterStatus
+			if val == nil {
+				(*out)[key] = nil
+			} else {
+				in, out := &val, &outVal
+				*out = new(SubscriptionPerClusterStatus)
+				(*in).DeepCopyInto(*out)
+			}
+			(*out)[key] = outVal
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubscriptionReport.
+func (in *SubscriptionReport) DeepCopy() *SubscriptionReport {
+	if in == nil {
+		return nil
+	}
+	out := new(SubscriptionReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SubscriptionReport) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubscriptionReportList) DeepCopyInto(out *SubscriptionReportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SubscriptionReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubscriptionReportList.
+func (in *SubscriptionReportList) DeepCopy() *SubscriptionReportList {
+	if in == nil {
+		return nil
+	}
+	out := new(SubscriptionReportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SubscriptionReportList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubscriptionPreview) DeepCopyInto(out *SubscriptionPreview) {
+	*out = *in
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Packages != nil {
+		in, out := &in.Packages, &out.Packages
+		*out = make([]PackagePreview, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubscriptionPreview.
+func (in *SubscriptionPreview) DeepCopy() *SubscriptionPreview {
+	if in == nil {
+		return nil
+	}
+	out := new(SubscriptionPreview)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubscriptionRevision) DeepCopyInto(out *SubscriptionRevision) {
+	*out = *in
+	in.CreationTime.DeepCopyInto(&out.CreationTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubscriptionRevision.
+func (in *SubscriptionRevision) DeepCopy() *SubscriptionRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(SubscriptionRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SubscriptionSpec) DeepCopyInto(out *SubscriptionSpec) {
 	*out = *in
+	if in.Channels != nil {
+		in, out := &in.Channels, &out.Channels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.PackageFilter != nil {
 		in, out := &in.PackageFilter, &out.PackageFilter
 		*out = new(PackageFilter)
@@ -316,6 +753,31 @@ func (in *SubscriptionSpec) DeepCopyInto(out *SubscriptionSpec) {
 		*out = new(TimeWindow)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]DependencyReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.RollingUpdate != nil {
+		in, out := &in.RollingUpdate, &out.RollingUpdate
+		*out = new(RollingUpdate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(Canary)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.HelmValuesRef != nil {
+		in, out := &in.HelmValuesRef, &out.HelmValuesRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
 	return
 }
 
@@ -348,6 +810,55 @@ func (in *SubscriptionStatus) DeepCopyInto(out *SubscriptionStatus) {
 			(*out)[key] = outVal
 		}
 	}
+	if in.TimeWindow != nil {
+		in, out := &in.TimeWindow, &out.TimeWindow
+		*out = new(TimeWindowStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Summary != nil {
+		in, out := &in.Summary, &out.Summary
+		*out = new(SubscriptionSummary)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]SubscriptionCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RollingUpdate != nil {
+		in, out := &in.RollingUpdate, &out.RollingUpdate
+		*out = new(RollingUpdateStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(CanaryStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Approval != nil {
+		in, out := &in.Approval, &out.Approval
+		*out = new(ApprovalStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Revisions != nil {
+		in, out := &in.Revisions, &out.Revisions
+		*out = make([]SubscriptionRevision, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Rollback != nil {
+		in, out := &in.Rollback, &out.Rollback
+		*out = new(RollbackStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Preview != nil {
+		in, out := &in.Preview, &out.Preview
+		*out = new(SubscriptionPreview)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -361,6 +872,29 @@ func (in *SubscriptionStatus) DeepCopy() *SubscriptionStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SubscriptionSummary) DeepCopyInto(out *SubscriptionSummary) {
+	*out = *in
+	if in.PackageFailures != nil {
+		in, out := &in.PackageFailures, &out.PackageFailures
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SubscriptionSummary.
+func (in *SubscriptionSummary) DeepCopy() *SubscriptionSummary {
+	if in == nil {
+		return nil
+	}
+	out := new(SubscriptionSummary)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SubscriptionUnitStatus) DeepCopyInto(out *SubscriptionUnitStatus) {
 	*out = *in
@@ -396,6 +930,21 @@ func (in *TimeWindow) DeepCopyInto(out *TimeWindow) {
 		*out = make([]HourRange, len(*in))
 		copy(*out, *in)
 	}
+	if in.Crons != nil {
+		in, out := &in.Crons, &out.Crons
+		*out = make([]CronWindow, len(*in))
+		copy(*out, *in)
+	}
+	if in.Dates != nil {
+		in, out := &in.Dates, &out.Dates
+		*out = make([]DateRange, len(*in))
+		copy(*out, *in)
+	}
+	if in.Calendar != nil {
+		in, out := &in.Calendar, &out.Calendar
+		*out = new(CalendarReference)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -408,3 +957,23 @@ func (in *TimeWindow) DeepCopy() *TimeWindow {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TimeWindowStatus) DeepCopyInto(out *TimeWindowStatus) {
+	*out = *in
+	if in.NextTransitionTime != nil {
+		in, out := &in.NextTransitionTime, &out.NextTransitionTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TimeWindowStatus.
+func (in *TimeWindowStatus) DeepCopy() *TimeWindowStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TimeWindowStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,358 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+// v1alpha1Channels keeps the channel strings of a v1alpha1 subscription
+type v1alpha1Channels struct {
+	Channel  string   `json:"channel"`
+	Channels []string `json:"channels,omitempty"`
+}
+
+// v1beta1Channels keeps the channel references of a v1beta1 subscription
+type v1beta1Channels struct {
+	Channel  ChannelReference   `json:"channel"`
+	Channels []ChannelReference `json:"channels,omitempty"`
+}
+
+// ConvertTo converts the subscription to the v1alpha1 hub version
+func (sub *Subscription) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*appv1alpha1.Subscription)
+	if !ok {
+		return errors.New("failed to convert subscription " + sub.Namespace + "/" + sub.Name + " to a non v1alpha1 version")
+	}
+
+	sub.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+
+	convertSpecToV1alpha1(&sub.Spec, &dst.Spec)
+	convertStatusToV1alpha1(&sub.Status, &dst.Status)
+
+	chns := v1beta1Channels{Channel: sub.Spec.Channel, Channels: sub.Spec.Channels}
+
+	// the v1alpha1 strings are restored unless the channels are changed in v1beta1 since
+	if kept, ok := popAnnotation(&dst.ObjectMeta, AnnotationV1alpha1Channels); ok {
+		alphachns := v1alpha1Channels{}
+
+		if json.Unmarshal([]byte(kept), &alphachns) == nil && equality.Semantic.DeepEqual(parseChannels(alphachns), chns) {
+			dst.Spec.Channel = alphachns.Channel
+			dst.Spec.Channels = alphachns.Channels
+
+			return nil
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(parseChannels(formatChannels(chns)), chns) {
+		return setAnnotation(&dst.ObjectMeta, AnnotationV1beta1Channels, chns)
+	}
+
+	return nil
+}
+
+// ConvertFrom converts the v1alpha1 hub version to the subscription
+func (sub *Subscription) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*appv1alpha1.Subscription)
+	if !ok {
+		return errors.New("failed to convert subscription " + sub.Namespace + "/" + sub.Name + " from a non v1alpha1 version")
+	}
+
+	src.ObjectMeta.DeepCopyInto(&sub.ObjectMeta)
+
+	convertSpecFromV1alpha1(&src.Spec, &sub.Spec)
+	convertStatusFromV1alpha1(&src.Status, &sub.Status)
+
+	alphachns := v1alpha1Channels{Channel: src.Spec.Channel, Channels: src.Spec.Channels}
+
+	// the v1beta1 references are restored unless the channels are changed in v1alpha1 since
+	if kept, ok := popAnnotation(&sub.ObjectMeta, AnnotationV1beta1Channels); ok {
+		chns := v1beta1Channels{}
+
+		if json.Unmarshal([]byte(kept), &chns) == nil && equality.Semantic.DeepEqual(formatChannels(chns), alphachns) {
+			sub.Spec.Channel = chns.Channel
+			sub.Spec.Channels = chns.Channels
+
+			return nil
+		}
+	}
+
+	if !equality.Semantic.DeepEqual(formatChannels(parseChannels(alphachns)), alphachns) {
+		return setAnnotation(&sub.ObjectMeta, AnnotationV1alpha1Channels, alphachns)
+	}
+
+	return nil
+}
+
+func convertSpecToV1alpha1(in *SubscriptionSpec, out *appv1alpha1.SubscriptionSpec) {
+	alphachns := formatChannels(v1beta1Channels{Channel: in.Channel, Channels: in.Channels})
+
+	out.Channel = alphachns.Channel
+	out.Channels = alphachns.Channels
+	out.Package = in.Package
+	out.PackageFilter = in.PackageFilter.DeepCopy()
+	out.PackageOverrides = nil
+
+	for _, ov := range in.PackageOverrides {
+		out.PackageOverrides = append(out.PackageOverrides, ov.DeepCopy())
+	}
+
+	out.Placement = in.Placement.DeepCopy()
+	out.Overrides = nil
+
+	for i := range in.Overrides {
+		out.Overrides = append(out.Overrides, *in.Overrides[i].DeepCopy())
+	}
+
+	out.TimeWindow = nil
+
+	if in.TimeWindow != nil {
+		out.TimeWindow = &appv1alpha1.TimeWindow{
+			WindowType: string(in.TimeWindow.WindowType),
+			Location:   in.TimeWindow.Location,
+			Weekdays:   append([]string(nil), in.TimeWindow.Weekdays...),
+			Hours:      append([]appv1alpha1.HourRange(nil), in.TimeWindow.Hours...),
+			Crons:      append([]appv1alpha1.CronWindow(nil), in.TimeWindow.Crons...),
+			Dates:      append([]appv1alpha1.DateRange(nil), in.TimeWindow.Dates...),
+			Calendar:   in.TimeWindow.Calendar.DeepCopy(),
+		}
+	}
+
+	out.DependsOn = append([]appv1alpha1.DependencyReference(nil), in.DependsOn...)
+	out.Suspend = in.Suspend
+	out.RollingUpdate = in.RollingUpdate.DeepCopy()
+	out.Canary = in.Canary.DeepCopy()
+	out.RevisionHistoryLimit = nil
+
+	if in.RevisionHistoryLimit != nil {
+		limit := *in.RevisionHistoryLimit
+		out.RevisionHistoryLimit = &limit
+	}
+
+	out.RollbackRevision = in.RollbackRevision
+	out.ApprovalRequired = in.ApprovalRequired
+	out.HelmValuesRef = in.HelmValuesRef.DeepCopy()
+}
+
+func convertSpecFromV1alpha1(in *appv1alpha1.SubscriptionSpec, out *SubscriptionSpec) {
+	chns := parseChannels(v1alpha1Channels{Channel: in.Channel, Channels: in.Channels})
+
+	out.Channel = chns.Channel
+	out.Channels = chns.Channels
+	out.Package = in.Package
+	out.PackageFilter = in.PackageFilter.DeepCopy()
+	out.PackageOverrides = nil
+
+	for _, ov := range in.PackageOverrides {
+		out.PackageOverrides = append(out.PackageOverrides, ov.DeepCopy())
+	}
+
+	out.Placement = in.Placement.DeepCopy()
+	out.Overrides = nil
+
+	for i := range in.Overrides {
+		out.Overrides = append(out.Overrides, *in.Overrides[i].DeepCopy())
+	}
+
+	out.TimeWindow = nil
+
+	if in.TimeWindow != nil {
+		out.TimeWindow = &TimeWindow{
+			WindowType: WindowType(in.TimeWindow.WindowType),
+			Location:   in.TimeWindow.Location,
+			Weekdays:   append([]string(nil), in.TimeWindow.Weekdays...),
+			Hours:      append([]appv1alpha1.HourRange(nil), in.TimeWindow.Hours...),
+			Crons:      append([]appv1alpha1.CronWindow(nil), in.TimeWindow.Crons...),
+			Dates:      append([]appv1alpha1.DateRange(nil), in.TimeWindow.Dates...),
+			Calendar:   in.TimeWindow.Calendar.DeepCopy(),
+		}
+	}
+
+	out.DependsOn = append([]appv1alpha1.DependencyReference(nil), in.DependsOn...)
+	out.Suspend = in.Suspend
+	out.RollingUpdate = in.RollingUpdate.DeepCopy()
+	out.Canary = in.Canary.DeepCopy()
+	out.RevisionHistoryLimit = nil
+
+	if in.RevisionHistoryLimit != nil {
+		limit := *in.RevisionHistoryLimit
+		out.RevisionHistoryLimit = &limit
+	}
+
+	out.RollbackRevision = in.RollbackRevision
+	out.ApprovalRequired = in.ApprovalRequired
+	out.HelmValuesRef = in.HelmValuesRef.DeepCopy()
+}
+
+func convertStatusToV1alpha1(in *SubscriptionStatus, out *appv1alpha1.SubscriptionStatus) {
+	out.Phase = appv1alpha1.SubscriptionPhase(in.Phase)
+	out.Message = in.Message
+	out.Reason = in.Reason
+	in.LastUpdateTime.DeepCopyInto(&out.LastUpdateTime)
+	out.Conditions = nil
+
+	for _, cond := range in.Conditions {
+		out.Conditions = append(out.Conditions, appv1alpha1.SubscriptionCondition{
+			Type:               appv1alpha1.SubscriptionConditionType(cond.Type),
+			Status:             cond.Status,
+			Reason:             cond.Reason,
+			Message:            cond.Message,
+			LastTransitionTime: *cond.LastTransitionTime.DeepCopy(),
+		})
+	}
+
+	out.Statuses = nil
+
+	if in.Statuses != nil {
+		in.Statuses.DeepCopyInto(&out.Statuses)
+	}
+
+	out.TimeWindow = in.TimeWindow.DeepCopy()
+	out.Summary = in.Summary.DeepCopy()
+	out.RollingUpdate = in.RollingUpdate.DeepCopy()
+	out.Canary = in.Canary.DeepCopy()
+	out.Approval = in.Approval.DeepCopy()
+	out.CurrentRevision = in.CurrentRevision
+	out.Revisions = nil
+
+	for i := range in.Revisions {
+		out.Revisions = append(out.Revisions, *in.Revisions[i].DeepCopy())
+	}
+
+	out.Rollback = in.Rollback.DeepCopy()
+	out.Preview = in.Preview.DeepCopy()
+}
+
+func convertStatusFromV1alpha1(in *appv1alpha1.SubscriptionStatus, out *SubscriptionStatus) {
+	out.Phase = SubscriptionPhase(in.Phase)
+	out.Message = in.Message
+	out.Reason = in.Reason
+	in.LastUpdateTime.DeepCopyInto(&out.LastUpdateTime)
+	out.Conditions = nil
+
+	for _, cond := range in.Conditions {
+		out.Conditions = append(out.Conditions, Condition{
+			Type:               ConditionType(cond.Type),
+			Status:             cond.Status,
+			Reason:             cond.Reason,
+			Message:            cond.Message,
+			LastTransitionTime: *cond.LastTransitionTime.DeepCopy(),
+		})
+	}
+
+	out.Statuses = nil
+
+	if in.Statuses != nil {
+		in.Statuses.DeepCopyInto(&out.Statuses)
+	}
+
+	out.TimeWindow = in.TimeWindow.DeepCopy()
+	out.Summary = in.Summary.DeepCopy()
+	out.RollingUpdate = in.RollingUpdate.DeepCopy()
+	out.Canary = in.Canary.DeepCopy()
+	out.Approval = in.Approval.DeepCopy()
+	out.CurrentRevision = in.CurrentRevision
+	out.Revisions = nil
+
+	for i := range in.Revisions {
+		out.Revisions = append(out.Revisions, *in.Revisions[i].DeepCopy())
+	}
+
+	out.Rollback = in.Rollback.DeepCopy()
+	out.Preview = in.Preview.DeepCopy()
+}
+
+// parseChannel converts a v1alpha1 channel string in namespace/name format to a reference,
+// a string in other formats is kept as the name
+func parseChannel(chn string) ChannelReference {
+	if chn == "" {
+		return ChannelReference{}
+	}
+
+	strs := strings.Split(chn, "/")
+	if len(strs) != 2 {
+		return ChannelReference{Name: chn}
+	}
+
+	return ChannelReference{Namespace: strs[0], Name: strs[1]}
+}
+
+// formatChannel converts a reference to a v1alpha1 channel string in namespace/name format
+func formatChannel(ref ChannelReference) string {
+	if ref == (ChannelReference{}) {
+		return ""
+	}
+
+	return ref.Namespace + "/" + ref.Name
+}
+
+func parseChannels(in v1alpha1Channels) v1beta1Channels {
+	out := v1beta1Channels{Channel: parseChannel(in.Channel)}
+
+	for _, chn := range in.Channels {
+		out.Channels = append(out.Channels, parseChannel(chn))
+	}
+
+	return out
+}
+
+func formatChannels(in v1beta1Channels) v1alpha1Channels {
+	out := v1alpha1Channels{Channel: formatChannel(in.Channel)}
+
+	for _, ref := range in.Channels {
+		out.Channels = append(out.Channels, formatChannel(ref))
+	}
+
+	return out
+}
+
+func setAnnotation(meta *metav1.ObjectMeta, key string, val interface{}) error {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+
+	meta.Annotations[key] = string(data)
+
+	return nil
+}
+
+// popAnnotation removes the annotation and returns its value
+func popAnnotation(meta *metav1.ObjectMeta, key string) (string, bool) {
+	val, ok := meta.Annotations[key]
+	if !ok {
+		return "", false
+	}
+
+	delete(meta.Annotations, key)
+
+	if len(meta.Annotations) == 0 {
+		meta.Annotations = nil
+	}
+
+	return val, true
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+const fuzzIterations = 1000
+
+func newFuzzer(seed int64) *fuzz.Fuzzer {
+	return fuzz.New().RandSource(rand.NewSource(seed)).NilChance(0.2).Funcs(
+		// apiVersion and kind are set by the conversion webhook
+		func(tm *metav1.TypeMeta, c fuzz.Continue) {},
+		// managed fields are not touched by the conversion
+		func(mf *metav1.ManagedFieldsEntry, c fuzz.Continue) {
+			*mf = metav1.ManagedFieldsEntry{Manager: c.RandString()}
+		},
+		func(raw *runtime.RawExtension, c fuzz.Continue) {
+			raw.Raw = []byte(`{"path":"spec.replicas","value":` + strconv.Itoa(c.Intn(10)) + `}`)
+		},
+		func(chn *ChannelReference, c fuzz.Continue) {
+			// mostly namespace/name, sometimes what a namespace/name string can not represent
+			switch c.Intn(4) {
+			case 0:
+				*chn = ChannelReference{}
+			case 1:
+				*chn = ChannelReference{Namespace: c.RandString() + "/" + c.RandString(), Name: c.RandString()}
+			default:
+				*chn = ChannelReference{Namespace: c.RandString(), Name: c.RandString()}
+			}
+		},
+		func(chn *string, c fuzz.Continue) {
+			*chn = c.RandString()
+			// add channel-like strings to the random ones
+			if c.RandBool() {
+				*chn += "/" + c.RandString()
+			}
+		},
+	)
+}
+
+func TestSubscriptionConversionFromV1alpha1RoundTrip(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	f := newFuzzer(1)
+
+	for i := 0; i < fuzzIterations; i++ {
+		src := &appv1alpha1.Subscription{}
+		f.Fuzz(src)
+
+		sub := &Subscription{}
+		g.Expect(sub.ConvertFrom(src.DeepCopy())).To(gomega.Succeed())
+
+		dst := &appv1alpha1.Subscription{}
+		g.Expect(sub.ConvertTo(dst)).To(gomega.Succeed())
+
+		if !equality.Semantic.DeepEqual(src, dst) {
+			t.Fatalf("v1alpha1 subscription changed by round trip:\n%#v\n%#v", src, dst)
+		}
+	}
+}
+
+func TestSubscriptionConversionFromV1beta1RoundTrip(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	f := newFuzzer(2)
+
+	for i := 0; i < fuzzIterations; i++ {
+		src := &Subscription{}
+		f.Fuzz(src)
+
+		hub := &appv1alpha1.Subscription{}
+		g.Expect(src.DeepCopy().ConvertTo(hub)).To(gomega.Succeed())
+
+		dst := &Subscription{}
+		g.Expect(dst.ConvertFrom(hub)).To(gomega.Succeed())
+
+		if !equality.Semantic.DeepEqual(src, dst) {
+			t.Fatalf("v1beta1 subscription changed by round trip:\n%#v\n%#v", src, dst)
+		}
+	}
+}
+
+func TestSubscriptionChannelConversion(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	src := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: "sub", Namespace: "default"},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel:    "ns-ch/ch",
+			Channels:   []string{"ns-ch/ch-2"},
+			Package:    "nginx",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "blocked"},
+		},
+	}
+
+	sub := &Subscription{}
+	g.Expect(sub.ConvertFrom(src)).To(gomega.Succeed())
+	g.Expect(sub.Spec.Channel).To(gomega.Equal(ChannelReference{Namespace: "ns-ch", Name: "ch"}))
+	g.Expect(sub.Spec.Channels).To(gomega.Equal([]ChannelReference{{Namespace: "ns-ch", Name: "ch-2"}}))
+	g.Expect(sub.Spec.Package).To(gomega.Equal("nginx"))
+	g.Expect(sub.Spec.TimeWindow.WindowType).To(gomega.Equal(WindowTypeBlocked))
+	g.Expect(sub.GetAnnotations()).NotTo(gomega.HaveKey(AnnotationV1alpha1Channels))
+
+	// a channel not in namespace/name format is kept in an annotation
+	src.Spec.Channel = "ch"
+
+	sub = &Subscription{}
+	g.Expect(sub.ConvertFrom(src)).To(gomega.Succeed())
+	g.Expect(sub.Spec.Channel).To(gomega.Equal(ChannelReference{Name: "ch"}))
+	g.Expect(sub.GetAnnotations()).To(gomega.HaveKey(AnnotationV1alpha1Channels))
+
+	dst := &appv1alpha1.Subscription{}
+	g.Expect(sub.ConvertTo(dst)).To(gomega.Succeed())
+	g.Expect(dst.Spec.Channel).To(gomega.Equal("ch"))
+	g.Expect(dst.GetAnnotations()).To(gomega.BeEmpty())
+
+	// the annotation is dropped once the channel is changed in v1beta1
+	sub.Spec.Channel = ChannelReference{Namespace: "ns-ch", Name: "ch"}
+
+	dst = &appv1alpha1.Subscription{}
+	g.Expect(sub.ConvertTo(dst)).To(gomega.Succeed())
+	g.Expect(dst.Spec.Channel).To(gomega.Equal("ns-ch/ch"))
+	g.Expect(dst.GetAnnotations()).To(gomega.BeEmpty())
+}
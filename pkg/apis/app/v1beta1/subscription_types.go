@@ -0,0 +1,218 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	plrv1alpha1 "github.com/IBM/multicloud-operators-placementrule/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+var (
+	// AnnotationV1alpha1Channels keeps the v1alpha1 channel strings not in namespace/name format,
+	// so the v1beta1 subscription converts back to the same v1alpha1 subscription
+	AnnotationV1alpha1Channels = SchemeGroupVersion.Group + "/v1alpha1-channels"
+	// AnnotationV1beta1Channels keeps the v1beta1 channel references not representable as namespace/name strings,
+	// so the v1alpha1 subscription converts back to the same v1beta1 subscription
+	AnnotationV1beta1Channels = SchemeGroupVersion.Group + "/v1beta1-channels"
+)
+
+// ChannelReference refers to a channel by namespace and name
+type ChannelReference struct {
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// WindowType defines whether the subscription applies only during the time window or is blocked during it
+// +kubebuilder:validation:Enum=active;blocked
+type WindowType string
+
+const (
+	// WindowTypeActive means the subscription applies only during the time window
+	WindowTypeActive WindowType = "active"
+	// WindowTypeBlocked means the subscription is blocked during the time window
+	WindowTypeBlocked WindowType = "blocked"
+)
+
+// TimeWindow defines a time window for subscription to run or be blocked
+type TimeWindow struct {
+	WindowType WindowType `json:"windowType,omitempty"`
+	// https://en.wikipedia.org/wiki/List_of_tz_database_time_zones
+	Location string `json:"location,omitempty"`
+	// weekdays defined the day of the week for this time window https://golang.org/pkg/time/#Weekday
+	Weekdays []string                `json:"weekdays,omitempty"`
+	Hours    []appv1alpha1.HourRange `json:"hours,omitempty"`
+	// recurring windows starting at the cron schedules, combined with the weekdays and hours
+	Crons []appv1alpha1.CronWindow `json:"crons,omitempty"`
+	// absolute date ranges, e.g. a change freeze, combined with the weekdays and hours
+	Dates []appv1alpha1.DateRange `json:"dates,omitempty"`
+	// shared maintenance calendar, its windows are combined with the ones above and its blackouts are never run
+	Calendar *appv1alpha1.CalendarReference `json:"calendar,omitempty"`
+}
+
+// SubscriptionSpec defines the desired state of Subscription
+type SubscriptionSpec struct {
+	Channel ChannelReference `json:"channel"`
+	// more channels subscribed after channel in increasing precedence:
+	// a package in a later channel replaces the package of the same name in the channels before
+	Channels []ChannelReference `json:"channels,omitempty"`
+	// To specify 1 package in channel
+	Package string `json:"package,omitempty"`
+	// To specify more than 1 package in channel
+	PackageFilter *appv1alpha1.PackageFilter `json:"packageFilter,omitempty"`
+	// To provide flexibility to override package in channel with local input
+	PackageOverrides []*appv1alpha1.Overrides `json:"packageOverrides,omitempty"`
+	// For hub use only, to specify which clusters to go to
+	Placement *plrv1alpha1.Placement `json:"placement,omitempty"`
+	// for hub use only to specify the overrides when apply to clusters
+	Overrides []dplv1alpha1.Overrides `json:"overrides,omitempty"`
+	// help user control when the subscription will take affect
+	TimeWindow *TimeWindow `json:"timeWindow,omitempty"`
+	// subscriptions which must be healthy before this subscription applies, on hub and on managed clusters
+	DependsOn []appv1alpha1.DependencyReference `json:"dependsOn,omitempty"`
+	// freeze the subscription, the hub stops updating the deployable and the subscribers stop syncing,
+	// resources deployed before stay in place
+	Suspend bool `json:"suspend,omitempty"`
+	// for hub use only, to control the rolling update to the rollingupdate-target subscription
+	RollingUpdate *appv1alpha1.RollingUpdate `json:"rollingUpdate,omitempty"`
+	// for hub use only, to deploy a change to the canary clusters first
+	Canary *appv1alpha1.Canary `json:"canary,omitempty"`
+	// for hub use only, number of revisions kept for rollback, default 10
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+	// for hub use only, re-propagate the revision to all clusters instead of the current subscription
+	RollbackRevision int64 `json:"rollbackRevision,omitempty"`
+	// for hub use only, a new channel generation is propagated only after the approved-channel-generation annotation names it.
+	// The gate is on hub only: it holds the channel generation of the propagated template, which triggers the subscribers
+	// to resync. Subscribers still sync the current channel content on their own resync, it is not pinned to a generation
+	ApprovalRequired bool `json:"approvalRequired,omitempty"`
+	// ConfigMap in the namespace of the subscription on the managed cluster, carrying the helm values of the cluster:
+	// values for all packages, <package name>.values for one package. It is the highest precedence helm values layer
+	HelmValuesRef *corev1.LocalObjectReference `json:"helmValuesRef,omitempty"`
+}
+
+// SubscriptionPhase defines the phasing of a Subscription
+// +kubebuilder:validation:Enum=Propagated;Subscribed;Failed;WaitingForDependency;Suspended
+type SubscriptionPhase string
+
+const (
+	// SubscriptionUnknown means the subscription is not reconciled yet
+	SubscriptionUnknown SubscriptionPhase = ""
+	// SubscriptionPropagated means this subscription is the "parent" sitting in hub
+	SubscriptionPropagated SubscriptionPhase = "Propagated"
+	// SubscriptionSubscribed means this subscription is child sitting in managed cluster
+	SubscriptionSubscribed SubscriptionPhase = "Subscribed"
+	// SubscriptionFailed means the subscription failed to propagate or subscribe
+	SubscriptionFailed SubscriptionPhase = "Failed"
+	// SubscriptionWaitingForDependency means a subscription in dependsOn is not healthy yet
+	SubscriptionWaitingForDependency SubscriptionPhase = "WaitingForDependency"
+	// SubscriptionSuspended means the subscription is frozen by spec.suspend
+	SubscriptionSuspended SubscriptionPhase = "Suspended"
+)
+
+// ConditionType defines the type of a subscription condition
+// +kubebuilder:validation:Enum=Ready;Propagated;Degraded
+type ConditionType string
+
+const (
+	// ConditionReady means all clusters are subscribed without failed packages
+	ConditionReady ConditionType = "Ready"
+	// ConditionPropagated means the subscription is propagated to the clusters
+	ConditionPropagated ConditionType = "Propagated"
+	// ConditionDegraded means some clusters failed the subscription
+	ConditionDegraded ConditionType = "Degraded"
+)
+
+// Condition defines an observation of the subscription state
+type Condition struct {
+	Type ConditionType `json:"type"`
+	// +kubebuilder:validation:Enum=True;False;Unknown
+	Status             corev1.ConditionStatus `json:"status"`
+	Reason             string                 `json:"reason,omitempty"`
+	Message            string                 `json:"message,omitempty"`
+	LastTransitionTime metav1.Time            `json:"lastTransitionTime,omitempty"`
+}
+
+// SubscriptionStatus defines the observed state of Subscription
+type SubscriptionStatus struct {
+	Phase          SubscriptionPhase `json:"phase,omitempty"`
+	Message        string            `json:"message,omitempty"`
+	Reason         string            `json:"reason,omitempty"`
+	LastUpdateTime metav1.Time       `json:"lastUpdateTime,omitempty"`
+
+	// conditions of the subscription, keyed by type
+	Conditions []Condition `json:"conditions,omitempty"`
+
+	// For endpoint, it is the status of subscription, key is packagename,
+	// For hub, it aggregates all status, key is cluster name
+	Statuses appv1alpha1.SubscriptionClusterStatusMap `json:"statuses,omitempty"`
+
+	// For endpoint, the state of the time window of the subscription
+	TimeWindow *appv1alpha1.TimeWindowStatus `json:"timeWindow,omitempty"`
+
+	// For hub, the counts of clusters by state
+	Summary *appv1alpha1.SubscriptionSummary `json:"summary,omitempty"`
+
+	// For hub, the progress of the rolling update to the rollingupdate-target subscription
+	RollingUpdate *appv1alpha1.RollingUpdateStatus `json:"rollingUpdate,omitempty"`
+
+	// For hub, the progress of the canary stage of the latest change
+	Canary *appv1alpha1.CanaryStatus `json:"canary,omitempty"`
+
+	// For hub, the approval of channel generations
+	Approval *appv1alpha1.ApprovalStatus `json:"approval,omitempty"`
+
+	// For hub, the revision propagated to clusters and the revisions kept for rollback, newest first
+	CurrentRevision int64                              `json:"currentRevision,omitempty"`
+	Revisions       []appv1alpha1.SubscriptionRevision `json:"revisions,omitempty"`
+	// For hub, the rollback applied by the rollback-revision annotation or spec.rollbackRevision
+	Rollback *appv1alpha1.RollbackStatus `json:"rollback,omitempty"`
+
+	// For hub, the clusters and packages resolved by the dry-run annotation
+	Preview *appv1alpha1.SubscriptionPreview `json:"preview,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Subscription is the Schema for the subscriptions API, converted from and to the v1alpha1 storage version
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.phase",description="subscription status"
+// +kubebuilder:printcolumn:name="Window",type="string",JSONPath=".status.timeWindow.state",description="time window state",priority=1
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+// +kubebuilder:resource:scope=Namespaced
+type Subscription struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SubscriptionSpec   `json:"spec,omitempty"`
+	Status SubscriptionStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// SubscriptionList contains a list of Subscription
+type SubscriptionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Subscription `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Subscription{}, &SubscriptionList{})
+}
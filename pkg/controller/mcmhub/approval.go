@@ -0,0 +1,167 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+// approvalGate holds a new channel generation until the approved-channel-generation annotation names it.
+// While the change is pending, the subscription deployable keeps the template and overrides propagated before,
+// and the package version changes of the new generation are recorded in sub.Status.Approval.
+// The template carries the approved package versions, the subscribers on the clusters hold off while the channel
+// moved past the approved generation or its packages differ from them, see utils.IsWaitingForApproval
+func (r *ReconcileSubscription) approvalGate(sub *appv1alpha1.Subscription, dpl *dplv1alpha1.Deployable) error {
+	found := &dplv1alpha1.Deployable{}
+
+	err := r.Get(context.TODO(), types.NamespacedName{Name: dpl.Name, Namespace: dpl.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	gen := getTemplateChannelGeneration(dpl)
+	packages := r.getChannelPackageVersions(sub)
+
+	ast := sub.Status.Approval
+	if ast == nil {
+		ast = &appv1alpha1.ApprovalStatus{}
+		sub.Status.Approval = ast
+	}
+
+	prevGen := ""
+	if err == nil {
+		prevGen = getTemplateChannelGeneration(found)
+	}
+
+	approved := strings.TrimSpace(sub.GetAnnotations()[appv1alpha1.AnnotationApprovedChannelGeneration])
+
+	// first deployment, same generation as propagated, or approved
+	if prevGen == "" || gen == prevGen || gen == approved {
+		if gen != ast.ApprovedChannelGeneration {
+			klog.Info("Channel generation ", gen, " of subscription ", sub.Namespace, "/", sub.Name, " is approved")
+		}
+
+		ast.ApprovedChannelGeneration = gen
+		ast.ApprovedPackages = packages
+		ast.Pending = nil
+
+		return setTemplateApprovedPackages(dpl, packages)
+	}
+
+	if ast.Pending == nil || ast.Pending.ChannelGeneration != gen {
+		ast.Pending = &appv1alpha1.PendingChange{
+			ChannelGeneration: gen,
+			Packages:          diffPackageVersions(ast.ApprovedPackages, packages),
+			DetectedTime:      metav1.Now(),
+		}
+
+		msg := "Channel generation " + gen + " is waiting for approval, annotate the subscription with " +
+			appv1alpha1.AnnotationApprovedChannelGeneration + "=" + gen + " to propagate it"
+		klog.Info(msg, " subscription: ", sub.Namespace, "/", sub.Name)
+		r.eventRecorder.RecordEvent(sub, "ApprovalRequired", msg, nil)
+	}
+
+	// keep the approved template propagated, including the overrides rendered for it
+	dpl.Spec.Template = found.Spec.Template.DeepCopy()
+	dpl.Spec.Overrides = nil
+
+	for _, ov := range found.Spec.Overrides {
+		dpl.Spec.Overrides = append(dpl.Spec.Overrides, *ov.DeepCopy())
+	}
+
+	return nil
+}
+
+// getChannelPackageVersions returns the versions of the packages subscribed in the channel, key is package name
+func (r *ReconcileSubscription) getChannelPackageVersions(sub *appv1alpha1.Subscription) map[string]string {
+	packages := make(map[string]string)
+
+	for _, dpl := range r.getSubscriptionDeployables(sub) {
+		packages[dpl.Name] = dpl.GetAnnotations()[dplv1alpha1.AnnotationDeployableVersion]
+	}
+
+	return packages
+}
+
+// diffPackageVersions returns the packages added, removed or with a different version, sorted by name
+func diffPackageVersions(from, to map[string]string) []appv1alpha1.PackageVersionChange {
+	var changes []appv1alpha1.PackageVersionChange
+
+	for name, v := range to {
+		if orgv, ok := from[name]; !ok || orgv != v {
+			changes = append(changes, appv1alpha1.PackageVersionChange{Name: name, From: orgv, To: v})
+		}
+	}
+
+	for name, v := range from {
+		if _, ok := to[name]; !ok {
+			changes = append(changes, appv1alpha1.PackageVersionChange{Name: name, From: v})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+
+	return changes
+}
+
+// setTemplateApprovedPackages records the approved package versions in the subscription template of the deployable
+func setTemplateApprovedPackages(dpl *dplv1alpha1.Deployable, packages map[string]string) error {
+	if packages == nil {
+		packages = make(map[string]string)
+	}
+
+	anno, err := json.Marshal(packages)
+	if err != nil {
+		return err
+	}
+
+	return setTemplateAnnotation(dpl, appv1alpha1.AnnotationApprovedPackages, string(anno))
+}
+
+func setTemplateAnnotation(dpl *dplv1alpha1.Deployable, key, value string) error {
+	tpl := &unstructured.Unstructured{}
+
+	err := json.Unmarshal(dpl.Spec.Template.Raw, tpl)
+	if err != nil {
+		klog.Info("Error in unmarshall, err:", err, " |template: ", string(dpl.Spec.Template.Raw))
+		return err
+	}
+
+	tplanno := tpl.GetAnnotations()
+	if tplanno == nil {
+		tplanno = make(map[string]string)
+	}
+
+	tplanno[key] = value
+	tpl.SetAnnotations(tplanno)
+
+	dpl.Spec.Template.Raw, err = json.Marshal(tpl)
+
+	return err
+}
@@ -0,0 +1,151 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	subutil "github.com/IBM/multicloud-operators-subscription/pkg/utils"
+)
+
+func TestApprovalPackageDiff(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	from := map[string]string{"nginx": "1.0.0", "mongodb": "3.6.0", "redis": "5.0.0"}
+	to := map[string]string{"nginx": "1.1.0", "mongodb": "3.6.0", "mysql": "8.0.0"}
+
+	g.Expect(diffPackageVersions(from, to)).To(gomega.Equal([]appv1alpha1.PackageVersionChange{
+		{Name: "mysql", To: "8.0.0"},
+		{Name: "nginx", From: "1.0.0", To: "1.1.0"},
+		{Name: "redis", From: "5.0.0"},
+	}))
+
+	g.Expect(diffPackageVersions(from, from)).To(gomega.BeEmpty())
+}
+
+func TestApprovalTemplatePackages(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	dpl := &dplv1alpha1.Deployable{}
+	dpl.Spec.Template = &runtime.RawExtension{
+		Raw: []byte(`{"kind":"Subscription","metadata":{"annotations":{"app.ibm.com/channel-generation":"4"}}}`),
+	}
+
+	g.Expect(setTemplateApprovedPackages(dpl, map[string]string{"nginx": "1.0.0"})).To(gomega.Succeed())
+	g.Expect(getTemplateChannelGeneration(dpl)).To(gomega.Equal("4"))
+
+	tpl := &appv1alpha1.Subscription{}
+	g.Expect(json.Unmarshal(dpl.Spec.Template.Raw, tpl)).To(gomega.Succeed())
+
+	approved, required := subutil.GetApprovedPackages(tpl)
+	g.Expect(required).To(gomega.BeTrue())
+	g.Expect(approved).To(gomega.Equal(map[string]string{"nginx": "1.0.0"}))
+}
+
+func TestApprovalReconcile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cl, rec := newTestReconciler(g)
+
+	achnkey := types.NamespacedName{Name: "approval-chn", Namespace: "approval-chn-namespace"}
+	asubkey := types.NamespacedName{Name: "approval-sub", Namespace: "approval-sub-namespace"}
+	dplkey := types.NamespacedName{Name: asubkey.Name + "-deployable", Namespace: asubkey.Namespace}
+
+	chn := &chnv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{Name: achnkey.Name, Namespace: achnkey.Namespace},
+		Spec:       chnv1alpha1.ChannelSpec{Type: chnv1alpha1.ChannelTypeNamespace},
+	}
+	g.Expect(cl.Create(context.TODO(), chn)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), chn)
+
+	instance := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: asubkey.Name, Namespace: asubkey.Namespace},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel:          achnkey.String(),
+			Placement:        placementOfClusters([]string{"c1"}),
+			ApprovalRequired: true,
+		},
+	}
+	g.Expect(cl.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), instance)
+	defer cl.Delete(context.TODO(), &dplv1alpha1.Deployable{ObjectMeta: metav1.ObjectMeta{Name: dplkey.Name, Namespace: dplkey.Namespace}})
+
+	// the first deployment needs no approval
+	sub := reconcileTestSubscription(g, cl, rec, asubkey)
+	g.Expect(sub.Status.Approval).NotTo(gomega.BeNil())
+	g.Expect(sub.Status.Approval.Pending).To(gomega.BeNil())
+
+	orggen := sub.Status.Approval.ApprovedChannelGeneration
+	g.Expect(orggen).NotTo(gomega.BeEmpty())
+
+	dpl := &dplv1alpha1.Deployable{}
+	g.Expect(cl.Get(context.TODO(), dplkey, dpl)).NotTo(gomega.HaveOccurred())
+
+	orgtpl := append([]byte(nil), dpl.Spec.Template.Raw...)
+
+	// a new channel generation is held, with the spec changed along with it
+	g.Expect(cl.Get(context.TODO(), achnkey, chn)).NotTo(gomega.HaveOccurred())
+	chn.Spec.PathName = achnkey.Namespace
+	g.Expect(cl.Update(context.TODO(), chn)).NotTo(gomega.HaveOccurred())
+
+	updateTestSubscription(g, cl, asubkey, func(sub *appv1alpha1.Subscription) {
+		sub.Spec.Package = "nginx"
+	})
+
+	newgen, err := rec.GetChannelGeneration(sub)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(newgen).NotTo(gomega.Equal(orggen))
+
+	sub = reconcileTestSubscription(g, cl, rec, asubkey)
+	g.Expect(sub.Status.Approval.Pending).NotTo(gomega.BeNil())
+	g.Expect(sub.Status.Approval.Pending.ChannelGeneration).To(gomega.Equal(newgen))
+	g.Expect(sub.Status.Approval.ApprovedChannelGeneration).To(gomega.Equal(orggen))
+
+	// the propagated template stays the approved one
+	g.Expect(cl.Get(context.TODO(), dplkey, dpl)).NotTo(gomega.HaveOccurred())
+	g.Expect(dpl.Spec.Template.Raw).To(gomega.Equal(orgtpl))
+	g.Expect(getTemplateChannelGeneration(dpl)).To(gomega.Equal(orggen))
+
+	// approving the generation propagates it
+	updateTestSubscription(g, cl, asubkey, func(sub *appv1alpha1.Subscription) {
+		sub.SetAnnotations(map[string]string{appv1alpha1.AnnotationApprovedChannelGeneration: newgen})
+	})
+
+	sub = reconcileTestSubscription(g, cl, rec, asubkey)
+	g.Expect(sub.Status.Approval.Pending).To(gomega.BeNil())
+	g.Expect(sub.Status.Approval.ApprovedChannelGeneration).To(gomega.Equal(newgen))
+
+	g.Expect(cl.Get(context.TODO(), dplkey, dpl)).NotTo(gomega.HaveOccurred())
+	g.Expect(getTemplateChannelGeneration(dpl)).To(gomega.Equal(newgen))
+
+	tpl := &appv1alpha1.Subscription{}
+	g.Expect(json.Unmarshal(dpl.Spec.Template.Raw, tpl)).To(gomega.Succeed())
+	g.Expect(tpl.Spec.Package).To(gomega.Equal("nginx"))
+
+	_, required := subutil.GetApprovedPackages(tpl)
+	g.Expect(required).To(gomega.BeTrue())
+}
@@ -0,0 +1,442 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	plrv1alpha1 "github.com/IBM/multicloud-operators-placementrule/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+// canaryRequeueInterval is how often the hub checks the canary clusters while baking
+const canaryRequeueInterval = 30 * time.Second
+
+// canary deploys a changed subscription deployable template to the canary clusters first, the other clusters keep
+// the previous template. After the bake time the change is promoted to all clusters, or it is aborted as soon as more
+// canary clusters than the failure threshold fail, reverting the canary clusters to the previous template.
+// It returns the subscription deployable to apply, the progress is kept in sub.Status.Canary. The canary deployable
+// is left to deleteCanaryDeployable, once the subscription deployable carries the canary clusters again.
+func (r *ReconcileSubscription) canary(sub *appv1alpha1.Subscription, dpl *dplv1alpha1.Deployable) (*dplv1alpha1.Deployable, error) {
+	canaryKey := types.NamespacedName{Name: sub.Name + "-canary-deployable", Namespace: sub.Namespace}
+	dplkey := types.NamespacedName{Name: dpl.Name, Namespace: dpl.Namespace}
+
+	found := &dplv1alpha1.Deployable{}
+
+	err := r.Get(context.TODO(), dplkey, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			// first deployment, there is no previous template to keep
+			return dpl, nil
+		}
+
+		return nil, err
+	}
+
+	hash, err := getTemplateHash(dpl)
+	if err != nil {
+		return nil, err
+	}
+
+	stableHash, err := getTemplateHash(found)
+	if err != nil {
+		return nil, err
+	}
+
+	cst := sub.Status.Canary
+
+	if hash == stableHash {
+		if cst != nil && cst.Phase == appv1alpha1.CanaryBaking {
+			// the change is gone before the canary stage is over
+			sub.Status.Canary = nil
+		}
+
+		return dpl, nil
+	}
+
+	if cst != nil && cst.TemplateHash == hash {
+		switch cst.Phase {
+		case appv1alpha1.CanaryPromoted:
+			return dpl, nil
+		case appv1alpha1.CanaryAborted:
+			// keep the previous template until there is a new change
+			return revertToStableDeployable(sub, dpl, found), nil
+		}
+	}
+
+	if cst == nil || cst.TemplateHash != hash {
+		clusters, err := r.getPlacementClusters(sub)
+		if err != nil {
+			return nil, err
+		}
+
+		canaryClusters, err := r.getCanaryClusters(sub, clusters)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(canaryClusters) == 0 || len(canaryClusters) == len(clusters) {
+			klog.Info("No canary stage for subscription ", sub.Namespace, "/", sub.Name, ", canary clusters ", canaryClusters,
+				" out of clusters ", clusters)
+
+			sub.Status.Canary = nil
+
+			return dpl, nil
+		}
+
+		klog.Info("Starting canary stage of subscription ", sub.Namespace, "/", sub.Name, " on clusters ", canaryClusters)
+
+		now := metav1.Now()
+		cst = &appv1alpha1.CanaryStatus{
+			Phase:              appv1alpha1.CanaryBaking,
+			ChannelGeneration:  getTemplateChannelGeneration(dpl),
+			TemplateHash:       hash,
+			Clusters:           canaryClusters,
+			StartTime:          now,
+			LastTransitionTime: now,
+		}
+		sub.Status.Canary = cst
+	}
+
+	canaryDpl := dpl.DeepCopy()
+	canaryDpl.Name = canaryKey.Name
+	canaryDpl.Spec.Placement = placementOfClusters(cst.Clusters)
+
+	err = r.updateCanaryDeployable(sub, canaryDpl)
+	if err != nil {
+		return nil, err
+	}
+
+	baked := time.Since(cst.StartTime.Time) >= getCanaryBakeTime(sub)
+
+	cst.FailedClusters, err = r.getFailedCanaryClusters(canaryKey, cst.Clusters, baked)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cst.FailedClusters) > sub.Spec.Canary.FailureThreshold {
+		msg := "Canary stage of channel generation " + cst.ChannelGeneration + " aborted, failed clusters: " +
+			strconv.Itoa(len(cst.FailedClusters)) + ", failure threshold: " + strconv.Itoa(sub.Spec.Canary.FailureThreshold)
+		klog.Info(msg, " subscription: ", sub.Namespace, "/", sub.Name)
+		r.eventRecorder.RecordEvent(sub, "CanaryAborted", msg, nil)
+
+		setCanaryPhase(cst, appv1alpha1.CanaryAborted)
+
+		return revertToStableDeployable(sub, dpl, found), nil
+	}
+
+	if baked {
+		msg := "Canary stage of channel generation " + cst.ChannelGeneration + " passed, promoting to all clusters"
+		klog.Info(msg, " subscription: ", sub.Namespace, "/", sub.Name)
+		r.eventRecorder.RecordEvent(sub, "CanaryPromoted", msg, nil)
+
+		setCanaryPhase(cst, appv1alpha1.CanaryPromoted)
+
+		return dpl, nil
+	}
+
+	// the other clusters keep the previous template while baking
+	clusters, err := r.getPlacementClusters(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	stable := revertToStableDeployable(sub, dpl, found)
+	stable.Spec.Placement = placementOfClusters(subtractClusters(clusters, cst.Clusters))
+
+	return stable, nil
+}
+
+// deleteCanaryDeployable deletes the canary deployable when the canary stage is over. It is called after the
+// subscription deployable is applied, so the canary clusters are reassigned to it before the canary deployable
+// and the subscription it propagated are removed
+func (r *ReconcileSubscription) deleteCanaryDeployable(sub *appv1alpha1.Subscription) error {
+	if sub.Status.Canary != nil && sub.Status.Canary.Phase == appv1alpha1.CanaryBaking {
+		return nil
+	}
+
+	return r.deleteOwnedDeployable(sub, types.NamespacedName{Name: sub.Name + "-canary-deployable", Namespace: sub.Namespace})
+}
+
+// getCanaryDeployable returns the canary deployable of a canary stage in progress
+func (r *ReconcileSubscription) getCanaryDeployable(sub *appv1alpha1.Subscription) *dplv1alpha1.Deployable {
+	if sub.Status.Canary == nil || sub.Status.Canary.Phase != appv1alpha1.CanaryBaking {
+		return nil
+	}
+
+	canaryDpl := &dplv1alpha1.Deployable{}
+
+	err := r.Get(context.TODO(), types.NamespacedName{Name: sub.Name + "-canary-deployable", Namespace: sub.Namespace}, canaryDpl)
+	if err != nil {
+		klog.V(5).Info("Failed to get canary deployable of subscription ", sub.Namespace, "/", sub.Name, " error: ", err)
+		return nil
+	}
+
+	return canaryDpl
+}
+
+// getCanaryClusters returns the clusters, out of the given ones, matching the canary cluster names or labels
+func (r *ReconcileSubscription) getCanaryClusters(sub *appv1alpha1.Subscription, clusters []string) ([]string, error) {
+	matched := make(map[string]bool)
+
+	for _, cl := range sub.Spec.Canary.Clusters {
+		matched[cl] = true
+	}
+
+	if sub.Spec.Canary.ClusterSelector != nil {
+		selected, err := r.getManagedClusters(sub.Spec.Canary.ClusterSelector)
+		if err != nil {
+			return nil, err
+		}
+
+		for cl := range selected {
+			matched[cl] = true
+		}
+	}
+
+	var canaryClusters []string
+
+	for _, cl := range clusters {
+		if matched[cl] {
+			canaryClusters = append(canaryClusters, cl)
+		}
+	}
+
+	return canaryClusters, nil
+}
+
+// getFailedCanaryClusters returns the canary clusters failing the change. Once baked, a cluster not reporting healthy is failed
+func (r *ReconcileSubscription) getFailedCanaryClusters(dplkey types.NamespacedName, clusters []string, baked bool) ([]string, error) {
+	found := &dplv1alpha1.Deployable{}
+
+	err := r.Get(context.TODO(), dplkey, found)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var failed []string
+
+	for _, cl := range clusters {
+		st := found.Status.PropagatedStatus[cl]
+
+		if isClusterSubscriptionFailed(st) || (baked && !isClusterSubscriptionHealthy(st)) {
+			failed = append(failed, cl)
+		}
+	}
+
+	return failed, nil
+}
+
+func isClusterSubscriptionFailed(st *dplv1alpha1.ResourceUnitStatus) bool {
+	if st == nil {
+		return false
+	}
+
+	if st.Phase == dplv1alpha1.DeployableFailed {
+		return true
+	}
+
+	if st.ResourceStatus == nil {
+		return false
+	}
+
+	mcsubstatus := &appv1alpha1.SubscriptionStatus{}
+
+	err := json.Unmarshal(st.ResourceStatus.Raw, mcsubstatus)
+	if err != nil {
+		klog.Info("Failed to unmashall status from cluster, error: ", err)
+		return false
+	}
+
+	if mcsubstatus.Phase == appv1alpha1.SubscriptionFailed {
+		return true
+	}
+
+	for _, clst := range mcsubstatus.Statuses {
+		if clst == nil {
+			continue
+		}
+
+		for _, pkgst := range clst.SubscriptionPackageStatus {
+			if pkgst != nil && pkgst.Phase == appv1alpha1.SubscriptionFailed {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// revertToStableDeployable makes the subscription deployable carry the previous template
+func revertToStableDeployable(sub *appv1alpha1.Subscription, dpl, found *dplv1alpha1.Deployable) *dplv1alpha1.Deployable {
+	stable := dpl.DeepCopy()
+	stable.Spec.Template = found.Spec.Template.DeepCopy()
+	stable.Spec.Overrides = nil
+
+	for _, ov := range found.Spec.Overrides {
+		stable.Spec.Overrides = append(stable.Spec.Overrides, *ov.DeepCopy())
+	}
+
+	stable.Spec.Placement = sub.Spec.Placement.DeepCopy()
+
+	return stable
+}
+
+// getTemplateHash hashes the deployable template regardless of how it is formatted
+func getTemplateHash(dpl *dplv1alpha1.Deployable) (string, error) {
+	if dpl.Spec.Template == nil {
+		return "", nil
+	}
+
+	tpl := make(map[string]interface{})
+
+	err := json.Unmarshal(dpl.Spec.Template.Raw, &tpl)
+	if err != nil {
+		klog.Info("Error in unmarshall, err:", err, " |template: ", string(dpl.Spec.Template.Raw))
+		return "", err
+	}
+
+	raw, err := json.Marshal(tpl)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(raw)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func getTemplateChannelGeneration(dpl *dplv1alpha1.Deployable) string {
+	tpl := &unstructured.Unstructured{}
+
+	if dpl.Spec.Template == nil || json.Unmarshal(dpl.Spec.Template.Raw, tpl) != nil {
+		return ""
+	}
+
+	return tpl.GetAnnotations()[appv1alpha1.AnnotationChannelGeneration]
+}
+
+func getCanaryBakeTime(sub *appv1alpha1.Subscription) time.Duration {
+	if sub.Spec.Canary.BakeTime != nil && sub.Spec.Canary.BakeTime.Duration > 0 {
+		return sub.Spec.Canary.BakeTime.Duration
+	}
+
+	return appv1alpha1.DefaultCanaryBakeTime
+}
+
+func setCanaryPhase(cst *appv1alpha1.CanaryStatus, phase appv1alpha1.CanaryPhase) {
+	if cst.Phase != phase {
+		cst.Phase = phase
+		cst.LastTransitionTime = metav1.Now()
+	}
+}
+
+// updateCanaryDeployable creates or updates the canary deployable propagating the changed template to the canary clusters
+func (r *ReconcileSubscription) updateCanaryDeployable(sub *appv1alpha1.Subscription, canaryDpl *dplv1alpha1.Deployable) error {
+	canaryKey := types.NamespacedName{
+		Namespace: canaryDpl.Namespace,
+		Name:      canaryDpl.Name,
+	}
+
+	found := &dplv1alpha1.Deployable{}
+	err := r.Get(context.TODO(), canaryKey, found)
+
+	if err != nil && errors.IsNotFound(err) {
+		klog.Info("Creating canary Deployable - ", "namespace: ", canaryDpl.Namespace, ", name: ", canaryDpl.Name)
+		err = r.Create(context.TODO(), canaryDpl)
+
+		//record events
+		addtionalMsg := "canary Depolyable " + canaryKey.String() + " created in the subscription namespace"
+		r.eventRecorder.RecordEvent(sub, "Deploy", addtionalMsg, err)
+
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	orgTpl := &unstructured.Unstructured{}
+	err = json.Unmarshal(canaryDpl.Spec.Template.Raw, orgTpl)
+
+	if err != nil {
+		klog.V(5).Info("Error in unmarshall canary deployable template, err:", err, " |template: ", string(canaryDpl.Spec.Template.Raw))
+		return err
+	}
+
+	fndTpl := &unstructured.Unstructured{}
+	err = json.Unmarshal(found.Spec.Template.Raw, fndTpl)
+
+	if err != nil {
+		klog.V(5).Info("Error in unmarshall found canary deployable template, err:", err, " |template: ", string(found.Spec.Template.Raw))
+		return err
+	}
+
+	if !reflect.DeepEqual(orgTpl, fndTpl) || !reflect.DeepEqual(canaryDpl.Spec.Overrides, found.Spec.Overrides) ||
+		!reflect.DeepEqual(canaryDpl.Spec.Placement, found.Spec.Placement) {
+		klog.V(5).Infof("Updating canary Deployable. orig: %#v, found: %#v", canaryDpl, found)
+
+		canaryDpl.Spec.DeepCopyInto(&found.Spec)
+
+		foundanno := found.GetAnnotations()
+		if foundanno == nil {
+			foundanno = make(map[string]string)
+		}
+
+		foundanno[dplv1alpha1.AnnotationIsGenerated] = "true"
+		foundanno[dplv1alpha1.AnnotationLocal] = "false"
+		found.SetAnnotations(foundanno)
+
+		klog.V(5).Info("Updating Deployable - ", "namespace: ", canaryDpl.Namespace, " ,name: ", canaryDpl.Name)
+
+		err = r.Update(context.TODO(), found)
+
+		//record events
+		addtionalMsg := "canary Depolyable " + canaryKey.String() + " updated in the subscription namespace"
+		r.eventRecorder.RecordEvent(sub, "Deploy", addtionalMsg, err)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// placementOfClusters returns a placement of the named clusters
+func placementOfClusters(clusters []string) *plrv1alpha1.Placement {
+	pl := &plrv1alpha1.Placement{}
+
+	for _, cl := range clusters {
+		pl.Clusters = append(pl.Clusters, plrv1alpha1.GenericClusterReference{Name: cl})
+	}
+
+	return pl
+}
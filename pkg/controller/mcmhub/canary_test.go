@@ -0,0 +1,193 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func TestCanaryTemplateHash(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	dpl := &dplv1alpha1.Deployable{}
+	dpl.Spec.Template = &runtime.RawExtension{
+		Raw: []byte(`{"kind":"Subscription","metadata":{"annotations":{"app.ibm.com/channel-generation":"2"}}}`),
+	}
+
+	formatted := dpl.DeepCopy()
+	formatted.Spec.Template.Raw = []byte(`{ "metadata": {"annotations": {"app.ibm.com/channel-generation": "2"}}, "kind": "Subscription" }`)
+
+	hash, err := getTemplateHash(dpl)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	fhash, err := getTemplateHash(formatted)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(fhash).To(gomega.Equal(hash))
+
+	g.Expect(getTemplateChannelGeneration(dpl)).To(gomega.Equal("2"))
+
+	changed := dpl.DeepCopy()
+	changed.Spec.Template.Raw = []byte(`{"kind":"Subscription","metadata":{"annotations":{"app.ibm.com/channel-generation":"3"}}}`)
+
+	chash, err := getTemplateHash(changed)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(chash).NotTo(gomega.Equal(hash))
+}
+
+func TestCanaryClusterFailure(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	g.Expect(isClusterSubscriptionFailed(nil)).To(gomega.BeFalse())
+
+	st := &dplv1alpha1.ResourceUnitStatus{}
+	st.Phase = dplv1alpha1.DeployableFailed
+	g.Expect(isClusterSubscriptionFailed(st)).To(gomega.BeTrue())
+
+	st.Phase = dplv1alpha1.DeployableDeployed
+	st.ResourceStatus = &runtime.RawExtension{Raw: []byte(`{"phase":"Subscribed","statuses":{"/":{"packages":{"pkg":{"phase":"Failed"}}}}}`)}
+	g.Expect(isClusterSubscriptionFailed(st)).To(gomega.BeTrue())
+
+	st.ResourceStatus = &runtime.RawExtension{Raw: []byte(`{"phase":"Subscribed","statuses":{"/":{"packages":{"pkg":{"phase":"Subscribed"}}}}}`)}
+	g.Expect(isClusterSubscriptionFailed(st)).To(gomega.BeFalse())
+
+	sub := &appv1alpha1.Subscription{}
+	sub.Spec.Canary = &appv1alpha1.Canary{}
+	g.Expect(getCanaryBakeTime(sub)).To(gomega.Equal(appv1alpha1.DefaultCanaryBakeTime))
+
+	sub.Spec.Canary.BakeTime = &metav1.Duration{Duration: time.Hour}
+	g.Expect(getCanaryBakeTime(sub)).To(gomega.Equal(time.Hour))
+}
+
+func TestCanaryReconcile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cl, rec := newTestReconciler(g)
+
+	cchnkey := types.NamespacedName{Name: "canary-chn", Namespace: "canary-chn-namespace"}
+	csubkey := types.NamespacedName{Name: "canary-sub", Namespace: "canary-sub-namespace"}
+	dplkey := types.NamespacedName{Name: csubkey.Name + "-deployable", Namespace: csubkey.Namespace}
+	canaryKey := types.NamespacedName{Name: csubkey.Name + "-canary-deployable", Namespace: csubkey.Namespace}
+
+	chn := &chnv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{Name: cchnkey.Name, Namespace: cchnkey.Namespace},
+		Spec:       chnv1alpha1.ChannelSpec{Type: chnv1alpha1.ChannelTypeNamespace},
+	}
+	g.Expect(cl.Create(context.TODO(), chn)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), chn)
+
+	instance := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: csubkey.Name, Namespace: csubkey.Namespace},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel:   cchnkey.String(),
+			Package:   "v1",
+			Placement: placementOfClusters([]string{"c1", "c2", "c3"}),
+			Canary:    &appv1alpha1.Canary{Clusters: []string{"c1"}},
+		},
+	}
+	g.Expect(cl.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), instance)
+	defer cl.Delete(context.TODO(), &dplv1alpha1.Deployable{ObjectMeta: metav1.ObjectMeta{Name: dplkey.Name, Namespace: dplkey.Namespace}})
+	defer cl.Delete(context.TODO(), &dplv1alpha1.Deployable{ObjectMeta: metav1.ObjectMeta{Name: canaryKey.Name, Namespace: canaryKey.Namespace}})
+
+	getPlacement := func(key types.NamespacedName) []string {
+		dpl := &dplv1alpha1.Deployable{}
+		g.Expect(cl.Get(context.TODO(), key, dpl)).NotTo(gomega.HaveOccurred())
+
+		var clusters []string
+		for _, cluster := range dpl.Spec.Placement.Clusters {
+			clusters = append(clusters, cluster.Name)
+		}
+
+		return clusters
+	}
+
+	expectCanaryDeleted := func() {
+		err := cl.Get(context.TODO(), canaryKey, &dplv1alpha1.Deployable{})
+		g.Expect(errors.IsNotFound(err)).To(gomega.BeTrue())
+	}
+
+	// the first deployment has no previous template to keep
+	sub := reconcileTestSubscription(g, cl, rec, csubkey)
+	g.Expect(sub.Status.Canary).To(gomega.BeNil())
+
+	// a change goes to the canary clusters first, the other clusters keep the previous template
+	updateTestSubscription(g, cl, csubkey, func(sub *appv1alpha1.Subscription) { sub.Spec.Package = "v2" })
+
+	sub = reconcileTestSubscription(g, cl, rec, csubkey)
+	g.Expect(sub.Status.Canary).NotTo(gomega.BeNil())
+	g.Expect(sub.Status.Canary.Phase).To(gomega.Equal(appv1alpha1.CanaryBaking))
+	g.Expect(sub.Status.Canary.Clusters).To(gomega.Equal([]string{"c1"}))
+
+	tpl, _ := getTestDeployableTemplate(g, cl, canaryKey)
+	g.Expect(tpl.Spec.Package).To(gomega.Equal("v2"))
+	g.Expect(getPlacement(canaryKey)).To(gomega.Equal([]string{"c1"}))
+
+	tpl, _ = getTestDeployableTemplate(g, cl, dplkey)
+	g.Expect(tpl.Spec.Package).To(gomega.Equal("v1"))
+	g.Expect(getPlacement(dplkey)).To(gomega.Equal([]string{"c2", "c3"}))
+
+	// a failed canary cluster aborts the change, the canary clusters get the previous template back
+	setTestClusterStatus(g, cl, canaryKey, appv1alpha1.SubscriptionFailed, time.Now(), "c1")
+
+	sub = reconcileTestSubscription(g, cl, rec, csubkey)
+	g.Expect(sub.Status.Canary.Phase).To(gomega.Equal(appv1alpha1.CanaryAborted))
+	g.Expect(sub.Status.Canary.FailedClusters).To(gomega.Equal([]string{"c1"}))
+
+	tpl, _ = getTestDeployableTemplate(g, cl, dplkey)
+	g.Expect(tpl.Spec.Package).To(gomega.Equal("v1"))
+	g.Expect(getPlacement(dplkey)).To(gomega.Equal([]string{"c1", "c2", "c3"}))
+	expectCanaryDeleted()
+
+	// the aborted change is not retried
+	sub = reconcileTestSubscription(g, cl, rec, csubkey)
+	g.Expect(sub.Status.Canary.Phase).To(gomega.Equal(appv1alpha1.CanaryAborted))
+
+	tpl, _ = getTestDeployableTemplate(g, cl, dplkey)
+	g.Expect(tpl.Spec.Package).To(gomega.Equal("v1"))
+
+	// a new change baked on healthy canary clusters is promoted to all clusters
+	updateTestSubscription(g, cl, csubkey, func(sub *appv1alpha1.Subscription) { sub.Spec.Package = "v3" })
+
+	sub = reconcileTestSubscription(g, cl, rec, csubkey)
+	g.Expect(sub.Status.Canary.Phase).To(gomega.Equal(appv1alpha1.CanaryBaking))
+
+	setTestClusterStatus(g, cl, canaryKey, appv1alpha1.SubscriptionSubscribed, time.Now(), "c1")
+
+	sub.Status.Canary.StartTime = metav1.NewTime(time.Now().Add(-time.Hour))
+	g.Expect(cl.Status().Update(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+
+	sub = reconcileTestSubscription(g, cl, rec, csubkey)
+	g.Expect(sub.Status.Canary.Phase).To(gomega.Equal(appv1alpha1.CanaryPromoted))
+
+	tpl, _ = getTestDeployableTemplate(g, cl, dplkey)
+	g.Expect(tpl.Spec.Package).To(gomega.Equal("v3"))
+	g.Expect(getPlacement(dplkey)).To(gomega.Equal([]string{"c1", "c2", "c3"}))
+	expectCanaryDeleted()
+}
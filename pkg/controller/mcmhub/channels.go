@@ -0,0 +1,63 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"k8s.io/klog"
+
+	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	subutil "github.com/IBM/multicloud-operators-subscription/pkg/utils"
+)
+
+// getChannelNamespaces returns the namespaces of the channels subscribed, in increasing precedence
+func (r *ReconcileSubscription) getChannelNamespaces(sub *appv1alpha1.Subscription) []string {
+	if !subutil.IsMultiChannelSubscription(sub) {
+		chNameSpace, _ := r.GetChannelNamespaceType(sub)
+		return []string{chNameSpace}
+	}
+
+	var namespaces []string
+
+	for _, chn := range subutil.GetSubscriptionChannels(sub) {
+		namespaces = append(namespaces, chn.Namespace)
+	}
+
+	return namespaces
+}
+
+// getChannelListGeneration joins the generations of the channels in the channel list, so a change to any of them
+// is propagated as a new channel generation
+func (r *ReconcileSubscription) getChannelListGeneration(sub *appv1alpha1.Subscription) (string, error) {
+	var gens []string
+
+	for _, chn := range subutil.GetSubscriptionChannels(sub) {
+		chobj := &chnv1alpha1.Channel{}
+
+		err := r.Get(context.TODO(), chn, chobj)
+		if err != nil {
+			klog.Info("Failed to get channel ", chn, " of subscription ", sub.Namespace, "/", sub.Name, " error: ", err)
+			return "", err
+		}
+
+		gens = append(gens, strconv.FormatInt(chobj.Generation, 10))
+	}
+
+	return strings.Join(gens, "-"), nil
+}
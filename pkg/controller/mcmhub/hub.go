@@ -18,9 +18,11 @@ import (
 	"context"
 	"encoding/json"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -56,27 +58,56 @@ func (r *ReconcileSubscription) doMCMHubReconcile(sub *appv1alpha1.Subscription)
 		return err
 	}
 
-	// if the subscription has the rollingupdate-target annotation, create a new deploayble as the target deployable of the subscription deployable
+	// a rollback re-propagates the template of a kept revision to all clusters, without approval or canary stage
+	rollback, err := r.rollbackToRevision(sub, dpl)
+	if err != nil {
+		return err
+	}
+
+	if sub.Spec.ApprovalRequired && !rollback {
+		// hold a new channel generation until it is approved
+		err = r.approvalGate(sub, dpl)
+		if err != nil {
+			return err
+		}
+	} else {
+		sub.Status.Approval = nil
+	}
+
+	// if the subscription has the rollingupdate-target annotation, prepare the deployable of the target subscription
 	targetDpl, err := r.createTargetDplForRollingUpdate(sub)
 
 	if err != nil {
 		return err
 	}
 
-	if targetDpl != nil {
-		dplAnno := dpl.GetAnnotations()
+	dplkey := types.NamespacedName{Name: dpl.Name, Namespace: dpl.Namespace}
 
-		if dplAnno == nil {
-			dplAnno = make(map[string]string)
+	if targetDpl != nil {
+		// move clusters of the subscription deployable to the target subscription in batches
+		dpl, err = r.rollingUpdate(sub, dpl, targetDpl)
+		if err != nil {
+			return err
 		}
+	} else if sub.Status.RollingUpdate != nil {
+		// rollingupdate-target annotation is removed
+		sub.Status.RollingUpdate = nil
+	}
 
-		dplAnno[appv1alpha1.AnnotationRollingUpdateTarget] = targetDpl.GetName()
+	// a canary deployable may exist, it is deleted once the subscription deployable is applied
+	hadCanary := sub.Status.Canary != nil
 
-		dpl.SetAnnotations(dplAnno)
+	if targetDpl == nil && sub.Status.RollingUpdate == nil && sub.Spec.Canary != nil && !rollback {
+		// deploy the change to the canary clusters before the rest of the placement
+		dpl, err = r.canary(sub, dpl)
+		if err != nil {
+			return err
+		}
+	} else {
+		sub.Status.Canary = nil
 	}
 
 	found := &dplv1alpha1.Deployable{}
-	dplkey := types.NamespacedName{Name: dpl.Name, Namespace: dpl.Namespace}
 	err = r.Get(context.TODO(), dplkey, found)
 
 	if err != nil && errors.IsNotFound(err) {
@@ -87,7 +118,17 @@ func (r *ReconcileSubscription) doMCMHubReconcile(sub *appv1alpha1.Subscription)
 		addtionalMsg := "Depolyable " + dplkey.String() + " created in the subscription namespace for deploying the subscription to managed clusters"
 		r.eventRecorder.RecordEvent(sub, "Deploy", addtionalMsg, err)
 
-		return err
+		if err != nil {
+			return err
+		}
+
+		if hadCanary {
+			if err = r.deleteCanaryDeployable(sub); err != nil {
+				return err
+			}
+		}
+
+		return r.recordRevision(sub, dpl)
 	} else if err != nil {
 		return err
 	}
@@ -108,9 +149,20 @@ func (r *ReconcileSubscription) doMCMHubReconcile(sub *appv1alpha1.Subscription)
 		return err
 	}
 
-	if !reflect.DeepEqual(org, fnd) {
+	tplChanged := !reflect.DeepEqual(org, fnd)
+
+	if tplChanged || !reflect.DeepEqual(dpl.Spec.Placement, found.Spec.Placement) ||
+		!reflect.DeepEqual(dpl.Spec.Overrides, found.Spec.Overrides) {
 		klog.V(5).Info("Updating Deployable spec:\n", string(dpl.Spec.Template.Raw), "\nfound:\n", string(found.Spec.Template.Raw))
 
+		// keep the template being replaced for rollback, the batches of a rolling update only change the overrides
+		if tplChanged {
+			err = r.recordRevision(sub, found)
+			if err != nil {
+				return err
+			}
+		}
+
 		dpl.Spec.DeepCopyInto(&found.Spec)
 		// may need to check owner ID and backoff it if is not owned by this subscription
 
@@ -134,7 +186,30 @@ func (r *ReconcileSubscription) doMCMHubReconcile(sub *appv1alpha1.Subscription)
 		if err != nil {
 			return err
 		}
+
+		if hadCanary {
+			if err = r.deleteCanaryDeployable(sub); err != nil {
+				return err
+			}
+		}
+
+		if tplChanged {
+			err = r.recordRevision(sub, dpl)
+		}
 	} else {
+		if hadCanary {
+			if err = r.deleteCanaryDeployable(sub); err != nil {
+				return err
+			}
+		}
+
+		if sub.Status.CurrentRevision == 0 {
+			err = r.recordRevision(sub, found)
+			if err != nil {
+				return err
+			}
+		}
+
 		err = r.updateSubscriptionStatus(sub, found)
 	}
 
@@ -170,6 +245,10 @@ func (r *ReconcileSubscription) GetChannelNamespaceType(s *appv1alpha1.Subscript
 
 // GetChannelGeneration get the channel generation
 func (r *ReconcileSubscription) GetChannelGeneration(s *appv1alpha1.Subscription) (string, error) {
+	if subutil.IsMultiChannelSubscription(s) {
+		return r.getChannelListGeneration(s)
+	}
+
 	chNameSpace := ""
 	chName := ""
 
@@ -278,24 +357,15 @@ func (r *ReconcileSubscription) stopDeploySubscription(sub *appv1alpha1.Subscrip
 		}
 	}
 
-	// delete target deployable if exists. This only happens when the subscription placement becomes empty
-	hubTargetDpl := &dplv1alpha1.Deployable{}
-	err = r.Get(context.TODO(), types.NamespacedName{Name: sub.Name + "-target-deployable", Namespace: sub.Namespace}, hubTargetDpl)
-
-	if err == nil {
-		// no longer hub, check owner-reference and delete if it is generated.
-		owners := hubTargetDpl.GetOwnerReferences()
-		for _, owner := range owners {
-			if owner.UID == sub.UID {
-				err = r.Delete(context.TODO(), hubTargetDpl)
-				if err != nil {
-					klog.Infof("Error in deleting sbuscription target deploayble: %#v, err: %v", hubTargetDpl, err)
-					return err
-				}
-			}
-		}
+	err = r.deleteOwnedDeployable(sub, types.NamespacedName{Name: sub.Name + "-canary-deployable", Namespace: sub.Namespace})
+	if err != nil {
+		return err
 	}
 
+	sub.Status.Canary = nil
+	sub.Status.Summary = nil
+	sub.Status.Conditions = nil
+
 	savest := sub.Status.DeepCopy()
 
 	if sub.Status.Statuses != nil {
@@ -353,6 +423,19 @@ func (r *ReconcileSubscription) prepareDeployableForSubscription(sub, rootSub *a
 		}
 	}
 
+	// set calendar version as annotation, so the clusters pick up the changes of the calendar
+	if tw := subep.Spec.TimeWindow; tw != nil && tw.Calendar != nil {
+		cal := &corev1.ConfigMap{}
+
+		err := r.Get(context.TODO(), types.NamespacedName{Name: tw.Calendar.Name, Namespace: sub.Namespace}, cal)
+		if err == nil {
+			subepanno[appv1alpha1.AnnotationCalendarGeneration] = cal.ResourceVersion
+		} else {
+			klog.Error("Failed to get calendar ", sub.Namespace, "/", tw.Calendar.Name, " of subscription ", sub.Name,
+				" with error: ", err)
+		}
+	}
+
 	subep.SetAnnotations(subepanno)
 	subep.SetGroupVersionKind(schema.GroupVersionKind{
 		Group:   appv1alpha1.SchemeGroupVersion.Group,
@@ -393,7 +476,7 @@ func (r *ReconcileSubscription) prepareDeployableForSubscription(sub, rootSub *a
 
 	// apply "/" override to template, and carry other overrides to deployable.
 	for _, ov := range sub.Spec.Overrides {
-		if ov.ClusterName == "/" {
+		if ov.ClusterName == "/" && !isTemplatedOverride(ov) {
 			tplobj := &unstructured.Unstructured{}
 			err = json.Unmarshal(dpl.Spec.Template.Raw, tplobj)
 
@@ -402,7 +485,7 @@ func (r *ReconcileSubscription) prepareDeployableForSubscription(sub, rootSub *a
 				return nil, err
 			}
 
-			tplobj, err = dplutils.OverrideTemplate(tplobj, ov.ClusterOverrides)
+			tplobj, err = subutil.OverrideTemplate(tplobj, ov.ClusterOverrides)
 			if err != nil {
 				klog.Info("Error in overriding obj ", tplobj, err)
 				return nil, err
@@ -420,6 +503,18 @@ func (r *ReconcileSubscription) prepareDeployableForSubscription(sub, rootSub *a
 		}
 	}
 
+	// templated overrides are rendered with the name, namespace and labels of each managed cluster
+	dpl.Spec.Overrides, err = r.renderTemplatedOverrides(sub, dpl.Spec.Overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	// the deployable takes path overrides only, patch overrides are applied here and carried as their result
+	dpl.Spec.Overrides, err = flattenPatchOverrides(dpl.Spec.Template.Raw, dpl.Spec.Overrides)
+	if err != nil {
+		return nil, err
+	}
+
 	return dpl, nil
 }
 
@@ -430,28 +525,94 @@ func (r *ReconcileSubscription) updateSubscriptionStatus(sub *appv1alpha1.Subscr
 	newsubstatus.Message = ""
 	newsubstatus.Reason = ""
 
-	if found.Status.Phase == dplv1alpha1.DeployableFailed {
+	// during canary, the clusters are split between the subscription deployable and the canary deployable
+	var dpls []*dplv1alpha1.Deployable
+
+	if found != nil {
+		dpls = append(dpls, found)
+	}
+
+	if canaryDpl := r.getCanaryDeployable(sub); canaryDpl != nil {
+		dpls = append(dpls, canaryDpl)
+	}
+
+	summary := &appv1alpha1.SubscriptionSummary{}
+	reported := make(map[string]bool)
+
+	if found != nil && found.Status.Phase == dplv1alpha1.DeployableFailed {
 		newsubstatus.Statuses = nil
 	} else {
 		newsubstatus.Statuses = make(map[string]*appv1alpha1.SubscriptionPerClusterStatus)
 
-		for k, v := range found.Status.PropagatedStatus {
-			clusterSubStatus := &appv1alpha1.SubscriptionPerClusterStatus{}
-			if v.Phase == dplv1alpha1.DeployableDeployed {
+		for _, d := range dpls {
+			for k, v := range d.Status.PropagatedStatus {
+				clusterSubStatus := &appv1alpha1.SubscriptionPerClusterStatus{}
 				mcsubstatus := &appv1alpha1.SubscriptionStatus{}
-				if v.ResourceStatus != nil {
-					err := json.Unmarshal(v.ResourceStatus.Raw, mcsubstatus)
-					if err != nil {
-						klog.Info("Failed to unmashall status from clusters")
-						return err
+				if v.Phase == dplv1alpha1.DeployableDeployed {
+					if v.ResourceStatus != nil {
+						err := json.Unmarshal(v.ResourceStatus.Raw, mcsubstatus)
+						if err != nil {
+							klog.Info("Failed to unmashall status from clusters")
+							return err
+						}
 					}
+					clusterSubStatus = mcsubstatus.Statuses["/"]
 				}
-				clusterSubStatus = mcsubstatus.Statuses["/"]
+
+				// the time window state is kept at the top of the cluster subscription status
+				if mcsubstatus.TimeWindow != nil {
+					if clusterSubStatus == nil {
+						clusterSubStatus = &appv1alpha1.SubscriptionPerClusterStatus{}
+					}
+
+					clusterSubStatus.TimeWindow = mcsubstatus.TimeWindow
+				}
+
+				newsubstatus.Statuses[k] = clusterSubStatus
+				reported[k] = true
+
+				addClusterToSummary(summary, v, mcsubstatus)
 			}
-			newsubstatus.Statuses[k] = clusterSubStatus
 		}
 	}
 
+	// the placed clusters which have not reported a status yet are unknown
+	clusters, err := r.getPlacementClusters(sub)
+	if err != nil {
+		klog.Info("Failed to get the placement clusters of subscription ", sub.Namespace, "/", sub.Name, " error: ", err)
+	}
+
+	for _, cl := range clusters {
+		if !reported[cl] {
+			addClusterToSummary(summary, nil, &appv1alpha1.SubscriptionStatus{})
+		}
+	}
+
+	newsubstatus.Summary = summary
+	newsubstatus.Conditions = getSubscriptionConditions(sub.Status.Conditions, found, summary)
+
+	if isStatusReportEnabled(sub) {
+		// keep the subscription small, the per-cluster statuses go to the report
+		err := r.updateSubscriptionReport(sub, newsubstatus.Statuses)
+		if err != nil {
+			return err
+		}
+
+		newsubstatus.Statuses = nil
+		summary.Report = sub.Name
+	} else if sub.Status.Summary != nil && sub.Status.Summary.Report != "" {
+		// the report was enabled before, keep it in status until it is deleted
+		if err := r.deleteSubscriptionReport(sub); err != nil {
+			summary.Report = sub.Status.Summary.Report
+		}
+	}
+
+	newsubstatus.RollingUpdate = sub.Status.RollingUpdate
+	newsubstatus.Canary = sub.Status.Canary
+	newsubstatus.Approval = sub.Status.Approval
+	newsubstatus.CurrentRevision = sub.Status.CurrentRevision
+	newsubstatus.Revisions = sub.Status.Revisions
+	newsubstatus.Rollback = sub.Status.Rollback
 	newsubstatus.LastUpdateTime = sub.Status.LastUpdateTime
 	klog.V(5).Info("Check status for ", sub.Namespace, "/", sub.Name, " with ", newsubstatus)
 
@@ -473,9 +634,35 @@ func (r *ReconcileSubscription) updateSubscriptionStatus(sub *appv1alpha1.Subscr
 func (r *ReconcileSubscription) getSubscriptionDeployables(sub *appv1alpha1.Subscription) map[string]*dplv1alpha1.Deployable {
 	allDpls := make(map[string]*dplv1alpha1.Deployable)
 
-	dplList := &dplv1alpha1.DeployableList{}
+	// a package in a later channel of the channel list replaces the package of the same name before, key is package name
+	pkgkeys := make(map[string]string)
 
-	chNameSpace, _ := r.GetChannelNamespaceType(sub)
+	for _, chNameSpace := range r.getChannelNamespaces(sub) {
+		dpls := r.getChannelNamespaceDeployables(sub, chNameSpace)
+		if dpls == nil {
+			return nil
+		}
+
+		for _, dpl := range dpls {
+			dplkey := types.NamespacedName{Name: dpl.Name, Namespace: dpl.Namespace}.String()
+
+			if orgkey, ok := pkgkeys[dpl.Name]; ok {
+				delete(allDpls, orgkey)
+			}
+
+			pkgkeys[dpl.Name] = dplkey
+			allDpls[dplkey] = dpl
+		}
+	}
+
+	return allDpls
+}
+
+// getChannelNamespaceDeployables returns the deployables in the channel namespace which pass the package filter,
+// nil if they can not be listed
+func (r *ReconcileSubscription) getChannelNamespaceDeployables(sub *appv1alpha1.Subscription,
+	chNameSpace string) []*dplv1alpha1.Deployable {
+	dplList := &dplv1alpha1.DeployableList{}
 
 	dplListOptions := &client.ListOptions{Namespace: chNameSpace}
 
@@ -498,23 +685,32 @@ func (r *ReconcileSubscription) getSubscriptionDeployables(sub *appv1alpha1.Subs
 
 	klog.V(5).Info("Hub Subscription found Deployables:", dplList.Items)
 
+	dpls := []*dplv1alpha1.Deployable{}
+
 	for _, dpl := range dplList.Items {
 		if !checkDeployableBySubcriptionPackageFilter(sub, dpl) {
 			continue
 		}
 
-		dplkey := types.NamespacedName{Name: dpl.Name, Namespace: dpl.Namespace}.String()
-		allDpls[dplkey] = dpl.DeepCopy()
+		dpls = append(dpls, dpl.DeepCopy())
 	}
 
-	return allDpls
+	return dpls
 }
 
 func checkDeployableBySubcriptionPackageFilter(sub *appv1alpha1.Subscription, dpl dplv1alpha1.Deployable) bool {
+	passed, _ := filterDeployableBySubscription(sub, dpl)
+
+	return passed
+}
+
+// filterDeployableBySubscription checks the deployable against the package filter of the subscription,
+// returns the reason if it does not pass
+func filterDeployableBySubscription(sub *appv1alpha1.Subscription, dpl dplv1alpha1.Deployable) (bool, string) {
 	if sub.Spec.PackageFilter != nil {
 		if sub.Spec.Package != "" && sub.Spec.Package != dpl.Name {
 			klog.V(5).Info("Name does not match, skiping:", sub.Spec.Package, "|", dpl.Name)
-			return false
+			return false, "name does not match package " + sub.Spec.Package
 		}
 
 		annotations := sub.Spec.PackageFilter.Annotations
@@ -544,17 +740,17 @@ func checkDeployableBySubcriptionPackageFilter(sub *appv1alpha1.Subscription, dp
 		klog.V(5).Info("checking annotations package filter: ", annotations)
 
 		if annotations != nil {
-			matched := true
-
-			for k, v := range annotations {
-				if dplanno[k] != v {
-					matched = false
-					break
-				}
+			keys := make([]string, 0, len(annotations))
+			for k := range annotations {
+				keys = append(keys, k)
 			}
 
-			if !matched {
-				return false
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				if dplanno[k] != annotations[k] {
+					return false, "annotation " + k + "=" + dplanno[k] + " does not match " + annotations[k]
+				}
 			}
 		}
 
@@ -564,15 +760,16 @@ func checkDeployableBySubcriptionPackageFilter(sub *appv1alpha1.Subscription, dp
 			klog.V(5).Infof("version check is %v; subscription version filter condition is %v, deployable version is: %v", vmatch, vsub, vdpl)
 
 			if !vmatch {
-				return false
+				return false, "version " + vdpl + " does not satisfy " + vsub
 			}
 		}
 	}
 
-	return true
+	return true, ""
 }
 
-// createTargetDplForRollingUpdate create a new deployable to contain the target subscription
+// createTargetDplForRollingUpdate prepares the deployable of the target subscription, it is not created.
+// Its template and overrides are rolled out to the clusters of the subscription deployable
 func (r *ReconcileSubscription) createTargetDplForRollingUpdate(sub *appv1alpha1.Subscription) (*dplv1alpha1.Deployable, error) {
 	annotations := sub.GetAnnotations()
 
@@ -608,75 +805,30 @@ func (r *ReconcileSubscription) createTargetDplForRollingUpdate(sub *appv1alpha1
 		return nil, err
 	}
 
-	targetSubDpl.Name = sub.Name + "-target-deployable"
-	targetSubDpl.Namespace = sub.Namespace
-
-	err = r.updateTargetSubscriptionDeployable(sub, targetSubDpl)
-
-	return targetSubDpl, err
+	return targetSubDpl, nil
 }
 
-func (r *ReconcileSubscription) updateTargetSubscriptionDeployable(sub *appv1alpha1.Subscription, targetSubDpl *dplv1alpha1.Deployable) error {
-	targetKey := types.NamespacedName{
-		Namespace: targetSubDpl.Namespace,
-		Name:      targetSubDpl.Name,
-	}
-
+// deleteOwnedDeployable deletes the deployable if it is owned by the subscription
+func (r *ReconcileSubscription) deleteOwnedDeployable(sub *appv1alpha1.Subscription, dplkey types.NamespacedName) error {
 	found := &dplv1alpha1.Deployable{}
-	err := r.Get(context.TODO(), targetKey, found)
-
-	if err != nil && errors.IsNotFound(err) {
-		klog.Info("Creating target Deployable - ", "namespace: ", targetSubDpl.Namespace, ", name: ", targetSubDpl.Name)
-		err = r.Create(context.TODO(), targetSubDpl)
-
-		//record events
-		addtionalMsg := "target Depolyable " + targetKey.String() + " created in the subscription namespace"
-		r.eventRecorder.RecordEvent(sub, "Deploy", addtionalMsg, err)
-
-		return err
-	} else if err != nil {
-		return err
-	}
-
-	orgTpl := &unstructured.Unstructured{}
-	err = json.Unmarshal(targetSubDpl.Spec.Template.Raw, orgTpl)
 
+	err := r.Get(context.TODO(), dplkey, found)
 	if err != nil {
-		klog.V(5).Info("Error in unmarshall target subscription deployable template, err:", err, " |template: ", string(targetSubDpl.Spec.Template.Raw))
-		return err
-	}
-
-	fndTpl := &unstructured.Unstructured{}
-	err = json.Unmarshal(found.Spec.Template.Raw, fndTpl)
+		if errors.IsNotFound(err) {
+			return nil
+		}
 
-	if err != nil {
-		klog.V(5).Info("Error in unmarshall target found subscription deployable template, err:", err, " |template: ", string(found.Spec.Template.Raw))
 		return err
 	}
 
-	if !reflect.DeepEqual(orgTpl, fndTpl) || !reflect.DeepEqual(targetSubDpl.Spec.Overrides, found.Spec.Overrides) {
-		klog.V(5).Infof("Updating target Deployable. orig: %#v, found: %#v", targetSubDpl, found)
-
-		targetSubDpl.Spec.DeepCopyInto(&found.Spec)
-
-		foundanno := found.GetAnnotations()
-		if foundanno == nil {
-			foundanno = make(map[string]string)
-		}
-
-		foundanno[dplv1alpha1.AnnotationIsGenerated] = "true"
-		foundanno[dplv1alpha1.AnnotationLocal] = "false"
-		found.SetAnnotations(foundanno)
-
-		klog.V(5).Info("Updating Deployable - ", "namespace: ", targetSubDpl.Namespace, " ,name: ", targetSubDpl.Name)
+	for _, owner := range found.GetOwnerReferences() {
+		if owner.UID == sub.UID {
+			err = r.Delete(context.TODO(), found)
 
-		err = r.Update(context.TODO(), found)
+			//record events
+			addtionalMsg := "Depolyable " + dplkey.String() + " deleted in the subscription namespace"
+			r.eventRecorder.RecordEvent(sub, "Delete", addtionalMsg, err)
 
-		//record events
-		addtionalMsg := "target Depolyable " + targetKey.String() + " updated in the subscription namespace"
-		r.eventRecorder.RecordEvent(sub, "Deploy", addtionalMsg, err)
-
-		if err != nil {
 			return err
 		}
 	}
@@ -19,9 +19,12 @@ import (
 	"reflect"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -34,6 +37,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	plrv1alpha1 "github.com/IBM/multicloud-operators-placementrule/pkg/apis/app/v1alpha1"
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
 	"github.com/IBM/multicloud-operators-subscription/pkg/utils"
 )
@@ -46,6 +50,17 @@ import (
 // Add creates a new Subscription Controller and adds it to the Manager. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
 func Add(mgr manager.Manager) error {
+	err := mgr.Add(manager.RunnableFunc(func(<-chan struct{}) error {
+		if err := deleteFormerTargetDeployables(mgr.GetAPIReader(), mgr.GetClient()); err != nil {
+			klog.Error("Failed to delete the target deployables of former rolling updates with error: ", err)
+		}
+
+		return nil
+	}))
+	if err != nil {
+		return err
+	}
+
 	return add(mgr, newReconciler(mgr))
 }
 
@@ -76,6 +91,53 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// in hub, watch the calendars referred by subscriptions, their versions are propagated with the subscriptions
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: &utils.CalendarMapper{Client: mgr.GetClient()},
+	}, utils.CalendarPredicateFunctions)
+	if err != nil {
+		return err
+	}
+
+	// in hub, watch the managed clusters and placement rules, the overrides rendered from cluster labels and the
+	// clusters of rolling updates follow them. They are watched only when their CRDs are installed
+	if isKindInstalled(mgr, clusterGVK) {
+		cl := &unstructured.Unstructured{}
+		cl.SetGroupVersionKind(clusterGVK)
+
+		err = c.Watch(&source.Kind{Type: cl}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: &clusterMapper{Client: mgr.GetClient()},
+		}, predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				return !reflect.DeepEqual(e.MetaNew.GetLabels(), e.MetaOld.GetLabels())
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	plrGVK := plrv1alpha1.SchemeGroupVersion.WithKind("PlacementRule")
+
+	if isKindInstalled(mgr, plrGVK) {
+		plr := &unstructured.Unstructured{}
+		plr.SetGroupVersionKind(plrGVK)
+
+		err = c.Watch(&source.Kind{Type: plr}, &handler.EnqueueRequestsFromMapFunc{
+			ToRequests: &placementRuleMapper{Client: mgr.GetClient()},
+		}, predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				newdecisions, _, _ := unstructured.NestedFieldNoCopy(e.ObjectNew.(*unstructured.Unstructured).Object, "status", "decisions")
+				olddecisions, _, _ := unstructured.NestedFieldNoCopy(e.ObjectOld.(*unstructured.Unstructured).Object, "status", "decisions")
+
+				return !reflect.DeepEqual(newdecisions, olddecisions)
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	// in hub, watch the deployable created by the subscription
 	err = c.Watch(&source.Kind{Type: &dplv1alpha1.Deployable{}}, &handler.EnqueueRequestForOwner{
 		IsController: true,
@@ -95,6 +157,17 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 	return nil
 }
 
+// isKindInstalled checks if the api server serves the kind
+func isKindInstalled(mgr manager.Manager, gvk schema.GroupVersionKind) bool {
+	_, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		klog.Info("Not watching ", gvk.String(), ", it is not installed: ", err)
+		return false
+	}
+
+	return true
+}
+
 // blank assignment to verify that ReconcileSubscription implements reconcile.Reconciler
 var _ reconcile.Reconciler = &ReconcileSubscription{}
 
@@ -131,13 +204,59 @@ func (r *ReconcileSubscription) Reconcile(request reconcile.Request) (reconcile.
 
 	// process as hub subscription, generate deployable to propagate
 	pl := instance.Spec.Placement
+	waiting := false
+
 	if pl != nil && (pl.PlacementRef != nil || pl.Clusters != nil || pl.ClusterSelector != nil) {
-		err = r.doMCMHubReconcile(instance)
+		// hold off until the subscriptions in dependsOn are healthy
+		var blocking string
 
-		instance.Status.Phase = appv1alpha1.SubscriptionPropagated
-		if err != nil {
+		var derr error
+
+		dryrun := isDryRun(instance)
+
+		if !dryrun {
+			instance.Status.Preview = nil
+		}
+
+		if !dryrun && !instance.Spec.Suspend {
+			blocking, derr = utils.GetBlockingDependency(r.Client, instance)
+		}
+
+		switch {
+		case dryrun:
+			// resolve only, the deployables propagated before are left as they are
+			preview, perr := r.previewSubscription(instance)
+			if perr != nil {
+				instance.Status.Phase = appv1alpha1.SubscriptionFailed
+				instance.Status.Reason = perr.Error()
+			}
+
+			instance.Status.Preview = preview
+		case instance.Spec.Suspend:
+			klog.Info("Hub subscription ", request.NamespacedName, " is suspended")
+
+			err = r.suspendSubscription(instance)
+			if err != nil {
+				instance.Status.Phase = appv1alpha1.SubscriptionFailed
+				instance.Status.Reason = err.Error()
+			}
+		case derr != nil:
 			instance.Status.Phase = appv1alpha1.SubscriptionFailed
-			instance.Status.Reason = err.Error()
+			instance.Status.Reason = derr.Error()
+		case blocking != "":
+			klog.Info("Hub subscription ", request.NamespacedName, " is waiting for dependency ", blocking)
+
+			waiting = true
+			instance.Status.Phase = appv1alpha1.SubscriptionWaitingForDependency
+			instance.Status.Reason = "waiting for subscription " + blocking
+		default:
+			err = r.doMCMHubReconcile(instance)
+
+			instance.Status.Phase = appv1alpha1.SubscriptionPropagated
+			if err != nil {
+				instance.Status.Phase = appv1alpha1.SubscriptionFailed
+				instance.Status.Reason = err.Error()
+			}
 		}
 	} else {
 		// no longer hub subscription
@@ -147,6 +266,10 @@ func (r *ReconcileSubscription) Reconcile(request reconcile.Request) (reconcile.
 			instance.Status.Reason = ""
 		}
 
+		instance.Status.RollingUpdate = nil
+		instance.Status.Canary = nil
+		instance.Status.Preview = nil
+
 		if instance.Status.Statuses != nil {
 			localkey := types.NamespacedName{}.String()
 			for k := range instance.Status.Statuses {
@@ -159,6 +282,20 @@ func (r *ReconcileSubscription) Reconcile(request reconcile.Request) (reconcile.
 
 	result := reconcile.Result{}
 
+	if waiting {
+		result.RequeueAfter = utils.DependencyRequeueInterval
+	}
+
+	// keep checking the health of the batch in progress
+	if instance.Status.RollingUpdate != nil && instance.Status.RollingUpdate.Phase == appv1alpha1.RollingUpdateProgressing {
+		result.RequeueAfter = rollingUpdateRequeueInterval
+	}
+
+	// keep checking the canary clusters until the bake time is over
+	if instance.Status.Canary != nil && instance.Status.Canary.Phase == appv1alpha1.CanaryBaking {
+		result.RequeueAfter = canaryRequeueInterval
+	}
+
 	if !reflect.DeepEqual(*orgst, instance.Status) {
 		klog.Info("MCM Hub updating subscriptoin status to ", instance.Status)
 
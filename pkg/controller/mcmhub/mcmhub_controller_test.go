@@ -15,6 +15,7 @@
 package mcmhub
 
 import (
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -22,13 +23,17 @@ import (
 	"golang.org/x/net/context"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils"
 )
 
 var c client.Client
@@ -143,3 +148,73 @@ func TestDoMCMReconcile(t *testing.T) {
 
 	g.Expect(rec.doMCMHubReconcile(instance)).NotTo(gomega.HaveOccurred())
 }
+
+// newTestReconciler returns a reconciler reading without cache, so every reconcile sees the status written by the previous one
+func newTestReconciler(g *gomega.GomegaWithT) (client.Client, *ReconcileSubscription) {
+	cl, err := client.New(cfg, client.Options{Scheme: scheme.Scheme})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	erecorder, _ := utils.NewEventRecorder(cfg, scheme.Scheme)
+
+	return cl, &ReconcileSubscription{Client: cl, scheme: scheme.Scheme, eventRecorder: erecorder}
+}
+
+// reconcileTestSubscription reconciles the hub subscription and returns it with the updated status
+func reconcileTestSubscription(g *gomega.GomegaWithT, cl client.Client, rec *ReconcileSubscription,
+	key types.NamespacedName) *appv1alpha1.Subscription {
+	_, err := rec.Reconcile(reconcile.Request{NamespacedName: key})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	sub := &appv1alpha1.Subscription{}
+	g.Expect(cl.Get(context.TODO(), key, sub)).NotTo(gomega.HaveOccurred())
+	g.Expect(sub.Status.Reason).To(gomega.BeEmpty())
+
+	return sub
+}
+
+func updateTestSubscription(g *gomega.GomegaWithT, cl client.Client, key types.NamespacedName,
+	update func(sub *appv1alpha1.Subscription)) {
+	sub := &appv1alpha1.Subscription{}
+	g.Expect(cl.Get(context.TODO(), key, sub)).NotTo(gomega.HaveOccurred())
+	update(sub)
+	g.Expect(cl.Update(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+}
+
+// setTestClusterStatus reports the subscription status of the clusters to the deployable, as the deployable controller does
+func setTestClusterStatus(g *gomega.GomegaWithT, cl client.Client, dplkey types.NamespacedName,
+	phase appv1alpha1.SubscriptionPhase, updated time.Time, clusters ...string) {
+	dpl := &dplv1alpha1.Deployable{}
+	g.Expect(cl.Get(context.TODO(), dplkey, dpl)).NotTo(gomega.HaveOccurred())
+
+	if dpl.Status.PropagatedStatus == nil {
+		dpl.Status.PropagatedStatus = make(map[string]*dplv1alpha1.ResourceUnitStatus)
+	}
+
+	for _, cluster := range clusters {
+		raw, err := json.Marshal(&appv1alpha1.SubscriptionStatus{Phase: phase, LastUpdateTime: metav1.NewTime(updated)})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		st := &dplv1alpha1.ResourceUnitStatus{}
+		st.Phase = dplv1alpha1.DeployableDeployed
+		st.ResourceStatus = &runtime.RawExtension{Raw: raw}
+		dpl.Status.PropagatedStatus[cluster] = st
+	}
+
+	g.Expect(cl.Status().Update(context.TODO(), dpl)).NotTo(gomega.HaveOccurred())
+}
+
+// getTestDeployableTemplate returns the subscription template of the deployable, and the clusters it has overrides for
+func getTestDeployableTemplate(g *gomega.GomegaWithT, cl client.Client, dplkey types.NamespacedName) (*appv1alpha1.Subscription, []string) {
+	dpl := &dplv1alpha1.Deployable{}
+	g.Expect(cl.Get(context.TODO(), dplkey, dpl)).NotTo(gomega.HaveOccurred())
+
+	tpl := &appv1alpha1.Subscription{}
+	g.Expect(json.Unmarshal(dpl.Spec.Template.Raw, tpl)).NotTo(gomega.HaveOccurred())
+
+	var overridden []string
+	for _, ov := range dpl.Spec.Overrides {
+		overridden = append(overridden, ov.ClusterName)
+	}
+
+	return tpl, overridden
+}
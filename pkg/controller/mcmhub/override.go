@@ -0,0 +1,563 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	plrv1alpha1 "github.com/IBM/multicloud-operators-placementrule/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	subutil "github.com/IBM/multicloud-operators-subscription/pkg/utils"
+)
+
+var clusterGVK = schema.GroupVersionKind{
+	Group:   "clusterregistry.k8s.io",
+	Version: "v1alpha1",
+	Kind:    "Cluster",
+}
+
+var clusterListGVK = schema.GroupVersionKind{
+	Group:   "clusterregistry.k8s.io",
+	Version: "v1alpha1",
+	Kind:    "ClusterList",
+}
+
+// overrideTemplateData is what a templated override is rendered with for each managed cluster, for example
+// {"path": "spec.packageOverrides", "value": "{{ index .ClusterLabels \"region\" }}.registry.io"}
+type overrideTemplateData struct {
+	ClusterName      string
+	ClusterNamespace string
+	ClusterLabels    map[string]string
+}
+
+// isTemplatedOverride checks if any value of the override is a template
+func isTemplatedOverride(ov dplv1alpha1.Overrides) bool {
+	for _, cov := range ov.ClusterOverrides {
+		if bytes.Contains(cov.RawExtension.Raw, []byte("{{")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// renderTemplatedOverrides renders the templated overrides for each managed cluster, so the deployable carries concrete
+// values only. Templated "/" overrides are rendered for every cluster of the placement and go before the overrides
+// of the same cluster
+func (r *ReconcileSubscription) renderTemplatedOverrides(sub *appv1alpha1.Subscription,
+	overrides []dplv1alpha1.Overrides) ([]dplv1alpha1.Overrides, error) {
+	templated := false
+
+	for _, ov := range overrides {
+		if isTemplatedOverride(ov) {
+			templated = true
+			break
+		}
+	}
+
+	if !templated {
+		return overrides, nil
+	}
+
+	clusters, err := r.getManagedClusters(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var globals []dplv1alpha1.Overrides
+
+	var rendered []dplv1alpha1.Overrides
+
+	for _, ov := range overrides {
+		if !isTemplatedOverride(ov) {
+			rendered = append(rendered, *ov.DeepCopy())
+			continue
+		}
+
+		if ov.ClusterName == "/" {
+			globals = append(globals, ov)
+			continue
+		}
+
+		rov, err := renderOverride(ov, getOverrideTemplateData(ov.ClusterName, clusters[ov.ClusterName]))
+		if err != nil {
+			return nil, err
+		}
+
+		rendered = append(rendered, rov)
+	}
+
+	if len(globals) == 0 {
+		return rendered, nil
+	}
+
+	targets, err := r.getPlacementClusters(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cl := range targets {
+		data := getOverrideTemplateData(cl, clusters[cl])
+
+		var covs []dplv1alpha1.ClusterOverride
+
+		for _, ov := range globals {
+			rov, err := renderOverride(ov, data)
+			if err != nil {
+				return nil, err
+			}
+
+			covs = append(covs, rov.ClusterOverrides...)
+		}
+
+		merged := false
+
+		for i := range rendered {
+			if rendered[i].ClusterName == cl {
+				rendered[i].ClusterOverrides = append(covs, rendered[i].ClusterOverrides...)
+				merged = true
+			}
+		}
+
+		if !merged {
+			rendered = append(rendered, dplv1alpha1.Overrides{ClusterName: cl, ClusterOverrides: covs})
+		}
+	}
+
+	return rendered, nil
+}
+
+// renderOverride renders the override values for the cluster. Each json string carrying a template is rendered on its
+// own, so the label values are escaped when the override is marshaled back and can't break the json
+func renderOverride(ov dplv1alpha1.Overrides, data *overrideTemplateData) (dplv1alpha1.Overrides, error) {
+	rov := *ov.DeepCopy()
+
+	for i, cov := range rov.ClusterOverrides {
+		var val interface{}
+
+		err := json.Unmarshal(cov.RawExtension.Raw, &val)
+		if err != nil {
+			klog.Info("Failed to unmarshal override ", string(cov.RawExtension.Raw), " error: ", err)
+			return rov, errors.New("override of cluster " + data.ClusterName + " is not valid json: " + err.Error())
+		}
+
+		val, err = renderOverrideValue(val, data)
+		if err != nil {
+			return rov, err
+		}
+
+		raw, err := json.Marshal(val)
+		if err != nil {
+			return rov, err
+		}
+
+		rov.ClusterOverrides[i].RawExtension.Raw = raw
+	}
+
+	return rov, nil
+}
+
+// renderOverrideValue renders the templated strings in the override value
+func renderOverrideValue(val interface{}, data *overrideTemplateData) (interface{}, error) {
+	switch v := val.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+
+		tpl, err := template.New("override").Option("missingkey=zero").Parse(v)
+		if err != nil {
+			klog.Info("Failed to parse override template ", v, " error: ", err)
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+
+		err = tpl.Execute(&buf, data)
+		if err != nil {
+			klog.Info("Failed to render override template for cluster ", data.ClusterName, " error: ", err)
+			return nil, err
+		}
+
+		return buf.String(), nil
+	case map[string]interface{}:
+		for k, item := range v {
+			rendered, err := renderOverrideValue(item, data)
+			if err != nil {
+				return nil, err
+			}
+
+			v[k] = rendered
+		}
+	case []interface{}:
+		for i, item := range v {
+			rendered, err := renderOverrideValue(item, data)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = rendered
+		}
+	}
+
+	return val, nil
+}
+
+// flattenedOverridePaths are the fields of the subscription template a flattened patch override may change
+var flattenedOverridePaths = []string{"spec", "metadata.labels", "metadata.annotations"}
+
+// flattenPatchOverrides applies the overrides of each cluster having patch overrides to the template, and replaces
+// them with path overrides of the fields they changed, as the deployable only takes path overrides to the clusters
+func flattenPatchOverrides(raw []byte, overrides []dplv1alpha1.Overrides) ([]dplv1alpha1.Overrides, error) {
+	var tplobj *unstructured.Unstructured
+
+	var flattened []dplv1alpha1.Overrides
+
+	for _, ov := range overrides {
+		patched := false
+
+		for _, cov := range ov.ClusterOverrides {
+			if subutil.IsPatchOverride(cov) {
+				patched = true
+				break
+			}
+		}
+
+		if !patched {
+			flattened = append(flattened, ov)
+			continue
+		}
+
+		if tplobj == nil {
+			tplobj = &unstructured.Unstructured{}
+
+			if err := json.Unmarshal(raw, tplobj); err != nil {
+				klog.Info("Error in unmarshall, err:", err, " |template: ", string(raw))
+				return nil, err
+			}
+		}
+
+		ovobj, err := subutil.OverrideTemplate(tplobj, ov.ClusterOverrides)
+		if err != nil {
+			return nil, errors.New("failed to override subscription for cluster " + ov.ClusterName + ": " + err.Error())
+		}
+
+		covs, err := diffOverridePaths(tplobj, ovobj)
+		if err != nil {
+			return nil, errors.New("failed to override subscription for cluster " + ov.ClusterName + ": " + err.Error())
+		}
+
+		if len(covs) > 0 {
+			flattened = append(flattened, dplv1alpha1.Overrides{ClusterName: ov.ClusterName, ClusterOverrides: covs})
+		}
+	}
+
+	return flattened, nil
+}
+
+// diffOverridePaths returns the path overrides turning the original template into the overridden one,
+// an error naming the first changed field out of the flattenedOverridePaths if there is one
+func diffOverridePaths(orgobj, ovobj *unstructured.Unstructured) ([]dplv1alpha1.ClusterOverride, error) {
+	orgrest, ovrest := orgobj.DeepCopy(), ovobj.DeepCopy()
+
+	for _, path := range flattenedOverridePaths {
+		fields := strings.Split(path, ".")
+		unstructured.RemoveNestedField(orgrest.Object, fields...)
+		unstructured.RemoveNestedField(ovrest.Object, fields...)
+	}
+
+	if path := changedFieldPath(orgrest.Object, ovrest.Object, ""); path != "" {
+		return nil, errors.New("override of " + path + " is not supported, patch overrides may only change " +
+			strings.Join(flattenedOverridePaths, ", "))
+	}
+
+	var covs []dplv1alpha1.ClusterOverride
+
+	for _, path := range flattenedOverridePaths {
+		fields := strings.Split(path, ".")
+		orgval, _, _ := unstructured.NestedFieldNoCopy(orgobj.Object, fields...)
+		ovval, _, _ := unstructured.NestedFieldNoCopy(ovobj.Object, fields...)
+
+		if equality.Semantic.DeepEqual(orgval, ovval) {
+			continue
+		}
+
+		cov, err := json.Marshal(map[string]interface{}{"path": path, "value": ovval})
+		if err != nil {
+			return nil, err
+		}
+
+		covs = append(covs, dplv1alpha1.ClusterOverride{RawExtension: runtime.RawExtension{Raw: cov}})
+	}
+
+	return covs, nil
+}
+
+// changedFieldPath returns the dotted path of the first field differing between the objects, empty if they are equal.
+// Lists are compared as a whole
+func changedFieldPath(orgval, ovval interface{}, prefix string) string {
+	orgmap, orgok := orgval.(map[string]interface{})
+	ovmap, ovok := ovval.(map[string]interface{})
+
+	if !orgok || !ovok {
+		if equality.Semantic.DeepEqual(orgval, ovval) {
+			return ""
+		}
+
+		return prefix
+	}
+
+	keys := make([]string, 0, len(orgmap)+len(ovmap))
+
+	for k := range orgmap {
+		keys = append(keys, k)
+	}
+
+	for k := range ovmap {
+		if _, ok := orgmap[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+
+		if changed := changedFieldPath(orgmap[k], ovmap[k], path); changed != "" {
+			return changed
+		}
+	}
+
+	return ""
+}
+
+func getOverrideTemplateData(name string, cluster *unstructured.Unstructured) *overrideTemplateData {
+	data := &overrideTemplateData{
+		ClusterName:   name,
+		ClusterLabels: make(map[string]string),
+	}
+
+	if cluster != nil {
+		data.ClusterNamespace = cluster.GetNamespace()
+
+		for k, v := range cluster.GetLabels() {
+			data.ClusterLabels[k] = v
+		}
+	}
+
+	return data
+}
+
+// getManagedClusters returns the managed clusters matching the selector, all clusters if it is nil. Key is cluster name
+func (r *ReconcileSubscription) getManagedClusters(selector *metav1.LabelSelector) (map[string]*unstructured.Unstructured, error) {
+	cllist := &unstructured.UnstructuredList{}
+	cllist.SetGroupVersionKind(clusterListGVK)
+
+	listOptions := &client.ListOptions{}
+
+	if selector != nil {
+		clSelector, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			klog.Error("Failed to set label selector of clusters:", selector, " err: ", err)
+			return nil, err
+		}
+
+		listOptions.LabelSelector = clSelector
+	}
+
+	err := r.List(context.TODO(), cllist, listOptions)
+	if err != nil {
+		klog.Error("Failed to list managed clusters, err: ", err)
+		return nil, err
+	}
+
+	clusters := make(map[string]*unstructured.Unstructured)
+
+	for i := range cllist.Items {
+		clusters[cllist.Items[i].GetName()] = &cllist.Items[i]
+	}
+
+	return clusters, nil
+}
+
+// getPlacementClusters returns the sorted names of the clusters the subscription is placed to
+func (r *ReconcileSubscription) getPlacementClusters(sub *appv1alpha1.Subscription) ([]string, error) {
+	pl := sub.Spec.Placement
+	if pl == nil {
+		return nil, nil
+	}
+
+	names := make(map[string]bool)
+
+	switch {
+	case pl.PlacementRef != nil:
+		// placement rule is read as unstructured, its types are not registered to the manager scheme
+		plr := &unstructured.Unstructured{}
+		plr.SetGroupVersionKind(plrv1alpha1.SchemeGroupVersion.WithKind("PlacementRule"))
+
+		plrkey := types.NamespacedName{Name: pl.PlacementRef.Name, Namespace: pl.PlacementRef.Namespace}
+
+		if plrkey.Namespace == "" {
+			plrkey.Namespace = sub.Namespace
+		}
+
+		err := r.Get(context.TODO(), plrkey, plr)
+		if err != nil {
+			klog.Info("Failed to get placement rule ", plrkey, " of subscription ", sub.Namespace, "/", sub.Name, " error: ", err)
+			return nil, err
+		}
+
+		decisions, _, err := unstructured.NestedSlice(plr.Object, "status", "decisions")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, decision := range decisions {
+			if d, ok := decision.(map[string]interface{}); ok {
+				if cl, ok := d["clusterName"].(string); ok {
+					names[cl] = true
+				}
+			}
+		}
+	case pl.Clusters != nil:
+		for _, cl := range pl.Clusters {
+			names[cl.Name] = true
+		}
+	case pl.ClusterSelector != nil:
+		clusters, err := r.getManagedClusters(pl.ClusterSelector)
+		if err != nil {
+			return nil, err
+		}
+
+		for cl := range clusters {
+			names[cl] = true
+		}
+	}
+
+	var targets []string
+
+	for cl := range names {
+		if strings.TrimSpace(cl) != "" {
+			targets = append(targets, cl)
+		}
+	}
+
+	sort.Strings(targets)
+
+	return targets, nil
+}
+
+// clusterMapper maps a managed cluster to the subscriptions whose overrides or placement depend on the cluster labels
+type clusterMapper struct {
+	client.Client
+}
+
+// Map returns the requests of the subscriptions with templated overrides or a cluster selector placement
+func (mapper *clusterMapper) Map(obj handler.MapObject) []reconcile.Request {
+	sublist := &appv1alpha1.SubscriptionList{}
+
+	err := mapper.List(context.TODO(), sublist, &client.ListOptions{})
+	if err != nil {
+		klog.Error("Failed to list subscriptions for cluster ", obj.Meta.GetName(), " with error: ", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+
+	for _, sub := range sublist.Items {
+		pl := sub.Spec.Placement
+		if pl == nil {
+			continue
+		}
+
+		templated := false
+
+		for _, ov := range sub.Spec.Overrides {
+			if isTemplatedOverride(ov) {
+				templated = true
+				break
+			}
+		}
+
+		if !templated && pl.ClusterSelector == nil {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: sub.Name, Namespace: sub.Namespace}})
+	}
+
+	return requests
+}
+
+// placementRuleMapper maps a placement rule to the subscriptions placed by it
+type placementRuleMapper struct {
+	client.Client
+}
+
+// Map returns the requests of the subscriptions referring to the placement rule
+func (mapper *placementRuleMapper) Map(obj handler.MapObject) []reconcile.Request {
+	sublist := &appv1alpha1.SubscriptionList{}
+
+	err := mapper.List(context.TODO(), sublist, &client.ListOptions{})
+	if err != nil {
+		klog.Error("Failed to list subscriptions for placement rule ", obj.Meta.GetNamespace(), "/", obj.Meta.GetName(),
+			" with error: ", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+
+	for _, sub := range sublist.Items {
+		pl := sub.Spec.Placement
+		if pl == nil || pl.PlacementRef == nil || pl.PlacementRef.Name != obj.Meta.GetName() {
+			continue
+		}
+
+		plrns := pl.PlacementRef.Namespace
+		if plrns == "" {
+			plrns = sub.Namespace
+		}
+
+		if plrns != obj.Meta.GetNamespace() {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: sub.Name, Namespace: sub.Namespace}})
+	}
+
+	return requests
+}
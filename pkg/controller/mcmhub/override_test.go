@@ -0,0 +1,205 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	plrv1alpha1 "github.com/IBM/multicloud-operators-placementrule/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func TestRenderTemplatedOverride(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	static := dplv1alpha1.Overrides{
+		ClusterName: "/",
+		ClusterOverrides: []dplv1alpha1.ClusterOverride{
+			{RawExtension: runtime.RawExtension{Raw: []byte(`{"path":"spec.name","value":"nginx"}`)}},
+		},
+	}
+	g.Expect(isTemplatedOverride(static)).To(gomega.BeFalse())
+
+	ov := dplv1alpha1.Overrides{
+		ClusterName: "/",
+		ClusterOverrides: []dplv1alpha1.ClusterOverride{
+			{RawExtension: runtime.RawExtension{
+				Raw: []byte(`{"path":"spec.registry","value":"{{ index .ClusterLabels \"region\" }}.registry.io/{{ .ClusterName }}"}`),
+			}},
+		},
+	}
+	g.Expect(isTemplatedOverride(ov)).To(gomega.BeTrue())
+
+	cluster := &unstructured.Unstructured{}
+	cluster.SetName("cluster1")
+	cluster.SetNamespace("cluster1-ns")
+	cluster.SetLabels(map[string]string{"region": "us-east"})
+
+	data := getOverrideTemplateData("cluster1", cluster)
+	g.Expect(data.ClusterNamespace).To(gomega.Equal("cluster1-ns"))
+
+	rov, err := renderOverride(ov, data)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(rov.ClusterOverrides[0].RawExtension.Raw)).To(
+		gomega.Equal(`{"path":"spec.registry","value":"us-east.registry.io/cluster1"}`))
+
+	// the original override is untouched
+	g.Expect(isTemplatedOverride(ov)).To(gomega.BeTrue())
+
+	// missing labels render empty
+	rov, err = renderOverride(ov, getOverrideTemplateData("cluster2", nil))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(rov.ClusterOverrides[0].RawExtension.Raw)).To(
+		gomega.Equal(`{"path":"spec.registry","value":".registry.io/cluster2"}`))
+
+	// label values are escaped in the rendered json
+	cluster.SetLabels(map[string]string{"region": `us-"east`})
+
+	rov, err = renderOverride(ov, getOverrideTemplateData("cluster1", cluster))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(rov.ClusterOverrides[0].RawExtension.Raw)).To(
+		gomega.Equal(`{"path":"spec.registry","value":"us-\"east.registry.io/cluster1"}`))
+
+	broken := dplv1alpha1.Overrides{
+		ClusterName: "cluster1",
+		ClusterOverrides: []dplv1alpha1.ClusterOverride{
+			{RawExtension: runtime.RawExtension{Raw: []byte(`{"path":"spec.name","value":{{ .ClusterName }}}`)}},
+		},
+	}
+
+	_, err = renderOverride(broken, data)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestFlattenPatchOverrides(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	tpl := []byte(`{"apiVersion":"app.ibm.com/v1alpha1","kind":"Subscription","metadata":{"name":"sub"},` +
+		`"spec":{"channel":"ns/ch","packageOverrides":[{"packageName":"nginx","packageOverrides":[{"path":"spec.replicas","value":1}]}]}}`)
+
+	static := dplv1alpha1.Overrides{
+		ClusterName: "cluster1",
+		ClusterOverrides: []dplv1alpha1.ClusterOverride{
+			{RawExtension: runtime.RawExtension{Raw: []byte(`{"path":"spec.name","value":"nginx"}`)}},
+		},
+	}
+
+	patched := dplv1alpha1.Overrides{
+		ClusterName: "cluster2",
+		ClusterOverrides: []dplv1alpha1.ClusterOverride{
+			{RawExtension: runtime.RawExtension{Raw: []byte(`{"jsonPatch":[{"op":"replace",` +
+				`"path":"/spec/packageOverrides/0/packageOverrides/0/value","value":3}]}`)}},
+			{RawExtension: runtime.RawExtension{Raw: []byte(`{"strategicMergePatch":{"metadata":{"annotations":{"app.ibm.com/region":"east"}}}}`)}},
+		},
+	}
+
+	noop := dplv1alpha1.Overrides{
+		ClusterName: "cluster3",
+		ClusterOverrides: []dplv1alpha1.ClusterOverride{
+			{RawExtension: runtime.RawExtension{Raw: []byte(`{"jsonPatch":[{"op":"test","path":"/spec/channel","value":"ns/ch"}]}`)}},
+		},
+	}
+
+	flattened, err := flattenPatchOverrides(tpl, []dplv1alpha1.Overrides{static, patched, noop})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(flattened).To(gomega.HaveLen(2))
+	g.Expect(flattened[0]).To(gomega.Equal(static))
+
+	g.Expect(flattened[1].ClusterName).To(gomega.Equal("cluster2"))
+	g.Expect(flattened[1].ClusterOverrides).To(gomega.HaveLen(2))
+	g.Expect(string(flattened[1].ClusterOverrides[0].RawExtension.Raw)).To(gomega.Equal(`{"path":"spec","value":{"channel":"ns/ch",` +
+		`"packageOverrides":[{"packageName":"nginx","packageOverrides":[{"path":"spec.replicas","value":3}]}]}}`))
+	g.Expect(string(flattened[1].ClusterOverrides[1].RawExtension.Raw)).To(
+		gomega.Equal(`{"path":"metadata.annotations","value":{"app.ibm.com/region":"east"}}`))
+
+	broken := dplv1alpha1.Overrides{
+		ClusterName: "cluster4",
+		ClusterOverrides: []dplv1alpha1.ClusterOverride{
+			{RawExtension: runtime.RawExtension{Raw: []byte(`{"jsonPatch":[{"op":"remove","path":"/spec/placement"}]}`)}},
+		},
+	}
+
+	_, err = flattenPatchOverrides(tpl, []dplv1alpha1.Overrides{broken})
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	renamed := dplv1alpha1.Overrides{
+		ClusterName: "cluster5",
+		ClusterOverrides: []dplv1alpha1.ClusterOverride{
+			{RawExtension: runtime.RawExtension{Raw: []byte(`{"jsonPatch":[{"op":"replace","path":"/metadata/name","value":"other"}]}`)}},
+		},
+	}
+
+	_, err = flattenPatchOverrides(tpl, []dplv1alpha1.Overrides{renamed})
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.Error()).To(gomega.ContainSubstring("metadata.name"))
+}
+
+func TestOverrideMappers(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cl, _ := newTestReconciler(g)
+
+	newsub := func(name string, pl *plrv1alpha1.Placement) *appv1alpha1.Subscription {
+		return &appv1alpha1.Subscription{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "mapper-sub-namespace"},
+			Spec:       appv1alpha1.SubscriptionSpec{Channel: "mapper-chn/chn", Placement: pl},
+		}
+	}
+
+	byrule := newsub("mapper-rule", &plrv1alpha1.Placement{PlacementRef: &corev1.ObjectReference{Name: "rule"}})
+
+	byselector := newsub("mapper-selector", &plrv1alpha1.Placement{})
+	byselector.Spec.Placement.ClusterSelector = &metav1.LabelSelector{}
+
+	byclusters := newsub("mapper-clusters", placementOfClusters([]string{"cluster1"}))
+
+	for _, sub := range []*appv1alpha1.Subscription{byrule, byselector, byclusters} {
+		g.Expect(cl.Create(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+
+		defer cl.Delete(context.TODO(), sub)
+	}
+
+	plr := &unstructured.Unstructured{}
+	plr.SetName("rule")
+	plr.SetNamespace("mapper-sub-namespace")
+
+	requests := (&placementRuleMapper{Client: cl}).Map(handler.MapObject{Meta: plr, Object: plr})
+	g.Expect(requests).To(gomega.Equal([]reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: byrule.Name, Namespace: byrule.Namespace}},
+	}))
+
+	// a rule of the same name in another namespace is not referred
+	plr.SetNamespace("mapper-other-namespace")
+	g.Expect((&placementRuleMapper{Client: cl}).Map(handler.MapObject{Meta: plr, Object: plr})).To(gomega.BeEmpty())
+
+	cluster := &unstructured.Unstructured{}
+	cluster.SetName("cluster1")
+
+	requests = (&clusterMapper{Client: cl}).Map(handler.MapObject{Meta: cluster, Object: cluster})
+	g.Expect(requests).To(gomega.Equal([]reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: byselector.Name, Namespace: byselector.Namespace}},
+	}))
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	dplutils "github.com/IBM/multicloud-operators-deployable/pkg/utils"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	subutil "github.com/IBM/multicloud-operators-subscription/pkg/utils"
+)
+
+func isDryRun(sub *appv1alpha1.Subscription) bool {
+	return strings.EqualFold(sub.GetAnnotations()[appv1alpha1.AnnotationDryRun], "true")
+}
+
+// previewSubscription resolves the clusters of the placement and checks every deployable in the channel against the
+// package filter, without touching the deployables of the subscription
+func (r *ReconcileSubscription) previewSubscription(sub *appv1alpha1.Subscription) (*appv1alpha1.SubscriptionPreview, error) {
+	preview := &appv1alpha1.SubscriptionPreview{}
+
+	err := r.checkPreviewChannelTypes(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	clusters, err := r.getPlacementClusters(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	preview.Clusters = clusters
+
+	var selector labels.Selector
+
+	if sub.Spec.PackageFilter != nil && sub.Spec.PackageFilter.LabelSelector != nil {
+		selector, err = dplutils.ConvertLabels(sub.Spec.PackageFilter.LabelSelector)
+		if err != nil {
+			klog.Error("Failed to set label selector of subscrption:", sub.Spec.PackageFilter.LabelSelector, " err: ", err)
+			return nil, err
+		}
+	}
+
+	// index of the package passed in the channels before, key is package name
+	passed := make(map[string]int)
+
+	for _, chNameSpace := range r.getChannelNamespaces(sub) {
+		dplList := &dplv1alpha1.DeployableList{}
+
+		err = r.List(context.TODO(), dplList, &client.ListOptions{Namespace: chNameSpace})
+		if err != nil {
+			klog.Error("Failed to list deployables in channel namespace ", chNameSpace, " err: ", err)
+			return nil, err
+		}
+
+		for _, dpl := range dplList.Items {
+			pkg := appv1alpha1.PackagePreview{
+				Name:    dpl.Name,
+				Version: dpl.GetAnnotations()[dplv1alpha1.AnnotationDeployableVersion],
+			}
+
+			if selector != nil && !selector.Matches(labels.Set(dpl.GetLabels())) {
+				pkg.Reason = "labels do not match " + selector.String()
+			} else {
+				pkg.Passed, pkg.Reason = filterDeployableBySubscription(sub, dpl)
+			}
+
+			if pkg.Passed {
+				if i, ok := passed[pkg.Name]; ok {
+					preview.Packages[i].Passed = false
+					preview.Packages[i].Reason = "replaced by the package in channel namespace " + chNameSpace
+				}
+
+				passed[pkg.Name] = len(preview.Packages)
+			}
+
+			preview.Packages = append(preview.Packages, pkg)
+		}
+	}
+
+	sort.SliceStable(preview.Packages, func(i, j int) bool {
+		return preview.Packages[i].Name < preview.Packages[j].Name
+	})
+
+	return preview, nil
+}
+
+// checkPreviewChannelTypes makes sure all channels of the subscription are namespace channels. The packages of the
+// helmrepo, github and objectbucket channels are only read by the subscribers on managed clusters, so hub can't preview them
+func (r *ReconcileSubscription) checkPreviewChannelTypes(sub *appv1alpha1.Subscription) error {
+	for _, chkey := range subutil.GetSubscriptionChannels(sub) {
+		chobj := &chnv1alpha1.Channel{}
+
+		err := r.Get(context.TODO(), chkey, chobj)
+		if err != nil {
+			klog.Info("Failed to get channel ", chkey, " of subscription ", sub.Namespace, "/", sub.Name, " error: ", err)
+			return err
+		}
+
+		if !strings.EqualFold(string(chobj.Spec.Type), chnv1alpha1.ChannelTypeNamespace) {
+			return errors.New("preview is unsupported for channel type " + string(chobj.Spec.Type) + " of channel " + chkey.String())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func TestPreviewPackageFilterReason(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	sub := &appv1alpha1.Subscription{}
+	sub.Spec.PackageFilter = &appv1alpha1.PackageFilter{
+		Annotations: map[string]string{"tier": "frontend"},
+		Version:     ">=1.2.0",
+	}
+
+	dpl := dplv1alpha1.Deployable{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "nginx",
+			Annotations: map[string]string{
+				"tier":                                  "frontend",
+				dplv1alpha1.AnnotationDeployableVersion: "1.3.0",
+			},
+		},
+	}
+
+	passed, reason := filterDeployableBySubscription(sub, dpl)
+	g.Expect(passed).To(gomega.BeTrue())
+	g.Expect(reason).To(gomega.BeEmpty())
+
+	dpl.Annotations[dplv1alpha1.AnnotationDeployableVersion] = "1.1.0"
+	passed, reason = filterDeployableBySubscription(sub, dpl)
+	g.Expect(passed).To(gomega.BeFalse())
+	g.Expect(reason).To(gomega.Equal("version 1.1.0 does not satisfy >=1.2.0"))
+
+	dpl.Annotations["tier"] = "backend"
+	passed, reason = filterDeployableBySubscription(sub, dpl)
+	g.Expect(passed).To(gomega.BeFalse())
+	g.Expect(reason).To(gomega.Equal("annotation tier=backend does not match frontend"))
+
+	sub.Spec.Package = "mongodb"
+	passed, reason = filterDeployableBySubscription(sub, dpl)
+	g.Expect(passed).To(gomega.BeFalse())
+	g.Expect(reason).To(gomega.Equal("name does not match package mongodb"))
+}
+
+func TestPreviewChannelType(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cl, rec := newTestReconciler(g)
+
+	nschnkey := types.NamespacedName{Name: "preview-ns-chn", Namespace: "preview-chn-namespace"}
+	hrchnkey := types.NamespacedName{Name: "preview-hr-chn", Namespace: "preview-chn-namespace"}
+
+	nschn := &chnv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{Name: nschnkey.Name, Namespace: nschnkey.Namespace},
+		Spec:       chnv1alpha1.ChannelSpec{Type: chnv1alpha1.ChannelTypeNamespace, PathName: nschnkey.Namespace},
+	}
+	hrchn := &chnv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{Name: hrchnkey.Name, Namespace: hrchnkey.Namespace},
+		Spec:       chnv1alpha1.ChannelSpec{Type: chnv1alpha1.ChannelTypeHelmRepo, PathName: "https://charts.example.com"},
+	}
+
+	for _, chn := range []*chnv1alpha1.Channel{nschn, hrchn} {
+		g.Expect(cl.Create(context.TODO(), chn)).NotTo(gomega.HaveOccurred())
+
+		defer cl.Delete(context.TODO(), chn)
+	}
+
+	sub := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: "preview-sub", Namespace: "preview-sub-namespace"},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel:   nschnkey.String(),
+			Placement: placementOfClusters([]string{"c1"}),
+		},
+	}
+
+	preview, err := rec.previewSubscription(sub)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(preview.Clusters).To(gomega.Equal([]string{"c1"}))
+
+	// the packages of a helmrepo channel are only read on managed clusters
+	sub.Spec.Channels = []string{hrchnkey.String()}
+
+	_, err = rec.previewSubscription(sub)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.Error()).To(gomega.ContainSubstring("unsupported for channel type " + chnv1alpha1.ChannelTypeHelmRepo))
+}
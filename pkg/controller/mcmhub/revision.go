@@ -0,0 +1,344 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+// revisionData is the part of the subscription deployable kept in a ControllerRevision
+type revisionData struct {
+	Template  *runtime.RawExtension   `json:"template"`
+	Overrides []dplv1alpha1.Overrides `json:"overrides,omitempty"`
+}
+
+// recordRevision keeps the template of the subscription deployable as a ControllerRevision owned by the subscription,
+// prunes the revisions beyond the history limit and refreshes the revision history in status
+func (r *ReconcileSubscription) recordRevision(sub *appv1alpha1.Subscription, dpl *dplv1alpha1.Deployable) error {
+	// a template frozen by spec.suspend is not a revision to roll back to
+	if suspended, _ := isTemplateSuspended(dpl); suspended {
+		klog.V(5).Info("Skipping revision of suspended template of subscription ", sub.Namespace, "/", sub.Name)
+		return nil
+	}
+
+	data, err := json.Marshal(revisionData{Template: dpl.Spec.Template, Overrides: dpl.Spec.Overrides})
+	if err != nil {
+		return err
+	}
+
+	hash, err := getRevisionHash(dpl)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := r.listRevisions(sub)
+	if err != nil {
+		return err
+	}
+
+	current := int64(0)
+
+	for _, cr := range revisions {
+		if cr.GetAnnotations()[appv1alpha1.AnnotationTemplateHash] == hash {
+			current = cr.Revision
+		}
+	}
+
+	if current == 0 {
+		current = 1
+		if len(revisions) > 0 {
+			current = revisions[len(revisions)-1].Revision + 1
+		}
+
+		cr := &appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      sub.Name + "-" + hash[:10],
+				Namespace: sub.Namespace,
+				Labels: map[string]string{
+					appv1alpha1.LabelRevisionOf: sub.Name,
+				},
+				Annotations: map[string]string{
+					appv1alpha1.AnnotationTemplateHash:      hash,
+					appv1alpha1.AnnotationChannelGeneration: getTemplateChannelGeneration(dpl),
+				},
+			},
+			Data:     runtime.RawExtension{Raw: data},
+			Revision: current,
+		}
+
+		if err = controllerutil.SetControllerReference(sub, cr, r.scheme); err != nil {
+			return err
+		}
+
+		klog.Info("Recording revision ", current, " of subscription ", sub.Namespace, "/", sub.Name)
+
+		err = r.Create(context.TODO(), cr)
+		if kerrors.IsAlreadyExists(err) {
+			// the list missed the revision recorded by a previous reconcile, keep its number
+			cr, err = r.getExistingRevision(sub, cr.Name, hash)
+			if err != nil {
+				return err
+			}
+
+			current = cr.Revision
+		} else if err != nil {
+			klog.Info("Failed to create revision of subscription ", sub.Namespace, "/", sub.Name, " error: ", err)
+			return err
+		} else {
+			cr.CreationTimestamp = metav1.Now()
+		}
+
+		revisions = append(revisions, *cr)
+
+		sort.Slice(revisions, func(i, j int) bool {
+			return revisions[i].Revision < revisions[j].Revision
+		})
+	}
+
+	sub.Status.CurrentRevision = current
+	sub.Status.Revisions = revisionsToStatus(r.pruneRevisions(sub, revisions, current))
+
+	return nil
+}
+
+// getExistingRevision reads the revision of the given name, it must keep the template of the given hash
+func (r *ReconcileSubscription) getExistingRevision(sub *appv1alpha1.Subscription, name, hash string) (*appsv1.ControllerRevision, error) {
+	cr := &appsv1.ControllerRevision{}
+
+	err := r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: sub.Namespace}, cr)
+	if err != nil {
+		klog.Info("Failed to get revision ", name, " of subscription ", sub.Namespace, "/", sub.Name, " error: ", err)
+		return nil, err
+	}
+
+	if !metav1.IsControlledBy(cr, sub) || cr.GetAnnotations()[appv1alpha1.AnnotationTemplateHash] != hash {
+		return nil, errors.New("revision " + name + " of subscription " + sub.Namespace + "/" + sub.Name +
+			" exists with another template")
+	}
+
+	return cr, nil
+}
+
+// rollbackToRevision replaces the template of the subscription deployable with the one of the rollback revision.
+// It returns false if no rollback is requested. The applied rollback is recorded in status: a rollback by
+// annotation is over once the subscription renders another template than the one it replaced, while
+// spec.rollbackRevision holds the revision until it is unset
+func (r *ReconcileSubscription) rollbackToRevision(sub *appv1alpha1.Subscription, dpl *dplv1alpha1.Deployable) (bool, error) {
+	rev := getRollbackRevision(sub)
+	if rev == 0 {
+		sub.Status.Rollback = nil
+		return false, nil
+	}
+
+	hash, err := getRevisionHash(dpl)
+	if err != nil {
+		return false, err
+	}
+
+	rbst := sub.Status.Rollback
+	if rbst != nil && rbst.Revision == rev && rbst.TemplateHash != hash && sub.Spec.RollbackRevision == 0 {
+		klog.V(5).Info("Rollback of subscription ", sub.Namespace, "/", sub.Name, " to revision ", rev,
+			" is superseded by a new template")
+		return false, nil
+	}
+
+	revisions, err := r.listRevisions(sub)
+	if err != nil {
+		return false, err
+	}
+
+	for _, cr := range revisions {
+		if cr.Revision != rev {
+			continue
+		}
+
+		data := &revisionData{}
+
+		err = json.Unmarshal(cr.Data.Raw, data)
+		if err != nil {
+			klog.Info("Error in unmarshall revision ", cr.Name, " err: ", err)
+			return false, err
+		}
+
+		klog.V(1).Info("Rolling back subscription ", sub.Namespace, "/", sub.Name, " to revision ", rev)
+
+		dpl.Spec.Template = data.Template
+		dpl.Spec.Overrides = data.Overrides
+
+		if rbst == nil || rbst.Revision != rev {
+			sub.Status.Rollback = &appv1alpha1.RollbackStatus{Revision: rev, TemplateHash: hash, AppliedTime: metav1.Now()}
+		}
+
+		return true, nil
+	}
+
+	return false, errors.New("rollback revision " + strconv.FormatInt(rev, 10) + " of subscription " +
+		sub.Namespace + "/" + sub.Name + " is not found")
+}
+
+// listRevisions returns the revisions owned by the subscription, sorted by revision
+func (r *ReconcileSubscription) listRevisions(sub *appv1alpha1.Subscription) ([]appsv1.ControllerRevision, error) {
+	crlist := &appsv1.ControllerRevisionList{}
+	listOptions := &client.ListOptions{
+		Namespace:     sub.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{appv1alpha1.LabelRevisionOf: sub.Name}),
+	}
+
+	err := r.List(context.TODO(), crlist, listOptions)
+	if err != nil {
+		klog.Error("Failed to list revisions of subscription ", sub.Namespace, "/", sub.Name, " err: ", err)
+		return nil, err
+	}
+
+	var revisions []appsv1.ControllerRevision
+
+	for _, cr := range crlist.Items {
+		if metav1.IsControlledBy(&cr, sub) {
+			revisions = append(revisions, cr)
+		}
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+
+	return revisions, nil
+}
+
+// pruneRevisions deletes the oldest revisions beyond the history limit, the current revision is always kept
+func (r *ReconcileSubscription) pruneRevisions(sub *appv1alpha1.Subscription,
+	revisions []appsv1.ControllerRevision, current int64) []appsv1.ControllerRevision {
+	limit := appv1alpha1.DefaultRevisionHistoryLimit
+	if sub.Spec.RevisionHistoryLimit != nil && *sub.Spec.RevisionHistoryLimit > 0 {
+		limit = int(*sub.Spec.RevisionHistoryLimit)
+	}
+
+	excess := len(revisions) - limit
+
+	var kept []appsv1.ControllerRevision
+
+	for i := range revisions {
+		cr := revisions[i]
+
+		if excess > 0 && cr.Revision != current {
+			klog.V(1).Info("Pruning revision ", cr.Revision, " of subscription ", sub.Namespace, "/", sub.Name)
+
+			err := r.Delete(context.TODO(), &cr)
+			if err == nil || kerrors.IsNotFound(err) {
+				excess--
+				continue
+			}
+
+			klog.Info("Failed to delete revision ", cr.Name, " error: ", err)
+		}
+
+		kept = append(kept, cr)
+	}
+
+	return kept
+}
+
+func revisionsToStatus(revisions []appsv1.ControllerRevision) []appv1alpha1.SubscriptionRevision {
+	var history []appv1alpha1.SubscriptionRevision
+
+	for i := len(revisions) - 1; i >= 0; i-- {
+		cr := revisions[i]
+
+		history = append(history, appv1alpha1.SubscriptionRevision{
+			Revision:          cr.Revision,
+			Name:              cr.Name,
+			ChannelGeneration: cr.GetAnnotations()[appv1alpha1.AnnotationChannelGeneration],
+			CreationTime:      cr.CreationTimestamp,
+		})
+	}
+
+	return history
+}
+
+// getRollbackRevision returns the rollback revision from the spec, then the annotation. 0 means no rollback
+func getRollbackRevision(sub *appv1alpha1.Subscription) int64 {
+	if sub.Spec.RollbackRevision > 0 {
+		return sub.Spec.RollbackRevision
+	}
+
+	anno := strings.TrimSpace(sub.GetAnnotations()[appv1alpha1.AnnotationRollbackRevision])
+	if anno == "" {
+		return 0
+	}
+
+	rev, err := strconv.ParseInt(anno, 10, 64)
+	if err != nil || rev < 0 {
+		klog.Info("Invalid rollback revision ", anno, " of subscription ", sub.Namespace, "/", sub.Name)
+		return 0
+	}
+
+	return rev
+}
+
+// getRevisionHash hashes the template and the overrides of the subscription deployable
+func getRevisionHash(dpl *dplv1alpha1.Deployable) (string, error) {
+	tplHash, err := getTemplateHash(dpl)
+	if err != nil {
+		return "", err
+	}
+
+	ovraw, err := json.Marshal(dpl.Spec.Overrides)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(append([]byte(tplHash), ovraw...))
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// isTemplateSuspended checks the suspend flag of the subscription in the deployable template
+func isTemplateSuspended(dpl *dplv1alpha1.Deployable) (bool, error) {
+	if dpl.Spec.Template == nil {
+		return false, nil
+	}
+
+	tpl := &unstructured.Unstructured{}
+
+	err := json.Unmarshal(dpl.Spec.Template.Raw, tpl)
+	if err != nil {
+		return false, err
+	}
+
+	suspended, _, err := unstructured.NestedBool(tpl.Object, "spec", "suspend")
+
+	return suspended, err
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func TestRollbackRevision(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	sub := &appv1alpha1.Subscription{}
+	g.Expect(getRollbackRevision(sub)).To(gomega.Equal(int64(0)))
+
+	sub.SetAnnotations(map[string]string{appv1alpha1.AnnotationRollbackRevision: "3"})
+	g.Expect(getRollbackRevision(sub)).To(gomega.Equal(int64(3)))
+
+	sub.SetAnnotations(map[string]string{appv1alpha1.AnnotationRollbackRevision: "latest"})
+	g.Expect(getRollbackRevision(sub)).To(gomega.Equal(int64(0)))
+
+	// spec takes precedence over annotation
+	sub.Spec.RollbackRevision = 2
+	g.Expect(getRollbackRevision(sub)).To(gomega.Equal(int64(2)))
+}
+
+func TestRevisionHistory(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	dpl := &dplv1alpha1.Deployable{}
+	dpl.Spec.Template = &runtime.RawExtension{Raw: []byte(`{"kind":"Subscription"}`)}
+
+	hash, err := getRevisionHash(dpl)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	dpl.Spec.Overrides = []dplv1alpha1.Overrides{{ClusterName: "cluster1"}}
+
+	ovhash, err := getRevisionHash(dpl)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(ovhash).NotTo(gomega.Equal(hash))
+
+	revisions := []appsv1.ControllerRevision{
+		{ObjectMeta: metav1.ObjectMeta{Name: "rev1"}, Revision: 1},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "rev2",
+				Annotations: map[string]string{appv1alpha1.AnnotationChannelGeneration: "5"},
+			},
+			Revision: 2,
+		},
+	}
+
+	history := revisionsToStatus(revisions)
+	g.Expect(history).To(gomega.HaveLen(2))
+	g.Expect(history[0].Name).To(gomega.Equal("rev2"))
+	g.Expect(history[0].ChannelGeneration).To(gomega.Equal("5"))
+	g.Expect(history[1].Revision).To(gomega.Equal(int64(1)))
+
+	suspended, err := isTemplateSuspended(dpl)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(suspended).To(gomega.BeFalse())
+
+	dpl.Spec.Template = &runtime.RawExtension{Raw: []byte(`{"kind":"Subscription","spec":{"suspend":true}}`)}
+
+	suspended, err = isTemplateSuspended(dpl)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(suspended).To(gomega.BeTrue())
+}
+
+func TestRevisionReconcile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cl, rec := newTestReconciler(g)
+
+	rchnkey := types.NamespacedName{Name: "revision-chn", Namespace: "revision-chn-namespace"}
+	rsubkey := types.NamespacedName{Name: "revision-sub", Namespace: "revision-sub-namespace"}
+	dplkey := types.NamespacedName{Name: rsubkey.Name + "-deployable", Namespace: rsubkey.Namespace}
+
+	chn := &chnv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{Name: rchnkey.Name, Namespace: rchnkey.Namespace},
+		Spec:       chnv1alpha1.ChannelSpec{Type: chnv1alpha1.ChannelTypeNamespace},
+	}
+	g.Expect(cl.Create(context.TODO(), chn)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), chn)
+
+	instance := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: rsubkey.Name, Namespace: rsubkey.Namespace},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel:   rchnkey.String(),
+			Package:   "v1",
+			Placement: placementOfClusters([]string{"c1"}),
+		},
+	}
+	g.Expect(cl.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), instance)
+	defer cl.Delete(context.TODO(), &dplv1alpha1.Deployable{ObjectMeta: metav1.ObjectMeta{Name: dplkey.Name, Namespace: dplkey.Namespace}})
+
+	sub := reconcileTestSubscription(g, cl, rec, rsubkey)
+	g.Expect(sub.Status.CurrentRevision).To(gomega.Equal(int64(1)))
+
+	updateTestSubscription(g, cl, rsubkey, func(sub *appv1alpha1.Subscription) { sub.Spec.Package = "v2" })
+
+	sub = reconcileTestSubscription(g, cl, rec, rsubkey)
+	g.Expect(sub.Status.CurrentRevision).To(gomega.Equal(int64(2)))
+	g.Expect(sub.Status.Revisions).To(gomega.HaveLen(2))
+
+	// the rollback by annotation holds while the subscription renders the template it replaced
+	updateTestSubscription(g, cl, rsubkey, func(sub *appv1alpha1.Subscription) {
+		sub.SetAnnotations(map[string]string{appv1alpha1.AnnotationRollbackRevision: "1"})
+	})
+
+	for i := 0; i < 2; i++ {
+		sub = reconcileTestSubscription(g, cl, rec, rsubkey)
+		g.Expect(sub.Status.CurrentRevision).To(gomega.Equal(int64(1)))
+		g.Expect(sub.Status.Rollback).NotTo(gomega.BeNil())
+		g.Expect(sub.Status.Rollback.Revision).To(gomega.Equal(int64(1)))
+
+		tpl, _ := getTestDeployableTemplate(g, cl, dplkey)
+		g.Expect(tpl.Spec.Package).To(gomega.Equal("v1"))
+	}
+
+	// a new template supersedes the rollback, the annotation is not applied again
+	updateTestSubscription(g, cl, rsubkey, func(sub *appv1alpha1.Subscription) { sub.Spec.Package = "v3" })
+
+	sub = reconcileTestSubscription(g, cl, rec, rsubkey)
+	g.Expect(sub.Status.CurrentRevision).To(gomega.Equal(int64(3)))
+
+	tpl, _ := getTestDeployableTemplate(g, cl, dplkey)
+	g.Expect(tpl.Spec.Package).To(gomega.Equal("v3"))
+
+	// a revision missed by the list is read back instead of recorded again
+	revisions, err := rec.listRevisions(sub)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(revisions).To(gomega.HaveLen(3))
+
+	missed := revisions[2].DeepCopy()
+	missed.SetLabels(nil)
+	g.Expect(cl.Update(context.TODO(), missed)).NotTo(gomega.HaveOccurred())
+
+	dpl := &dplv1alpha1.Deployable{}
+	g.Expect(cl.Get(context.TODO(), dplkey, dpl)).NotTo(gomega.HaveOccurred())
+
+	sub.Status.CurrentRevision = 0
+	g.Expect(rec.recordRevision(sub, dpl)).NotTo(gomega.HaveOccurred())
+	g.Expect(sub.Status.CurrentRevision).To(gomega.Equal(int64(3)))
+	g.Expect(sub.Status.Revisions[0].Name).To(gomega.Equal(missed.Name))
+}
@@ -0,0 +1,383 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	subutil "github.com/IBM/multicloud-operators-subscription/pkg/utils"
+)
+
+// rollingUpdateRequeueInterval is how often the hub checks the health of the batch in progress
+const rollingUpdateRequeueInterval = 15 * time.Second
+
+// rollingUpdate moves the clusters of the subscription deployable to the target subscription in batches of maxUnavailable.
+// The clusters are resolved from the placement at every reconcile, and the moved clusters get the target template
+// through path overrides of the subscription deployable. The next batch is only started after all clusters of the
+// current batch report the target subscription Subscribed without failed packages. Once all clusters are moved,
+// the subscription deployable carries the target template. The progress is kept in sub.Status.RollingUpdate.
+func (r *ReconcileSubscription) rollingUpdate(sub *appv1alpha1.Subscription,
+	dpl, targetDpl *dplv1alpha1.Deployable) (*dplv1alpha1.Deployable, error) {
+	target := sub.GetAnnotations()[appv1alpha1.AnnotationRollingUpdateTarget]
+	rust := sub.Status.RollingUpdate
+
+	if rust == nil || rust.Target != target {
+		klog.Info("Starting rolling update of subscription ", sub.Namespace, "/", sub.Name, " to ", target)
+
+		rust = &appv1alpha1.RollingUpdateStatus{
+			Target:             target,
+			Phase:              appv1alpha1.RollingUpdateProgressing,
+			LastTransitionTime: metav1.Now(),
+		}
+		sub.Status.RollingUpdate = rust
+	}
+
+	if rust.Phase == appv1alpha1.RollingUpdateCompleted {
+		return promoteTargetDeployable(sub, dpl, targetDpl), nil
+	}
+
+	clusters, err := r.getPlacementClusters(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	// clusters removed from the placement leave the rolling update, new clusters join the remaining ones
+	rust.Clusters = clusters
+	rust.UpdatedClusters = intersectClusters(rust.UpdatedClusters, clusters)
+	rust.CurrentBatch = intersectClusters(rust.CurrentBatch, clusters)
+
+	if len(rust.CurrentBatch) > 0 {
+		healthy, err := r.areClustersHealthy(types.NamespacedName{Name: dpl.Name, Namespace: dpl.Namespace},
+			rust.CurrentBatch, rust.CurrentBatchStartTime)
+		if err != nil {
+			return nil, err
+		}
+
+		if healthy {
+			klog.Info("Rolling update batch ", rust.CurrentBatch, " of subscription ", sub.Namespace, "/", sub.Name, " is healthy")
+
+			rust.UpdatedClusters = append(rust.UpdatedClusters, rust.CurrentBatch...)
+			rust.CurrentBatch = nil
+		}
+	}
+
+	paused := isRollingUpdatePaused(sub)
+
+	if len(rust.CurrentBatch) == 0 {
+		remaining := subtractClusters(rust.Clusters, rust.UpdatedClusters)
+
+		switch {
+		case len(remaining) == 0:
+			klog.Info("Rolling update of subscription ", sub.Namespace, "/", sub.Name, " to ", target, " completed")
+			setRollingUpdatePhase(rust, appv1alpha1.RollingUpdateCompleted)
+
+			return promoteTargetDeployable(sub, dpl, targetDpl), nil
+		case !paused:
+			batchSize := getRollingUpdateMaxUnavailable(sub, len(rust.Clusters))
+			if batchSize > len(remaining) {
+				batchSize = len(remaining)
+			}
+
+			rust.CurrentBatch = append([]string{}, remaining[:batchSize]...)
+			rust.CurrentBatchStartTime = metav1.Now()
+
+			klog.Info("Rolling update of subscription ", sub.Namespace, "/", sub.Name, " moving clusters ", rust.CurrentBatch)
+		}
+	}
+
+	if paused {
+		setRollingUpdatePhase(rust, appv1alpha1.RollingUpdatePaused)
+	} else {
+		setRollingUpdatePhase(rust, appv1alpha1.RollingUpdateProgressing)
+	}
+
+	moved := append(append([]string{}, rust.UpdatedClusters...), rust.CurrentBatch...)
+
+	err = overrideClustersWithTarget(dpl, targetDpl, moved)
+	if err != nil {
+		return nil, err
+	}
+
+	return dpl, nil
+}
+
+// promoteTargetDeployable makes the subscription deployable carry the target template to all clusters
+func promoteTargetDeployable(sub *appv1alpha1.Subscription, dpl, targetDpl *dplv1alpha1.Deployable) *dplv1alpha1.Deployable {
+	promoted := dpl.DeepCopy()
+	targetDpl.Spec.DeepCopyInto(&promoted.Spec)
+	promoted.Spec.Placement = sub.Spec.Placement.DeepCopy()
+
+	return promoted
+}
+
+// overrideClustersWithTarget replaces the overrides of the clusters in the deployable with the path overrides
+// turning its template into the target template, overridden for each cluster by the target deployable
+func overrideClustersWithTarget(dpl, targetDpl *dplv1alpha1.Deployable, clusters []string) error {
+	if len(clusters) == 0 {
+		return nil
+	}
+
+	orgobj := &unstructured.Unstructured{}
+
+	err := json.Unmarshal(dpl.Spec.Template.Raw, orgobj)
+	if err != nil {
+		klog.Info("Error in unmarshall, err:", err, " |template: ", string(dpl.Spec.Template.Raw))
+		return err
+	}
+
+	tgtobj := &unstructured.Unstructured{}
+
+	err = json.Unmarshal(targetDpl.Spec.Template.Raw, tgtobj)
+	if err != nil {
+		klog.Info("Error in unmarshall, err:", err, " |template: ", string(targetDpl.Spec.Template.Raw))
+		return err
+	}
+
+	movedmap := make(map[string]bool)
+	for _, cl := range clusters {
+		movedmap[cl] = true
+	}
+
+	var overrides []dplv1alpha1.Overrides
+
+	for _, ov := range dpl.Spec.Overrides {
+		if !movedmap[ov.ClusterName] {
+			overrides = append(overrides, ov)
+		}
+	}
+
+	targetOverrides := make(map[string][]dplv1alpha1.ClusterOverride)
+	for _, ov := range targetDpl.Spec.Overrides {
+		targetOverrides[ov.ClusterName] = append(targetOverrides[ov.ClusterName], ov.ClusterOverrides...)
+	}
+
+	for _, cl := range clusters {
+		ovobj, err := subutil.OverrideTemplate(tgtobj, targetOverrides[cl])
+		if err != nil {
+			return errors.New("failed to override target subscription for cluster " + cl + ": " + err.Error())
+		}
+
+		covs, err := diffOverridePaths(orgobj, ovobj)
+		if err != nil {
+			return err
+		}
+
+		if len(covs) > 0 {
+			overrides = append(overrides, dplv1alpha1.Overrides{ClusterName: cl, ClusterOverrides: covs})
+		}
+	}
+
+	dpl.Spec.Overrides = overrides
+
+	return nil
+}
+
+// areClustersHealthy checks if the subscription propagated by the deployable is subscribed without failed packages
+// on all the clusters, with a status reported by the clusters after the given time
+func (r *ReconcileSubscription) areClustersHealthy(dplkey types.NamespacedName, clusters []string, since metav1.Time) (bool, error) {
+	found := &dplv1alpha1.Deployable{}
+
+	err := r.Get(context.TODO(), dplkey, found)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	for _, cl := range clusters {
+		st := found.Status.PropagatedStatus[cl]
+		if !isClusterSubscriptionHealthy(st) || !isClusterStatusUpdatedAfter(st, since) {
+			klog.V(5).Info("Cluster ", cl, " of deployable ", dplkey, " is not healthy yet")
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func isClusterSubscriptionHealthy(st *dplv1alpha1.ResourceUnitStatus) bool {
+	if st == nil || st.Phase != dplv1alpha1.DeployableDeployed || st.ResourceStatus == nil {
+		return false
+	}
+
+	mcsubstatus := &appv1alpha1.SubscriptionStatus{}
+
+	err := json.Unmarshal(st.ResourceStatus.Raw, mcsubstatus)
+	if err != nil {
+		klog.Info("Failed to unmashall status from cluster, error: ", err)
+		return false
+	}
+
+	if mcsubstatus.Phase != appv1alpha1.SubscriptionSubscribed {
+		return false
+	}
+
+	for _, clst := range mcsubstatus.Statuses {
+		if clst == nil {
+			continue
+		}
+
+		for _, pkgst := range clst.SubscriptionPackageStatus {
+			if pkgst != nil && pkgst.Phase == appv1alpha1.SubscriptionFailed {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// isClusterStatusUpdatedAfter checks if the subscription on the cluster reported its status after the given time,
+// an older status may still describe the subscription before the cluster was moved
+func isClusterStatusUpdatedAfter(st *dplv1alpha1.ResourceUnitStatus, since metav1.Time) bool {
+	if st == nil || st.ResourceStatus == nil {
+		return false
+	}
+
+	mcsubstatus := &appv1alpha1.SubscriptionStatus{}
+
+	err := json.Unmarshal(st.ResourceStatus.Raw, mcsubstatus)
+	if err != nil {
+		klog.Info("Failed to unmashall status from cluster, error: ", err)
+		return false
+	}
+
+	return mcsubstatus.LastUpdateTime.After(since.Time)
+}
+
+// getRollingUpdateMaxUnavailable returns the batch size from the spec, then the annotation, then the default percentage
+func getRollingUpdateMaxUnavailable(sub *appv1alpha1.Subscription, total int) int {
+	maxUnavailable := intstr.FromString(strconv.Itoa(appv1alpha1.DefaultRollingUpdateMaxUnavailablePercentage) + "%")
+
+	if anno := strings.TrimSpace(sub.GetAnnotations()[appv1alpha1.AnnotationRollingUpdateMaxUnavailable]); anno != "" {
+		maxUnavailable = intstr.Parse(anno)
+	}
+
+	if sub.Spec.RollingUpdate != nil && sub.Spec.RollingUpdate.MaxUnavailable != nil {
+		maxUnavailable = *sub.Spec.RollingUpdate.MaxUnavailable
+	}
+
+	n, err := intstr.GetValueFromIntOrPercent(&maxUnavailable, total, true)
+	if err != nil {
+		klog.Info("Invalid maxUnavailable ", maxUnavailable.String(), ", using the default percentage. error: ", err)
+
+		n = (total*appv1alpha1.DefaultRollingUpdateMaxUnavailablePercentage + 99) / 100
+	}
+
+	if n < 1 {
+		n = 1
+	}
+
+	return n
+}
+
+func isRollingUpdatePaused(sub *appv1alpha1.Subscription) bool {
+	if sub.Spec.RollingUpdate != nil && sub.Spec.RollingUpdate.Paused {
+		return true
+	}
+
+	return strings.EqualFold(sub.GetAnnotations()[appv1alpha1.AnnotationRollingUpdatePaused], "true")
+}
+
+func setRollingUpdatePhase(rust *appv1alpha1.RollingUpdateStatus, phase appv1alpha1.RollingUpdatePhase) {
+	if rust.Phase != phase {
+		rust.Phase = phase
+		rust.LastTransitionTime = metav1.Now()
+	}
+}
+
+func subtractClusters(all, excluded []string) []string {
+	exmap := make(map[string]bool)
+	for _, cl := range excluded {
+		exmap[cl] = true
+	}
+
+	var left []string
+
+	for _, cl := range all {
+		if !exmap[cl] {
+			left = append(left, cl)
+		}
+	}
+
+	return left
+}
+
+func intersectClusters(clusters, included []string) []string {
+	inmap := make(map[string]bool)
+	for _, cl := range included {
+		inmap[cl] = true
+	}
+
+	var kept []string
+
+	for _, cl := range clusters {
+		if inmap[cl] {
+			kept = append(kept, cl)
+		}
+	}
+
+	return kept
+}
+
+// deleteFormerTargetDeployables deletes the <subscription>-target-deployable deployables created by the rolling updates
+// of former releases, the rolling updates now move the clusters with path overrides of the subscription deployable.
+// It runs once when the hub controller starts
+func deleteFormerTargetDeployables(reader client.Reader, clt client.Client) error {
+	dpls := &dplv1alpha1.DeployableList{}
+
+	err := reader.List(context.TODO(), dpls)
+	if err != nil {
+		return err
+	}
+
+	for i := range dpls.Items {
+		dpl := &dpls.Items[i]
+
+		for _, owner := range dpl.GetOwnerReferences() {
+			if owner.Kind != "Subscription" || dpl.Name != owner.Name+"-target-deployable" {
+				continue
+			}
+
+			klog.Info("Deleting deployable ", dpl.Namespace, "/", dpl.Name, " of a former rolling update")
+
+			err = clt.Delete(context.TODO(), dpl)
+			if err != nil && !kerrors.IsNotFound(err) {
+				return err
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
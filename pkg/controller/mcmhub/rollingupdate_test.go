@@ -0,0 +1,273 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func TestRollingUpdateMaxUnavailable(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	sub := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "rolling-sub",
+			Namespace: "default",
+		},
+	}
+
+	// default is 25%, rounded up
+	g.Expect(getRollingUpdateMaxUnavailable(sub, 10)).To(gomega.Equal(3))
+	g.Expect(getRollingUpdateMaxUnavailable(sub, 1)).To(gomega.Equal(1))
+
+	sub.SetAnnotations(map[string]string{appv1alpha1.AnnotationRollingUpdateMaxUnavailable: "50%"})
+	g.Expect(getRollingUpdateMaxUnavailable(sub, 10)).To(gomega.Equal(5))
+
+	sub.SetAnnotations(map[string]string{appv1alpha1.AnnotationRollingUpdateMaxUnavailable: "2"})
+	g.Expect(getRollingUpdateMaxUnavailable(sub, 10)).To(gomega.Equal(2))
+
+	sub.SetAnnotations(map[string]string{appv1alpha1.AnnotationRollingUpdateMaxUnavailable: "0"})
+	g.Expect(getRollingUpdateMaxUnavailable(sub, 10)).To(gomega.Equal(1))
+
+	// spec takes precedence over annotation
+	maxUnavailable := intstr.FromInt(4)
+	sub.Spec.RollingUpdate = &appv1alpha1.RollingUpdate{MaxUnavailable: &maxUnavailable}
+	g.Expect(getRollingUpdateMaxUnavailable(sub, 10)).To(gomega.Equal(4))
+
+	g.Expect(isRollingUpdatePaused(sub)).To(gomega.BeFalse())
+
+	sub.Spec.RollingUpdate.Paused = true
+	g.Expect(isRollingUpdatePaused(sub)).To(gomega.BeTrue())
+
+	sub.Spec.RollingUpdate = nil
+	sub.SetAnnotations(map[string]string{appv1alpha1.AnnotationRollingUpdatePaused: "true"})
+	g.Expect(isRollingUpdatePaused(sub)).To(gomega.BeTrue())
+}
+
+func TestRollingUpdateClusterHealth(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	g.Expect(subtractClusters([]string{"c1", "c2", "c3"}, []string{"c2"})).To(gomega.Equal([]string{"c1", "c3"}))
+	g.Expect(subtractClusters([]string{"c1"}, []string{"c1"})).To(gomega.BeEmpty())
+	g.Expect(placementOfClusters([]string{"c1", "c2"}).Clusters).To(gomega.HaveLen(2))
+
+	g.Expect(isClusterSubscriptionHealthy(nil)).To(gomega.BeFalse())
+
+	newUnitStatus := func(pkgphase appv1alpha1.SubscriptionPhase) *dplv1alpha1.ResourceUnitStatus {
+		mcsubstatus := &appv1alpha1.SubscriptionStatus{
+			Phase: appv1alpha1.SubscriptionSubscribed,
+			Statuses: map[string]*appv1alpha1.SubscriptionPerClusterStatus{
+				"/": {
+					SubscriptionPackageStatus: map[string]*appv1alpha1.SubscriptionUnitStatus{
+						"pkg": {Phase: pkgphase},
+					},
+				},
+			},
+		}
+
+		raw, err := json.Marshal(mcsubstatus)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		st := &dplv1alpha1.ResourceUnitStatus{}
+		st.Phase = dplv1alpha1.DeployableDeployed
+		st.ResourceStatus = &runtime.RawExtension{Raw: raw}
+
+		return st
+	}
+
+	g.Expect(isClusterSubscriptionHealthy(newUnitStatus(appv1alpha1.SubscriptionSubscribed))).To(gomega.BeTrue())
+	g.Expect(isClusterSubscriptionHealthy(newUnitStatus(appv1alpha1.SubscriptionFailed))).To(gomega.BeFalse())
+}
+
+func TestRollingUpdateReconcile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cl, rec := newTestReconciler(g)
+
+	rchnkey := types.NamespacedName{Name: "rolling-chn", Namespace: "rolling-chn-namespace"}
+	rsubkey := types.NamespacedName{Name: "rolling-sub", Namespace: "rolling-sub-namespace"}
+	dplkey := types.NamespacedName{Name: rsubkey.Name + "-deployable", Namespace: rsubkey.Namespace}
+
+	chn := &chnv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{Name: rchnkey.Name, Namespace: rchnkey.Namespace},
+		Spec:       chnv1alpha1.ChannelSpec{Type: chnv1alpha1.ChannelTypeNamespace},
+	}
+	g.Expect(cl.Create(context.TODO(), chn)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), chn)
+
+	target := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: "rolling-sub-v2", Namespace: rsubkey.Namespace},
+		Spec:       appv1alpha1.SubscriptionSpec{Channel: rchnkey.String(), Package: "v2"},
+	}
+	g.Expect(cl.Create(context.TODO(), target)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), target)
+
+	maxUnavailable := intstr.FromInt(2)
+	instance := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        rsubkey.Name,
+			Namespace:   rsubkey.Namespace,
+			Annotations: map[string]string{appv1alpha1.AnnotationRollingUpdateTarget: target.Name},
+		},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel:       rchnkey.String(),
+			Package:       "v1",
+			Placement:     placementOfClusters([]string{"c1", "c2", "c3", "c4"}),
+			RollingUpdate: &appv1alpha1.RollingUpdate{MaxUnavailable: &maxUnavailable},
+		},
+	}
+	g.Expect(cl.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), instance)
+	defer cl.Delete(context.TODO(), &dplv1alpha1.Deployable{ObjectMeta: metav1.ObjectMeta{Name: dplkey.Name, Namespace: dplkey.Namespace}})
+
+	reconcileSub := func() *appv1alpha1.Subscription {
+		sub := reconcileTestSubscription(g, cl, rec, rsubkey)
+		g.Expect(sub.Status.RollingUpdate).NotTo(gomega.BeNil())
+
+		return sub
+	}
+
+	setClusterStatus := func(phase appv1alpha1.SubscriptionPhase, updated time.Time, clusters ...string) {
+		setTestClusterStatus(g, cl, dplkey, phase, updated, clusters...)
+	}
+
+	getDeployable := func() (*appv1alpha1.Subscription, []string) {
+		return getTestDeployableTemplate(g, cl, dplkey)
+	}
+
+	fresh := time.Now().Add(time.Minute)
+
+	// the first batch is moved to the target through overrides of the subscription deployable
+	sub := reconcileSub()
+	g.Expect(sub.Status.RollingUpdate.Phase).To(gomega.Equal(appv1alpha1.RollingUpdateProgressing))
+	g.Expect(sub.Status.RollingUpdate.CurrentBatch).To(gomega.Equal([]string{"c1", "c2"}))
+
+	tpl, overridden := getDeployable()
+	g.Expect(tpl.Spec.Package).To(gomega.Equal("v1"))
+	g.Expect(overridden).To(gomega.Equal([]string{"c1", "c2"}))
+
+	// an unhealthy cluster or a status reported before the batch started stops the rolling update
+	setClusterStatus(appv1alpha1.SubscriptionSubscribed, fresh, "c1")
+	setClusterStatus(appv1alpha1.SubscriptionFailed, fresh, "c2")
+
+	sub = reconcileSub()
+	g.Expect(sub.Status.RollingUpdate.CurrentBatch).To(gomega.Equal([]string{"c1", "c2"}))
+	g.Expect(sub.Status.RollingUpdate.UpdatedClusters).To(gomega.BeEmpty())
+
+	setClusterStatus(appv1alpha1.SubscriptionSubscribed, time.Now().Add(-time.Hour), "c2")
+
+	sub = reconcileSub()
+	g.Expect(sub.Status.RollingUpdate.CurrentBatch).To(gomega.Equal([]string{"c1", "c2"}))
+
+	// a paused rolling update finishes the current batch without starting the next one
+	updateTestSubscription(g, cl, rsubkey, func(sub *appv1alpha1.Subscription) { sub.Spec.RollingUpdate.Paused = true })
+	setClusterStatus(appv1alpha1.SubscriptionSubscribed, fresh, "c2")
+
+	sub = reconcileSub()
+	g.Expect(sub.Status.RollingUpdate.Phase).To(gomega.Equal(appv1alpha1.RollingUpdatePaused))
+	g.Expect(sub.Status.RollingUpdate.UpdatedClusters).To(gomega.Equal([]string{"c1", "c2"}))
+	g.Expect(sub.Status.RollingUpdate.CurrentBatch).To(gomega.BeEmpty())
+
+	_, overridden = getDeployable()
+	g.Expect(overridden).To(gomega.Equal([]string{"c1", "c2"}))
+
+	// the clusters are resolved from the placement at every reconcile
+	updateTestSubscription(g, cl, rsubkey, func(sub *appv1alpha1.Subscription) {
+		sub.Spec.RollingUpdate.Paused = false
+		sub.Spec.Placement = placementOfClusters([]string{"c1", "c2", "c3"})
+	})
+
+	sub = reconcileSub()
+	g.Expect(sub.Status.RollingUpdate.Phase).To(gomega.Equal(appv1alpha1.RollingUpdateProgressing))
+	g.Expect(sub.Status.RollingUpdate.Clusters).To(gomega.Equal([]string{"c1", "c2", "c3"}))
+	g.Expect(sub.Status.RollingUpdate.CurrentBatch).To(gomega.Equal([]string{"c3"}))
+
+	_, overridden = getDeployable()
+	g.Expect(overridden).To(gomega.Equal([]string{"c1", "c2", "c3"}))
+
+	// once all clusters are healthy, the subscription deployable carries the target template
+	setClusterStatus(appv1alpha1.SubscriptionSubscribed, fresh, "c3")
+
+	sub = reconcileSub()
+	g.Expect(sub.Status.RollingUpdate.Phase).To(gomega.Equal(appv1alpha1.RollingUpdateCompleted))
+
+	tpl, overridden = getDeployable()
+	g.Expect(tpl.Name).To(gomega.Equal(rsubkey.Name))
+	g.Expect(tpl.Spec.Package).To(gomega.Equal("v2"))
+	g.Expect(overridden).To(gomega.BeEmpty())
+}
+
+func TestDeleteFormerTargetDeployables(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cl, _ := newTestReconciler(g)
+
+	sub := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: "former-sub", Namespace: "default"},
+		Spec:       appv1alpha1.SubscriptionSpec{Channel: "default/former-chn"},
+	}
+	g.Expect(cl.Create(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), sub)
+
+	newdpl := func(name string) *dplv1alpha1.Deployable {
+		dpl := &dplv1alpha1.Deployable{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: sub.Namespace,
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "app.ibm.com/v1alpha1",
+					Kind:       "Subscription",
+					Name:       sub.Name,
+					UID:        sub.UID,
+				}},
+			},
+		}
+		dpl.Spec.Template = &runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"ConfigMap"}`)}
+
+		g.Expect(cl.Create(context.TODO(), dpl)).NotTo(gomega.HaveOccurred())
+
+		return dpl
+	}
+
+	target := newdpl(sub.Name + "-target-deployable")
+	dpl := newdpl(sub.Name + "-deployable")
+
+	defer cl.Delete(context.TODO(), dpl)
+
+	g.Expect(deleteFormerTargetDeployables(cl, cl)).To(gomega.Succeed())
+
+	// only the target deployable of the former rolling update is deleted
+	err := cl.Get(context.TODO(), types.NamespacedName{Name: target.Name, Namespace: target.Namespace}, target)
+	g.Expect(kerrors.IsNotFound(err)).To(gomega.BeTrue())
+	g.Expect(cl.Get(context.TODO(), types.NamespacedName{Name: dpl.Name, Namespace: dpl.Namespace}, dpl)).To(gomega.Succeed())
+}
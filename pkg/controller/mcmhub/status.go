@@ -0,0 +1,199 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+// addClusterToSummary counts the cluster by the state of the subscription propagated to it
+func addClusterToSummary(summary *appv1alpha1.SubscriptionSummary, st *dplv1alpha1.ResourceUnitStatus,
+	mcsubstatus *appv1alpha1.SubscriptionStatus) {
+	failedPkgs := 0
+
+	for _, clst := range mcsubstatus.Statuses {
+		if clst == nil {
+			continue
+		}
+
+		for pkg, pkgst := range clst.SubscriptionPackageStatus {
+			if pkgst == nil || pkgst.Phase != appv1alpha1.SubscriptionFailed {
+				continue
+			}
+
+			if summary.PackageFailures == nil {
+				summary.PackageFailures = make(map[string]int)
+			}
+
+			summary.PackageFailures[pkg]++
+			failedPkgs++
+		}
+	}
+
+	switch {
+	case st == nil:
+		summary.Unknown++
+	case st.Phase == dplv1alpha1.DeployableFailed || mcsubstatus.Phase == appv1alpha1.SubscriptionFailed || failedPkgs > 0:
+		summary.Failed++
+	case st.Phase == dplv1alpha1.DeployableDeployed && mcsubstatus.Phase == appv1alpha1.SubscriptionSubscribed:
+		summary.Subscribed++
+	case st.Phase != "":
+		summary.Pending++
+	default:
+		summary.Unknown++
+	}
+}
+
+// getSubscriptionConditions returns the Propagated, Ready and Degraded conditions of the hub subscription,
+// the transition time is kept from the existing conditions if the status does not change
+func getSubscriptionConditions(existing []appv1alpha1.SubscriptionCondition, found *dplv1alpha1.Deployable,
+	summary *appv1alpha1.SubscriptionSummary) []appv1alpha1.SubscriptionCondition {
+	total := summary.Subscribed + summary.Failed + summary.Pending + summary.Unknown
+
+	propagated := appv1alpha1.SubscriptionCondition{
+		Type:   appv1alpha1.SubscriptionPropagatedCondition,
+		Status: corev1.ConditionTrue,
+		Reason: "DeployableCreated",
+	}
+
+	if found != nil && found.Status.Phase == dplv1alpha1.DeployableFailed {
+		propagated.Status = corev1.ConditionFalse
+		propagated.Reason = "DeployableFailed"
+		propagated.Message = "Failed to propagate the subscription deployable " + found.Namespace + "/" + found.Name
+	}
+
+	ready := appv1alpha1.SubscriptionCondition{
+		Type:    appv1alpha1.SubscriptionReady,
+		Status:  corev1.ConditionFalse,
+		Reason:  "ClustersNotReady",
+		Message: strconv.Itoa(summary.Subscribed) + " of " + strconv.Itoa(total) + " clusters subscribed",
+	}
+
+	if total > 0 && summary.Subscribed == total {
+		ready.Status = corev1.ConditionTrue
+		ready.Reason = "AllClustersSubscribed"
+	}
+
+	degraded := appv1alpha1.SubscriptionCondition{
+		Type:   appv1alpha1.SubscriptionDegraded,
+		Status: corev1.ConditionFalse,
+		Reason: "NoFailedClusters",
+	}
+
+	if summary.Failed > 0 {
+		degraded.Status = corev1.ConditionTrue
+		degraded.Reason = "ClustersFailed"
+		degraded.Message = strconv.Itoa(summary.Failed) + " of " + strconv.Itoa(total) + " clusters failed"
+	}
+
+	conditions := []appv1alpha1.SubscriptionCondition{propagated, ready, degraded}
+
+	for i := range conditions {
+		conditions[i].LastTransitionTime = metav1.Now()
+
+		for _, cond := range existing {
+			if cond.Type == conditions[i].Type && cond.Status == conditions[i].Status {
+				conditions[i].LastTransitionTime = cond.LastTransitionTime
+			}
+		}
+	}
+
+	return conditions
+}
+
+func isStatusReportEnabled(sub *appv1alpha1.Subscription) bool {
+	return strings.EqualFold(sub.GetAnnotations()[appv1alpha1.AnnotationStatusReport], "true")
+}
+
+// updateSubscriptionReport keeps the per-cluster statuses in the SubscriptionReport of the subscription
+func (r *ReconcileSubscription) updateSubscriptionReport(sub *appv1alpha1.Subscription, statuses appv1alpha1.SubscriptionClusterStatusMap) error {
+	report := &appv1alpha1.SubscriptionReport{}
+	reportkey := types.NamespacedName{Name: sub.Name, Namespace: sub.Namespace}
+
+	err := r.Get(context.TODO(), reportkey, report)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Info("Failed to get subscription report ", reportkey, " error: ", err)
+			return err
+		}
+
+		report = &appv1alpha1.SubscriptionReport{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      sub.Name,
+				Namespace: sub.Namespace,
+			},
+			Statuses: statuses,
+		}
+
+		if err = controllerutil.SetControllerReference(sub, report, r.scheme); err != nil {
+			return err
+		}
+
+		klog.V(5).Info("Creating subscription report ", reportkey)
+
+		return r.Create(context.TODO(), report)
+	}
+
+	if reflect.DeepEqual(report.Statuses, statuses) {
+		return nil
+	}
+
+	report.Statuses = statuses
+
+	klog.V(5).Info("Updating subscription report ", reportkey)
+
+	return r.Update(context.TODO(), report)
+}
+
+// deleteSubscriptionReport deletes the SubscriptionReport owned by the subscription if any
+func (r *ReconcileSubscription) deleteSubscriptionReport(sub *appv1alpha1.Subscription) error {
+	report := &appv1alpha1.SubscriptionReport{}
+
+	err := r.Get(context.TODO(), types.NamespacedName{Name: sub.Name, Namespace: sub.Namespace}, report)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+
+		klog.Info("Failed to get subscription report of ", sub.Namespace, "/", sub.Name, " error: ", err)
+
+		return err
+	}
+
+	if !metav1.IsControlledBy(report, sub) {
+		return nil
+	}
+
+	err = r.Delete(context.TODO(), report)
+	if err != nil && !errors.IsNotFound(err) {
+		klog.Info("Failed to delete subscription report of ", sub.Namespace, "/", sub.Name, " error: ", err)
+		return err
+	}
+
+	return nil
+}
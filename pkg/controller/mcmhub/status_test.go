@@ -0,0 +1,176 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	"golang.org/x/net/context"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func TestSubscriptionSummary(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	summary := &appv1alpha1.SubscriptionSummary{}
+
+	deployed := &dplv1alpha1.ResourceUnitStatus{}
+	deployed.Phase = dplv1alpha1.DeployableDeployed
+
+	subscribed := &appv1alpha1.SubscriptionStatus{
+		Phase: appv1alpha1.SubscriptionSubscribed,
+		Statuses: appv1alpha1.SubscriptionClusterStatusMap{
+			"/": {
+				SubscriptionPackageStatus: map[string]*appv1alpha1.SubscriptionUnitStatus{
+					"nginx": {Phase: appv1alpha1.SubscriptionSubscribed},
+				},
+			},
+		},
+	}
+
+	failed := subscribed.DeepCopy()
+	failed.Statuses["/"].SubscriptionPackageStatus["mongodb"] = &appv1alpha1.SubscriptionUnitStatus{Phase: appv1alpha1.SubscriptionFailed}
+
+	addClusterToSummary(summary, deployed, subscribed)
+	addClusterToSummary(summary, deployed, failed)
+	addClusterToSummary(summary, deployed, &appv1alpha1.SubscriptionStatus{})
+	addClusterToSummary(summary, &dplv1alpha1.ResourceUnitStatus{}, &appv1alpha1.SubscriptionStatus{})
+
+	g.Expect(summary.Subscribed).To(gomega.Equal(1))
+	g.Expect(summary.Failed).To(gomega.Equal(1))
+	g.Expect(summary.Pending).To(gomega.Equal(1))
+	g.Expect(summary.Unknown).To(gomega.Equal(1))
+	g.Expect(summary.PackageFailures).To(gomega.Equal(map[string]int{"mongodb": 1}))
+
+	conditions := getSubscriptionConditions(nil, nil, summary)
+	g.Expect(conditions).To(gomega.HaveLen(3))
+
+	for _, cond := range conditions {
+		switch cond.Type {
+		case appv1alpha1.SubscriptionPropagatedCondition:
+			g.Expect(cond.Status).To(gomega.Equal(corev1.ConditionTrue))
+		case appv1alpha1.SubscriptionReady:
+			g.Expect(cond.Status).To(gomega.Equal(corev1.ConditionFalse))
+		case appv1alpha1.SubscriptionDegraded:
+			g.Expect(cond.Status).To(gomega.Equal(corev1.ConditionTrue))
+		}
+	}
+
+	// transition time is kept while the status does not change
+	again := getSubscriptionConditions(conditions, nil, summary)
+	g.Expect(again).To(gomega.Equal(conditions))
+}
+
+func TestSubscriptionReportReconcile(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cl, rec := newTestReconciler(g)
+
+	rchnkey := types.NamespacedName{Name: "report-chn", Namespace: "report-chn-namespace"}
+	rsubkey := types.NamespacedName{Name: "report-sub", Namespace: "report-sub-namespace"}
+	dplkey := types.NamespacedName{Name: rsubkey.Name + "-deployable", Namespace: rsubkey.Namespace}
+
+	chn := &chnv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{Name: rchnkey.Name, Namespace: rchnkey.Namespace},
+		Spec:       chnv1alpha1.ChannelSpec{Type: chnv1alpha1.ChannelTypeNamespace},
+	}
+	g.Expect(cl.Create(context.TODO(), chn)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), chn)
+
+	instance := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        rsubkey.Name,
+			Namespace:   rsubkey.Namespace,
+			Annotations: map[string]string{appv1alpha1.AnnotationStatusReport: "true"},
+		},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel:   rchnkey.String(),
+			Placement: placementOfClusters([]string{"c1"}),
+		},
+	}
+	g.Expect(cl.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), instance)
+	defer cl.Delete(context.TODO(), &dplv1alpha1.Deployable{ObjectMeta: metav1.ObjectMeta{Name: dplkey.Name, Namespace: dplkey.Namespace}})
+
+	// the first reconcile creates the subscription deployable, the next one collects its status
+	reconcileTestSubscription(g, cl, rec, rsubkey)
+
+	sub := reconcileTestSubscription(g, cl, rec, rsubkey)
+	g.Expect(sub.Status.Summary).NotTo(gomega.BeNil())
+	g.Expect(sub.Status.Summary.Report).To(gomega.Equal(rsubkey.Name))
+	g.Expect(cl.Get(context.TODO(), rsubkey, &appv1alpha1.SubscriptionReport{})).NotTo(gomega.HaveOccurred())
+
+	// the report recorded in status is deleted once the annotation is removed
+	updateTestSubscription(g, cl, rsubkey, func(sub *appv1alpha1.Subscription) { sub.SetAnnotations(nil) })
+
+	sub = reconcileTestSubscription(g, cl, rec, rsubkey)
+	g.Expect(sub.Status.Summary.Report).To(gomega.BeEmpty())
+
+	err := cl.Get(context.TODO(), rsubkey, &appv1alpha1.SubscriptionReport{})
+	g.Expect(errors.IsNotFound(err)).To(gomega.BeTrue())
+}
+
+func TestSubscriptionSummaryUnreportedClusters(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cl, rec := newTestReconciler(g)
+
+	uchnkey := types.NamespacedName{Name: "unreported-chn", Namespace: "unreported-chn-namespace"}
+	usubkey := types.NamespacedName{Name: "unreported-sub", Namespace: "unreported-sub-namespace"}
+	dplkey := types.NamespacedName{Name: usubkey.Name + "-deployable", Namespace: usubkey.Namespace}
+
+	chn := &chnv1alpha1.Channel{
+		ObjectMeta: metav1.ObjectMeta{Name: uchnkey.Name, Namespace: uchnkey.Namespace},
+		Spec:       chnv1alpha1.ChannelSpec{Type: chnv1alpha1.ChannelTypeNamespace},
+	}
+	g.Expect(cl.Create(context.TODO(), chn)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), chn)
+
+	instance := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: usubkey.Name, Namespace: usubkey.Namespace},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel:   uchnkey.String(),
+			Placement: placementOfClusters([]string{"c1", "c2"}),
+		},
+	}
+	g.Expect(cl.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+
+	defer cl.Delete(context.TODO(), instance)
+	defer cl.Delete(context.TODO(), &dplv1alpha1.Deployable{ObjectMeta: metav1.ObjectMeta{Name: dplkey.Name, Namespace: dplkey.Namespace}})
+
+	reconcileTestSubscription(g, cl, rec, usubkey)
+
+	// only c1 reported, c2 is placed but unknown
+	setTestClusterStatus(g, cl, dplkey, appv1alpha1.SubscriptionSubscribed, time.Now(), "c1")
+
+	sub := reconcileTestSubscription(g, cl, rec, usubkey)
+	g.Expect(sub.Status.Summary).NotTo(gomega.BeNil())
+	g.Expect(sub.Status.Summary.Subscribed).To(gomega.Equal(1))
+	g.Expect(sub.Status.Summary.Unknown).To(gomega.Equal(1))
+	g.Expect(sub.Status.Statuses).To(gomega.HaveKey("c1"))
+	g.Expect(sub.Status.Statuses).NotTo(gomega.HaveKey("c2"))
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"context"
+	"encoding/json"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+// suspendSubscription freezes a suspended hub subscription. The deployables propagated before are kept as they are,
+// only the suspend flag is set in their templates so the endpoint subscribers stop syncing, and the cluster status
+// keeps being collected
+func (r *ReconcileSubscription) suspendSubscription(sub *appv1alpha1.Subscription) error {
+	var found *dplv1alpha1.Deployable
+
+	for _, suffix := range []string{"-deployable", "-canary-deployable"} {
+		dpl := &dplv1alpha1.Deployable{}
+
+		err := r.Get(context.TODO(), types.NamespacedName{Name: sub.Name + suffix, Namespace: sub.Namespace}, dpl)
+		if err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+
+			return err
+		}
+
+		if suffix == "-deployable" {
+			found = dpl
+		}
+
+		changed, err := setTemplateSuspend(dpl, true)
+		if err != nil {
+			return err
+		}
+
+		if !changed {
+			continue
+		}
+
+		klog.Info("Suspending deployable ", dpl.Namespace, "/", dpl.Name, " of subscription ", sub.Namespace, "/", sub.Name)
+
+		err = r.Update(context.TODO(), dpl)
+
+		//record events
+		addtionalMsg := "Depolyable " + dpl.Namespace + "/" + dpl.Name + " suspended in the subscription namespace"
+		r.eventRecorder.RecordEvent(sub, "Suspend", addtionalMsg, err)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err := r.updateSubscriptionStatus(sub, found)
+
+	sub.Status.Phase = appv1alpha1.SubscriptionSuspended
+	sub.Status.Reason = "subscription is suspended, set spec.suspend to false to resume"
+
+	return err
+}
+
+// setTemplateSuspend sets the suspend flag of the subscription in the deployable template and in the overrides
+// replacing the whole spec for a cluster, returns true if it changed
+func setTemplateSuspend(dpl *dplv1alpha1.Deployable, suspend bool) (bool, error) {
+	if dpl.Spec.Template == nil {
+		return false, nil
+	}
+
+	tpl := &unstructured.Unstructured{}
+
+	err := json.Unmarshal(dpl.Spec.Template.Raw, tpl)
+	if err != nil {
+		klog.Info("Error in unmarshall, err:", err, " |template: ", string(dpl.Spec.Template.Raw))
+		return false, err
+	}
+
+	changed, err := setOverridesSuspend(dpl, suspend)
+	if err != nil {
+		return false, err
+	}
+
+	orgSuspend, _, err := unstructured.NestedBool(tpl.Object, "spec", "suspend")
+	if err != nil {
+		return false, err
+	}
+
+	if orgSuspend == suspend {
+		return changed, nil
+	}
+
+	err = unstructured.SetNestedField(tpl.Object, suspend, "spec", "suspend")
+	if err != nil {
+		return false, err
+	}
+
+	dpl.Spec.Template.Raw, err = json.Marshal(tpl)
+
+	return true, err
+}
+
+// setOverridesSuspend sets the suspend flag in the spec path overrides, such as the ones of the clusters moved
+// by a rolling update, returns true if any changed
+func setOverridesSuspend(dpl *dplv1alpha1.Deployable, suspend bool) (bool, error) {
+	changed := false
+
+	for i := range dpl.Spec.Overrides {
+		for j, cov := range dpl.Spec.Overrides[i].ClusterOverrides {
+			ov := make(map[string]interface{})
+
+			if err := json.Unmarshal(cov.RawExtension.Raw, &ov); err != nil {
+				continue
+			}
+
+			spec, ok := ov["value"].(map[string]interface{})
+			if ov["path"] != "spec" || !ok {
+				continue
+			}
+
+			if orgSuspend, _ := spec["suspend"].(bool); orgSuspend == suspend {
+				continue
+			}
+
+			spec["suspend"] = suspend
+
+			raw, err := json.Marshal(ov)
+			if err != nil {
+				return false, err
+			}
+
+			dpl.Spec.Overrides[i].ClusterOverrides[j].RawExtension.Raw = raw
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
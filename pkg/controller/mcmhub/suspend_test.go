@@ -0,0 +1,43 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcmhub
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+)
+
+func TestSuspendTemplate(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	dpl := &dplv1alpha1.Deployable{}
+	dpl.Spec.Template = &runtime.RawExtension{
+		Raw: []byte(`{"kind":"Subscription","spec":{"channel":"default/ch"}}`),
+	}
+
+	changed, err := setTemplateSuspend(dpl, true)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(changed).To(gomega.BeTrue())
+	g.Expect(string(dpl.Spec.Template.Raw)).To(gomega.Equal(`{"kind":"Subscription","spec":{"channel":"default/ch","suspend":true}}`))
+
+	// already suspended, nothing to update
+	changed, err = setTemplateSuspend(dpl, true)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(changed).To(gomega.BeFalse())
+}
@@ -0,0 +1,181 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils"
+)
+
+// syncCalendar copies the calendar of a subscription propagated from hub to the namespace of the subscription,
+// where the subscribers evaluate it. The calendar of a standalone subscription is already in its namespace.
+// A local configmap with the name of the calendar is taken over only if it was copied from hub
+func (r *ReconcileSubscription) syncCalendar(instance *appv1alpha1.Subscription) error {
+	calname := ""
+	hubsub := instance.GetAnnotations()[dplv1alpha1.AnnotationSubscription]
+
+	tw := instance.Spec.TimeWindow
+	if tw != nil && tw.Calendar != nil && r.hubclient != nil && hubsub != "" {
+		calname = tw.Calendar.Name
+	}
+
+	// the calendar may be renamed or removed from the subscription
+	err := r.deleteStaleCalendars(instance, calname)
+	if err != nil {
+		klog.Error("Failed to clean up stale calendars of subscription ", instance.Namespace, "/", instance.Name,
+			" with error: ", err)
+		return err
+	}
+
+	if calname == "" {
+		return nil
+	}
+
+	hubcal := &corev1.ConfigMap{}
+	hubkey := types.NamespacedName{Name: calname, Namespace: utils.NamespacedNameFormat(hubsub).Namespace}
+
+	err = r.hubclient.Get(context.TODO(), hubkey, hubcal)
+	if err != nil {
+		klog.Error("Failed to get calendar ", hubkey, " of subscription ", instance.Namespace, "/", instance.Name,
+			" from hub with error: ", err)
+		return err
+	}
+
+	cal := &corev1.ConfigMap{}
+	calkey := types.NamespacedName{Name: calname, Namespace: instance.Namespace}
+
+	err = r.Get(context.TODO(), calkey, cal)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		cal = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      calkey.Name,
+				Namespace: calkey.Namespace,
+				Labels:    map[string]string{CalendarReferredMarker + instance.Name: "true"},
+			},
+			Data: hubcal.Data,
+		}
+		cal.SetOwnerReferences(addObjectOwnedBySub(cal, instance))
+
+		klog.Info("Creating calendar ", calkey, " for subscription ", instance.Name, " from hub")
+
+		return r.Create(context.TODO(), cal)
+	}
+
+	// the hub is the managed cluster itself
+	if cal.UID == hubcal.UID {
+		return nil
+	}
+
+	if !isCalendarCopy(cal) && !isObjectOwnedBySub(cal, instance.Name) {
+		klog.Info("Configmap ", calkey, " is not a calendar copied from hub, leaving it to subscription ", instance.Name)
+		return nil
+	}
+
+	lbls := cal.GetLabels()
+	if lbls == nil {
+		lbls = make(map[string]string)
+	}
+
+	if reflect.DeepEqual(cal.Data, hubcal.Data) && lbls[CalendarReferredMarker+instance.Name] == "true" &&
+		isObjectOwnedBySub(cal, instance.Name) {
+		return nil
+	}
+
+	lbls[CalendarReferredMarker+instance.Name] = "true"
+	cal.SetLabels(lbls)
+	cal.SetOwnerReferences(addObjectOwnedBySub(cal, instance))
+	cal.Data = hubcal.Data
+
+	klog.Info("Updating calendar ", calkey, " for subscription ", instance.Name, " from hub")
+
+	return r.Update(context.TODO(), cal)
+}
+
+// deleteStaleCalendars releases the calendars copied from hub for the subscription except the one named keep,
+// the copies no other subscription owns are deleted
+func (r *ReconcileSubscription) deleteStaleCalendars(instance *appv1alpha1.Subscription, keep string) error {
+	marker := CalendarReferredMarker + instance.Name
+	opts := &client.ListOptions{
+		Namespace:     instance.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{marker: "true"}),
+	}
+
+	cals := &corev1.ConfigMapList{}
+
+	err := r.List(context.TODO(), cals, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range cals.Items {
+		if item.Name == keep {
+			continue
+		}
+
+		cal := item.DeepCopy()
+
+		lbls := cal.GetLabels()
+		delete(lbls, marker)
+		cal.SetLabels(lbls)
+		cal.SetOwnerReferences(deleteSubFromObjectOwnersByName(cal, instance.Name))
+
+		if len(cal.GetOwnerReferences()) == 0 {
+			klog.Info("Deleting calendar ", cal.Namespace, "/", cal.Name, " no longer used by subscription ", instance.Name)
+
+			err = r.Delete(context.TODO(), cal)
+			if err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+
+			continue
+		}
+
+		klog.Info("Releasing calendar ", cal.Namespace, "/", cal.Name, " no longer used by subscription ", instance.Name)
+
+		err = r.Update(context.TODO(), cal)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isCalendarCopy(cal *corev1.ConfigMap) bool {
+	for k := range cal.GetLabels() {
+		if strings.HasPrefix(k, CalendarReferredMarker) {
+			return true
+		}
+	}
+
+	return false
+}
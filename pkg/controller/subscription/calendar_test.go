@@ -0,0 +1,106 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func TestSyncCalendar(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// the same cluster plays the hub, the hub calendars are in the namespace of the hub subscription
+	rec := &ReconcileSubscription{Client: clt, hubclient: clt}
+
+	hubns := "ns-cal-hub"
+	hubdata := map[string]string{"windows": "hub"}
+
+	for _, name := range []string{"cal-a", "cal-b"} {
+		hubcal := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: hubns},
+			Data:       hubdata,
+		}
+		g.Expect(clt.Create(context.TODO(), hubcal)).To(gomega.Succeed())
+
+		defer clt.Delete(context.TODO(), hubcal)
+	}
+
+	sub := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "cal-sub",
+			Namespace:   nssubTest,
+			UID:         types.UID("cal-sub-uid"),
+			Annotations: map[string]string{dplv1alpha1.AnnotationSubscription: hubns + "/cal-sub"},
+		},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel: chKey.String(),
+			TimeWindow: &appv1alpha1.TimeWindow{
+				Calendar: &appv1alpha1.CalendarReference{Name: "cal-a"},
+			},
+		},
+	}
+
+	// a local configmap not copied from hub is left alone
+	localdata := map[string]string{"windows": "local"}
+	local := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "cal-a", Namespace: nssubTest},
+		Data:       localdata,
+	}
+	g.Expect(clt.Create(context.TODO(), local)).To(gomega.Succeed())
+
+	defer clt.Delete(context.TODO(), local)
+
+	g.Expect(rec.syncCalendar(sub)).To(gomega.Succeed())
+
+	cal := &corev1.ConfigMap{}
+	g.Expect(clt.Get(context.TODO(), types.NamespacedName{Name: "cal-a", Namespace: nssubTest}, cal)).To(gomega.Succeed())
+	g.Expect(cal.Data).To(gomega.Equal(localdata))
+	g.Expect(cal.GetLabels()).NotTo(gomega.HaveKey(CalendarReferredMarker + sub.Name))
+	g.Expect(cal.GetOwnerReferences()).To(gomega.BeEmpty())
+
+	// a calendar missing locally is copied from hub
+	sub.Spec.TimeWindow.Calendar.Name = "cal-b"
+	g.Expect(rec.syncCalendar(sub)).To(gomega.Succeed())
+
+	calb := types.NamespacedName{Name: "cal-b", Namespace: nssubTest}
+	g.Expect(clt.Get(context.TODO(), calb, cal)).To(gomega.Succeed())
+	g.Expect(cal.Data).To(gomega.Equal(hubdata))
+	g.Expect(cal.GetLabels()).To(gomega.HaveKeyWithValue(CalendarReferredMarker+sub.Name, "true"))
+	g.Expect(isObjectOwnedBySub(cal, sub.Name)).To(gomega.BeTrue())
+
+	// the copy is deleted once the calendar is removed from the subscription
+	sub.Spec.TimeWindow.Calendar = nil
+	g.Expect(rec.syncCalendar(sub)).To(gomega.Succeed())
+
+	err = clt.Get(context.TODO(), calb, cal)
+	g.Expect(errors.IsNotFound(err)).To(gomega.BeTrue())
+
+	g.Expect(clt.Get(context.TODO(), types.NamespacedName{Name: "cal-a", Namespace: nssubTest}, cal)).To(gomega.Succeed())
+	g.Expect(cal.Data).To(gomega.Equal(localdata))
+}
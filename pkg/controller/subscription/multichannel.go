@@ -0,0 +1,208 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils"
+)
+
+// doMultiChannelReconcile subscribes each channel of the channel list with a per-channel subscription owned by the
+// instance. The later channel takes over the resources of a package with the same name in the channels before,
+// and its package status replaces the one of the channels before in the instance status
+func (r *ReconcileSubscription) doMultiChannelReconcile(instance *appv1alpha1.Subscription) error {
+	// the channels are subscribed by the per-channel subscriptions only
+	for _, sub := range r.subscribers {
+		_ = sub.UnsubscribeItem(types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace})
+	}
+
+	chns := utils.GetSubscriptionChannels(instance)
+	children := make(map[string]bool)
+
+	var chsubs []*appv1alpha1.Subscription
+
+	for i, chn := range chns {
+		chsub, err := r.applyChannelSubscription(instance, chn, i)
+		if err != nil {
+			return err
+		}
+
+		children[chsub.Name] = true
+
+		chsubs = append(chsubs, chsub)
+	}
+
+	err := r.deleteStaleChannelSubscriptions(instance, children)
+	if err != nil {
+		return err
+	}
+
+	mergeChannelSubscriptionStatus(instance, chsubs)
+
+	return nil
+}
+
+func getChannelSubscriptionName(instance *appv1alpha1.Subscription, precedence int) string {
+	return instance.Name + "-channel-" + strconv.Itoa(precedence)
+}
+
+// applyChannelSubscription creates or updates the per-channel subscription at the precedence of the channel list
+func (r *ReconcileSubscription) applyChannelSubscription(instance *appv1alpha1.Subscription, chn types.NamespacedName,
+	precedence int) (*appv1alpha1.Subscription, error) {
+	chsub := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      getChannelSubscriptionName(instance, precedence),
+			Namespace: instance.Namespace,
+		},
+	}
+
+	instance.Spec.DeepCopyInto(&chsub.Spec)
+	chsub.Spec.Channel = chn.String()
+	chsub.Spec.Channels = nil
+
+	lbls := make(map[string]string)
+	for k, v := range instance.GetLabels() {
+		lbls[k] = v
+	}
+
+	lbls[appv1alpha1.LabelChannelOf] = instance.Name
+	chsub.SetLabels(lbls)
+
+	annotations := make(map[string]string)
+	for k, v := range instance.GetAnnotations() {
+		annotations[k] = v
+	}
+
+	annotations[appv1alpha1.AnnotationChannelPrecedence] = strconv.Itoa(precedence)
+	chsub.SetAnnotations(annotations)
+
+	err := controllerutil.SetControllerReference(instance, chsub, r.scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	found := &appv1alpha1.Subscription{}
+
+	err = r.Get(context.TODO(), types.NamespacedName{Name: chsub.Name, Namespace: chsub.Namespace}, found)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return nil, err
+		}
+
+		klog.Info("Creating subscription ", chsub.Namespace, "/", chsub.Name, " for channel ", chn, " of subscription ",
+			instance.Namespace, "/", instance.Name)
+
+		err = r.Create(context.TODO(), chsub)
+
+		return chsub, err
+	}
+
+	if reflect.DeepEqual(found.Spec, chsub.Spec) && reflect.DeepEqual(found.GetLabels(), chsub.GetLabels()) &&
+		reflect.DeepEqual(found.GetAnnotations(), chsub.GetAnnotations()) {
+		return found, nil
+	}
+
+	klog.Info("Updating subscription ", chsub.Namespace, "/", chsub.Name, " for channel ", chn, " of subscription ",
+		instance.Namespace, "/", instance.Name)
+
+	found.SetLabels(chsub.GetLabels())
+	found.SetAnnotations(chsub.GetAnnotations())
+	found.SetOwnerReferences(chsub.GetOwnerReferences())
+	chsub.Spec.DeepCopyInto(&found.Spec)
+
+	err = r.Update(context.TODO(), found)
+
+	return found, err
+}
+
+// deleteStaleChannelSubscriptions deletes the per-channel subscriptions of channels removed from the channel list
+func (r *ReconcileSubscription) deleteStaleChannelSubscriptions(instance *appv1alpha1.Subscription, children map[string]bool) error {
+	chsublist := &appv1alpha1.SubscriptionList{}
+
+	listOptions := &client.ListOptions{
+		Namespace:     instance.Namespace,
+		LabelSelector: labels.SelectorFromSet(labels.Set{appv1alpha1.LabelChannelOf: instance.Name}),
+	}
+
+	err := r.List(context.TODO(), chsublist, listOptions)
+	if err != nil {
+		return err
+	}
+
+	for i := range chsublist.Items {
+		chsub := &chsublist.Items[i]
+
+		if children[chsub.Name] || !metav1.IsControlledBy(chsub, instance) {
+			continue
+		}
+
+		klog.Info("Deleting subscription ", chsub.Namespace, "/", chsub.Name, " of a channel removed from subscription ",
+			instance.Namespace, "/", instance.Name)
+
+		err = r.Delete(context.TODO(), chsub)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mergeChannelSubscriptionStatus merges the package status of the per-channel subscriptions in increasing precedence
+func mergeChannelSubscriptionStatus(instance *appv1alpha1.Subscription, chsubs []*appv1alpha1.Subscription) {
+	sort.SliceStable(chsubs, func(i, j int) bool {
+		return utils.GetChannelPrecedence(chsubs[i]) < utils.GetChannelPrecedence(chsubs[j])
+	})
+
+	localkey := types.NamespacedName{}.String()
+	pkgstatus := make(map[string]*appv1alpha1.SubscriptionUnitStatus)
+
+	for _, chsub := range chsubs {
+		clst, ok := chsub.Status.Statuses[localkey]
+		if !ok || clst == nil {
+			continue
+		}
+
+		for pkg, st := range clst.SubscriptionPackageStatus {
+			if st != nil {
+				pkgstatus[pkg] = st.DeepCopy()
+			}
+		}
+	}
+
+	if instance.Status.Statuses == nil {
+		instance.Status.Statuses = make(appv1alpha1.SubscriptionClusterStatusMap)
+	}
+
+	if len(pkgstatus) == 0 {
+		delete(instance.Status.Statuses, localkey)
+		return
+	}
+
+	instance.Status.Statuses[localkey] = &appv1alpha1.SubscriptionPerClusterStatus{SubscriptionPackageStatus: pkgstatus}
+}
@@ -0,0 +1,64 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func newChannelSubscription(precedence int, pkgs map[string]appv1alpha1.SubscriptionPhase) *appv1alpha1.Subscription {
+	chsub := &appv1alpha1.Subscription{}
+	chsub.SetLabels(map[string]string{appv1alpha1.LabelChannelOf: "app"})
+	chsub.SetAnnotations(map[string]string{appv1alpha1.AnnotationChannelPrecedence: strconv.Itoa(precedence)})
+
+	pkgstatus := make(map[string]*appv1alpha1.SubscriptionUnitStatus)
+	for pkg, phase := range pkgs {
+		pkgstatus[pkg] = &appv1alpha1.SubscriptionUnitStatus{Phase: phase}
+	}
+
+	chsub.Status.Statuses = appv1alpha1.SubscriptionClusterStatusMap{
+		types.NamespacedName{}.String(): &appv1alpha1.SubscriptionPerClusterStatus{SubscriptionPackageStatus: pkgstatus},
+	}
+
+	return chsub
+}
+
+func TestMergeChannelSubscriptionStatus(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	base := newChannelSubscription(0, map[string]appv1alpha1.SubscriptionPhase{
+		"nginx":   appv1alpha1.SubscriptionFailed,
+		"mongodb": appv1alpha1.SubscriptionSubscribed,
+	})
+	env := newChannelSubscription(1, map[string]appv1alpha1.SubscriptionPhase{
+		"nginx": appv1alpha1.SubscriptionSubscribed,
+	})
+
+	instance := &appv1alpha1.Subscription{}
+
+	// the later channel replaces the package status of the same name whatever the order given
+	mergeChannelSubscriptionStatus(instance, []*appv1alpha1.Subscription{env, base})
+
+	pkgstatus := instance.Status.Statuses[types.NamespacedName{}.String()].SubscriptionPackageStatus
+	g.Expect(pkgstatus).To(gomega.HaveLen(2))
+	g.Expect(pkgstatus["nginx"].Phase).To(gomega.Equal(appv1alpha1.SubscriptionSubscribed))
+	g.Expect(pkgstatus["mongodb"].Phase).To(gomega.Equal(appv1alpha1.SubscriptionSubscribed))
+}
@@ -38,6 +38,10 @@ var SubscriptionGVK = schema.GroupVersionKind{Group: "app.ibm.com", Kind: "Subsc
 //SercertReferredMarker is used as a label key to filter out the secert coming from reference
 var SercertReferredMarker = "IsReferredBySub-"
 
+//CalendarReferredMarker is used as a label key to mark the calendar copied from hub for the subscription,
+//the calendars are not the configmaps referred by the package filter and are left alone by DeleteReferredObjects
+var CalendarReferredMarker = "IsCalendarOfSub-"
+
 type referredObject interface {
 	runtime.Object
 	metav1.Object
@@ -16,6 +16,7 @@ package subscription
 
 import (
 	"context"
+	"reflect"
 	"strings"
 	"time"
 
@@ -29,8 +30,10 @@ import (
 	"k8s.io/klog"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
@@ -101,6 +104,38 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	// Watch the calendars referred by subscriptions
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: &utils.CalendarMapper{Client: mgr.GetClient()},
+	}, utils.CalendarPredicateFunctions)
+	if err != nil {
+		return err
+	}
+
+	// Watch the helm values ConfigMaps referred by subscriptions
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: &utils.HelmValuesMapper{Client: mgr.GetClient()},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Watch the status of the per-channel subscriptions of a subscription with channel list
+	err = c.Watch(&source.Kind{Type: &appv1alpha1.Subscription{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &appv1alpha1.Subscription{},
+	}, predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			newsub := e.ObjectNew.(*appv1alpha1.Subscription)
+			oldsub := e.ObjectOld.(*appv1alpha1.Subscription)
+
+			return newsub.Status.Phase != oldsub.Status.Phase || !reflect.DeepEqual(newsub.Status.Statuses, oldsub.Status.Statuses)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -154,14 +189,56 @@ func (r *ReconcileSubscription) Reconcile(request reconcile.Request) (reconcile.
 		return reconcile.Result{}, err
 	}
 
+	result := reconcile.Result{}
+
 	pl := instance.Spec.Placement
 	if pl != nil && pl.Local != nil && *pl.Local {
-		err = r.doReconcile(instance)
+		// the subscribers hold off until the calendar is available
+		if cerr := r.syncCalendar(instance); cerr != nil {
+			klog.Error("Failed to sync calendar of subscription ", request.NamespacedName, " with error: ", cerr)
+		}
+
+		if utils.IsMultiChannelSubscription(instance) {
+			err = r.doMultiChannelReconcile(instance)
+		} else {
+			err = r.doReconcile(instance)
+		}
+
+		if instance.Status.Phase == appv1alpha1.SubscriptionWaitingForDependency ||
+			instance.Status.Phase == appv1alpha1.SubscriptionSuspended {
+			instance.Status.Reason = ""
+		}
 
 		instance.Status.Phase = appv1alpha1.SubscriptionSubscribed
 		if err != nil {
 			instance.Status.Phase = appv1alpha1.SubscriptionFailed
 			instance.Status.Reason = err.Error()
+		} else if instance.Spec.Suspend {
+			// the subscribers keep the resources deployed but stop syncing
+			instance.Status.Phase = appv1alpha1.SubscriptionSuspended
+			instance.Status.Reason = "subscription is suspended, set spec.suspend to false to resume"
+		} else {
+			// the subscribers hold off until the subscriptions in dependsOn are healthy
+			blocking, derr := utils.GetBlockingDependency(r.Client, instance)
+
+			switch {
+			case derr != nil:
+				instance.Status.Phase = appv1alpha1.SubscriptionFailed
+				instance.Status.Reason = derr.Error()
+			case blocking != "":
+				instance.Status.Phase = appv1alpha1.SubscriptionWaitingForDependency
+				instance.Status.Reason = "waiting for subscription " + blocking
+				result.RequeueAfter = utils.DependencyRequeueInterval
+			}
+		}
+
+		// refresh the time window state when it changes
+		instance.Status.TimeWindow = utils.GetTimeWindowStatus(r.Client, instance, time.Now())
+		if tws := instance.Status.TimeWindow; tws != nil && tws.NextTransitionTime != nil {
+			nextTransition := time.Until(tws.NextTransitionTime.Time) + time.Second
+			if result.RequeueAfter == 0 || nextTransition < result.RequeueAfter {
+				result.RequeueAfter = nextTransition
+			}
 		}
 	} else {
 		// no longer local
@@ -169,6 +246,11 @@ func (r *ReconcileSubscription) Reconcile(request reconcile.Request) (reconcile.
 			_ = sub.UnsubscribeItem(request.NamespacedName)
 		}
 
+		err = r.deleteStaleChannelSubscriptions(instance, nil)
+		if err != nil {
+			klog.Error("Failed to delete the per-channel subscriptions of ", request.NamespacedName, " with error: ", err)
+		}
+
 		if instance.Status.Phase == appv1alpha1.SubscriptionFailed || instance.Status.Phase == appv1alpha1.SubscriptionSubscribed {
 			instance.Status.Phase = ""
 			instance.Status.Message = ""
@@ -178,14 +260,14 @@ func (r *ReconcileSubscription) Reconcile(request reconcile.Request) (reconcile.
 		if instance.Status.Statuses != nil {
 			delete(instance.Status.Statuses, types.NamespacedName{}.String())
 		}
+
+		instance.Status.TimeWindow = nil
 	}
 
 	instance.Status.LastUpdateTime = metav1.Now()
 
 	err = r.Status().Update(context.TODO(), instance)
 
-	result := reconcile.Result{}
-
 	if err != nil {
 		klog.Error("Failed to update status for subscription ", request.NamespacedName, " with error: ", err, " retry after 1 seconds")
 
@@ -224,6 +306,20 @@ func (r *ReconcileSubscription) doReconcile(instance *appv1alpha1.Subscription)
 		}
 	}
 
+	if instance.Spec.HelmValuesRef != nil {
+		subitem.HelmValuesConfigMap = &corev1.ConfigMap{}
+		valuescfgkey := types.NamespacedName{
+			Name:      instance.Spec.HelmValuesRef.Name,
+			Namespace: instance.Namespace,
+		}
+
+		err = r.Get(context.TODO(), valuescfgkey, subitem.HelmValuesConfigMap)
+		if err != nil {
+			klog.Error("Failed to get helm values configmap of subscription, error: ", err)
+			return err
+		}
+	}
+
 	if subitem.Channel.Spec.SecretRef != nil {
 		subitem.ChannelSecret = &corev1.Secret{}
 		chnseckey := types.NamespacedName{
@@ -16,13 +16,18 @@ package github
 
 import (
 	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/ghodss/yaml"
 	"github.com/onsi/gomega"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -32,6 +37,7 @@ import (
 
 	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils/timewindowtest"
 )
 
 const rsc1 = `apiVersion: v1
@@ -619,3 +625,58 @@ data:
 	githubsub.Spec.Package = ""
 	githubsub.Spec.PackageFilter = nil
 }
+
+func TestGitHubSubscriberTimeWindows(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mgr, err := manager.New(cfg, manager.Options{MetricsBindAddress: "0"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(Add(mgr, cfg, &id, 2)).NotTo(gomega.HaveOccurred())
+	stopMgr, mgrStopped := StartTestManager(mgr, g)
+
+	defer func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+	}()
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	repo := newLocalGitRepo(g)
+	defer os.RemoveAll(repo)
+
+	timewindowtest.Run(t, clt, githubsub, func(sub *appv1alpha1.Subscription) time.Duration {
+		chn := githubchn.DeepCopy()
+		chn.Name = "timewindow"
+		chn.Spec.PathName = repo
+
+		ghsi := &SubscriberItem{synchronizer: defaultSubscriber.synchronizer}
+		ghsi.Subscription = sub
+		ghsi.Channel = chn
+
+		return ghsi.syncOnce()
+	})
+}
+
+// newLocalGitRepo creates a git repo with a single commit on master in a temporary directory
+func newLocalGitRepo(g *gomega.GomegaWithT) string {
+	dir, err := ioutil.TempDir("", "timewindow")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	r, err := git.PlainInit(dir, false)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	w, err := r.Worktree()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("time windows\n"), 0600)).NotTo(gomega.HaveOccurred())
+
+	_, err = w.Add("README.md")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	_, err = w.Commit("init", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	return dir
+}
@@ -28,15 +28,16 @@ import (
 	"github.com/blang/semver"
 	"github.com/ghodss/yaml"
 	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/helm/pkg/chartutil"
 	"k8s.io/helm/pkg/repo"
 	"k8s.io/klog"
@@ -46,7 +47,6 @@ import (
 	gitignore "github.com/sabhiram/go-gitignore"
 
 	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
-	dplutils "github.com/IBM/multicloud-operators-deployable/pkg/utils"
 	releasev1alpha1 "github.com/IBM/multicloud-operators-subscription-release/pkg/apis/app/v1alpha1"
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
 	kubesynchronizer "github.com/IBM/multicloud-operators-subscription/pkg/synchronizer/kubernetes"
@@ -76,6 +76,7 @@ type SubscriberItem struct {
 	rbacFiles             []string
 	otherFiles            []string
 	indexFile             *repo.IndexFile
+	droppedCharts         map[string]error
 }
 
 type kubeResource struct {
@@ -93,23 +94,72 @@ func (ghsi *SubscriberItem) Start() {
 
 	ghsi.stopch = make(chan struct{})
 
-	go wait.Until(func() {
-		tw := ghsi.SubscriberItem.Subscription.Spec.TimeWindow
-		if tw != nil {
-			nextRun := utils.NextStartPoint(tw, time.Now())
-			if nextRun > time.Duration(0) {
-				klog.V(1).Infof("Subcription %v/%v will de deploy after %v",
-					ghsi.SubscriberItem.Subscription.GetNamespace(),
-					ghsi.SubscriberItem.Subscription.GetName(), nextRun)
-				return
-			}
-		}
+	go utils.SyncUntil(ghsi.syncOnce, time.Duration(ghsi.syncinterval)*time.Second, ghsi.stopch)
+}
 
-		err := ghsi.doSubscription()
-		if err != nil {
-			klog.Error(err, "Subscription error.")
+// syncOnce runs one round of the subscriber loop, returns how long the loop holds off for the time window
+func (ghsi *SubscriberItem) syncOnce() time.Duration {
+	if nextRun := utils.TimeWindowHoldOff(ghsi.synchronizer.LocalClient, ghsi.SubscriberItem.Subscription, ghsi.repoChanged); nextRun > 0 {
+		return nextRun
+	}
+
+	if ghsi.SubscriberItem.Subscription.Spec.Suspend {
+		klog.V(1).Infof("Subscription %v/%v is suspended",
+			ghsi.SubscriberItem.Subscription.GetNamespace(), ghsi.SubscriberItem.Subscription.GetName())
+		return time.Duration(0)
+	}
+
+	if utils.IsWaitingForDependency(ghsi.synchronizer.LocalClient, ghsi.SubscriberItem.Subscription) {
+		return time.Duration(0)
+	}
+
+	if utils.IsWaitingForApproval(ghsi.SubscriberItem.Subscription, ghsi.SubscriberItem.Channel, nil) {
+		return time.Duration(0)
+	}
+
+	err := ghsi.doSubscription()
+	if err != nil {
+		klog.Error(err, "Subscription error.")
+		return time.Duration(0)
+	}
+
+	_ = utils.ClearTimeWindowPending(ghsi.synchronizer.LocalClient, ghsi.SubscriberItem.Subscription)
+
+	return time.Duration(0)
+}
+
+// repoChanged checks whether the head of the subscribed branch moved since the last sync, without cloning the repo
+func (ghsi *SubscriberItem) repoChanged() bool {
+	auth, err := ghsi.getGitAuth()
+	if err != nil {
+		return false
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{ghsi.Channel.Spec.PathName},
+	})
+
+	options := &git.ListOptions{}
+	if auth != nil {
+		options.Auth = auth
+	}
+
+	refs, err := remote.List(options)
+	if err != nil {
+		klog.Error(err, "Failed to list the references of the git repo ", ghsi.Channel.Spec.PathName)
+		return false
+	}
+
+	branch := ghsi.getGitBranch()
+
+	for _, ref := range refs {
+		if ref.Name() == branch {
+			return ref.Hash().String() != ghsi.commitID
 		}
-	}, time.Duration(ghsi.syncinterval)*time.Second, ghsi.stopch)
+	}
+
+	return false
 }
 
 // Stop unsubscribes a subscriber item with namespace channel
@@ -472,11 +522,11 @@ func (ghsi *SubscriberItem) subscribeHelmCharts(indexFile *repo.IndexFile) (err
 		}
 
 		dpl := &dplv1alpha1.Deployable{}
+		dpl.Name = ghsi.packageStatusName(packageName, chartVersions[0].GetVersion())
+
 		if ghsi.Channel == nil {
-			dpl.Name = ghsi.Subscription.Name + "-" + packageName + "-" + chartVersions[0].GetVersion()
 			dpl.Namespace = ghsi.Subscription.Namespace
 		} else {
-			dpl.Name = ghsi.Channel.Name + "-" + packageName + "-" + chartVersions[0].GetVersion()
 			dpl.Namespace = ghsi.Channel.Namespace
 		}
 
@@ -513,12 +563,16 @@ func (ghsi *SubscriberItem) subscribeHelmCharts(indexFile *repo.IndexFile) (err
 		pkgMap[dplkey.Name] = true
 	}
 
+	utils.SetDroppedPackagesStatus(&ghsi.Subscription.Status, ghsi.droppedCharts, pkgMap)
+
 	if utils.ValidatePackagesInSubscriptionStatus(ghsi.synchronizer.LocalClient, ghsi.Subscription, pkgMap) != nil {
 		err = ghsi.synchronizer.LocalClient.Get(context.TODO(), hostkey, ghsi.Subscription)
 		if err != nil {
 			klog.Error("Failed to get subscription resource with error:", err)
 		}
 
+		utils.SetDroppedPackagesStatus(&ghsi.Subscription.Status, ghsi.droppedCharts, pkgMap)
+
 		err = utils.ValidatePackagesInSubscriptionStatus(ghsi.synchronizer.LocalClient, ghsi.Subscription, pkgMap)
 	}
 
@@ -534,45 +588,13 @@ func (ghsi *SubscriberItem) cloneGitRepo() (commitID string, err error) {
 		ReferenceName:     ghsi.getGitBranch(),
 	}
 
-	if ghsi.Channel.Spec.SecretRef != nil {
-		secret := &corev1.Secret{}
-		secns := ghsi.Channel.Spec.SecretRef.Namespace
-
-		if secns == "" {
-			secns = ghsi.Channel.Namespace
-		}
-
-		err := ghsi.synchronizer.LocalClient.Get(context.TODO(), types.NamespacedName{Name: ghsi.Channel.Spec.SecretRef.Name, Namespace: secns}, secret)
-		if err != nil {
-			klog.Error(err, "Unable to get secret.")
-			return "", err
-		}
-
-		username := ""
-		accessToken := ""
-
-		err = yaml.Unmarshal(secret.Data[UserID], &username)
-		if err != nil {
-			klog.Error(err, "Failed to unmarshal username from the secret.")
-			return "", err
-		} else if username == "" {
-			klog.Error(err, "Failed to get user from the secret.")
-			return "", errors.New("failed to get user from the secret")
-		}
-
-		err = yaml.Unmarshal(secret.Data[AccessToken], &accessToken)
-		if err != nil {
-			klog.Error(err, "Failed to unmarshal accessToken from the secret.")
-			return "", err
-		} else if accessToken == "" {
-			klog.Error(err, "Failed to get accressToken from the secret.")
-			return "", errors.New("failed to get accressToken from the secret")
-		}
+	auth, err := ghsi.getGitAuth()
+	if err != nil {
+		return "", err
+	}
 
-		options.Auth = &githttp.BasicAuth{
-			Username: username,
-			Password: accessToken,
-		}
+	if auth != nil {
+		options.Auth = auth
 	}
 
 	ghsi.repoRoot = filepath.Join(os.TempDir(), ghsi.Channel.Namespace, ghsi.Channel.Name)
@@ -613,6 +635,52 @@ func (ghsi *SubscriberItem) cloneGitRepo() (commitID string, err error) {
 	return commit.ID().String(), nil
 }
 
+// getGitAuth reads the user and access token of the git repo from the channel secret, nil if there is no secret
+func (ghsi *SubscriberItem) getGitAuth() (*githttp.BasicAuth, error) {
+	if ghsi.Channel.Spec.SecretRef == nil {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	secns := ghsi.Channel.Spec.SecretRef.Namespace
+
+	if secns == "" {
+		secns = ghsi.Channel.Namespace
+	}
+
+	err := ghsi.synchronizer.LocalClient.Get(context.TODO(), types.NamespacedName{Name: ghsi.Channel.Spec.SecretRef.Name, Namespace: secns}, secret)
+	if err != nil {
+		klog.Error(err, "Unable to get secret.")
+		return nil, err
+	}
+
+	username := ""
+	accessToken := ""
+
+	err = yaml.Unmarshal(secret.Data[UserID], &username)
+	if err != nil {
+		klog.Error(err, "Failed to unmarshal username from the secret.")
+		return nil, err
+	} else if username == "" {
+		klog.Error(err, "Failed to get user from the secret.")
+		return nil, errors.New("failed to get user from the secret")
+	}
+
+	err = yaml.Unmarshal(secret.Data[AccessToken], &accessToken)
+	if err != nil {
+		klog.Error(err, "Failed to unmarshal accessToken from the secret.")
+		return nil, err
+	} else if accessToken == "" {
+		klog.Error(err, "Failed to get accressToken from the secret.")
+		return nil, errors.New("failed to get accressToken from the secret")
+	}
+
+	return &githttp.BasicAuth{
+		Username: username,
+		Password: accessToken,
+	}, nil
+}
+
 func (ghsi *SubscriberItem) getGitBranch() plumbing.ReferenceName {
 	branch := plumbing.Master
 
@@ -821,6 +889,7 @@ func (ghsi *SubscriberItem) getOverrides(packageName string) dplv1alpha1.Overrid
 	return dploverrides
 }
 
+// override applies the package overrides of the subscription and the layered helm values on the helm release
 func (ghsi *SubscriberItem) override(helmRelease *releasev1alpha1.HelmRelease) error {
 	//Overrides with the values provided in the subscription for that package
 	overrides := ghsi.getOverrides(helmRelease.Spec.ChartName)
@@ -838,7 +907,8 @@ func (ghsi *SubscriberItem) override(helmRelease *releasev1alpha1.HelmRelease) e
 		klog.Warning("Processing local deployable with error template:", helmRelease, err)
 	}
 
-	template, err = dplutils.OverrideTemplate(template, overrides.ClusterOverrides)
+	template, err = utils.OverrideHelmRelease(template, helmRelease.Spec.ChartName, ghsi.ChannelConfigMap,
+		overrides.ClusterOverrides, ghsi.HelmValuesConfigMap)
 
 	if err != nil {
 		klog.Error("Failed to apply override for instance: ")
@@ -869,6 +939,72 @@ func (ghsi *SubscriberItem) filterCharts(indexFile *repo.IndexFile) {
 
 	//Removes non matching version, tillerVersion, digest
 	ghsi.filterOnVersion(indexFile)
+
+	//Keep only the version picked by the version policies if multiple remains after filtering.
+	ghsi.takeVersion(indexFile)
+}
+
+//takeVersion if the indexFile contains multiple versions for a given chart, then
+//only the version picked by the version policies of the subscription is kept.
+//The index is generated from the repo at clone time, so the charts have no creation time to soak.
+//The charts dropped by the pinned policy are kept in droppedCharts with the reason, keyed by their package status name.
+func (ghsi *SubscriberItem) takeVersion(indexFile *repo.IndexFile) {
+	var filter *appv1alpha1.PackageFilter
+	if ghsi.Subscription != nil {
+		filter = ghsi.Subscription.Spec.PackageFilter
+	}
+
+	ghsi.droppedCharts = make(map[string]error)
+
+	for k, chartVersions := range indexFile.Entries {
+		candidates := make([]utils.VersionCandidate, len(chartVersions))
+		for i, chartVersion := range chartVersions {
+			candidates[i] = utils.VersionCandidate{Version: chartVersion.GetVersion()}
+		}
+
+		current := ""
+
+		if ghsi.Subscription != nil && ghsi.synchronizer != nil {
+			var err error
+
+			current, err = utils.GetDeployedChartVersion(ghsi.synchronizer.LocalClient, ghsi.Subscription, k)
+			if err != nil {
+				klog.Info("Keeping chart ", k, " out of this sync, its deployed version is unknown")
+				delete(indexFile.Entries, k)
+
+				continue
+			}
+		}
+
+		picked, err := utils.SelectVersion(filter, candidates, current, time.Now())
+		if err != nil {
+			klog.Info("Dropping chart ", k, ": ", err)
+			ghsi.droppedCharts[ghsi.packageStatusName(k, current)] = err
+			delete(indexFile.Entries, k)
+
+			continue
+		}
+
+		if picked < 0 {
+			klog.V(3).Info("No version of chart ", k, " passed the version policies")
+			delete(indexFile.Entries, k)
+
+			continue
+		}
+
+		indexFile.Entries[k] = []*repo.ChartVersion{chartVersions[picked]}
+	}
+
+	klog.V(4).Info("After version policies:", indexFile)
+}
+
+//packageStatusName returns the name of the package of the chart version in the subscription status, the name of its deployable
+func (ghsi *SubscriberItem) packageStatusName(packageName, version string) string {
+	if ghsi.Channel == nil {
+		return ghsi.Subscription.Name + "-" + packageName + "-" + version
+	}
+
+	return ghsi.Channel.Name + "-" + packageName + "-" + version
 }
 
 //checkKeywords Checks if the charts has at least 1 keyword from the packageFilter.Keywords array
@@ -15,6 +15,8 @@
 package helmrepo
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -26,6 +28,7 @@ import (
 
 	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils/timewindowtest"
 )
 
 var c client.Client
@@ -91,3 +94,37 @@ func TestHelmSubscriber(t *testing.T) {
 
 	g.Expect(defaultSubscriber.UnsubscribeItem(sharedkey)).NotTo(gomega.HaveOccurred())
 }
+
+func TestHelmSubscriberTimeWindows(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mgr, err := manager.New(cfg, manager.Options{MetricsBindAddress: "0"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(Add(mgr, cfg, &id, 2)).NotTo(gomega.HaveOccurred())
+	stopMgr, mgrStopped := StartTestManager(mgr, g)
+
+	defer func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+	}()
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	repo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("apiVersion: v1\nentries: {}\n"))
+	}))
+	defer repo.Close()
+
+	timewindowtest.Run(t, clt, helmsub, func(sub *appv1alpha1.Subscription) time.Duration {
+		chn := helmchn.DeepCopy()
+		chn.Spec.PathName = repo.URL
+
+		hrsi := &SubscriberItem{synchronizer: defaultSubscriber.synchronizer}
+		hrsi.Subscription = sub
+		hrsi.Channel = chn
+
+		return hrsi.syncOnce()
+	})
+}
@@ -36,13 +36,11 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	utilrand "k8s.io/apimachinery/pkg/util/rand"
-	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/rest"
 	"k8s.io/helm/pkg/repo"
 	"k8s.io/klog"
 
 	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
-	dplutils "github.com/IBM/multicloud-operators-deployable/pkg/utils"
 	releasev1alpha1 "github.com/IBM/multicloud-operators-subscription-release/pkg/apis/app/v1alpha1"
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
 	kubesynchronizer "github.com/IBM/multicloud-operators-subscription/pkg/synchronizer/kubernetes"
@@ -62,10 +60,11 @@ const (
 type SubscriberItem struct {
 	appv1alpha1.SubscriberItem
 
-	hash         string
-	stopch       chan struct{}
-	syncinterval int
-	synchronizer *kubesynchronizer.KubeSynchronizer
+	hash          string
+	stopch        chan struct{}
+	syncinterval  int
+	synchronizer  *kubesynchronizer.KubeSynchronizer
+	droppedCharts map[string]error
 }
 
 // SubscribeItem subscribes a subscriber item with namespace channel
@@ -77,20 +76,32 @@ func (hrsi *SubscriberItem) Start() {
 
 	hrsi.stopch = make(chan struct{})
 
-	go wait.Until(func() {
-		tw := hrsi.SubscriberItem.Subscription.Spec.TimeWindow
-		if tw != nil {
-			nextRun := utils.NextStartPoint(tw, time.Now())
-			if nextRun > time.Duration(0) {
-				klog.V(1).Infof("Subcription %v/%v will de deploy after %v",
-					hrsi.SubscriberItem.Subscription.GetNamespace(),
-					hrsi.SubscriberItem.Subscription.GetName(), nextRun)
-				return
-			}
-		}
+	go utils.SyncUntil(hrsi.syncOnce, time.Duration(hrsi.syncinterval)*time.Second, hrsi.stopch)
+}
+
+// syncOnce runs one round of the subscriber loop, returns how long the loop holds off for the time window
+func (hrsi *SubscriberItem) syncOnce() time.Duration {
+	if nextRun := utils.TimeWindowHoldOff(hrsi.synchronizer.LocalClient, hrsi.SubscriberItem.Subscription, hrsi.repoChanged); nextRun > 0 {
+		return nextRun
+	}
+
+	if hrsi.SubscriberItem.Subscription.Spec.Suspend {
+		klog.V(1).Infof("Subscription %v/%v is suspended",
+			hrsi.SubscriberItem.Subscription.GetNamespace(), hrsi.SubscriberItem.Subscription.GetName())
+		return time.Duration(0)
+	}
+
+	if utils.IsWaitingForDependency(hrsi.synchronizer.LocalClient, hrsi.SubscriberItem.Subscription) {
+		return time.Duration(0)
+	}
 
-		hrsi.doSubscription()
-	}, time.Duration(hrsi.syncinterval)*time.Second, hrsi.stopch)
+	if utils.IsWaitingForApproval(hrsi.SubscriberItem.Subscription, hrsi.SubscriberItem.Channel, nil) {
+		return time.Duration(0)
+	}
+
+	hrsi.doSubscription()
+
+	return time.Duration(0)
 }
 
 func (hrsi *SubscriberItem) Stop() {
@@ -126,7 +137,29 @@ func (hrsi *SubscriberItem) doSubscription() {
 
 	if err != nil {
 		klog.Error("Failed to process helm repo subscription with error:", err)
+		return
 	}
+
+	_ = utils.ClearTimeWindowPending(hrsi.synchronizer.LocalClient, hrsi.Subscription)
+}
+
+// repoChanged checks whether the index of the helm repo changed since the last sync
+func (hrsi *SubscriberItem) repoChanged() bool {
+	repoURL := hrsi.Channel.Spec.PathName
+
+	httpClient, err := hrsi.getHelmRepoClient()
+	if err != nil {
+		klog.Error(err, "Unable to create client for helm repo", repoURL)
+		return false
+	}
+
+	_, hash, err := hrsi.getHelmRepoIndex(httpClient, repoURL)
+	if err != nil {
+		klog.Error(err, "Unable to retrieve the helm repo index", repoURL)
+		return false
+	}
+
+	return hash != hrsi.hash
 }
 
 func (hrsi *SubscriberItem) processSubscription() error {
@@ -289,8 +322,8 @@ func (hrsi *SubscriberItem) filterCharts(indexFile *repo.IndexFile) error {
 	}
 	//Removes non matching version, tillerVersion, digest
 	hrsi.filterOnVersion(indexFile)
-	//Keep only the lastest version if multiple remains after filtering.
-	err = takeLatestVersion(indexFile)
+	//Keep only the version picked by the version policies if multiple remains after filtering.
+	err = hrsi.takeVersion(indexFile)
 	if err != nil {
 		klog.Error("Failed to filter on version with error: ", err)
 	}
@@ -441,28 +474,67 @@ func (hrsi *SubscriberItem) checkVersion(chartVersion *repo.ChartVersion) bool {
 	return true
 }
 
-//takeLatestVersion if the indexFile contains multiple versions for a given chart, then
-//only the latest is kept.
-func takeLatestVersion(indexFile *repo.IndexFile) (err error) {
+//takeVersion if the indexFile contains multiple versions for a given chart, then
+//only the version picked by the version policies of the subscription is kept.
+//The charts dropped by the pinned policy are kept in droppedCharts with the reason, keyed by their package status name.
+func (hrsi *SubscriberItem) takeVersion(indexFile *repo.IndexFile) error {
 	indexFile.SortEntries()
 
-	for k := range indexFile.Entries {
-		//Get return the latest version when version is empty but
-		//there is a bug in the masterminds semver used by helm
-		// "*" constraint is not working properly
-		// "*" is equivalent to ">=0.0.0"
-		chartVersion, err := indexFile.Get(k, ">=0.0.0")
+	hrsi.droppedCharts = make(map[string]error)
+
+	var filter *appv1alpha1.PackageFilter
+	if hrsi.Subscription != nil {
+		filter = hrsi.Subscription.Spec.PackageFilter
+	}
+
+	for k, chartVersions := range indexFile.Entries {
+		current := ""
+
+		if hrsi.Subscription != nil && hrsi.synchronizer != nil {
+			var err error
+
+			current, err = utils.GetDeployedChartVersion(hrsi.synchronizer.LocalClient, hrsi.Subscription, k)
+			if err != nil {
+				return err
+			}
+		}
+
+		candidates := make([]utils.VersionCandidate, len(chartVersions))
+		for i, chartVersion := range chartVersions {
+			candidates[i] = utils.VersionCandidate{Version: chartVersion.GetVersion(), Created: chartVersion.Created}
+		}
+
+		picked, err := utils.SelectVersion(filter, candidates, current, time.Now())
 		if err != nil {
-			klog.Error(err)
-			return err
+			klog.Info("Dropping chart ", k, ": ", err)
+			hrsi.droppedCharts[hrsi.packageStatusName(k, current)] = err
+			delete(indexFile.Entries, k)
+
+			continue
+		}
+
+		if picked < 0 {
+			klog.V(3).Info("No version of chart ", k, " passed the version policies")
+			delete(indexFile.Entries, k)
+
+			continue
 		}
 
-		indexFile.Entries[k] = []*repo.ChartVersion{chartVersion}
+		indexFile.Entries[k] = []*repo.ChartVersion{chartVersions[picked]}
 	}
 
 	return nil
 }
 
+//packageStatusName returns the name of the package of the chart version in the subscription status, the name of its deployable
+func (hrsi *SubscriberItem) packageStatusName(packageName, version string) string {
+	if hrsi.Channel == nil {
+		return hrsi.Subscription.Name + "-" + packageName + "-" + version
+	}
+
+	return hrsi.Channel.Name + "-" + packageName + "-" + version
+}
+
 func (hrsi *SubscriberItem) getOverrides(packageName string) dplv1alpha1.Overrides {
 	dploverrides := dplv1alpha1.Overrides{}
 
@@ -499,116 +571,11 @@ func (hrsi *SubscriberItem) manageHelmCR(indexFile *repo.IndexFile, repoURL stri
 	for packageName, chartVersions := range indexFile.Entries {
 		klog.V(5).Infof("chart: %s\n%v", packageName, chartVersions)
 
-		helmReleaseNewName := packageName + "-" + hrsi.Subscription.Name + "-" + hrsi.Subscription.Namespace
-
-		helmRelease := &releasev1alpha1.HelmRelease{}
-		//Create a new helrmReleases
-		//Try to retrieve the releases to check if we have to reuse the releaseName or calculate one.
-
-		for i := range chartVersions[0].URLs {
-			parsedURL, err := url.Parse(chartVersions[0].URLs[i])
-
-			if err != nil {
-				klog.Error("Failed to parse url with error:", err)
-				return err
-			}
-
-			if parsedURL.Scheme == "local" {
-				//make sure there is one and only one slash
-				repoURL = strings.TrimSuffix(repoURL, "/") + "/"
-				chartVersions[0].URLs[i] = strings.Replace(chartVersions[0].URLs[i], "local://", repoURL, -1)
-			}
-		}
-		//Check if Update or Create
-		err = hrsi.synchronizer.LocalClient.Get(context.TODO(),
-			types.NamespacedName{Name: helmReleaseNewName, Namespace: hrsi.Subscription.Namespace}, helmRelease)
-
+		dpl, err := hrsi.helmReleaseDeployable(packageName, chartVersions[0], repoURL)
 		if err != nil {
-			if errors.IsNotFound(err) {
-				klog.V(2).Infof("Create helmRelease %s", helmReleaseNewName)
-
-				helmRelease = &releasev1alpha1.HelmRelease{
-					TypeMeta: metav1.TypeMeta{
-						APIVersion: "app.ibm.com/v1alpha1",
-						Kind:       "HelmRelease",
-					},
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      helmReleaseNewName,
-						Namespace: hrsi.Subscription.Namespace,
-						OwnerReferences: []metav1.OwnerReference{{
-							APIVersion: hrsi.Subscription.APIVersion,
-							Kind:       hrsi.Subscription.Kind,
-							Name:       hrsi.Subscription.Name,
-							UID:        hrsi.Subscription.UID,
-						}},
-					},
-					Spec: releasev1alpha1.HelmReleaseSpec{
-						Source: &releasev1alpha1.Source{
-							SourceType: releasev1alpha1.HelmRepoSourceType,
-							HelmRepo: &releasev1alpha1.HelmRepo{
-								Urls: chartVersions[0].URLs,
-							},
-						},
-						ConfigMapRef: hrsi.Channel.Spec.ConfigMapRef,
-						SecretRef:    hrsi.Channel.Spec.SecretRef,
-						ChartName:    packageName,
-						ReleaseName:  getReleaseName(helmReleaseNewName),
-						Version:      chartVersions[0].GetVersion(),
-					},
-				}
-			} else {
-				klog.Error("Error in getting existing helm release", err)
-				return err
-			}
-		} else {
-			// set kind and apiversion, coz it is not in the resource get from k8s
-			helmRelease.APIVersion = "app.ibm.com/v1alpha1"
-			helmRelease.Kind = "HelmRelease"
-			klog.V(2).Infof("Update helmRelease spec %s", helmRelease.Name)
-			releaseName := helmRelease.Spec.ReleaseName
-			helmRelease.Spec = releasev1alpha1.HelmReleaseSpec{
-				Source: &releasev1alpha1.Source{
-					SourceType: releasev1alpha1.HelmRepoSourceType,
-					HelmRepo: &releasev1alpha1.HelmRepo{
-						Urls: chartVersions[0].URLs,
-					},
-				},
-				ConfigMapRef: hrsi.Channel.Spec.ConfigMapRef,
-				SecretRef:    hrsi.Channel.Spec.SecretRef,
-				ChartName:    packageName,
-				ReleaseName:  releaseName,
-				Version:      chartVersions[0].GetVersion(),
-			}
-		}
-
-		err := hrsi.override(helmRelease)
-
-		if err != nil {
-			klog.Error("Failed to override ", helmRelease.Name, " err:", err)
-			return err
-		}
-
-		dpl := &dplv1alpha1.Deployable{}
-		if hrsi.Channel == nil {
-			dpl.Name = hrsi.Subscription.Name + "-" + packageName + "-" + chartVersions[0].GetVersion()
-			dpl.Namespace = hrsi.Subscription.Namespace
-		} else {
-			dpl.Name = hrsi.Channel.Name + "-" + packageName + "-" + chartVersions[0].GetVersion()
-			dpl.Namespace = hrsi.Channel.Namespace
-		}
-
-		dpl.Spec.Template = &runtime.RawExtension{}
-		dpl.Spec.Template.Raw, err = json.Marshal(helmRelease)
-
-		if err != nil {
-			klog.Error("Failed to mashall helm release", helmRelease)
 			return err
 		}
 
-		dplanno := make(map[string]string)
-		dplanno[dplv1alpha1.AnnotationLocal] = "true"
-		dpl.SetAnnotations(dplanno)
-
 		err = hrsi.synchronizer.RegisterTemplate(hostkey, dpl, syncsource)
 		if err != nil {
 			klog.Info("eror in registering :", err)
@@ -630,18 +597,158 @@ func (hrsi *SubscriberItem) manageHelmCR(indexFile *repo.IndexFile, repoURL stri
 		pkgMap[dplkey.Name] = true
 	}
 
+	utils.SetDroppedPackagesStatus(&hrsi.Subscription.Status, hrsi.droppedCharts, pkgMap)
+
 	if utils.ValidatePackagesInSubscriptionStatus(hrsi.synchronizer.LocalClient, hrsi.Subscription, pkgMap) != nil {
 		err = hrsi.synchronizer.LocalClient.Get(context.TODO(), hostkey, hrsi.Subscription)
 		if err != nil {
 			klog.Error("Failed to get and subscription resource with error:", err)
 		}
 
+		utils.SetDroppedPackagesStatus(&hrsi.Subscription.Status, hrsi.droppedCharts, pkgMap)
+
 		err = utils.ValidatePackagesInSubscriptionStatus(hrsi.synchronizer.LocalClient, hrsi.Subscription, pkgMap)
 	}
 
 	return err
 }
 
+//helmReleaseDeployable creates or updates the HelmRelease of the chart version and packages it in a deployable
+func (hrsi *SubscriberItem) helmReleaseDeployable(packageName string, chartVersion *repo.ChartVersion, repoURL string) (*dplv1alpha1.Deployable, error) {
+	helmReleaseNewName := packageName + "-" + hrsi.Subscription.Name + "-" + hrsi.Subscription.Namespace
+
+	helmRelease := &releasev1alpha1.HelmRelease{}
+	//Create a new helrmReleases
+	//Try to retrieve the releases to check if we have to reuse the releaseName or calculate one.
+
+	for i := range chartVersion.URLs {
+		parsedURL, err := url.Parse(chartVersion.URLs[i])
+
+		if err != nil {
+			klog.Error("Failed to parse url with error:", err)
+			return nil, err
+		}
+
+		if parsedURL.Scheme == "local" {
+			//make sure there is one and only one slash
+			repoURL = strings.TrimSuffix(repoURL, "/") + "/"
+			chartVersion.URLs[i] = strings.Replace(chartVersion.URLs[i], "local://", repoURL, -1)
+		}
+	}
+	//Check if Update or Create
+	err := hrsi.synchronizer.LocalClient.Get(context.TODO(),
+		types.NamespacedName{Name: helmReleaseNewName, Namespace: hrsi.Subscription.Namespace}, helmRelease)
+
+	if err != nil {
+		if errors.IsNotFound(err) {
+			klog.V(2).Infof("Create helmRelease %s", helmReleaseNewName)
+
+			helmRelease = &releasev1alpha1.HelmRelease{
+				TypeMeta: metav1.TypeMeta{
+					APIVersion: "app.ibm.com/v1alpha1",
+					Kind:       "HelmRelease",
+				},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      helmReleaseNewName,
+					Namespace: hrsi.Subscription.Namespace,
+					OwnerReferences: []metav1.OwnerReference{{
+						APIVersion: hrsi.Subscription.APIVersion,
+						Kind:       hrsi.Subscription.Kind,
+						Name:       hrsi.Subscription.Name,
+						UID:        hrsi.Subscription.UID,
+					}},
+				},
+				Spec: releasev1alpha1.HelmReleaseSpec{
+					Source: &releasev1alpha1.Source{
+						SourceType: releasev1alpha1.HelmRepoSourceType,
+						HelmRepo: &releasev1alpha1.HelmRepo{
+							Urls: chartVersion.URLs,
+						},
+					},
+					ConfigMapRef: hrsi.Channel.Spec.ConfigMapRef,
+					SecretRef:    hrsi.Channel.Spec.SecretRef,
+					ChartName:    packageName,
+					ReleaseName:  getReleaseName(helmReleaseNewName),
+					Version:      chartVersion.GetVersion(),
+				},
+			}
+		} else {
+			klog.Error("Error in getting existing helm release", err)
+			return nil, err
+		}
+	} else {
+		// set kind and apiversion, coz it is not in the resource get from k8s
+		helmRelease.APIVersion = "app.ibm.com/v1alpha1"
+		helmRelease.Kind = "HelmRelease"
+		klog.V(2).Infof("Update helmRelease spec %s", helmRelease.Name)
+		releaseName := helmRelease.Spec.ReleaseName
+		helmRelease.Spec = releasev1alpha1.HelmReleaseSpec{
+			Source: &releasev1alpha1.Source{
+				SourceType: releasev1alpha1.HelmRepoSourceType,
+				HelmRepo: &releasev1alpha1.HelmRepo{
+					Urls: chartVersion.URLs,
+				},
+			},
+			ConfigMapRef: hrsi.Channel.Spec.ConfigMapRef,
+			SecretRef:    hrsi.Channel.Spec.SecretRef,
+			ChartName:    packageName,
+			ReleaseName:  releaseName,
+			Version:      chartVersion.GetVersion(),
+		}
+	}
+
+	err = hrsi.override(helmRelease)
+
+	if err != nil {
+		klog.Error("Failed to override ", helmRelease.Name, " err:", err)
+		return nil, err
+	}
+
+	dpl := &dplv1alpha1.Deployable{}
+	dpl.Name = hrsi.packageStatusName(packageName, chartVersion.GetVersion())
+
+	if hrsi.Channel == nil {
+		dpl.Namespace = hrsi.Subscription.Namespace
+	} else {
+		dpl.Namespace = hrsi.Channel.Namespace
+	}
+
+	dpl.Spec.Template = &runtime.RawExtension{}
+	dpl.Spec.Template.Raw, err = json.Marshal(helmRelease)
+
+	if err != nil {
+		klog.Error("Failed to mashall helm release", helmRelease)
+		return nil, err
+	}
+
+	dplanno := make(map[string]string)
+	dplanno[dplv1alpha1.AnnotationLocal] = "true"
+	dpl.SetAnnotations(dplanno)
+
+	return dpl, nil
+}
+
+// FilterCharts filters the index file for the subscriber item the way helm repo channels do: by package name, keywords,
+// version, tillerVersion and digest, then only the version picked by the version policies is kept.
+// It returns the charts dropped by the pinned policy with the reason, keyed by their package name in the subscription status
+func FilterCharts(subitem *appv1alpha1.SubscriberItem, synchronizer *kubesynchronizer.KubeSynchronizer,
+	indexFile *repo.IndexFile) (map[string]error, error) {
+	hrsi := &SubscriberItem{SubscriberItem: *subitem, synchronizer: synchronizer}
+
+	err := hrsi.filterCharts(indexFile)
+
+	return hrsi.droppedCharts, err
+}
+
+// HelmReleaseDeployable packages the chart version in the deployable of a HelmRelease for the subscriber item the way
+// helm repo channels do, the chart URLs with the local:// scheme are relative to repoURL
+func HelmReleaseDeployable(subitem *appv1alpha1.SubscriberItem, synchronizer *kubesynchronizer.KubeSynchronizer,
+	packageName string, chartVersion *repo.ChartVersion, repoURL string) (*dplv1alpha1.Deployable, error) {
+	hrsi := &SubscriberItem{SubscriberItem: *subitem, synchronizer: synchronizer}
+
+	return hrsi.helmReleaseDeployable(packageName, chartVersion, repoURL)
+}
+
 func getReleaseName(base string) string {
 	if len(base) > maxNameLength {
 		//minus 1 because adding "-"
@@ -652,6 +759,7 @@ func getReleaseName(base string) string {
 	return base
 }
 
+// override applies the package overrides of the subscription and the layered helm values on the helm release
 func (hrsi *SubscriberItem) override(helmRelease *releasev1alpha1.HelmRelease) error {
 	//Overrides with the values provided in the subscription for that package
 	overrides := hrsi.getOverrides(helmRelease.Spec.ChartName)
@@ -669,7 +777,8 @@ func (hrsi *SubscriberItem) override(helmRelease *releasev1alpha1.HelmRelease) e
 		klog.Warning("Processing local deployable with error template:", helmRelease, err)
 	}
 
-	template, err = dplutils.OverrideTemplate(template, overrides.ClusterOverrides)
+	template, err = utils.OverrideHelmRelease(template, helmRelease.Spec.ChartName, hrsi.ChannelConfigMap,
+		overrides.ClusterOverrides, hrsi.HelmValuesConfigMap)
 
 	if err != nil {
 		klog.Error("Failed to apply override for instance: ")
@@ -33,6 +33,9 @@ import (
 	"github.com/IBM/multicloud-operators-subscription/pkg/utils"
 )
 
+// errWaitingForApproval is returned when the channel content differs from the package versions approved on hub
+var errWaitingForApproval = errors.New("waiting for approval of the channel content")
+
 // DeployableReconciler reconciles a Deployable object of Nmespace channel
 type DeployableReconciler struct {
 	// This client, initialized using mgr.Client() above, is a split client
@@ -46,28 +49,39 @@ type DeployableReconciler struct {
 func (r *DeployableReconciler) Reconcile(request reconcile.Request) (reconcile.Result, error) {
 	klog.V(1).Info("Deployable Reconciling: ", request.NamespacedName, " deployable for subitem ", r.itemkey)
 
-	tw := r.subscriber.itemmap[r.itemkey].Subscription.Spec.TimeWindow
-	if tw != nil {
-		nextRun := utils.NextStartPoint(tw, time.Now())
-		klog.V(5).Infof(time.Now().String())
-		klog.V(5).Infof("Reconciling deployable %v, for subscription %v, with tw %v having nextRun time %v",
-			request.NamespacedName.String(), r.subscriber.itemmap[r.itemkey].Subscription.GetName(), tw, nextRun)
+	// out-of-window changes are deferred till the window opens, the reconcile is triggered by a change
+	if nextRun := utils.TimeWindowHoldOff(r.subscriber.synchronizer.LocalClient, r.subscriber.itemmap[r.itemkey].Subscription, nil); nextRun > 0 {
+		klog.V(1).Infof("Deployable %v will be reconciled after %v", request.NamespacedName.String(), nextRun)
+		return reconcile.Result{RequeueAfter: nextRun}, nil
+	}
 
-		if nextRun > time.Duration(0) {
-			klog.V(1).Infof("Subcription %v will run after %v", request.NamespacedName.String(), nextRun)
-			return reconcile.Result{RequeueAfter: nextRun}, nil
-		}
+	if r.subscriber.itemmap[r.itemkey].Subscription.Spec.Suspend {
+		klog.V(1).Infof("Subcription for %v is suspended", request.NamespacedName.String())
+		// keep checking, so the subscription picks up where it stopped once resumed
+		return reconcile.Result{RequeueAfter: time.Duration(r.subscriber.synchronizer.Interval*5) * time.Second}, nil
+	}
+
+	if utils.IsWaitingForDependency(r.subscriber.synchronizer.LocalClient, r.subscriber.itemmap[r.itemkey].Subscription) {
+		return reconcile.Result{RequeueAfter: utils.DependencyRequeueInterval}, nil
 	}
 
 	result := reconcile.Result{}
 	err := r.doSubscription()
 
+	if err == errWaitingForApproval {
+		return reconcile.Result{RequeueAfter: utils.ApprovalRequeueInterval}, nil
+	}
+
 	if err != nil {
 		result.RequeueAfter = time.Duration(r.subscriber.synchronizer.Interval*5) * time.Second
 
 		klog.Error("Failed to reconcile deployable for namespace subscriber with error:", err)
+
+		return result, nil
 	}
 
+	_ = utils.ClearTimeWindowPending(r.subscriber.synchronizer.LocalClient, r.subscriber.itemmap[r.itemkey].Subscription)
+
 	return result, nil
 }
 
@@ -116,19 +130,19 @@ func (r *DeployableReconciler) doSubscription() error {
 		klog.Error("Failed to list objecrts from namespace ", subNamespace, " err:", err)
 	}
 
+	// the deployed resources are kept until hub approves the channel content
+	if utils.IsWaitingForApproval(subitem.Subscription, subitem.Channel, utils.DplArrayToDplPointers(dpllist.Items)) {
+		return errWaitingForApproval
+	}
+
 	hostkey := types.NamespacedName{Name: subitem.Subscription.Name, Namespace: subitem.Subscription.Namespace}
 	syncsource := deployablesyncsource + hostkey.String()
 	// subscribed k8s resource
 	kvalid := r.subscriber.synchronizer.CreateValiadtor(syncsource)
 	pkgMap := make(map[string]bool)
 
-	vsub := ""
-
-	if subitem.Subscription.Spec.PackageFilter != nil {
-		vsub = subitem.Subscription.Spec.PackageFilter.Version
-	}
-
-	versionMap := utils.GenerateVersionSet(utils.DplArrayToDplPointers(dpllist.Items), vsub)
+	versionMap, dropped := utils.SelectVersionSet(utils.DplArrayToDplPointers(dpllist.Items), subitem.Subscription.Spec.PackageFilter,
+		utils.GetDeployedPackages(&subitem.Subscription.Status), time.Now())
 
 	for _, dpl := range dpllist.Items {
 		klog.V(5).Infof("Updating subscription %v, with Deployable %v  ", syncsource, hostkey)
@@ -173,6 +187,16 @@ func (r *DeployableReconciler) doSubscription() error {
 
 	r.subscriber.synchronizer.ApplyValiadtor(kvalid)
 
+	// the synchronizer doesn't report the packages dropped by the version policies
+	if len(dropped) > 0 {
+		utils.SetDroppedPackagesStatus(&subitem.Subscription.Status, dropped, pkgMap)
+
+		err = utils.ValidatePackagesInSubscriptionStatus(r.subscriber.synchronizer.LocalClient, subitem.Subscription, pkgMap)
+		if err != nil {
+			klog.Error("Failed to update status of dropped packages of subscription ", hostkey, " with error: ", err)
+		}
+	}
+
 	return retryerr
 }
 
@@ -229,6 +253,8 @@ func (r *DeployableReconciler) doSubscribeDeployable(subitem *SubscriberItem, dp
 		return nil, nil, err
 	}
 
+	utils.SetDeployedVersionAnnotations(template, dpl)
+
 	// owner reference does not work with cluster scoped subscription
 	if !subitem.clusterscoped {
 		err = controllerutil.SetControllerReference(subitem.Subscription, template, r.subscriber.scheme)
@@ -31,6 +31,7 @@ import (
 	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
 	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils/timewindowtest"
 )
 
 var c client.Client
@@ -267,3 +268,130 @@ func TestSecretReconcile(t *testing.T) {
 	//checking if the reconcile has any error
 	g.Expect(srtRec.Reconcile(dplSrtRq)).ShouldNot(gomega.BeNil())
 }
+
+func TestDeployableReconcilerTimeWindows(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mgr, err := manager.New(cfg, manager.Options{MetricsBindAddress: "0"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(Add(mgr, cfg, &id, 2)).NotTo(gomega.HaveOccurred())
+	stopMgr, mgrStopped := StartTestManager(mgr, g)
+
+	defer func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+	}()
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	chn := channel.DeepCopy()
+	chn.Spec.PathName = "timewindow-channel"
+
+	sub := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default"},
+		Spec:       appv1alpha1.SubscriptionSpec{Channel: id.String()},
+	}
+
+	// the deployable is synced at once in the window, and deferred till the window opens out of it
+	timewindowtest.Run(t, clt, sub, func(tcsub *appv1alpha1.Subscription) time.Duration {
+		itemkey := types.NamespacedName{Name: tcsub.Name, Namespace: tcsub.Namespace}
+		defaultSubscriber.itemmap[itemkey] = &SubscriberItem{
+			SubscriberItem: appv1alpha1.SubscriberItem{Subscription: tcsub, Channel: chn},
+		}
+
+		defer delete(defaultSubscriber.itemmap, itemkey)
+
+		rec := &DeployableReconciler{Client: clt, subscriber: defaultSubscriber, itemkey: itemkey}
+		result, err := rec.Reconcile(reconcile.Request{NamespacedName: types.NamespacedName{Name: "dpl", Namespace: chn.Spec.PathName}})
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		return result.RequeueAfter
+	})
+}
+
+func TestDeployableReconcilerPinnedVersionGone(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mgr, err := manager.New(cfg, manager.Options{MetricsBindAddress: "0"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(Add(mgr, cfg, &id, 2)).NotTo(gomega.HaveOccurred())
+	stopMgr, mgrStopped := StartTestManager(mgr, g)
+
+	defer func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+	}()
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	chn := channel.DeepCopy()
+	chn.Spec.PathName = "pinned-channel"
+
+	// the pinned version 1.0.0 is deleted from the channel, only a newer version is left
+	dpl := &dplv1alpha1.Deployable{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:         "pinned-nginx-2",
+			GenerateName: "pinned-nginx-",
+			Namespace:    chn.Spec.PathName,
+			Annotations:  map[string]string{dplv1alpha1.AnnotationDeployableVersion: "1.1.0"},
+		},
+		Spec: dplv1alpha1.DeployableSpec{
+			Template: &runtime.RawExtension{
+				Object: &workloadconfigmap,
+			},
+		},
+	}
+	g.Expect(clt.Create(context.TODO(), dpl)).NotTo(gomega.HaveOccurred())
+
+	defer clt.Delete(context.TODO(), dpl)
+
+	sub := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: "pinned-sub", Namespace: "default"},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel:       id.String(),
+			PackageFilter: &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyPinned},
+		},
+	}
+	g.Expect(clt.Create(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+
+	defer clt.Delete(context.TODO(), sub)
+
+	sub.Status.LastUpdateTime = metav1.Now()
+	sub.Status.Statuses = appv1alpha1.SubscriptionClusterStatusMap{
+		"/": {
+			SubscriptionPackageStatus: map[string]*appv1alpha1.SubscriptionUnitStatus{
+				"pinned-nginx-1": {
+					Phase:          appv1alpha1.SubscriptionSubscribed,
+					LastUpdateTime: metav1.Now(),
+					Group:          dpl.GenerateName,
+					Version:        "1.0.0",
+				},
+			},
+		},
+	}
+	g.Expect(clt.Status().Update(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+
+	itemkey := types.NamespacedName{Name: sub.Name, Namespace: sub.Namespace}
+	defaultSubscriber.itemmap[itemkey] = &SubscriberItem{
+		SubscriberItem: appv1alpha1.SubscriberItem{Subscription: sub, Channel: chn},
+	}
+
+	defer delete(defaultSubscriber.itemmap, itemkey)
+
+	rec := &DeployableReconciler{Client: clt, subscriber: defaultSubscriber, itemkey: itemkey}
+	g.Expect(rec.doSubscription()).NotTo(gomega.HaveOccurred())
+
+	// the package is dropped rather than moved to the newer version
+	cur := &appv1alpha1.Subscription{}
+	g.Expect(clt.Get(context.TODO(), itemkey, cur)).NotTo(gomega.HaveOccurred())
+
+	pkgs := cur.Status.Statuses["/"].SubscriptionPackageStatus
+	g.Expect(pkgs).NotTo(gomega.HaveKey(dpl.Name))
+	g.Expect(pkgs).To(gomega.HaveKey("pinned-nginx-1"))
+	g.Expect(pkgs["pinned-nginx-1"].Phase).To(gomega.Equal(appv1alpha1.SubscriptionFailed))
+	g.Expect(pkgs["pinned-nginx-1"].Version).To(gomega.Equal("1.0.0"))
+}
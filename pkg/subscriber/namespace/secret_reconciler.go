@@ -64,13 +64,24 @@ func (s *SecretReconciler) Reconcile(request reconcile.Request) (reconcile.Resul
 		defer klog.Infof("Exiting: %v()\n request %v, secret for subitem %v", fnName, request.NamespacedName, s.Itemkey)
 	}
 
-	tw := s.Subscriber.itemmap[s.Itemkey].Subscription.Spec.TimeWindow
-	if tw != nil {
-		nextRun := utils.NextStartPoint(tw, time.Now())
-		if nextRun > time.Duration(0) {
-			klog.V(1).Infof("Subcription %v will run after %v", request.NamespacedName.String(), nextRun)
-			return reconcile.Result{RequeueAfter: nextRun}, nil
-		}
+	// out-of-window changes are deferred till the window opens, the reconcile is triggered by a change
+	if nextRun := utils.TimeWindowHoldOff(s.Subscriber.synchronizer.LocalClient, s.Subscriber.itemmap[s.Itemkey].Subscription, nil); nextRun > 0 {
+		klog.V(1).Infof("Secret %v will be reconciled after %v", request.NamespacedName.String(), nextRun)
+		return reconcile.Result{RequeueAfter: nextRun}, nil
+	}
+
+	if s.Subscriber.itemmap[s.Itemkey].Subscription.Spec.Suspend {
+		klog.V(1).Infof("Subcription for %v is suspended", request.NamespacedName.String())
+		// keep checking, so the subscription picks up where it stopped once resumed
+		return reconcile.Result{RequeueAfter: time.Duration(s.Subscriber.synchronizer.Interval*5) * time.Second}, nil
+	}
+
+	if utils.IsWaitingForDependency(s.Subscriber.synchronizer.LocalClient, s.Subscriber.itemmap[s.Itemkey].Subscription) {
+		return reconcile.Result{RequeueAfter: utils.DependencyRequeueInterval}, nil
+	}
+
+	if utils.IsWaitingForApproval(s.Subscriber.itemmap[s.Itemkey].Subscription, s.Subscriber.itemmap[s.Itemkey].Channel, nil) {
+		return reconcile.Result{RequeueAfter: utils.ApprovalRequeueInterval}, nil
 	}
 
 	klog.V(1).Info("Reconciling: ", request.NamespacedName, " sercet for subitem ", s.Itemkey)
@@ -105,6 +116,8 @@ func (s *SecretReconciler) Reconcile(request reconcile.Request) (reconcile.Resul
 
 	s.RegisterToResourceMap(dpls)
 
+	_ = utils.ClearTimeWindowPending(s.Subscriber.synchronizer.LocalClient, s.Subscriber.itemmap[s.Itemkey].Subscription)
+
 	return reconcile.Result{}, nil
 }
 
@@ -0,0 +1,335 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectbucket
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/repo"
+	"k8s.io/klog"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils/objectstore"
+)
+
+// bucketObject is an object of the bucket as of the last listing
+type bucketObject struct {
+	etag         string
+	lastModified time.Time
+	// changed is true if the object is new or its content changed since the former listing
+	changed bool
+	// dpl is the deployable of the object, nil if the object is not a template
+	dpl *dplv1alpha1.Deployable
+	// chart is the chart version of a chart tarball, nil if the object is not a chart
+	chart *repo.ChartVersion
+	// index is the helm repo index of the index.yaml below the prefix
+	index *repo.IndexFile
+	// unfetched is true for a chart tarball left unread because the index.yaml below the prefix lists the charts
+	unfetched bool
+	// registered is the template of the object in the synchronizer, nil if it is not registered
+	registered *registeredTemplate
+}
+
+// registeredTemplate identifies a template registered to the synchronizer
+type registeredTemplate struct {
+	gvk    schema.GroupVersionKind
+	dplkey types.NamespacedName
+}
+
+// unchanged checks whether the listed object is the cached one
+func (obj *bucketObject) unchanged(info objectstore.ObjectInfo) bool {
+	if info.ETag == "" && info.LastModified.IsZero() {
+		return false
+	}
+
+	return obj.etag == info.ETag && obj.lastModified.Equal(info.LastModified)
+}
+
+// syncObjects lists the objects below the prefix and only fetches the new and changed ones,
+// the objects missing from the listing are dropped from the cache
+func (obsi *SubscriberItem) syncObjects(prefix string) (map[string]*bucketObject, error) {
+	infos, err := obsi.objectStore.List(obsi.bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := obsi.objects
+	if obsi.objectsPath != obsi.bucket+"/"+prefix {
+		cached = nil
+	}
+
+	objects := make(map[string]*bucketObject)
+
+	indexed := false
+
+	for _, info := range infos {
+		if info.Key == prefix+HelmIndexFile {
+			indexed = true
+		}
+	}
+
+	for _, info := range infos {
+		// skip the placeholders of folders
+		if strings.HasSuffix(info.Key, "/") {
+			continue
+		}
+
+		if obj, ok := cached[info.Key]; ok && obj.unchanged(info) && (indexed || !obj.unfetched) {
+			obj.changed = false
+			objects[info.Key] = obj
+
+			continue
+		}
+
+		// the charts are taken from the index, the helm release reads the tarball itself
+		if indexed && strings.HasSuffix(info.Key, HelmChartSuffix) {
+			objects[info.Key] = &bucketObject{
+				etag:         info.ETag,
+				lastModified: info.LastModified,
+				changed:      true,
+				unfetched:    true,
+			}
+
+			continue
+		}
+
+		obj, err := obsi.fetchObject(prefix, info)
+		if err != nil {
+			klog.Info("Failed to get object ", info.Key, " in bucket ", obsi.bucket)
+			return nil, err
+		}
+
+		klog.V(5).Info("Fetched new or changed object ", obsi.bucket, "/", info.Key, " ETag: ", info.ETag)
+
+		objects[info.Key] = obj
+	}
+
+	for key := range cached {
+		if _, ok := objects[key]; !ok {
+			klog.V(5).Info("Object ", obsi.bucket, "/", key, " is deleted")
+		}
+	}
+
+	obsi.objects = objects
+	obsi.objectsPath = obsi.bucket + "/" + prefix
+
+	return objects, nil
+}
+
+// fetchObject reads the object as a stream, the chart tarballs are indexed without being kept in memory
+func (obsi *SubscriberItem) fetchObject(prefix string, info objectstore.ObjectInfo) (*bucketObject, error) {
+	body, err := obsi.objectStore.GetStream(obsi.bucket, info.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	defer body.Close()
+
+	obj := &bucketObject{
+		etag:         info.ETag,
+		lastModified: info.LastModified,
+		changed:      true,
+	}
+
+	if strings.HasSuffix(info.Key, HelmChartSuffix) {
+		obj.chart, err = obsi.objectChart(prefix, info, body)
+
+		return obj, err
+	}
+
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Key == prefix+HelmIndexFile {
+		obj.index = obsi.objectIndex(info.Key, content)
+	} else {
+		obj.dpl = obsi.objectDeployable(prefix, info.Key, content)
+	}
+
+	return obj, nil
+}
+
+// objectsChanged checks whether the subscription or the objects below its prefix changed since the last sync,
+// only the listing is fetched
+func (obsi *SubscriberItem) objectsChanged() bool {
+	if obsi.syncedGeneration != obsi.Subscription.Generation {
+		return true
+	}
+
+	prefix := obsi.prefix
+	if obsi.SubscriptionConfigMap != nil {
+		prefix = joinBucketPrefix(prefix, obsi.SubscriptionConfigMap.Data[Path])
+	}
+
+	if obsi.objectsPath != obsi.bucket+"/"+prefix {
+		return true
+	}
+
+	infos, err := obsi.objectStore.List(obsi.bucket, prefix)
+	if err != nil {
+		klog.Info("Failed to list objects in bucket ", obsi.bucket, " with prefix ", prefix)
+		return false
+	}
+
+	listed := 0
+
+	for _, info := range infos {
+		if strings.HasSuffix(info.Key, "/") {
+			continue
+		}
+
+		if obj, ok := obsi.objects[info.Key]; !ok || !obj.unchanged(info) {
+			return true
+		}
+
+		listed++
+	}
+
+	return listed != len(obsi.objects)
+}
+
+// objectDeployable converts the template of the object to a deployable, returns nil if the object is not a template
+func (obsi *SubscriberItem) objectDeployable(prefix, key string, tplb []byte) *dplv1alpha1.Deployable {
+	dpl := &dplv1alpha1.Deployable{}
+	dpl.Name = objectDeployableName(prefix, key)
+	dpl.Namespace = obsi.bucket
+	dpl.Spec.Template = &runtime.RawExtension{}
+
+	err := yaml.Unmarshal(tplb, dpl.Spec.Template)
+	if err != nil {
+		klog.Error("Failed to unmashall ", obsi.bucket, "/", key, " err:", err)
+		return nil
+	}
+
+	klog.V(5).Infof("Retived Dpl: %v", dpl)
+
+	return dpl
+}
+
+// objectIndex loads the helm repo index of the object, the relative chart URLs are made local to the prefix,
+// returns nil if the object is not an index
+func (obsi *SubscriberItem) objectIndex(key string, indexb []byte) *repo.IndexFile {
+	indexFile := &repo.IndexFile{}
+
+	err := yaml.Unmarshal(indexb, indexFile)
+	if err != nil || indexFile.APIVersion == "" {
+		klog.Error("Failed to load helm repo index ", obsi.bucket, "/", key, " err:", err)
+		return nil
+	}
+
+	for _, chartVersions := range indexFile.Entries {
+		for _, chartVersion := range chartVersions {
+			for i, chartURL := range chartVersion.URLs {
+				parsedURL, err := url.Parse(chartURL)
+				if err == nil && parsedURL.Scheme == "" {
+					chartVersion.URLs[i] = "local://" + strings.TrimPrefix(chartURL, "/")
+				}
+			}
+		}
+	}
+
+	indexFile.SortEntries()
+
+	return indexFile
+}
+
+// objectChart indexes the chart tarball read from the stream, returns nil if the object is not a chart,
+// an error is returned only if reading the stream failed
+func (obsi *SubscriberItem) objectChart(prefix string, info objectstore.ObjectInfo, body io.Reader) (*repo.ChartVersion, error) {
+	digest := sha256.New()
+	tee := io.TeeReader(body, digest)
+
+	chart, err := chartutil.LoadArchive(tee)
+	if err != nil {
+		klog.Error("Failed to load chart ", obsi.bucket, "/", info.Key, " err:", err)
+	}
+
+	// the digest covers the whole tarball, including what the archive reader left unread
+	if _, cerr := io.Copy(ioutil.Discard, tee); cerr != nil {
+		return nil, cerr
+	}
+
+	if chart == nil {
+		return nil, nil
+	}
+
+	return &repo.ChartVersion{
+		Metadata: chart.Metadata,
+		URLs:     []string{"local://" + strings.TrimPrefix(info.Key, prefix)},
+		Digest:   hex.EncodeToString(digest.Sum(nil)),
+		Created:  info.LastModified,
+	}, nil
+}
+
+// chartIndex returns a copy of the index.yaml below the prefix, without it the charts tarballs are indexed
+func chartIndex(objects map[string]*bucketObject, keys []string) *repo.IndexFile {
+	indexFile := repo.NewIndexFile()
+
+	for _, key := range keys {
+		if objects[key].index != nil {
+			for name, chartVersions := range objects[key].index.Entries {
+				for _, chartVersion := range chartVersions {
+					indexFile.Entries[name] = append(indexFile.Entries[name], copyChartVersion(chartVersion))
+				}
+			}
+
+			return indexFile
+		}
+	}
+
+	for _, key := range keys {
+		if chartVersion := objects[key].chart; chartVersion != nil {
+			indexFile.Entries[chartVersion.Name] = append(indexFile.Entries[chartVersion.Name], copyChartVersion(chartVersion))
+		}
+	}
+
+	indexFile.SortEntries()
+
+	return indexFile
+}
+
+// copyChartVersion copies the chart version so that filtering and packaging leave the cached one unchanged
+func copyChartVersion(chartVersion *repo.ChartVersion) *repo.ChartVersion {
+	cv := *chartVersion
+	cv.URLs = append([]string(nil), chartVersion.URLs...)
+
+	return &cv
+}
+
+// sortedObjectKeys returns the keys of the objects in order
+func sortedObjectKeys(objects map[string]*bucketObject) []string {
+	keys := make([]string, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -25,6 +25,8 @@ import (
 
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
 	kubesynchronizer "github.com/IBM/multicloud-operators-subscription/pkg/synchronizer/kubernetes"
+	awsutils "github.com/IBM/multicloud-operators-subscription/pkg/utils/aws"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils/objectstore"
 )
 
 type itemmap map[types.NamespacedName]*SubscriberItem
@@ -35,6 +37,8 @@ type Subscriber struct {
 	manager      manager.Manager
 	synchronizer *kubesynchronizer.KubeSynchronizer
 	syncinterval int
+	// newObjectStore connects the subscriber items to their object store, S3 by default
+	newObjectStore objectstore.Factory
 }
 
 var defaultSubscriber *Subscriber
@@ -89,6 +93,7 @@ func (obs *Subscriber) SubscribeItem(subitem *appv1alpha1.SubscriberItem) error
 		obssubitem = &SubscriberItem{}
 		obssubitem.syncinterval = obs.syncinterval
 		obssubitem.synchronizer = obs.synchronizer
+		obssubitem.newObjectStore = obs.newObjectStore
 	}
 
 	subitem.DeepCopyInto(&obssubitem.SubscriberItem)
@@ -135,6 +140,7 @@ func CreateObjectBucketSubsriber(config *rest.Config, scheme *runtime.Scheme, mg
 
 	obsubscriber.itemmap = make(map[types.NamespacedName]*SubscriberItem)
 	obsubscriber.syncinterval = syncinterval
+	obsubscriber.newObjectStore = awsutils.NewHandler
 
 	return obsubscriber
 }
@@ -15,12 +15,21 @@
 package objectbucket
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"testing"
 	"time"
 
 	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
@@ -28,6 +37,9 @@ import (
 	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
 	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	awsutils "github.com/IBM/multicloud-operators-subscription/pkg/utils/aws"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils/objectstore"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils/timewindowtest"
 )
 
 var c client.Client
@@ -102,3 +114,379 @@ func TestDoSubscribeDeployable(t *testing.T) {
 	_, _, err = obsi.doSubscribeDeployable(dpl, nil, nil)
 	g.Expect(err).To(gomega.HaveOccurred())
 }
+
+// emptyObjectStore keeps an empty bucket
+type emptyObjectStore struct {
+	objectstore.ObjectStore
+}
+
+func (s *emptyObjectStore) List(bucket, prefix string) ([]objectstore.ObjectInfo, error) {
+	return nil, nil
+}
+
+func TestObjectSubscriberTimeWindows(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mgr, err := manager.New(cfg, manager.Options{MetricsBindAddress: "0"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(Add(mgr, cfg, &id, 2)).NotTo(gomega.HaveOccurred())
+	stopMgr, mgrStopped := StartTestManager(mgr, g)
+
+	defer func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+	}()
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	timewindowtest.Run(t, clt, helmsub, func(sub *appv1alpha1.Subscription) time.Duration {
+		obsi := &SubscriberItem{bucket: "timewindow", objectStore: &emptyObjectStore{}, synchronizer: defaultSubscriber.synchronizer}
+		obsi.Subscription = sub
+		obsi.Channel = helmchn.DeepCopy()
+
+		return obsi.syncOnce()
+	})
+}
+
+func bucketConfigMap(name string) []byte {
+	return []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ` + name + `
+data:
+  color: blue
+`)
+}
+
+// registeredConfigMaps returns the names of the ConfigMap templates registered to the synchronizer
+func registeredConfigMaps(obsi *SubscriberItem) map[string]bool {
+	names := make(map[string]bool)
+
+	resmap, ok := obsi.synchronizer.KubeResources[schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}]
+	if !ok {
+		return names
+	}
+
+	for _, tplunit := range resmap.TemplateMap {
+		if tplunit.GetNamespace() == obsi.Subscription.Namespace {
+			names[tplunit.GetName()] = true
+		}
+	}
+
+	return names
+}
+
+func TestObjectSubscriberMemoryStore(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mgr, err := manager.New(cfg, manager.Options{MetricsBindAddress: "0"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(Add(mgr, cfg, &id, 2)).NotTo(gomega.HaveOccurred())
+	stopMgr, mgrStopped := StartTestManager(mgr, g)
+
+	defer func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+	}()
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	sub := helmsub.DeepCopy()
+	sub.Name = "memorystore"
+	g.Expect(clt.Create(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+
+	store := objectstore.NewMemoryStore("templates")
+	g.Expect(store.Put("templates", "dev/bucket-config", bucketConfigMap("bucket-config"))).NotTo(gomega.HaveOccurred())
+	g.Expect(store.Put("templates", "dev/apps/", nil)).NotTo(gomega.HaveOccurred())
+	g.Expect(store.Put("templates", "dev/apps/web/web-config", bucketConfigMap("web-config"))).NotTo(gomega.HaveOccurred())
+	g.Expect(store.Put("templates", "prod/prod-config", bucketConfigMap("prod-config"))).NotTo(gomega.HaveOccurred())
+
+	var connected *objectstore.Config
+
+	obsi := &SubscriberItem{synchronizer: defaultSubscriber.synchronizer}
+	obsi.newObjectStore = func(cfg *objectstore.Config) (objectstore.ObjectStore, error) {
+		connected = cfg
+		return store, nil
+	}
+	obsi.Subscription = sub
+	obsi.Channel = helmchn.DeepCopy()
+	obsi.Channel.Spec.PathName = "http://minio:9000/templates/dev/"
+
+	g.Expect(obsi.initObjectStore()).NotTo(gomega.HaveOccurred())
+	g.Expect(connected.Endpoint).To(gomega.Equal("http://minio:9000"))
+	g.Expect(obsi.bucket).To(gomega.Equal("templates"))
+	g.Expect(obsi.prefix).To(gomega.Equal("dev/"))
+
+	// the objects below the prefix of the channel are registered to the synchronizer, including the ones in folders
+	g.Expect(obsi.doSubscription()).NotTo(gomega.HaveOccurred())
+	g.Expect(registeredConfigMaps(obsi)).To(gomega.Equal(map[string]bool{"bucket-config": true, "web-config": true}))
+	g.Expect(store.Gets).To(gomega.Equal(2))
+
+	// unchanged objects are not fetched again and stay registered
+	g.Expect(obsi.doSubscription()).NotTo(gomega.HaveOccurred())
+	g.Expect(registeredConfigMaps(obsi)).To(gomega.Equal(map[string]bool{"bucket-config": true, "web-config": true}))
+	g.Expect(store.Gets).To(gomega.Equal(2))
+
+	// only the changed object is fetched, the deleted one is detected from the listing
+	g.Expect(store.Put("templates", "dev/bucket-config", bucketConfigMap("renamed-config"))).NotTo(gomega.HaveOccurred())
+	g.Expect(store.Delete("templates", "dev/apps/web/web-config")).NotTo(gomega.HaveOccurred())
+
+	g.Expect(obsi.doSubscription()).NotTo(gomega.HaveOccurred())
+	g.Expect(registeredConfigMaps(obsi)).To(gomega.Equal(map[string]bool{"renamed-config": true}))
+	g.Expect(store.Gets).To(gomega.Equal(3))
+
+	g.Expect(store.Put("templates", "dev/apps/web/web-config", bucketConfigMap("web-config"))).NotTo(gomega.HaveOccurred())
+
+	// the subscription selects a folder below the prefix of the channel
+	obsi.SubscriptionConfigMap = &corev1.ConfigMap{Data: map[string]string{Path: "apps/web"}}
+
+	g.Expect(obsi.doSubscription()).NotTo(gomega.HaveOccurred())
+	g.Expect(registeredConfigMaps(obsi)).To(gomega.Equal(map[string]bool{"web-config": true}))
+
+	// a missing bucket fails the connection
+	obsi.Channel.Spec.PathName = "http://minio:9000/charts"
+	g.Expect(obsi.initObjectStore()).To(gomega.Equal(objectstore.ErrBucketNotFound))
+
+	hostkey := types.NamespacedName{Name: sub.Name, Namespace: sub.Namespace}
+	obsi.synchronizer.CleanupByHost(hostkey, objectbucketsyncsource+hostkey.String())
+
+	g.Expect(clt.Delete(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+}
+
+func TestParseBucketPath(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cases := []struct {
+		pathName string
+		endpoint string
+		bucket   string
+		prefix   string
+	}{
+		{"http://minio:9000/templates", "http://minio:9000", "templates", ""},
+		{"http://minio:9000/templates/", "http://minio:9000", "templates", ""},
+		{"https://s3.amazonaws.com/templates/dev/", "https://s3.amazonaws.com", "templates", "dev/"},
+		{"https://s3.amazonaws.com/templates/dev/apps/", "https://s3.amazonaws.com", "templates", "dev/apps/"},
+		// without the trailing "/" the last segment is the bucket, the endpoint may have a path
+		{"https://gateway.example.com/s3/templates", "https://gateway.example.com/s3", "templates", ""},
+	}
+
+	for _, tc := range cases {
+		endpoint, bucket, prefix, err := parseBucketPath(tc.pathName)
+		g.Expect(err).NotTo(gomega.HaveOccurred(), tc.pathName)
+		g.Expect([]string{endpoint, bucket, prefix}).To(gomega.Equal([]string{tc.endpoint, tc.bucket, tc.prefix}), tc.pathName)
+	}
+
+	for _, pathName := range []string{"templates", "http://minio:9000", "http://minio:9000/", "://minio"} {
+		_, _, _, err := parseBucketPath(pathName)
+		g.Expect(err).To(gomega.HaveOccurred(), pathName)
+	}
+
+	g.Expect(objectDeployableName("dev/", "dev/apps/web/web-config.yaml")).To(gomega.Equal("apps-web-web-config.yaml"))
+}
+
+func TestObjectStoreConfig(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	obsi := &SubscriberItem{}
+
+	// without a secret the object store uses its default credentials
+	cfg, err := obsi.objectStoreConfig("https://s3.amazonaws.com")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(*cfg).To(gomega.Equal(objectstore.Config{Endpoint: "https://s3.amazonaws.com"}))
+
+	obsi.ChannelSecret = &corev1.Secret{Data: map[string][]byte{
+		awsutils.SecretMapKeyAccessKeyID:     []byte("AKIAEXAMPLE"),
+		awsutils.SecretMapKeySecretAccessKey: []byte("c2VjcmV0"),
+		awsutils.SecretMapKeySessionToken:    []byte("dG9rZW4="),
+	}}
+	obsi.ChannelConfigMap = &corev1.ConfigMap{Data: map[string]string{
+		awsutils.ConfigMapKeyRegion:             "eu-west-1",
+		awsutils.ConfigMapKeyRoleARN:            "arn:aws:iam::123456789012:role/channel-reader",
+		awsutils.ConfigMapKeyCACert:             "-----BEGIN CERTIFICATE-----",
+		awsutils.ConfigMapKeyInsecureSkipVerify: "true",
+	}}
+
+	cfg, err = obsi.objectStoreConfig("https://rgw.example.com")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(*cfg).To(gomega.Equal(objectstore.Config{
+		Endpoint:           "https://rgw.example.com",
+		Region:             "eu-west-1",
+		AccessKeyID:        "AKIAEXAMPLE",
+		SecretAccessKey:    "c2VjcmV0",
+		SessionToken:       "dG9rZW4=",
+		RoleARN:            "arn:aws:iam::123456789012:role/channel-reader",
+		CACert:             []byte("-----BEGIN CERTIFICATE-----"),
+		InsecureSkipVerify: true,
+	}))
+
+	obsi.ChannelConfigMap.Data[awsutils.ConfigMapKeyInsecureSkipVerify] = "maybe"
+	_, err = obsi.objectStoreConfig("https://rgw.example.com")
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func chartArchive(g *gomega.GomegaWithT, name, version string, keywords ...string) []byte {
+	chartyaml := "apiVersion: v1\nname: " + name + "\nversion: " + version + "\nkeywords:\n"
+	for _, keyword := range keywords {
+		chartyaml += "- " + keyword + "\n"
+	}
+
+	buf := &bytes.Buffer{}
+	gzw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gzw)
+
+	g.Expect(tw.WriteHeader(&tar.Header{Name: name + "/Chart.yaml", Mode: 0644, Size: int64(len(chartyaml))})).To(gomega.Succeed())
+
+	_, err := tw.Write([]byte(chartyaml))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(tw.Close()).To(gomega.Succeed())
+	g.Expect(gzw.Close()).To(gomega.Succeed())
+
+	return buf.Bytes()
+}
+
+func registeredHelmRelease(g *gomega.GomegaWithT, obsi *SubscriberItem, name string) (string, []string) {
+	resmap, ok := obsi.synchronizer.KubeResources[HelmReleaseGVK]
+	g.Expect(ok).To(gomega.BeTrue())
+
+	for _, tplunit := range resmap.TemplateMap {
+		if tplunit.GetName() != name {
+			continue
+		}
+
+		version, _, err := unstructured.NestedString(tplunit.Object, "spec", "version")
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		urls, _, err := unstructured.NestedStringSlice(tplunit.Object, "spec", "source", "helmRepo", "urls")
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// the keys of the object store are not handed to the helm release as repo credentials
+		_, found, err := unstructured.NestedFieldNoCopy(tplunit.Object, "spec", "secretRef")
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		g.Expect(found).To(gomega.BeFalse())
+
+		return version, urls
+	}
+
+	return "", nil
+}
+
+func TestObjectSubscriberCharts(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mgr, err := manager.New(cfg, manager.Options{MetricsBindAddress: "0"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(Add(mgr, cfg, &id, 2)).NotTo(gomega.HaveOccurred())
+	stopMgr, mgrStopped := StartTestManager(mgr, g)
+
+	defer func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+	}()
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	sub := helmsub.DeepCopy()
+	sub.Name = "charts"
+	sub.Spec.Package = "nginx"
+	g.Expect(clt.Create(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+
+	store := objectstore.NewMemoryStore("charts")
+	g.Expect(store.Put("charts", "repo/nginx-1.0.0.tgz", chartArchive(g, "nginx", "1.0.0", "stable"))).NotTo(gomega.HaveOccurred())
+	betachart := chartArchive(g, "nginx", "1.1.0", "beta")
+	g.Expect(store.Put("charts", "repo/beta/nginx-1.1.0.tgz", betachart)).NotTo(gomega.HaveOccurred())
+	g.Expect(store.Put("charts", "repo/redis-2.0.0.tgz", chartArchive(g, "redis", "2.0.0", "stable"))).NotTo(gomega.HaveOccurred())
+
+	obsi := &SubscriberItem{synchronizer: defaultSubscriber.synchronizer}
+	obsi.newObjectStore = func(cfg *objectstore.Config) (objectstore.ObjectStore, error) {
+		return store, nil
+	}
+	obsi.Subscription = sub
+	obsi.Channel = helmchn.DeepCopy()
+	obsi.Channel.Spec.PathName = "http://minio:9000/charts/repo/"
+	obsi.Channel.Spec.SecretRef = &corev1.ObjectReference{Name: "s3keys", Namespace: obsi.Channel.Namespace}
+
+	g.Expect(obsi.initObjectStore()).NotTo(gomega.HaveOccurred())
+
+	releaseName := "nginx-" + sub.Name + "-" + sub.Namespace
+
+	// without an index the chart tarballs are indexed and the latest version of the package is picked
+	g.Expect(obsi.doSubscription()).NotTo(gomega.HaveOccurred())
+
+	version, urls := registeredHelmRelease(g, obsi, releaseName)
+	g.Expect(version).To(gomega.Equal("1.1.0"))
+	g.Expect(urls).To(gomega.Equal([]string{"memory://charts/repo/beta/nginx-1.1.0.tgz?expiry=168h0m0s"}))
+	g.Expect(registeredHelmRelease(g, obsi, "redis-"+sub.Name+"-"+sub.Namespace)).To(gomega.BeEmpty())
+
+	// the keywords of the charts are filtered like in helm repo channels
+	obsi.Subscription.Spec.PackageFilter = &appv1alpha1.PackageFilter{
+		LabelSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"stable": "true"}},
+	}
+
+	g.Expect(obsi.doSubscription()).NotTo(gomega.HaveOccurred())
+
+	version, urls = registeredHelmRelease(g, obsi, releaseName)
+	g.Expect(version).To(gomega.Equal("1.0.0"))
+	g.Expect(urls).To(gomega.Equal([]string{"memory://charts/repo/nginx-1.0.0.tgz?expiry=168h0m0s"}))
+
+	// the index of the bucket takes precedence over the chart tarballs
+	index := `apiVersion: v1
+entries:
+  nginx:
+  - name: nginx
+    version: 2.0.0
+    keywords:
+    - stable
+    urls:
+    - releases/nginx-2.0.0.tgz
+`
+	g.Expect(store.Put("charts", "repo/index.yaml", []byte(index))).NotTo(gomega.HaveOccurred())
+	g.Expect(store.Put("charts", "repo/releases/nginx-2.0.0.tgz", chartArchive(g, "nginx", "2.0.0", "stable"))).NotTo(gomega.HaveOccurred())
+
+	gets := store.Gets
+
+	g.Expect(obsi.doSubscription()).NotTo(gomega.HaveOccurred())
+
+	version, urls = registeredHelmRelease(g, obsi, releaseName)
+	g.Expect(version).To(gomega.Equal("2.0.0"))
+	g.Expect(urls).To(gomega.Equal([]string{"memory://charts/repo/releases/nginx-2.0.0.tgz?expiry=168h0m0s"}))
+
+	// with an index only the index is read, the helm release downloads the tarball
+	g.Expect(store.Gets - gets).To(gomega.Equal(1))
+	g.Expect(obsi.objects["repo/releases/nginx-2.0.0.tgz"].unfetched).To(gomega.BeTrue())
+
+	// the cached charts are left unchanged by the filtering
+	g.Expect(obsi.objects["repo/beta/nginx-1.1.0.tgz"].chart.URLs).To(gomega.Equal([]string{"local://beta/nginx-1.1.0.tgz"}))
+
+	// the digest of the streamed chart covers the whole tarball
+	digest := sha256.Sum256(betachart)
+	g.Expect(obsi.objects["repo/beta/nginx-1.1.0.tgz"].chart.Digest).To(gomega.Equal(hex.EncodeToString(digest[:])))
+
+	// without the index the tarballs left unread are indexed again
+	g.Expect(store.Delete("charts", "repo/index.yaml")).NotTo(gomega.HaveOccurred())
+	g.Expect(obsi.doSubscription()).NotTo(gomega.HaveOccurred())
+
+	version, _ = registeredHelmRelease(g, obsi, releaseName)
+	g.Expect(version).To(gomega.Equal("2.0.0"))
+	g.Expect(obsi.objects["repo/releases/nginx-2.0.0.tgz"].unfetched).To(gomega.BeFalse())
+
+	// the URLs presigned with temporary credentials expire with them and are renewed half way
+	store.PresignLifetime = 10 * time.Minute
+	obsi.chartURLs = nil
+
+	g.Expect(obsi.doSubscription()).NotTo(gomega.HaveOccurred())
+
+	_, urls = registeredHelmRelease(g, obsi, releaseName)
+	g.Expect(urls).To(gomega.Equal([]string{"memory://charts/repo/releases/nginx-2.0.0.tgz?expiry=10m0s"}))
+	g.Expect(obsi.chartURLs["charts/repo/releases/nginx-2.0.0.tgz"].renew).To(gomega.BeTemporally("~", time.Now().Add(5*time.Minute), time.Minute))
+
+	hostkey := types.NamespacedName{Name: sub.Name, Namespace: sub.Namespace}
+	obsi.synchronizer.CleanupByHost(hostkey, objectbucketsyncsource+hostkey.String())
+
+	g.Expect(clt.Delete(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+}
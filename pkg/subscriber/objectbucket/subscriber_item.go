@@ -18,35 +18,72 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/url"
+	"path"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ghodss/yaml"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/helm/pkg/repo"
 	"k8s.io/klog"
 
 	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	"github.com/IBM/multicloud-operators-subscription/pkg/subscriber/helmrepo"
 	kubesynchronizer "github.com/IBM/multicloud-operators-subscription/pkg/synchronizer/kubernetes"
 
 	"github.com/IBM/multicloud-operators-subscription/pkg/utils"
 	awsutils "github.com/IBM/multicloud-operators-subscription/pkg/utils/aws"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils/objectstore"
 )
 
 var SubscriptionGVK = schema.GroupVersionKind{Group: "app.ibm.com", Kind: "Subscription", Version: "v1alpha1"}
 
+// HelmReleaseGVK is the kind of the deployables of the charts in the bucket
+var HelmReleaseGVK = schema.GroupVersionKind{Group: "app.ibm.com", Kind: "HelmRelease", Version: "v1alpha1"}
+
+const (
+	// Path is the key of object bucket package filter config map, a folder below the prefix of the channel
+	Path = "path"
+	// HelmIndexFile is the helm repo index below the prefix, it indexes the charts instead of the chart tarballs
+	HelmIndexFile = "index.yaml"
+	// HelmChartSuffix is the suffix of the chart tarballs
+	HelmChartSuffix = ".tgz"
+	// ChartURLExpiry is how long the presigned URLs of the chart tarballs in the bucket are valid, the longest SigV4
+	// allows. Renewing a URL rewrites the helm release, the URLs expire earlier with temporary credentials though
+	ChartURLExpiry = 7 * 24 * time.Hour
+)
+
+// presignedURL is a presigned chart URL and the time it is presigned again, half way to its expiry
+type presignedURL struct {
+	url   string
+	renew time.Time
+}
+
 // SubscriberItem - defines the unit of namespace subscription
 type SubscriberItem struct {
 	appv1alpha1.SubscriberItem
 
-	bucket      string
-	objectStore awsutils.ObjectStore
-	stopch      chan struct{}
+	endpoint       string
+	bucket         string
+	prefix         string
+	objectStore    objectstore.ObjectStore
+	newObjectStore objectstore.Factory
+	stopch         chan struct{}
+
+	// objects caches the objects of the last listing by key, objectsPath is the bucket and prefix they are listed from
+	objects          map[string]*bucketObject
+	objectsPath      string
+	syncedGeneration int64
+	syncedVersions   map[string]utils.VersionRep
+	// chartURLs caches the presigned URLs of the chart tarballs by key
+	chartURLs map[string]*presignedURL
 
 	syncinterval int
 	synchronizer *kubesynchronizer.KubeSynchronizer
@@ -66,24 +103,39 @@ func (obsi *SubscriberItem) Start() {
 
 	obsi.stopch = make(chan struct{})
 
-	go wait.Until(func() {
-		tw := obsi.SubscriberItem.Subscription.Spec.TimeWindow
-		if tw != nil {
-			nextRun := utils.NextStartPoint(tw, time.Now())
-			if nextRun > time.Duration(0) {
-				klog.V(1).Infof("Subcription %v/%v will de deploy after %v",
-					obsi.SubscriberItem.Subscription.GetNamespace(),
-					obsi.SubscriberItem.Subscription.GetName(), nextRun)
-				return
-			}
-		}
+	go utils.SyncUntil(obsi.syncOnce, time.Duration(obsi.syncinterval)*time.Second, obsi.stopch)
+}
 
-		err := obsi.doSubscription()
+// syncOnce runs one round of the subscriber loop, returns how long the loop holds off for the time window
+func (obsi *SubscriberItem) syncOnce() time.Duration {
+	if nextRun := utils.TimeWindowHoldOff(obsi.synchronizer.LocalClient, obsi.SubscriberItem.Subscription, obsi.objectsChanged); nextRun > 0 {
+		return nextRun
+	}
 
-		if err != nil {
-			klog.Error("Object Bucket ", obsi.Subscription.Namespace, "/", obsi.Subscription.Name, "housekeeping failed with error: ", err)
-		}
-	}, time.Duration(obsi.syncinterval)*time.Second, obsi.stopch)
+	if obsi.SubscriberItem.Subscription.Spec.Suspend {
+		klog.V(1).Infof("Subscription %v/%v is suspended",
+			obsi.SubscriberItem.Subscription.GetNamespace(), obsi.SubscriberItem.Subscription.GetName())
+		return time.Duration(0)
+	}
+
+	if utils.IsWaitingForDependency(obsi.synchronizer.LocalClient, obsi.SubscriberItem.Subscription) {
+		return time.Duration(0)
+	}
+
+	if utils.IsWaitingForApproval(obsi.SubscriberItem.Subscription, obsi.SubscriberItem.Channel, nil) {
+		return time.Duration(0)
+	}
+
+	err := obsi.doSubscription()
+
+	if err != nil {
+		klog.Error("Object Bucket ", obsi.Subscription.Namespace, "/", obsi.Subscription.Name, "housekeeping failed with error: ", err)
+		return time.Duration(0)
+	}
+
+	_ = utils.ClearTimeWindowPending(obsi.synchronizer.LocalClient, obsi.SubscriberItem.Subscription)
+
+	return time.Duration(0)
 }
 
 // Stop the subscriber
@@ -97,8 +149,6 @@ func (obsi *SubscriberItem) Stop() {
 func (obsi *SubscriberItem) initObjectStore() error {
 	var err error
 
-	awshandler := &awsutils.Handler{}
-
 	pathName := obsi.Channel.Spec.PathName
 
 	if pathName == "" {
@@ -108,81 +158,170 @@ func (obsi *SubscriberItem) initObjectStore() error {
 		return errors.New(errmsg)
 	}
 
-	if strings.HasSuffix(pathName, "/") {
-		last := len(pathName) - 1
-		pathName = pathName[:last]
+	endpoint, bucket, prefix, err := parseBucketPath(pathName)
+	if err != nil {
+		klog.Error("Invalid Pathname in channel ", obsi.Channel.Name, " error: ", err)
+		return err
 	}
 
-	loc := strings.LastIndex(pathName, "/")
-	endpoint := pathName[:loc]
-	obsi.bucket = pathName[loc+1:]
-
-	accessKeyID := ""
-	secretAccessKey := ""
+	// the cached objects belong to the former object store
+	if endpoint != obsi.endpoint {
+		obsi.objects = nil
+	}
 
-	if obsi.ChannelSecret != nil {
-		err = yaml.Unmarshal(obsi.ChannelSecret.Data[awsutils.SecretMapKeyAccessKeyID], &accessKeyID)
-		if err != nil {
-			klog.Error("Failed to unmashall accessKey from secret with error:", err)
+	obsi.endpoint = endpoint
+	obsi.bucket = bucket
+	obsi.prefix = prefix
 
-			return err
-		}
+	cfg, err := obsi.objectStoreConfig(endpoint)
+	if err != nil {
+		return err
+	}
 
-		err = yaml.Unmarshal(obsi.ChannelSecret.Data[awsutils.SecretMapKeySecretAccessKey], &secretAccessKey)
-		if err != nil {
-			klog.Error("Failed to unmashall secretaccessKey from secret with error:", err)
+	klog.V(2).Info("Trying to connect to aws ", endpoint, "|", obsi.bucket, "|", obsi.prefix)
 
-			return err
-		}
+	newObjectStore := obsi.newObjectStore
+	if newObjectStore == nil {
+		newObjectStore = awsutils.NewHandler
 	}
 
-	klog.V(2).Info("Trying to connect to aws ", endpoint, "|", obsi.bucket)
-
-	if err := awshandler.InitObjectStoreConnection(endpoint, accessKeyID, secretAccessKey); err != nil {
+	store, err := newObjectStore(cfg)
+	if err != nil {
 		klog.Error(err, "unable initialize object store settings")
 		return err
 	}
 	// Check whether the connection is setup successfully
-	if err := awshandler.Exists(obsi.bucket); err != nil {
+	if err := store.Exists(obsi.bucket); err != nil {
 		klog.Error(err, "Unable to access object store bucket ", obsi.bucket, " for channel ", obsi.Channel.Name)
 		return err
 	}
 
-	obsi.objectStore = awshandler
+	obsi.objectStore = store
+	// the presigned chart URLs may be signed with the former credentials
+	obsi.chartURLs = nil
 
 	return nil
 }
 
-func (obsi *SubscriberItem) doSubscription() error {
-	var dpls []*dplv1alpha1.Deployable
+// objectStoreConfig reads the connection to the object store from the channel secret and config map,
+// without access keys in the secret the object store uses its default credentials
+func (obsi *SubscriberItem) objectStoreConfig(endpoint string) (*objectstore.Config, error) {
+	cfg := &objectstore.Config{Endpoint: endpoint}
 
-	keys, err := obsi.objectStore.List(obsi.bucket)
-	klog.V(5).Infof("object keys: %v", keys)
+	if obsi.ChannelSecret != nil {
+		secretKeys := []struct {
+			key   string
+			value *string
+		}{
+			{awsutils.SecretMapKeyAccessKeyID, &cfg.AccessKeyID},
+			{awsutils.SecretMapKeySecretAccessKey, &cfg.SecretAccessKey},
+			{awsutils.SecretMapKeySessionToken, &cfg.SessionToken},
+		}
 
-	if err != nil {
-		klog.Info("Failed to list objects in bucket ", obsi.bucket)
+		for _, sk := range secretKeys {
+			if err := yaml.Unmarshal(obsi.ChannelSecret.Data[sk.key], sk.value); err != nil {
+				klog.Error("Failed to unmashall ", sk.key, " from secret with error:", err)
+				return nil, err
+			}
+		}
 	}
-	//converting template from obeject store to DPL
-	for _, key := range keys {
-		tplb, err := obsi.objectStore.Get(obsi.bucket, key)
-		if err != nil {
-			klog.Info("Failed to get object ", key, " in bucket ", obsi.bucket)
-			return err
+
+	if obsi.ChannelConfigMap != nil {
+		data := obsi.ChannelConfigMap.Data
+
+		cfg.Region = data[awsutils.ConfigMapKeyRegion]
+		cfg.RoleARN = data[awsutils.ConfigMapKeyRoleARN]
+		cfg.CACert = []byte(data[awsutils.ConfigMapKeyCACert])
+
+		if data[awsutils.ConfigMapKeyInsecureSkipVerify] != "" {
+			b, err := strconv.ParseBool(data[awsutils.ConfigMapKeyInsecureSkipVerify])
+			if err != nil {
+				klog.Error(err, "Unable to parse insecureSkipVerify: ", data[awsutils.ConfigMapKeyInsecureSkipVerify])
+				return nil, err
+			}
+
+			cfg.InsecureSkipVerify = b
 		}
+	}
 
-		dpl := &dplv1alpha1.Deployable{}
-		dpl.Name = key
-		dpl.Namespace = obsi.bucket
-		dpl.Spec.Template = &runtime.RawExtension{}
-		err = yaml.Unmarshal(tplb, dpl.Spec.Template)
+	return cfg, nil
+}
 
-		if err != nil {
-			klog.Error("Failed to unmashall ", obsi.bucket, "/", key, " err:", err)
-			continue
+// parseBucketPath splits the channel pathname into the endpoint, the bucket and the prefix. A pathname ending with "/"
+// is <endpoint>/<bucket>/[<prefix>/], otherwise the last segment is the bucket and the endpoint keeps the rest of the path,
+// as in https://gateway/s3/<bucket>. A prefix is empty or ends with "/"
+func parseBucketPath(pathName string) (string, string, string, error) {
+	u, err := url.Parse(pathName)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	if u.Scheme == "" || u.Host == "" {
+		return "", "", "", errors.New("pathname " + pathName + " is not an endpoint URL")
+	}
+
+	bucketPath := strings.Trim(u.Path, "/")
+	if bucketPath == "" {
+		return "", "", "", errors.New("pathname " + pathName + " has no bucket")
+	}
+
+	endpoint := u.Scheme + "://" + u.Host
+
+	if !strings.HasSuffix(u.Path, "/") {
+		loc := strings.LastIndex(bucketPath, "/")
+		if loc < 0 {
+			return endpoint, bucketPath, "", nil
 		}
 
-		klog.V(5).Infof("Retived Dpl: %v", dpl)
-		dpls = append(dpls, dpl)
+		return endpoint + "/" + bucketPath[:loc], bucketPath[loc+1:], "", nil
+	}
+
+	segments := strings.SplitN(bucketPath, "/", 2)
+
+	prefix := ""
+	if len(segments) > 1 {
+		prefix = joinBucketPrefix("", segments[1])
+	}
+
+	return endpoint, segments[0], prefix, nil
+}
+
+// joinBucketPrefix appends the folder to the prefix
+func joinBucketPrefix(prefix, folder string) string {
+	folder = strings.Trim(folder, "/")
+	if folder == "" {
+		return prefix
+	}
+
+	return prefix + folder + "/"
+}
+
+// objectDeployableName names the deployable of an object by its key below the prefix, folders are separated by "-"
+func objectDeployableName(prefix, key string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(key, prefix), "/", "-")
+}
+
+func (obsi *SubscriberItem) doSubscription() error {
+	prefix := obsi.prefix
+	if obsi.SubscriptionConfigMap != nil {
+		prefix = joinBucketPrefix(prefix, obsi.SubscriptionConfigMap.Data[Path])
+	}
+
+	// an incomplete listing would remove the resources of the missing objects
+	objects, err := obsi.syncObjects(prefix)
+	if err != nil {
+		klog.Info("Failed to sync objects in bucket ", obsi.bucket, " with prefix ", prefix)
+		return err
+	}
+
+	var dpls []*dplv1alpha1.Deployable
+
+	keys := sortedObjectKeys(objects)
+
+	for _, key := range keys {
+		if objects[key].dpl != nil {
+			dpls = append(dpls, objects[key].dpl)
+		}
 	}
 
 	hostkey := types.NamespacedName{Name: obsi.Subscription.Name, Namespace: obsi.Subscription.Namespace}
@@ -191,16 +330,28 @@ func (obsi *SubscriberItem) doSubscription() error {
 	kvalid := obsi.synchronizer.CreateValiadtor(syncsource)
 	pkgMap := make(map[string]bool)
 
-	var vsub = ""
+	versionMap, dropped := utils.SelectVersionSet(dpls, obsi.Subscription.Spec.PackageFilter,
+		utils.GetDeployedPackages(&obsi.Subscription.Status), time.Now())
 
-	if obsi.Subscription.Spec.PackageFilter != nil {
-		vsub = obsi.Subscription.Spec.PackageFilter.Version
-	}
+	// the templates of unchanged objects stay registered unless the subscription or the selected versions change
+	resync := obsi.syncedGeneration != obsi.Subscription.Generation || !reflect.DeepEqual(obsi.syncedVersions, versionMap)
+
+	for _, key := range keys {
+		obj := objects[key]
+		if obj.dpl == nil {
+			continue
+		}
+
+		if !resync && !obj.changed && obj.registered != nil {
+			kvalid.AddValidResource(obj.registered.gvk, hostkey, obj.registered.dplkey)
+			pkgMap[obj.registered.dplkey.Name] = true
+
+			continue
+		}
 
-	versionMap := utils.GenerateVersionSet(dpls, vsub)
+		obj.registered = nil
 
-	for _, dpl := range dpls {
-		dpltosync, validgvk, err := obsi.doSubscribeDeployable(dpl.DeepCopy(), versionMap, pkgMap)
+		dpltosync, validgvk, err := obsi.doSubscribeDeployable(obj.dpl.DeepCopy(), versionMap, pkgMap)
 
 		if err != nil {
 			continue
@@ -227,13 +378,21 @@ func (obsi *SubscriberItem) doSubscription() error {
 		}
 		kvalid.AddValidResource(*validgvk, hostkey, dplkey)
 
+		obj.registered = &registeredTemplate{gvk: *validgvk, dplkey: dplkey}
 		pkgMap[dplkey.Name] = true
 
 		klog.V(5).Info("Finished Register ", *validgvk, hostkey, dplkey, " with err:", err)
 	}
 
+	utils.SetDroppedPackagesStatus(&obsi.Subscription.Status, dropped, pkgMap)
+
+	obsi.subscribeCharts(chartIndex(objects, keys), prefix, hostkey, syncsource, kvalid, pkgMap)
+
 	obsi.synchronizer.ApplyValiadtor(kvalid)
 
+	obsi.syncedGeneration = obsi.Subscription.Generation
+	obsi.syncedVersions = versionMap
+
 	if utils.ValidatePackagesInSubscriptionStatus(obsi.synchronizer.LocalClient, obsi.Subscription, pkgMap) != nil {
 		err = obsi.synchronizer.LocalClient.Get(context.TODO(), hostkey, obsi.Subscription)
 		if err != nil {
@@ -246,6 +405,123 @@ func (obsi *SubscriberItem) doSubscription() error {
 	return err
 }
 
+// subscribeCharts registers the HelmRelease of the charts picked by the subscription like helm repo channels do
+func (obsi *SubscriberItem) subscribeCharts(indexFile *repo.IndexFile, prefix string, hostkey types.NamespacedName,
+	syncsource string, kvalid *kubesynchronizer.Validator, pkgMap map[string]bool) {
+	if len(indexFile.Entries) == 0 {
+		return
+	}
+
+	if obsi.Subscription.Spec.Package == "" {
+		klog.V(3).Info("Skipping the charts in bucket ", obsi.bucket, ", subscription ", hostkey, " has no package name")
+		return
+	}
+
+	dropped, err := helmrepo.FilterCharts(&obsi.SubscriberItem, obsi.synchronizer, indexFile)
+	if err != nil {
+		klog.Info("Failed to filter charts in bucket ", obsi.bucket, " with error: ", err)
+		return
+	}
+
+	utils.SetDroppedPackagesStatus(&obsi.Subscription.Status, dropped, pkgMap)
+
+	// the secret of the channel holds the keys of the object store, the helm releases read the charts through
+	// presigned URLs instead
+	subitem := obsi.SubscriberItem
+	subitem.Channel = obsi.Channel.DeepCopy()
+	subitem.Channel.Spec.SecretRef = nil
+
+	for packageName, chartVersions := range indexFile.Entries {
+		if len(chartVersions) == 0 {
+			continue
+		}
+
+		if err := obsi.presignChartURLs(chartVersions[0], prefix); err != nil {
+			klog.Info("Failed to presign the URLs of chart ", packageName, " with error: ", err)
+			continue
+		}
+
+		dpl, err := helmrepo.HelmReleaseDeployable(&subitem, obsi.synchronizer, packageName, chartVersions[0], "")
+		if err != nil {
+			klog.Info("Failed to package chart ", packageName, " with error: ", err)
+			continue
+		}
+
+		validgvk := obsi.synchronizer.GetValidatedGVK(HelmReleaseGVK)
+		if validgvk == nil {
+			gvkerr := errors.New("Resource " + HelmReleaseGVK.String() + " is not supported")
+			klog.V(2).Info(gvkerr)
+
+			err = utils.SetInClusterPackageStatus(&(obsi.Subscription.Status), dpl.GetName(), gvkerr, nil)
+			if err != nil {
+				klog.Info("error in setting in cluster package status :", err)
+			}
+
+			pkgMap[dpl.GetName()] = true
+
+			continue
+		}
+
+		err = obsi.synchronizer.RegisterTemplate(hostkey, dpl, syncsource)
+		if err != nil {
+			klog.Info("eror in registering :", err)
+			err = utils.SetInClusterPackageStatus(&(obsi.Subscription.Status), dpl.GetName(), err, nil)
+
+			if err != nil {
+				klog.Info("error in setting in cluster package status :", err)
+			}
+
+			pkgMap[dpl.GetName()] = true
+
+			continue
+		}
+
+		dplkey := types.NamespacedName{
+			Name:      dpl.Name,
+			Namespace: dpl.Namespace,
+		}
+		kvalid.AddValidResource(*validgvk, hostkey, dplkey)
+
+		pkgMap[dplkey.Name] = true
+
+		klog.V(5).Info("Finished Register ", *validgvk, hostkey, dplkey)
+	}
+}
+
+// presignChartURLs replaces the local:// URLs of the chart version, relative to the prefix, with presigned URLs of the
+// tarballs in the bucket. A cached URL is reused until half of its expiry passed so the helm release stays unchanged
+func (obsi *SubscriberItem) presignChartURLs(chartVersion *repo.ChartVersion, prefix string) error {
+	if obsi.chartURLs == nil {
+		obsi.chartURLs = make(map[string]*presignedURL)
+	}
+
+	now := time.Now()
+
+	for i, chartURL := range chartVersion.URLs {
+		if !strings.HasPrefix(chartURL, "local://") {
+			continue
+		}
+
+		key := path.Join(prefix, strings.TrimPrefix(chartURL, "local://"))
+
+		presigned, ok := obsi.chartURLs[obsi.bucket+"/"+key]
+		if !ok || now.After(presigned.renew) {
+			signed, expires, err := obsi.objectStore.PresignGet(obsi.bucket, key, ChartURLExpiry)
+			if err != nil {
+				return err
+			}
+
+			// the URL is never reused past the lifetime of the credentials signing it
+			presigned = &presignedURL{url: signed, renew: now.Add(expires.Sub(now) / 2)}
+			obsi.chartURLs[obsi.bucket+"/"+key] = presigned
+		}
+
+		chartVersion.URLs[i] = presigned.url
+	}
+
+	return nil
+}
+
 func (obsi *SubscriberItem) doSubscribeDeployable(dpl *dplv1alpha1.Deployable,
 	versionMap map[string]utils.VersionRep, pkgMap map[string]bool) (*dplv1alpha1.Deployable, *schema.GroupVersionKind, error) {
 	var annotations map[string]string
@@ -334,6 +610,8 @@ func (obsi *SubscriberItem) doSubscribeDeployable(dpl *dplv1alpha1.Deployable,
 		return nil, nil, errors.New(errmsg)
 	}
 
+	utils.SetDeployedVersionAnnotations(template, dpl)
+
 	template.SetOwnerReferences([]metav1.OwnerReference{{
 		APIVersion: SubscriptionGVK.Version,
 		Kind:       SubscriptionGVK.Kind,
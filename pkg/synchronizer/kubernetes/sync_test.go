@@ -450,3 +450,60 @@ func TestServiceResource(t *testing.T) {
 
 	g.Expect(svc.Spec.Ports[0]).Should(gomega.Equal(serviceport2))
 }
+
+func TestValueFromSecretChange(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	sync, err := CreateSynchronizer(cfg, cfg, &host, 2, nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	stop := make(chan struct{})
+	sync.dynamicFactory.Start(stop)
+
+	defer close(stop)
+
+	sub := subinstance.DeepCopy()
+	g.Expect(c.Create(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+
+	defer c.Delete(context.TODO(), sub)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "valuefrom-db", Namespace: sharedkey.Namespace},
+		Data:       map[string][]byte{"password": []byte("old")},
+	}
+	g.Expect(c.Create(context.TODO(), secret)).NotTo(gomega.HaveOccurred())
+
+	defer c.Delete(context.TODO(), secret)
+
+	cfgmap := workloadconfigmap.DeepCopy()
+	cfgmap.Name = "valuefrom-workload"
+	cfgmap.Annotations = map[string]string{
+		appv1alpha1.AnnotationValueFromOverrides: `[{"path":"data.password","valueFrom":{"secretKeyRef":{"name":"valuefrom-db","key":"password"}}}]`,
+	}
+
+	dpl := dplinstance.DeepCopy()
+	dpl.Spec.Template = &runtime.RawExtension{Object: cfgmap}
+	g.Expect(sync.RegisterTemplate(sharedkey, dpl, source)).NotTo(gomega.HaveOccurred())
+
+	defer sync.DeRegisterTemplate(sharedkey, sharedkey, source)
+
+	cfgkey := types.NamespacedName{Name: cfgmap.Name, Namespace: cfgmap.Namespace}
+	result := &corev1.ConfigMap{}
+
+	sync.houseKeeping()
+	g.Expect(c.Get(context.TODO(), cfgkey, result)).NotTo(gomega.HaveOccurred())
+	g.Expect(result.Data).To(gomega.HaveKeyWithValue("password", "old"))
+
+	secret.Data["password"] = []byte("new")
+	g.Expect(c.Update(context.TODO(), secret)).NotTo(gomega.HaveOccurred())
+
+	g.Eventually(func() string {
+		sync.houseKeeping()
+
+		if err := c.Get(context.TODO(), cfgkey, result); err != nil {
+			return ""
+		}
+
+		return result.Data["password"]
+	}, 10*time.Second, time.Second).Should(gomega.Equal("new"))
+}
@@ -18,6 +18,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
@@ -47,6 +48,11 @@ type TemplateUnit struct {
 	Source          string
 	ResourceUpdated bool
 	StatusUpdated   bool
+	// overrides resolved from ConfigMaps and Secrets of ValueFromNamespace when the resource is applied,
+	// the template keeps the references only so the values stay out of the registry and its logs
+	ValueFrom          []utils.ValueFromOverride
+	ValueFromNamespace string
+	ValueFromHash      string
 }
 
 // ResourceMap is a registry for all resources
@@ -71,6 +77,10 @@ type KubeSynchronizer struct {
 	signal <-chan struct{}
 
 	dynamicFactory dynamicinformer.DynamicSharedInformerFactory
+
+	// ConfigMaps and Secrets changed since the last house keeping, keyed by valueSourceKey
+	valueSourcesMutex   sync.Mutex
+	valueSourcesChanged map[string]bool
 }
 
 var (
@@ -144,6 +154,7 @@ func CreateSynchronizer(config, remoteConfig *rest.Config, syncid *types.Namespa
 	}
 
 	s.discoverResources()
+	s.watchValueFromSources()
 
 	return s, nil
 }
@@ -175,6 +186,7 @@ func (sync *KubeSynchronizer) Start(s <-chan struct{}) error {
 //HouseKeeping - Apply resources defined in sync.KubeResources
 func (sync *KubeSynchronizer) houseKeeping() {
 	crdUpdated := false
+	valueSourcesChanged := sync.takeChangedValueSources()
 	// make sure the template map and the actual resource are aligned
 	for gvk, res := range sync.KubeResources {
 		var err error
@@ -198,7 +210,7 @@ func (sync *KubeSynchronizer) houseKeeping() {
 			continue
 		}
 
-		sync.applyKindTemplates(res)
+		sync.applyKindTemplates(res, valueSourcesChanged)
 	}
 
 	if crdUpdated {
@@ -301,7 +313,19 @@ func (sync *KubeSynchronizer) checkServerObjects(res *ResourceMap) error {
 
 func (sync *KubeSynchronizer) createNewResourceByTemplateUnit(ri dynamic.ResourceInterface, tplunit *TemplateUnit) error {
 	klog.V(5).Info("Apply - Creating New Resource ", tplunit)
-	obj, err := ri.Create(tplunit.Unstructured, metav1.CreateOptions{})
+
+	tplobj, err := sync.resolveTemplate(tplunit)
+	if err != nil {
+		tplunit.ResourceUpdated = false
+
+		if sterr := sync.Extension.UpdateHostStatus(err, tplunit.Unstructured, nil); sterr != nil {
+			klog.Error("Failed to update host status with error: ", sterr)
+		}
+
+		return err
+	}
+
+	obj, err := ri.Create(tplobj, metav1.CreateOptions{})
 
 	// Auto Create Namespace if not exist
 	if err != nil && errors.IsNotFound(err) {
@@ -318,7 +342,7 @@ func (sync *KubeSynchronizer) createNewResourceByTemplateUnit(ri dynamic.Resourc
 
 			if err == nil {
 				// try again
-				obj, err = ri.Create(tplunit.Unstructured, metav1.CreateOptions{})
+				obj, err = ri.Create(tplobj, metav1.CreateOptions{})
 			}
 		}
 	}
@@ -351,7 +375,8 @@ func (sync *KubeSynchronizer) updateResourceByTemplateUnit(ri dynamic.ResourceIn
 	var err error
 
 	tplown := sync.Extension.GetHostFromObject(tplunit)
-	if tplown != nil && !sync.Extension.IsObjectOwnedByHost(obj, *tplown, sync.SynchronizerID) {
+	if tplown != nil && !sync.Extension.IsObjectOwnedByHost(obj, *tplown, sync.SynchronizerID) &&
+		!sync.isOwnedByLowerChannelPrecedence(obj, *tplown) {
 		errmsg := "Obj " + tplunit.GetNamespace() + "/" + tplunit.GetName() + " exists and owned by others, backoff"
 		klog.Info(errmsg)
 
@@ -366,8 +391,16 @@ func (sync *KubeSynchronizer) updateResourceByTemplateUnit(ri dynamic.ResourceIn
 		return err
 	}
 
-	newobj := tplunit.Unstructured.DeepCopy()
-	newobj.SetResourceVersion(obj.GetResourceVersion())
+	newobj, err := sync.resolveTemplate(tplunit)
+	if err != nil {
+		tplunit.ResourceUpdated = false
+
+		if sterr := sync.Extension.UpdateHostStatus(err, tplunit.Unstructured, nil); sterr != nil {
+			klog.Error("Failed to update host status with error: ", sterr)
+		}
+
+		return err
+	}
 
 	if isService {
 		var objb, tplb, pb []byte
@@ -378,7 +411,7 @@ func (sync *KubeSynchronizer) updateResourceByTemplateUnit(ri dynamic.ResourceIn
 			return err
 		}
 
-		tplb, err = tplunit.MarshalJSON()
+		tplb, err = newobj.MarshalJSON()
 
 		if err != nil {
 			klog.Error("Failed to marshall tplunit with error:", err)
@@ -391,10 +424,14 @@ func (sync *KubeSynchronizer) updateResourceByTemplateUnit(ri dynamic.ResourceIn
 			return err
 		}
 
-		klog.V(4).Info("Generating Patch for service update.\nObjb:", string(objb), "\ntplb:", string(tplb), "\nPatch:", string(pb))
+		// resolved valueFrom overrides may be secrets
+		if len(tplunit.ValueFrom) == 0 {
+			klog.V(4).Info("Generating Patch for service update.\nObjb:", string(objb), "\ntplb:", string(tplb), "\nPatch:", string(pb))
+		}
 
 		_, err = ri.Patch(obj.GetName(), types.MergePatchType, pb, metav1.PatchOptions{})
 	} else {
+		newobj.SetResourceVersion(obj.GetResourceVersion())
 		_, err = ri.Update(newobj, metav1.UpdateOptions{})
 	}
 
@@ -415,15 +452,49 @@ func (sync *KubeSynchronizer) updateResourceByTemplateUnit(ri dynamic.ResourceIn
 	return nil
 }
 
+// resolveTemplate returns a copy of the template with the values of its valueFrom overrides
+func (sync *KubeSynchronizer) resolveTemplate(tplunit *TemplateUnit) (*unstructured.Unstructured, error) {
+	if len(tplunit.ValueFrom) == 0 {
+		return tplunit.Unstructured.DeepCopy(), nil
+	}
+
+	tplobj, hash, err := utils.ResolveValueFromOverrides(sync.LocalClient, tplunit.Unstructured, tplunit.ValueFrom, tplunit.ValueFromNamespace)
+	if err != nil {
+		klog.Error("Failed to resolve valueFrom overrides of ", tplunit.GetNamespace(), "/", tplunit.GetName(), " with error: ", err)
+		return nil, err
+	}
+
+	tplunit.ValueFromHash = hash
+
+	return tplobj, nil
+}
+
+// isOwnedByLowerChannelPrecedence checks if the object is owned by a subscription of an earlier channel in the same
+// channel list, so a later channel can take the resource over
+func (sync *KubeSynchronizer) isOwnedByLowerChannelPrecedence(obj metav1.Object, host types.NamespacedName) bool {
+	if !sync.Extension.IsObjectOwnedBySynchronizer(obj, sync.SynchronizerID) {
+		return false
+	}
+
+	objhost := sync.Extension.GetHostFromObject(obj)
+	if objhost == nil {
+		return false
+	}
+
+	return utils.HasChannelPrecedence(sync.LocalClient, host, *objhost)
+}
+
 var serviceGVR = schema.GroupVersionResource{
 	Version:  "v1",
 	Resource: "Service",
 }
 
-func (sync *KubeSynchronizer) applyKindTemplates(res *ResourceMap) {
+func (sync *KubeSynchronizer) applyKindTemplates(res *ResourceMap, valueSourcesChanged map[string]bool) {
 	nri := sync.DynamicClient.Resource(res.GroupVersionResource)
 
 	for k, tplunit := range res.TemplateMap {
+		sync.refreshValueFrom(tplunit, valueSourcesChanged)
+
 		err := sync.applyTemplate(nri, res.Namespaced, k, tplunit, (res.GroupVersionResource == serviceGVR))
 		if err != nil {
 			klog.Error("Failed to apply kind template", tplunit.Unstructured, "with error:", err)
@@ -678,19 +749,40 @@ func (sync *KubeSynchronizer) RegisterTemplate(host types.NamespacedName, instan
 		}
 	}
 
+	// valueFrom overrides are resolved on the cluster of the subscription, the values are read now to surface missing
+	// references to the host, and again whenever the resource is applied
+	valueFrom, err := utils.TakeValueFromOverrides(template)
+	if err != nil {
+		return err
+	}
+
+	var valueFromHash string
+
+	if len(valueFrom) > 0 {
+		_, valueFromHash, err = utils.ResolveValueFromOverrides(sync.LocalClient, template, valueFrom, host.Namespace)
+		if err != nil {
+			klog.Error("Failed to resolve valueFrom overrides for instance: ", instance.Namespace, "/", instance.Name, " with error: ", err)
+			return err
+		}
+	}
+
 	klog.V(4).Info("overrided template: ", template)
 	// skip no-op to template
 
-	if existingTemplateUnit != nil && reflect.DeepEqual(existingTemplateUnit.Unstructured, template) {
+	if existingTemplateUnit != nil && reflect.DeepEqual(existingTemplateUnit.Unstructured, template) &&
+		reflect.DeepEqual(existingTemplateUnit.ValueFrom, valueFrom) && existingTemplateUnit.ValueFromHash == valueFromHash {
 		klog.V(2).Info("Skipping.. template in registry is the same ", existingTemplateUnit)
 		return nil
 	}
 
 	templateUnit := &TemplateUnit{
-		ResourceUpdated: false,
-		StatusUpdated:   false,
-		Unstructured:    template.DeepCopy(),
-		Source:          source,
+		ResourceUpdated:    false,
+		StatusUpdated:      false,
+		Unstructured:       template.DeepCopy(),
+		Source:             source,
+		ValueFrom:          valueFrom,
+		ValueFromNamespace: host.Namespace,
+		ValueFromHash:      valueFromHash,
 	}
 	resmap.TemplateMap[reskey] = templateUnit
 	sync.KubeResources[template.GetObjectKind().GroupVersionKind()] = resmap
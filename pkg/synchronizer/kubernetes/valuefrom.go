@@ -0,0 +1,128 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog"
+
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils"
+)
+
+var (
+	configMapGVR = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+	secretGVR    = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+)
+
+// watchValueFromSources watches the ConfigMaps and Secrets, the valueFrom overrides referring to a changed one are
+// resolved again at the next house keeping
+func (sync *KubeSynchronizer) watchValueFromSources() {
+	sync.valueSourcesChanged = make(map[string]bool)
+
+	for kind, gvr := range map[string]schema.GroupVersionResource{"ConfigMap": configMapGVR, "Secret": secretGVR} {
+		kind := kind
+
+		sync.dynamicFactory.ForResource(gvr).Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: func(new interface{}) {
+				sync.markValueSourceChanged(kind, new)
+			},
+			UpdateFunc: func(old, new interface{}) {
+				oldobj, ok := old.(*unstructured.Unstructured)
+				newobj, nok := new.(*unstructured.Unstructured)
+
+				// skip the periodic resyncs
+				if ok && nok && oldobj.GetResourceVersion() == newobj.GetResourceVersion() {
+					return
+				}
+
+				sync.markValueSourceChanged(kind, new)
+			},
+			DeleteFunc: func(old interface{}) {
+				if tombstone, ok := old.(cache.DeletedFinalStateUnknown); ok {
+					old = tombstone.Obj
+				}
+
+				sync.markValueSourceChanged(kind, old)
+			},
+		})
+	}
+}
+
+func (sync *KubeSynchronizer) markValueSourceChanged(kind string, obj interface{}) {
+	uobj, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+
+	sync.valueSourcesMutex.Lock()
+	defer sync.valueSourcesMutex.Unlock()
+
+	sync.valueSourcesChanged[valueSourceKey(kind, uobj.GetNamespace(), uobj.GetName())] = true
+}
+
+// takeChangedValueSources returns the ConfigMaps and Secrets changed since the last call
+func (sync *KubeSynchronizer) takeChangedValueSources() map[string]bool {
+	sync.valueSourcesMutex.Lock()
+	defer sync.valueSourcesMutex.Unlock()
+
+	changed := sync.valueSourcesChanged
+	sync.valueSourcesChanged = make(map[string]bool)
+
+	return changed
+}
+
+// valueFromChanged checks if a ConfigMap or Secret referred by the valueFrom overrides of the template unit changed
+func valueFromChanged(tplunit *TemplateUnit, changed map[string]bool) bool {
+	for _, ov := range tplunit.ValueFrom {
+		if ref := ov.ValueFrom.ConfigMapKeyRef; ref != nil && changed[valueSourceKey("ConfigMap", tplunit.ValueFromNamespace, ref.Name)] {
+			return true
+		}
+
+		if ref := ov.ValueFrom.SecretKeyRef; ref != nil && changed[valueSourceKey("Secret", tplunit.ValueFromNamespace, ref.Name)] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func valueSourceKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// refreshValueFrom re-reads the values of the valueFrom overrides referring to a changed ConfigMap or Secret,
+// the resource is updated if they changed
+func (sync *KubeSynchronizer) refreshValueFrom(tplunit *TemplateUnit, changed map[string]bool) {
+	if len(tplunit.ValueFrom) == 0 || !tplunit.ResourceUpdated || !valueFromChanged(tplunit, changed) {
+		return
+	}
+
+	_, hash, err := utils.ResolveValueFromOverrides(sync.LocalClient, tplunit.Unstructured, tplunit.ValueFrom, tplunit.ValueFromNamespace)
+	if err != nil {
+		klog.Error("Failed to refresh valueFrom overrides of ", tplunit.GetNamespace(), "/", tplunit.GetName(), " with error: ", err)
+
+		tplunit.ResourceUpdated = false
+
+		return
+	}
+
+	if hash != tplunit.ValueFromHash {
+		klog.V(2).Info("Values of valueFrom overrides of ", tplunit.GetNamespace(), "/", tplunit.GetName(), " changed, updating the resource")
+
+		tplunit.ResourceUpdated = false
+	}
+}
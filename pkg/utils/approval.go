@@ -0,0 +1,110 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+// ApprovalRequeueInterval is how often a subscription waiting for approval checks the channel again
+const ApprovalRequeueInterval = 30 * time.Second
+
+// GetApprovedPackages returns the package versions approved on hub, key is package name.
+// It returns false if the subscription does not require approval
+func GetApprovedPackages(sub *appv1alpha1.Subscription) (map[string]string, bool) {
+	anno := sub.GetAnnotations()[appv1alpha1.AnnotationApprovedPackages]
+	if anno == "" {
+		return nil, false
+	}
+
+	packages := make(map[string]string)
+
+	if err := json.Unmarshal([]byte(anno), &packages); err != nil {
+		klog.Error("Failed to parse approved packages of subscription ", sub.Namespace, "/", sub.Name, " err: ", err)
+		return nil, true
+	}
+
+	return packages, true
+}
+
+// IsWaitingForApproval checks if the subscription should hold off because the channel moved past the generation approved
+// on hub, or the deployables of the channel differ from the approved package versions. The deployables are nil for
+// channels whose packages are not deployables, then only the generation is checked
+func IsWaitingForApproval(sub *appv1alpha1.Subscription, chn *chnv1alpha1.Channel, dpls []*dplv1alpha1.Deployable) bool {
+	approved, required := GetApprovedPackages(sub)
+	if !required {
+		return false
+	}
+
+	if approved == nil {
+		return true
+	}
+
+	precedence := GetChannelPrecedence(sub)
+
+	if chn != nil {
+		gens := strings.Split(sub.GetAnnotations()[appv1alpha1.AnnotationChannelGeneration], "-")
+
+		// the generation of a channel list joins the generations of its channels
+		gen := gens[0]
+		if precedence >= 0 && precedence < len(gens) {
+			gen = gens[precedence]
+		}
+
+		if gen != "" && gen != strconv.FormatInt(chn.Generation, 10) {
+			klog.V(1).Infof("Subscription %v/%v is waiting for approval of generation %v of channel %v/%v",
+				sub.Namespace, sub.Name, chn.Generation, chn.Namespace, chn.Name)
+			return true
+		}
+	}
+
+	// the packages of a channel list are approved together, a channel of the list has a part of them
+	if dpls == nil || precedence >= 0 {
+		return false
+	}
+
+	listed := make(map[string]bool)
+
+	for _, dpl := range dpls {
+		if (sub.Spec.Package != "" && sub.Spec.Package != dpl.Name) || FiltePackageOut(sub.Spec.PackageFilter, dpl) {
+			continue
+		}
+
+		listed[dpl.Name] = true
+
+		if version, ok := approved[dpl.Name]; !ok || version != dpl.GetAnnotations()[dplv1alpha1.AnnotationDeployableVersion] {
+			klog.V(1).Infof("Subscription %v/%v is waiting for approval of package %v", sub.Namespace, sub.Name, dpl.Name)
+			return true
+		}
+	}
+
+	for name := range approved {
+		if !listed[name] {
+			klog.V(1).Infof("Subscription %v/%v is waiting for approval of removing package %v", sub.Namespace, sub.Name, name)
+			return true
+		}
+	}
+
+	return false
+}
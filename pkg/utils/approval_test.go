@@ -0,0 +1,82 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	chnv1alpha1 "github.com/IBM/multicloud-operators-channel/pkg/apis/app/v1alpha1"
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func TestIsWaitingForApproval(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	chn := &chnv1alpha1.Channel{ObjectMeta: metav1.ObjectMeta{Name: "chn", Namespace: "chn-ns", Generation: 3}}
+
+	newdpl := func(name, version string) *dplv1alpha1.Deployable {
+		return &dplv1alpha1.Deployable{ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Annotations: map[string]string{dplv1alpha1.AnnotationDeployableVersion: version},
+		}}
+	}
+
+	dpls := []*dplv1alpha1.Deployable{newdpl("nginx", "1.0.0"), newdpl("redis", "5.0.0")}
+
+	// no approval required
+	sub := &appv1alpha1.Subscription{ObjectMeta: metav1.ObjectMeta{Name: "sub", Namespace: "default"}}
+	g.Expect(IsWaitingForApproval(sub, chn, dpls)).To(gomega.BeFalse())
+
+	sub.SetAnnotations(map[string]string{
+		appv1alpha1.AnnotationChannelGeneration: "3",
+		appv1alpha1.AnnotationApprovedPackages:  `{"nginx":"1.0.0","redis":"5.0.0"}`,
+	})
+	g.Expect(IsWaitingForApproval(sub, chn, dpls)).To(gomega.BeFalse())
+
+	// the channel moved past the approved generation
+	chn.Generation = 4
+	g.Expect(IsWaitingForApproval(sub, chn, nil)).To(gomega.BeTrue())
+
+	chn.Generation = 3
+
+	// a changed, added or removed package is not approved
+	g.Expect(IsWaitingForApproval(sub, chn, []*dplv1alpha1.Deployable{newdpl("nginx", "1.1.0"), newdpl("redis", "5.0.0")})).To(gomega.BeTrue())
+	g.Expect(IsWaitingForApproval(sub, chn, append(dpls, newdpl("mysql", "8.0.0")))).To(gomega.BeTrue())
+	g.Expect(IsWaitingForApproval(sub, chn, dpls[:1])).To(gomega.BeTrue())
+
+	// the packages not subscribed are not compared
+	sub.Spec.Package = "nginx"
+	sub.SetAnnotations(map[string]string{
+		appv1alpha1.AnnotationChannelGeneration: "3",
+		appv1alpha1.AnnotationApprovedPackages:  `{"nginx":"1.0.0"}`,
+	})
+	g.Expect(IsWaitingForApproval(sub, chn, append(dpls, newdpl("mysql", "8.0.0")))).To(gomega.BeFalse())
+
+	// a channel of a channel list is compared with its generation in the list
+	sub.SetLabels(map[string]string{appv1alpha1.LabelChannelOf: "parent"})
+	sub.SetAnnotations(map[string]string{
+		appv1alpha1.AnnotationChannelGeneration: "2-3",
+		appv1alpha1.AnnotationChannelPrecedence: "1",
+		appv1alpha1.AnnotationApprovedPackages:  `{}`,
+	})
+	g.Expect(IsWaitingForApproval(sub, chn, dpls)).To(gomega.BeFalse())
+
+	chn.Generation = 2
+	g.Expect(IsWaitingForApproval(sub, chn, dpls)).To(gomega.BeTrue())
+}
@@ -17,44 +17,66 @@ package aws
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/endpoints"
 	"github.com/aws/aws-sdk-go-v2/aws/external"
+	"github.com/aws/aws-sdk-go-v2/aws/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"k8s.io/klog"
-)
 
-// ObjectStore interface
-type ObjectStore interface {
-	InitObjectStoreConnection(endpoint, accessKeyID, secretAccessKey string) error
-	Exists(bucket string) error
-	Create(bucket string) error
-	List(bucket string) ([]string, error)
-	Put(bucket, name string, content []byte) error
-	Delete(bucket, name string) error
-	Get(bucket, name string) ([]byte, error)
-}
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils/objectstore"
+)
 
-var _ ObjectStore = &Handler{}
+var _ objectstore.ObjectStore = &Handler{}
 
 const (
 	// SecretMapKeyAccessKeyID is key of accesskeyid in secret
 	SecretMapKeyAccessKeyID = "AccessKeyID"
 	// SecretMapKeySecretAccessKey is key of secretaccesskey in secret
 	SecretMapKeySecretAccessKey = "SecretAccessKey"
+	// SecretMapKeySessionToken is key of the session token of temporary credentials in secret
+	SecretMapKeySessionToken = "SessionToken"
+	// ConfigMapKeyRegion is key of the region in config map
+	ConfigMapKeyRegion = "region"
+	// ConfigMapKeyRoleARN is key of the ARN of the role to assume in config map
+	ConfigMapKeyRoleARN = "roleARN"
+	// ConfigMapKeyCACert is key of the PEM encoded CA certificates of the endpoint in config map
+	ConfigMapKeyCACert = "caCert"
+	// ConfigMapKeyInsecureSkipVerify is key of skipping the verification of the endpoint certificate in config map
+	ConfigMapKeyInsecureSkipVerify = "insecureSkipVerify"
+	// DefaultRegion is the region of object stores without a region configured, MinIO and Ceph RGW accept it too
+	DefaultRegion = "us-east-1"
+	// AssumeRoleDuration is how long the credentials of an assumed role last
+	AssumeRoleDuration = time.Hour
+	// AssumeRoleExpiryWindow is how long before they expire the credentials of an assumed role are renewed,
+	// the URLs presigned with them are valid at least as long
+	AssumeRoleExpiryWindow = 30 * time.Minute
+	// SessionTokenLifetime is taken as the lifetime of the session token in the secret, which is unknown,
+	// it is the shortest session STS issues
+	SessionTokenLifetime = 15 * time.Minute
 )
 
 // Handler handles connections to aws
 type Handler struct {
 	*s3.Client
+	// credentials sign the requests, the presigned URLs expire with them
+	credentials aws.CredentialsProvider
 }
 
 // credentialProvider provides credetials for mcm hub deployable
 type credentialProvider struct {
 	AccessKeyID     string
 	SecretAccessKey string
+	SessionToken    string
 }
 
 // Retrieve follow the Provider interface
@@ -62,54 +84,136 @@ func (p *credentialProvider) Retrieve() (aws.Credentials, error) {
 	awscred := aws.Credentials{
 		SecretAccessKey: p.SecretAccessKey,
 		AccessKeyID:     p.AccessKeyID,
+		SessionToken:    p.SessionToken,
 	}
 
 	return awscred, nil
 }
 
+// NewHandler connects a S3 handler to the object store of the config
+func NewHandler(cfg *objectstore.Config) (objectstore.ObjectStore, error) {
+	h := &Handler{}
+
+	if err := h.Connect(cfg); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
 // InitObjectStoreConnection connect to object store
 func (h *Handler) InitObjectStoreConnection(endpoint, accessKeyID, secretAccessKey string) error {
+	return h.Connect(&objectstore.Config{
+		Endpoint:        endpoint,
+		AccessKeyID:     accessKeyID,
+		SecretAccessKey: secretAccessKey,
+	})
+}
+
+// Connect connects to the object store of the config.
+// Without access keys the credentials come from the default credential chain: the environment, the shared
+// credentials file and the role of the instance. With a role ARN, the credentials assume the role through STS
+func (h *Handler) Connect(cfg *objectstore.Config) error {
 	klog.Info("Preparing S3 settings")
 
-	cfg, err := external.LoadDefaultAWSConfig()
+	awscfg, err := external.LoadDefaultAWSConfig()
 
 	if err != nil {
 		klog.Error("Failed to load aws config. error: ", err)
 		return err
 	}
-	// aws client report error without minio
-	cfg.Region = "minio"
 
-	defaultResolver := endpoints.NewDefaultResolver()
-	s3CustResolverFn := func(service, region string) (aws.Endpoint, error) {
-		if service == "s3" {
-			return aws.Endpoint{
-				URL: endpoint,
-			}, nil
+	// aws client report error without region
+	if cfg.Region != "" {
+		awscfg.Region = cfg.Region
+	} else if awscfg.Region == "" {
+		awscfg.Region = DefaultRegion
+	}
+
+	if len(cfg.CACert) > 0 || cfg.InsecureSkipVerify {
+		httpClient, err := newHTTPClient(cfg.CACert, cfg.InsecureSkipVerify)
+		if err != nil {
+			klog.Error("Failed to configure TLS of object store ", cfg.Endpoint, ". error: ", err)
+			return err
 		}
 
-		return defaultResolver.ResolveEndpoint(service, region)
+		awscfg.HTTPClient = httpClient
 	}
 
-	cfg.EndpointResolver = aws.EndpointResolverFunc(s3CustResolverFn)
-	cfg.Credentials = &credentialProvider{
-		AccessKeyID:     accessKeyID,
-		SecretAccessKey: secretAccessKey,
+	if cfg.Endpoint != "" {
+		defaultResolver := endpoints.NewDefaultResolver()
+		s3CustResolverFn := func(service, region string) (aws.Endpoint, error) {
+			if service == "s3" {
+				return aws.Endpoint{
+					URL: cfg.Endpoint,
+				}, nil
+			}
+
+			return defaultResolver.ResolveEndpoint(service, region)
+		}
+
+		awscfg.EndpointResolver = aws.EndpointResolverFunc(s3CustResolverFn)
 	}
 
-	h.Client = s3.New(cfg)
+	if cfg.AccessKeyID != "" {
+		awscfg.Credentials = &credentialProvider{
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretAccessKey,
+			SessionToken:    cfg.SessionToken,
+		}
+	} else {
+		klog.V(2).Info("No access key for object store ", cfg.Endpoint, ", using the default credential chain")
+	}
+
+	if cfg.RoleARN != "" {
+		klog.V(2).Info("Assuming role ", cfg.RoleARN, " for object store ", cfg.Endpoint)
+
+		provider := stscreds.NewAssumeRoleProvider(sts.New(awscfg), cfg.RoleARN)
+		provider.Duration = AssumeRoleDuration
+		provider.ExpiryWindow = AssumeRoleExpiryWindow
+		awscfg.Credentials = provider
+	}
+
+	h.credentials = awscfg.Credentials
+
+	h.Client = s3.New(awscfg)
 	if h.Client == nil {
 		klog.Error("Failed to connect to s3 service")
-		return err
+		return errors.New("failed to create s3 client for " + cfg.Endpoint)
 	}
 
 	h.Client.ForcePathStyle = true
 
-	klog.V(2).Info("S3 configured ")
+	klog.V(2).Info("S3 configured in region ", awscfg.Region)
 
 	return nil
 }
 
+// newHTTPClient returns a HTTP client trusting the CA certificates in addition to the system ones
+func newHTTPClient(caCert []byte, insecureSkipVerify bool) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+
+	if len(caCert) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("no PEM encoded certificate in " + ConfigMapKeyCACert)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport}, nil
+}
+
 // Create a bucket
 func (h *Handler) Create(bucket string) error {
 	req := h.Client.CreateBucketRequest(&s3.CreateBucketInput{
@@ -140,19 +244,34 @@ func (h *Handler) Exists(bucket string) error {
 	return nil
 }
 
-// List all objects in bucket
-func (h *Handler) List(bucket string) ([]string, error) {
-	klog.V(10).Info("List S3 Objects ", bucket)
+// List all objects in bucket with the prefix, page by page
+func (h *Handler) List(bucket, prefix string) ([]objectstore.ObjectInfo, error) {
+	klog.V(10).Info("List S3 Objects ", bucket, "/", prefix)
+
+	input := &s3.ListObjectsV2Input{Bucket: &bucket}
+	if prefix != "" {
+		input.Prefix = &prefix
+	}
 
-	req := h.Client.ListObjectsRequest(&s3.ListObjectsInput{Bucket: &bucket})
-	p := s3.NewListObjectsPaginator(req)
+	req := h.Client.ListObjectsV2Request(input)
+	p := s3.NewListObjectsV2Paginator(req)
 
-	var keys []string
+	var infos []objectstore.ObjectInfo
 
 	for p.Next(context.TODO()) {
 		page := p.CurrentPage()
 		for _, obj := range page.Contents {
-			keys = append(keys, *obj.Key)
+			info := objectstore.ObjectInfo{Key: *obj.Key}
+
+			if obj.ETag != nil {
+				info.ETag = *obj.ETag
+			}
+
+			if obj.LastModified != nil {
+				info.LastModified = *obj.LastModified
+			}
+
+			infos = append(infos, info)
 		}
 	}
 
@@ -161,13 +280,33 @@ func (h *Handler) List(bucket string) ([]string, error) {
 		return nil, err
 	}
 
-	klog.V(10).Info("List S3 Objects result ", keys)
+	klog.V(10).Info("List S3 Objects result ", infos)
 
-	return keys, nil
+	return infos, nil
 }
 
 // Get get existing object
 func (h *Handler) Get(bucket, name string) ([]byte, error) {
+	body, err := h.GetStream(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+
+	defer body.Close()
+
+	content, err := ioutil.ReadAll(body)
+	if err != nil {
+		klog.Error("Failed to read object ", bucket, "/", name, ". error: ", err)
+		return nil, err
+	}
+
+	klog.V(5).Info("Object Store Get Success: ", bucket, "/", name, " size: ", len(content))
+
+	return content, nil
+}
+
+// GetStream returns the body of existing object
+func (h *Handler) GetStream(bucket, name string) (io.ReadCloser, error) {
 	req := h.Client.GetObjectRequest(&s3.GetObjectInput{
 		Bucket: &bucket,
 		Key:    &name,
@@ -179,22 +318,76 @@ func (h *Handler) Get(bucket, name string) ([]byte, error) {
 		return nil, err
 	}
 
-	body, err := ioutil.ReadAll(resp.Body)
+	return resp.Body, nil
+}
+
+// PresignGet returns a presigned URL of existing object and the time it expires. A presigned URL is valid only as long
+// as the credentials signing it, it expires before the expiry passes with temporary credentials
+func (h *Handler) PresignGet(bucket, name string, expiry time.Duration) (string, time.Time, error) {
+	expiry, err := h.presignExpiry(expiry)
 	if err != nil {
-		klog.Error()
+		klog.Error("Failed to retrieve the credentials to presign Get request. error: ", err)
+		return "", time.Time{}, err
 	}
 
-	klog.V(5).Info("Object Store Get Success: \n", string(body))
+	now := time.Now()
 
-	return body, nil
+	req := h.Client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: &bucket,
+		Key:    &name,
+	})
+
+	presigned, err := req.Presign(expiry)
+	if err != nil {
+		klog.Error("Failed to presign Get request. error: ", err)
+		return "", time.Time{}, err
+	}
+
+	return presigned, now.Add(expiry), nil
+}
+
+// presignExpiry caps the expiry by the lifetime left of the credentials
+func (h *Handler) presignExpiry(expiry time.Duration) (time.Duration, error) {
+	if h.credentials == nil {
+		return expiry, nil
+	}
+
+	creds, err := h.credentials.Retrieve()
+	if err != nil {
+		return 0, err
+	}
+
+	lifetime := expiry
+
+	switch {
+	case creds.CanExpire:
+		lifetime = time.Until(creds.Expires)
+	case creds.SessionToken != "":
+		lifetime = SessionTokenLifetime
+	}
+
+	if lifetime <= 0 {
+		return 0, errors.New("the credentials of the object store expired")
+	}
+
+	if lifetime < expiry {
+		return lifetime, nil
+	}
+
+	return expiry, nil
 }
 
 // Put create new object
 func (h *Handler) Put(bucket, name string, content []byte) error {
+	return h.PutStream(bucket, name, bytes.NewReader(content))
+}
+
+// PutStream create new object from the content of reader
+func (h *Handler) PutStream(bucket, name string, content io.ReadSeeker) error {
 	req := h.Client.PutObjectRequest(&s3.PutObjectInput{
 		Bucket: &bucket,
 		Key:    &name,
-		Body:   bytes.NewReader(content),
+		Body:   content,
 	})
 
 	resp, err := req.Send(context.Background())
@@ -0,0 +1,132 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils/objectstore"
+)
+
+func selfSignedCA(g *gomega.GomegaWithT) ([]byte, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "object-store-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	cert, err := x509.ParseCertificate(der)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), cert
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	capem, cacert := selfSignedCA(g)
+
+	client, err := newHTTPClient(capem, false)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	tlsConfig := client.Transport.(*http.Transport).TLSClientConfig
+	g.Expect(tlsConfig.InsecureSkipVerify).To(gomega.BeFalse())
+
+	// the endpoint certificates signed by the CA verify
+	_, err = cacert.Verify(x509.VerifyOptions{Roots: tlsConfig.RootCAs})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	client, err = newHTTPClient(nil, true)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify).To(gomega.BeTrue())
+
+	_, err = newHTTPClient([]byte("not a certificate"), false)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	// the handler does not connect before the first request
+	h := &Handler{}
+	g.Expect(h.Connect(&objectstore.Config{
+		Endpoint:        "https://minio.example.com:9000",
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKIAEXAMPLE",
+		SecretAccessKey: "secret",
+		CACert:          capem,
+	})).To(gomega.Succeed())
+	g.Expect(h.Client).NotTo(gomega.BeNil())
+
+	g.Expect(h.Connect(&objectstore.Config{Endpoint: "https://minio.example.com:9000", CACert: []byte("-")})).NotTo(gomega.Succeed())
+}
+
+func TestPresignGet(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	h := &Handler{}
+	g.Expect(h.Connect(&objectstore.Config{
+		Endpoint:        "https://minio.example.com:9000",
+		AccessKeyID:     "AKIAEXAMPLE",
+		SecretAccessKey: "secret",
+	})).To(gomega.Succeed())
+
+	// presigning is local, the object store is not contacted
+	presigned, expires, err := h.PresignGet("charts", "repo/nginx-1.0.0.tgz", time.Hour)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(expires).To(gomega.BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+	u, err := url.Parse(presigned)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(u.Host).To(gomega.Equal("minio.example.com:9000"))
+	g.Expect(u.Path).To(gomega.Equal("/charts/repo/nginx-1.0.0.tgz"))
+	g.Expect(u.Query().Get("X-Amz-Expires")).To(gomega.Equal("3600"))
+	g.Expect(u.Query().Get("X-Amz-Credential")).To(gomega.HavePrefix("AKIAEXAMPLE/"))
+	g.Expect(u.Query().Get("X-Amz-Signature")).NotTo(gomega.BeEmpty())
+
+	// the lifetime of a session token is unknown, the URLs expire with the shortest session
+	g.Expect(h.Connect(&objectstore.Config{
+		Endpoint:        "https://minio.example.com:9000",
+		AccessKeyID:     "ASIAEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+	})).To(gomega.Succeed())
+
+	presigned, expires, err = h.PresignGet("charts", "repo/nginx-1.0.0.tgz", time.Hour)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(expires).To(gomega.BeTemporally("~", time.Now().Add(SessionTokenLifetime), time.Minute))
+
+	u, err = url.Parse(presigned)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(u.Query().Get("X-Amz-Expires")).To(gomega.Equal("900"))
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"time"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+const (
+	// CalendarWindowsKey is the key of the yaml list of named windows in the calendar ConfigMap
+	CalendarWindowsKey = "windows"
+	// CalendarBlackoutsKey is the key of the yaml list of blackout date ranges in the calendar ConfigMap
+	CalendarBlackoutsKey = "blackouts"
+	// CalendarLocationKey is the key of the location of the windows and blackouts in the calendar ConfigMap
+	CalendarLocationKey = "location"
+	// CalendarRequeueInterval defines how long a subscription holds off when its calendar can not be read
+	CalendarRequeueInterval = 60 * time.Second
+)
+
+// CalendarWindow is a named window of a calendar, its window type and location are not used
+type CalendarWindow struct {
+	Name                   string `json:"name"`
+	appv1alpha1.TimeWindow `json:",inline"`
+}
+
+// Calendar is the maintenance calendar parsed from a ConfigMap
+type Calendar struct {
+	Location  string
+	Windows   []CalendarWindow
+	Blackouts []appv1alpha1.DateRange
+}
+
+// ParseCalendar parses the maintenance calendar in the ConfigMap
+func ParseCalendar(cm *corev1.ConfigMap) (*Calendar, error) {
+	cal := &Calendar{Location: cm.Data[CalendarLocationKey]}
+
+	if err := yaml.Unmarshal([]byte(cm.Data[CalendarWindowsKey]), &cal.Windows); err != nil {
+		klog.Error("Failed to parse windows of calendar ", cm.Namespace, "/", cm.Name, " with error: ", err)
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal([]byte(cm.Data[CalendarBlackoutsKey]), &cal.Blackouts); err != nil {
+		klog.Error("Failed to parse blackouts of calendar ", cm.Namespace, "/", cm.Name, " with error: ", err)
+		return nil, err
+	}
+
+	return cal, nil
+}
+
+// GetWindows returns the calendar windows named by the reference, all windows if it names none
+func (cal *Calendar) GetWindows(ref *appv1alpha1.CalendarReference) []CalendarWindow {
+	if ref == nil || len(ref.Windows) == 0 {
+		return cal.Windows
+	}
+
+	names := make(map[string]bool)
+	for _, name := range ref.Windows {
+		names[name] = true
+	}
+
+	var windows []CalendarWindow
+
+	for _, w := range cal.Windows {
+		if names[w.Name] {
+			windows = append(windows, w)
+			delete(names, w.Name)
+		}
+	}
+
+	for name := range names {
+		klog.Info("Window ", name, " is not in calendar ", ref.Name)
+	}
+
+	return windows
+}
+
+// GetCalendar returns the calendar the time window of the subscription refers to, nil if there is none
+func GetCalendar(clt client.Client, sub *appv1alpha1.Subscription) (*Calendar, error) {
+	tw := sub.Spec.TimeWindow
+	if tw == nil || tw.Calendar == nil {
+		return nil, nil
+	}
+
+	cm := &corev1.ConfigMap{}
+
+	err := clt.Get(context.TODO(), types.NamespacedName{Name: tw.Calendar.Name, Namespace: sub.Namespace}, cm)
+	if err != nil {
+		klog.Error("Failed to get calendar ", sub.Namespace, "/", tw.Calendar.Name, " of subscription ", sub.Name,
+			" with error: ", err)
+		return nil, err
+	}
+
+	return ParseCalendar(cm)
+}
+
+// NextStartPointForSubscription evaluates the time window of the subscription combined with its calendar.
+// The subscription holds off for CalendarRequeueInterval if the calendar can not be read
+func NextStartPointForSubscription(clt client.Client, sub *appv1alpha1.Subscription, t time.Time) time.Duration {
+	tw := sub.Spec.TimeWindow
+	if tw == nil {
+		return time.Duration(0)
+	}
+
+	cal, err := GetCalendar(clt, sub)
+	if err != nil {
+		return CalendarRequeueInterval
+	}
+
+	return NextStartPointWithCalendar(tw, cal, t)
+}
+
+// IsCalendarConfigMap checks if the ConfigMap keeps a calendar, i.e. has windows or blackouts
+func IsCalendarConfigMap(obj runtime.Object) bool {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return false
+	}
+
+	_, haswindows := cm.Data[CalendarWindowsKey]
+	_, hasblackouts := cm.Data[CalendarBlackoutsKey]
+
+	return haswindows || hasblackouts
+}
+
+// CalendarPredicateFunctions passes the events of calendar ConfigMaps only, the other ConfigMaps are not mapped
+var CalendarPredicateFunctions = predicate.Funcs{
+	CreateFunc: func(e event.CreateEvent) bool {
+		return IsCalendarConfigMap(e.Object)
+	},
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		return IsCalendarConfigMap(e.ObjectOld) || IsCalendarConfigMap(e.ObjectNew)
+	},
+	DeleteFunc: func(e event.DeleteEvent) bool {
+		return IsCalendarConfigMap(e.Object)
+	},
+	GenericFunc: func(e event.GenericEvent) bool {
+		return IsCalendarConfigMap(e.Object)
+	},
+}
+
+// CalendarMapper maps a calendar ConfigMap to the subscriptions in its namespace referring to it
+type CalendarMapper struct {
+	client.Client
+}
+
+// Map returns the requests of the subscriptions referring to the calendar
+func (mapper *CalendarMapper) Map(obj handler.MapObject) []reconcile.Request {
+	sublist := &appv1alpha1.SubscriptionList{}
+
+	err := mapper.List(context.TODO(), sublist, &client.ListOptions{Namespace: obj.Meta.GetNamespace()})
+	if err != nil {
+		klog.Error("Failed to list subscriptions referring to calendar ", obj.Meta.GetNamespace(), "/", obj.Meta.GetName(),
+			" with error: ", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+
+	for _, sub := range sublist.Items {
+		tw := sub.Spec.TimeWindow
+		if tw == nil || tw.Calendar == nil || tw.Calendar.Name != obj.Meta.GetName() {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: sub.Name, Namespace: sub.Namespace}})
+	}
+
+	return requests
+}
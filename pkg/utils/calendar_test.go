@@ -0,0 +1,239 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+const calendarWindows = `
+- name: weekend
+  weekdays: ["Saturday"]
+  hours:
+  - start: "1:00AM"
+    end: "3:00AM"
+- name: nightly
+  crons:
+  - schedule: "0 22 * * *"
+    duration: 2h
+`
+
+func newCalendarConfigMap(name, blackouts, location string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Data: map[string]string{
+			CalendarWindowsKey:   calendarWindows,
+			CalendarBlackoutsKey: blackouts,
+			CalendarLocationKey:  location,
+		},
+	}
+}
+
+func TestParseCalendar(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cal, err := ParseCalendar(newCalendarConfigMap("maintenance", `[{start: "2019-11-06", end: "2019-11-06"}]`, "UTC"))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(cal.Location).To(gomega.Equal("UTC"))
+	g.Expect(cal.Windows).To(gomega.HaveLen(2))
+	g.Expect(cal.Windows[1].Name).To(gomega.Equal("nightly"))
+	g.Expect(cal.Windows[1].Crons[0].Duration.Duration).To(gomega.Equal(2 * time.Hour))
+	g.Expect(cal.Blackouts).To(gomega.Equal([]appv1alpha1.DateRange{{Start: "2019-11-06", End: "2019-11-06"}}))
+
+	windows := cal.GetWindows(&appv1alpha1.CalendarReference{Name: "maintenance", Windows: []string{"nightly", "missing"}})
+	g.Expect(windows).To(gomega.HaveLen(1))
+	g.Expect(windows[0].Name).To(gomega.Equal("nightly"))
+
+	g.Expect(cal.GetWindows(&appv1alpha1.CalendarReference{Name: "maintenance"})).To(gomega.HaveLen(2))
+
+	_, err = ParseCalendar(newCalendarConfigMap("broken", "{start", ""))
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestTimeWindowWithCalendar(t *testing.T) {
+	newCalendar := func(blackouts []appv1alpha1.DateRange, location string) *Calendar {
+		cal, err := ParseCalendar(newCalendarConfigMap("maintenance", "", location))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cal.Blackouts = blackouts
+
+		return cal
+	}
+
+	wholeDay := []appv1alpha1.DateRange{{Start: "2019-11-06", End: "2019-11-06"}}
+
+	testCases := []struct {
+		desc    string
+		curTime string
+		windows *appv1alpha1.TimeWindow
+		cal     *Calendar
+		want    time.Duration
+	}{
+		{
+			desc:    "all calendar windows, before tonight's window",
+			curTime: "Wed Nov  6 14:21:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{WindowType: "active", Calendar: &appv1alpha1.CalendarReference{Name: "maintenance"}},
+			cal:     newCalendar(nil, ""),
+			want:    7*time.Hour + 39*time.Minute,
+		},
+		{
+			desc:    "named calendar window only",
+			curTime: "Wed Nov  6 14:21:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "active",
+				Calendar:   &appv1alpha1.CalendarReference{Name: "maintenance", Windows: []string{"weekend"}},
+			},
+			cal:  newCalendar(nil, ""),
+			want: 2*24*time.Hour + 10*time.Hour + 39*time.Minute,
+		},
+		{
+			desc:    "calendar window combined with the windows of the subscription",
+			curTime: "Wed Nov  6 14:21:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "active",
+				Hours:      []appv1alpha1.HourRange{{Start: "3:00PM", End: "4:00PM"}},
+				Calendar:   &appv1alpha1.CalendarReference{Name: "maintenance", Windows: []string{"nightly"}},
+			},
+			cal:  newCalendar(nil, ""),
+			want: 39 * time.Minute,
+		},
+		{
+			desc:    "tonight's window is in a blackout",
+			curTime: "Wed Nov  6 14:21:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "active",
+				Calendar:   &appv1alpha1.CalendarReference{Name: "maintenance", Windows: []string{"nightly"}},
+			},
+			cal:  newCalendar(wholeDay, ""),
+			want: 24*time.Hour + 7*time.Hour + 39*time.Minute,
+		},
+		{
+			desc:    "blackouts only, in a blackout",
+			curTime: "Wed Nov  6 14:21:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{WindowType: "active", Calendar: &appv1alpha1.CalendarReference{Name: "maintenance"}},
+			cal:     &Calendar{Blackouts: wholeDay},
+			want:    9*time.Hour + 39*time.Minute,
+		},
+		{
+			desc:    "blackouts only, out of the blackouts",
+			curTime: "Thu Nov  7 14:21:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{WindowType: "active", Calendar: &appv1alpha1.CalendarReference{Name: "maintenance"}},
+			cal:     &Calendar{Blackouts: wholeDay},
+			want:    0,
+		},
+		{
+			desc:    "blocked window, in a blackout",
+			curTime: "Wed Nov  6 14:21:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "blocked",
+				Calendar:   &appv1alpha1.CalendarReference{Name: "maintenance", Windows: []string{"weekend"}},
+			},
+			cal:  newCalendar(wholeDay, ""),
+			want: 9*time.Hour + 39*time.Minute,
+		},
+		{
+			desc:    "blocked window, in a calendar window",
+			curTime: "Wed Nov  6 23:00:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{WindowType: "blocked", Calendar: &appv1alpha1.CalendarReference{Name: "maintenance"}},
+			cal:     newCalendar(nil, ""),
+			want:    time.Hour,
+		},
+		{
+			desc:    "calendar windows in the location of the calendar",
+			curTime: "Wed Nov  6 14:21:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "active",
+				Location:   "UTC",
+				Calendar:   &appv1alpha1.CalendarReference{Name: "maintenance", Windows: []string{"nightly"}},
+			},
+			cal:  newCalendar(nil, "America/Toronto"),
+			want: 12*time.Hour + 39*time.Minute,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			c, _ := time.Parse(time.UnixDate, tC.curTime)
+			got := NextStartPointWithCalendar(tC.windows, tC.cal, c)
+
+			if got != tC.want {
+				t.Errorf("wanted time.Duration %v, got %v", tC.want, got)
+			}
+		})
+	}
+}
+
+func TestCalendarPredicate(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	cm := newCalendarConfigMap("predicate-calendar", "", "")
+	other := &corev1.ConfigMap{Data: map[string]string{"config": "value"}}
+
+	g.Expect(CalendarPredicateFunctions.Create(event.CreateEvent{Meta: cm, Object: cm})).To(gomega.BeTrue())
+	g.Expect(CalendarPredicateFunctions.Create(event.CreateEvent{Meta: other, Object: other})).To(gomega.BeFalse())
+
+	// a ConfigMap turned into or out of a calendar is passed
+	g.Expect(CalendarPredicateFunctions.Update(event.UpdateEvent{
+		MetaOld: other, ObjectOld: other, MetaNew: cm, ObjectNew: cm,
+	})).To(gomega.BeTrue())
+	g.Expect(CalendarPredicateFunctions.Update(event.UpdateEvent{
+		MetaOld: other, ObjectOld: other, MetaNew: other, ObjectNew: other,
+	})).To(gomega.BeFalse())
+}
+
+func TestCalendarMapper(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	cm := newCalendarConfigMap("mapper-calendar", "", "")
+
+	referring := newDependencySubscription("mapper-referring")
+	referring.Spec.TimeWindow = &appv1alpha1.TimeWindow{Calendar: &appv1alpha1.CalendarReference{Name: cm.Name}}
+
+	other := newDependencySubscription("mapper-other")
+
+	for _, sub := range []*appv1alpha1.Subscription{referring, other} {
+		g.Expect(clt.Create(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+
+		defer clt.Delete(context.TODO(), sub)
+	}
+
+	mapper := &CalendarMapper{Client: clt}
+	requests := mapper.Map(handler.MapObject{Meta: cm, Object: cm})
+
+	g.Expect(requests).To(gomega.Equal([]reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: referring.Name, Namespace: referring.Namespace}},
+	}))
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// GetSubscriptionChannels returns spec.channel followed by spec.channels, in increasing precedence.
+// A channel listed twice keeps its last position
+func GetSubscriptionChannels(sub *appv1alpha1.Subscription) []types.NamespacedName {
+	var chns []types.NamespacedName
+
+	for _, chstr := range append([]string{sub.Spec.Channel}, sub.Spec.Channels...) {
+		chstr = strings.TrimSpace(chstr)
+		if chstr == "" {
+			continue
+		}
+
+		chkey := types.NamespacedName{Name: chstr, Namespace: sub.Namespace}
+		if strs := strings.Split(chstr, "/"); len(strs) == 2 {
+			chkey = types.NamespacedName{Name: strs[1], Namespace: strs[0]}
+		}
+
+		for i, c := range chns {
+			if c == chkey {
+				chns = append(chns[:i], chns[i+1:]...)
+				break
+			}
+		}
+
+		chns = append(chns, chkey)
+	}
+
+	return chns
+}
+
+// IsMultiChannelSubscription checks if the subscription subscribes a channel list
+func IsMultiChannelSubscription(sub *appv1alpha1.Subscription) bool {
+	return len(sub.Spec.Channels) > 0
+}
+
+// GetChannelPrecedence returns the position of the per-channel subscription in the channel list, -1 if it is not one
+func GetChannelPrecedence(sub *appv1alpha1.Subscription) int {
+	if sub.GetLabels()[appv1alpha1.LabelChannelOf] == "" {
+		return -1
+	}
+
+	p, err := strconv.Atoi(sub.GetAnnotations()[appv1alpha1.AnnotationChannelPrecedence])
+	if err != nil {
+		return -1
+	}
+
+	return p
+}
+
+// HasChannelPrecedence checks if both subscriptions subscribe channels of the same channel list,
+// and the channel of host comes later in the list than the one of other
+func HasChannelPrecedence(clt client.Client, host, other types.NamespacedName) bool {
+	if clt == nil || host.Namespace != other.Namespace {
+		return false
+	}
+
+	hostsub := &appv1alpha1.Subscription{}
+	othersub := &appv1alpha1.Subscription{}
+
+	if err := clt.Get(context.TODO(), host, hostsub); err != nil {
+		return false
+	}
+
+	if err := clt.Get(context.TODO(), other, othersub); err != nil {
+		return false
+	}
+
+	parent := hostsub.GetLabels()[appv1alpha1.LabelChannelOf]
+	if parent == "" || parent != othersub.GetLabels()[appv1alpha1.LabelChannelOf] {
+		return false
+	}
+
+	if GetChannelPrecedence(hostsub) <= GetChannelPrecedence(othersub) {
+		return false
+	}
+
+	klog.V(1).Info("Subscription ", host, " takes precedence over ", other, " in channel list of ", parent)
+
+	return true
+}
@@ -0,0 +1,50 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func TestGetSubscriptionChannels(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	sub := &appv1alpha1.Subscription{}
+	sub.Namespace = "app-ns"
+	sub.Spec.Channel = "base-ns/base"
+
+	g.Expect(IsMultiChannelSubscription(sub)).To(gomega.BeFalse())
+	g.Expect(GetSubscriptionChannels(sub)).To(gomega.Equal([]types.NamespacedName{{Namespace: "base-ns", Name: "base"}}))
+
+	sub.Spec.Channels = []string{"env-ns/prod", "local", "base-ns/base"}
+
+	g.Expect(IsMultiChannelSubscription(sub)).To(gomega.BeTrue())
+	g.Expect(GetSubscriptionChannels(sub)).To(gomega.Equal([]types.NamespacedName{
+		{Namespace: "env-ns", Name: "prod"},
+		{Namespace: "app-ns", Name: "local"},
+		{Namespace: "base-ns", Name: "base"},
+	}))
+
+	g.Expect(GetChannelPrecedence(sub)).To(gomega.Equal(-1))
+
+	sub.SetLabels(map[string]string{appv1alpha1.LabelChannelOf: "app"})
+	sub.SetAnnotations(map[string]string{appv1alpha1.AnnotationChannelPrecedence: "2"})
+	g.Expect(GetChannelPrecedence(sub)).To(gomega.Equal(2))
+}
@@ -0,0 +1,238 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchLimit bounds the search of the next trigger of a cron schedule, a schedule not triggered within it never runs
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+var cronMonthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronWeekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// CronSchedule is a parsed 5-field cron expression: minute hour day-of-month month day-of-week.
+// Fields accept *, values, names of months and weekdays, ranges, lists and steps. Day-of-week also accepts
+// the nth weekday of the month, e.g. SUN#1 is the first Sunday. As in the standard cron, a time matches
+// either day field if both of them are restricted
+type CronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// bit n is set if the nth weekday of the month matches, per weekday
+	dowNth [7]uint8
+
+	domStar bool
+	dowStar bool
+}
+
+// ParseCronSchedule parses a 5-field cron expression
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.New("cron schedule " + spec + " must have 5 fields: minute hour day-of-month month day-of-week")
+	}
+
+	var err error
+
+	s := &CronSchedule{
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, err
+	}
+
+	for _, item := range strings.Split(fields[4], ",") {
+		strs := strings.Split(item, "#")
+		if len(strs) == 1 {
+			bits, err := parseCronField(item, 0, 7, cronWeekdayNames)
+			if err != nil {
+				return nil, err
+			}
+
+			// both 0 and 7 are Sunday
+			if bits&(1<<7) != 0 {
+				bits |= 1
+			}
+
+			s.dow |= bits
+
+			continue
+		}
+
+		wd, err := parseCronValue(strs[0], 0, 7, cronWeekdayNames)
+		if err != nil || len(strs) != 2 {
+			return nil, errors.New("invalid nth weekday " + item + " in cron schedule " + spec)
+		}
+
+		nth, err := strconv.Atoi(strs[1])
+		if err != nil || nth < 1 || nth > 5 {
+			return nil, errors.New("invalid nth weekday " + item + " in cron schedule " + spec + ", nth must be 1 to 5")
+		}
+
+		s.dowNth[wd%7] |= 1 << uint(nth)
+	}
+
+	return s, nil
+}
+
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+
+	for _, item := range strings.Split(field, ",") {
+		rng, step := item, 1
+
+		if strs := strings.Split(item, "/"); len(strs) == 2 {
+			var err error
+
+			rng = strs[0]
+
+			step, err = strconv.Atoi(strs[1])
+			if err != nil || step < 1 {
+				return 0, errors.New("invalid step in cron field " + item)
+			}
+		} else if len(strs) > 2 {
+			return 0, errors.New("invalid cron field " + item)
+		}
+
+		start, end := min, max
+
+		if rng != "*" {
+			strs := strings.Split(rng, "-")
+			if len(strs) > 2 {
+				return 0, errors.New("invalid range in cron field " + item)
+			}
+
+			var err error
+
+			if start, err = parseCronValue(strs[0], min, max, names); err != nil {
+				return 0, err
+			}
+
+			end = start
+
+			if len(strs) == 2 {
+				if end, err = parseCronValue(strs[1], min, max, names); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// a/n means from a to the max
+				end = max
+			}
+
+			if start > end {
+				return 0, errors.New("invalid range in cron field " + item + ", start is after end")
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseCronValue(str string, min, max int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(str)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(str)
+	if err != nil || v < min || v > max {
+		return 0, errors.New("invalid value " + str + " in cron field, must be " + strconv.Itoa(min) + " to " + strconv.Itoa(max))
+	}
+
+	return v, nil
+}
+
+func (s *CronSchedule) matchDay(t time.Time) bool {
+	if s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	wd := t.Weekday()
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(wd)) != 0 || s.dowNth[wd]&(1<<uint((t.Day()-1)/7+1)) != 0
+
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+
+	return domMatch || dowMatch
+}
+
+// Next returns the first trigger of the schedule not before t, in the location of t.
+// A trigger in the hour skipped by a daylight saving change is skipped with it.
+// The zero time is returned if there is no trigger in 5 years
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	limit := t.Add(cronSearchLimit)
+
+	// round up to the minute
+	if t.Second() != 0 || t.Nanosecond() != 0 {
+		t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	}
+
+	for t.Before(limit) {
+		var next time.Time
+
+		switch {
+		case !s.matchDay(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+
+		// the wall clock may go back across a daylight saving change
+		if !next.After(t) {
+			next = t.Add(time.Minute)
+		}
+
+		t = next
+	}
+
+	return time.Time{}
+}
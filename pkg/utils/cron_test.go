@@ -0,0 +1,133 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	for _, spec := range []string{"* * * * *", "*/15 9-17 * * MON-FRI", "0 2 1,15 jan-jun 0-7", "0 2 * * SUN#1,SAT#5", "5/10 * * * *"} {
+		if _, err := ParseCronSchedule(spec); err != nil {
+			t.Errorf("failed to parse cron schedule %v, error: %v", spec, err)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * SUN#6",
+		"* * * * FUN", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := ParseCronSchedule(spec); err == nil {
+			t.Errorf("parsed invalid cron schedule %v", spec)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		schedule string
+		curTime  string
+		want     string
+	}{
+		{
+			desc:     "every 15 minutes in business hours",
+			schedule: "*/15 9-17 * * MON-FRI",
+			curTime:  "Fri Nov  8 17:50:00 UTC 2019",
+			want:     "Mon Nov 11 09:00:00 UTC 2019",
+		},
+		{
+			desc:     "the current minute is a trigger",
+			schedule: "30 10 * * *",
+			curTime:  "Fri Nov  8 10:30:00 UTC 2019",
+			want:     "Fri Nov  8 10:30:00 UTC 2019",
+		},
+		{
+			desc:     "first Sunday of the month",
+			schedule: "0 2 * * SUN#1",
+			curTime:  "Sun Nov  3 02:01:00 UTC 2019",
+			want:     "Sun Dec  1 02:00:00 UTC 2019",
+		},
+		{
+			desc:     "either day of month or weekday",
+			schedule: "0 0 1 * MON",
+			curTime:  "Tue Oct 29 12:00:00 UTC 2019",
+			want:     "Fri Nov  1 00:00:00 UTC 2019",
+		},
+		{
+			desc:     "leap day",
+			schedule: "0 0 29 feb *",
+			curTime:  "Fri Nov  8 10:30:00 UTC 2019",
+			want:     "Sat Feb 29 00:00:00 UTC 2020",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s, err := ParseCronSchedule(tC.schedule)
+			if err != nil {
+				t.Fatalf("failed to parse cron schedule %v, error: %v", tC.schedule, err)
+			}
+
+			c, _ := time.Parse(time.UnixDate, tC.curTime)
+			want, _ := time.Parse(time.UnixDate, tC.want)
+
+			if got := s.Next(c); !got.Equal(want) {
+				t.Errorf("wanted next trigger %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNextDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Skip("no time zone database: ", err)
+	}
+
+	s, err := ParseCronSchedule("0 * * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the clock is set back from 2:00AM EDT to 1:00AM EST, the hourly triggers stay an hour apart
+	c := time.Date(2019, time.November, 3, 4, 30, 0, 0, time.UTC).In(loc)
+
+	var triggers []time.Time
+
+	for i := 0; i < 3; i++ {
+		c = s.Next(c)
+		triggers = append(triggers, c)
+		c = c.Add(time.Minute)
+	}
+
+	for i := 1; i < len(triggers); i++ {
+		if d := triggers[i].Sub(triggers[i-1]); d > 2*time.Hour || d <= 0 {
+			t.Errorf("hourly triggers %v and %v are %v apart", triggers[i-1], triggers[i], d)
+		}
+	}
+
+	// the clock is set forward from 2:00AM EST to 3:00AM EDT, 2:30AM is skipped
+	s, err = ParseCronSchedule("30 2 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = time.Date(2020, time.March, 8, 0, 0, 0, 0, loc)
+	want := time.Date(2020, time.March, 9, 2, 30, 0, 0, loc)
+
+	if got := s.Next(c); !got.Equal(want) {
+		t.Errorf("wanted next trigger %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DependencyRequeueInterval is how often a subscription waiting for its dependencies checks them again
+const DependencyRequeueInterval = 30 * time.Second
+
+// GetBlockingDependency returns the first subscription in dependsOn which is not healthy yet, empty if all are healthy.
+// An error is returned if the dependencies form a cycle
+func GetBlockingDependency(clt client.Client, sub *appv1alpha1.Subscription) (string, error) {
+	if len(sub.Spec.DependsOn) == 0 {
+		return "", nil
+	}
+
+	subkey := types.NamespacedName{Name: sub.Name, Namespace: sub.Namespace}.String()
+
+	cycle := findDependencyCycle(clt, sub, []string{subkey}, map[string]bool{subkey: true}, make(map[string]bool))
+	if cycle != nil {
+		return "", errors.New("dependency cycle detected: " + strings.Join(cycle, " -> "))
+	}
+
+	for _, dep := range sub.Spec.DependsOn {
+		depkey := getDependencyKey(sub, dep)
+		depsub := &appv1alpha1.Subscription{}
+
+		err := clt.Get(context.TODO(), depkey, depsub)
+		if err != nil {
+			klog.V(1).Info("Failed to get dependency ", depkey, " of subscription ", subkey, " error: ", err)
+			return depkey.String(), nil
+		}
+
+		if !IsSubscriptionHealthy(depsub) {
+			return depkey.String(), nil
+		}
+	}
+
+	return "", nil
+}
+
+// IsWaitingForDependency checks if the subscription should hold off until its dependencies are healthy
+func IsWaitingForDependency(clt client.Client, sub *appv1alpha1.Subscription) bool {
+	blocking, err := GetBlockingDependency(clt, sub)
+	if err != nil {
+		klog.Error("Subscription ", sub.Namespace, "/", sub.Name, " is blocked by ", err)
+		return true
+	}
+
+	if blocking != "" {
+		klog.V(1).Infof("Subscription %v/%v is waiting for dependency %v", sub.Namespace, sub.Name, blocking)
+		return true
+	}
+
+	return false
+}
+
+// IsSubscriptionHealthy checks if a subscription is subscribed without failed packages on managed cluster,
+// or ready on all clusters on hub
+func IsSubscriptionHealthy(sub *appv1alpha1.Subscription) bool {
+	switch sub.Status.Phase {
+	case appv1alpha1.SubscriptionSubscribed:
+		for _, clst := range sub.Status.Statuses {
+			if clst == nil {
+				continue
+			}
+
+			for _, pkgst := range clst.SubscriptionPackageStatus {
+				if pkgst != nil && pkgst.Phase == appv1alpha1.SubscriptionFailed {
+					return false
+				}
+			}
+		}
+
+		return true
+	case appv1alpha1.SubscriptionPropagated:
+		for _, cond := range sub.Status.Conditions {
+			if cond.Type == appv1alpha1.SubscriptionReady {
+				return cond.Status == corev1.ConditionTrue
+			}
+		}
+	}
+
+	return false
+}
+
+func getDependencyKey(sub *appv1alpha1.Subscription, dep appv1alpha1.DependencyReference) types.NamespacedName {
+	depkey := types.NamespacedName{Name: dep.Name, Namespace: dep.Namespace}
+	if depkey.Namespace == "" {
+		depkey.Namespace = sub.Namespace
+	}
+
+	return depkey
+}
+
+// findDependencyCycle walks the dependencies depth first, returns the path of the first cycle found
+func findDependencyCycle(clt client.Client, sub *appv1alpha1.Subscription, path []string, onpath, done map[string]bool) []string {
+	for _, dep := range sub.Spec.DependsOn {
+		depkey := getDependencyKey(sub, dep)
+		key := depkey.String()
+
+		if onpath[key] {
+			return append(append([]string{}, path...), key)
+		}
+
+		if done[key] {
+			continue
+		}
+
+		depsub := &appv1alpha1.Subscription{}
+
+		err := clt.Get(context.TODO(), depkey, depsub)
+		if err != nil {
+			continue
+		}
+
+		onpath[key] = true
+
+		if cycle := findDependencyCycle(clt, depsub, append(path, key), onpath, done); cycle != nil {
+			return cycle
+		}
+
+		delete(onpath, key)
+
+		done[key] = true
+	}
+
+	return nil
+}
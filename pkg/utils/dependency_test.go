@@ -0,0 +1,106 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func newDependencySubscription(name string, deps ...string) *appv1alpha1.Subscription {
+	sub := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel: "default/ch",
+		},
+	}
+
+	for _, dep := range deps {
+		sub.Spec.DependsOn = append(sub.Spec.DependsOn, appv1alpha1.DependencyReference{Name: dep})
+	}
+
+	return sub
+}
+
+func TestSubscriptionHealthy(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	sub := newDependencySubscription("healthy")
+	g.Expect(IsSubscriptionHealthy(sub)).To(gomega.BeFalse())
+
+	sub.Status.Phase = appv1alpha1.SubscriptionSubscribed
+	sub.Status.Statuses = appv1alpha1.SubscriptionClusterStatusMap{
+		"/": &appv1alpha1.SubscriptionPerClusterStatus{
+			SubscriptionPackageStatus: map[string]*appv1alpha1.SubscriptionUnitStatus{
+				"nginx": {Phase: appv1alpha1.SubscriptionSubscribed},
+			},
+		},
+	}
+	g.Expect(IsSubscriptionHealthy(sub)).To(gomega.BeTrue())
+
+	sub.Status.Statuses["/"].SubscriptionPackageStatus["nginx"].Phase = appv1alpha1.SubscriptionFailed
+	g.Expect(IsSubscriptionHealthy(sub)).To(gomega.BeFalse())
+
+	sub.Status.Phase = appv1alpha1.SubscriptionPropagated
+	sub.Status.Conditions = []appv1alpha1.SubscriptionCondition{
+		{Type: appv1alpha1.SubscriptionReady, Status: corev1.ConditionFalse},
+	}
+	g.Expect(IsSubscriptionHealthy(sub)).To(gomega.BeFalse())
+
+	sub.Status.Conditions[0].Status = corev1.ConditionTrue
+	g.Expect(IsSubscriptionHealthy(sub)).To(gomega.BeTrue())
+}
+
+func TestDependencyCycle(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	suba := newDependencySubscription("dep-a", "dep-b")
+	subb := newDependencySubscription("dep-b", "dep-c")
+	subc := newDependencySubscription("dep-c")
+
+	for _, sub := range []*appv1alpha1.Subscription{suba, subb, subc} {
+		g.Expect(clt.Create(context.TODO(), sub)).To(gomega.Succeed())
+		defer clt.Delete(context.TODO(), sub)
+	}
+
+	// dep-b is not healthy yet
+	blocking, err := GetBlockingDependency(clt, suba)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(blocking).To(gomega.Equal("default/dep-b"))
+
+	// dep-c -> dep-a closes the cycle
+	g.Expect(clt.Get(context.TODO(), client.ObjectKey{Name: "dep-c", Namespace: "default"}, subc)).To(gomega.Succeed())
+	subc.Spec.DependsOn = []appv1alpha1.DependencyReference{{Name: "dep-a"}}
+	g.Expect(clt.Update(context.TODO(), subc)).To(gomega.Succeed())
+
+	_, err = GetBlockingDependency(clt, suba)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.Error()).To(gomega.ContainSubstring("default/dep-a -> default/dep-b -> default/dep-c -> default/dep-a"))
+
+	g.Expect(IsWaitingForDependency(clt, suba)).To(gomega.BeTrue())
+}
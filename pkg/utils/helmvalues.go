@@ -0,0 +1,243 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+const (
+	// HelmValuesPath is the path of the package overrides carrying helm values, for example
+	// {"path": "spec.values", "value": "defaultBackend:\n  replicaCount: 3\n"}
+	HelmValuesPath = "spec.values"
+	// HelmValuesKey is the key of the channel and helm values ConfigMaps carrying helm values for all packages,
+	// the key <package name>.values carries the helm values of a single package
+	HelmValuesKey = "values"
+)
+
+// OverrideHelmRelease applies the package overrides on a HelmRelease template and sets its values from the layers below,
+// from the lowest to the highest precedence:
+// - the defaults of the chart, applied by helm
+// - the values of the channel ConfigMap
+// - the spec.values package overrides of the subscription, in order
+// - the values of the helm values ConfigMap of the subscription on the managed cluster, referred by spec.helmValuesRef
+// The layers are deep merged, a null value removes the key from the lower layers.
+// The hash of the merged values is kept in the template annotation and reported in the package status
+func OverrideHelmRelease(template *unstructured.Unstructured, packageName string, chncfg *corev1.ConfigMap,
+	overrides []dplv1alpha1.ClusterOverride, clustercfg *corev1.ConfigMap) (*unstructured.Unstructured, error) {
+	valuesovs, others, err := takeHelmValuesOverrides(overrides)
+	if err != nil {
+		return nil, err
+	}
+
+	ovt, err := OverrideTemplate(template, others)
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []string
+
+	layers = append(layers, getConfigMapHelmValues(chncfg, packageName)...)
+	layers = append(layers, valuesovs...)
+	layers = append(layers, getConfigMapHelmValues(clustercfg, packageName)...)
+
+	if len(layers) == 0 {
+		return ovt, nil
+	}
+
+	values, hash, err := MergeHelmValues(layers)
+	if err != nil {
+		return nil, err
+	}
+
+	err = unstructured.SetNestedField(ovt.Object, values, "spec", "values")
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := ovt.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[appv1alpha1.AnnotationHelmValuesHash] = hash
+	ovt.SetAnnotations(annotations)
+
+	klog.V(5).Info("Merged ", len(layers), " layers of helm values for package ", packageName, " hash: ", hash)
+
+	return ovt, nil
+}
+
+// MergeHelmValues deep merges the YAML helm values layers in order, a later layer takes precedence.
+// It returns the merged values and their hash
+func MergeHelmValues(layers []string) (string, string, error) {
+	merged := make(map[string]interface{})
+
+	for i, layer := range layers {
+		values := make(map[string]interface{})
+
+		err := yaml.Unmarshal([]byte(layer), &values)
+		if err != nil {
+			return "", "", errors.New("failed to parse helm values of layer " + strconv.Itoa(i) + ": " + err.Error())
+		}
+
+		merged = mergeHelmValues(merged, values)
+	}
+
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return string(data), hex.EncodeToString(sum[:]), nil
+}
+
+// mergeHelmValues merges maps recursively, lists and scalars of src replace the ones of dst
+func mergeHelmValues(dst, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		if v == nil {
+			delete(dst, k)
+			continue
+		}
+
+		srcmap, srcok := v.(map[string]interface{})
+		dstmap, dstok := dst[k].(map[string]interface{})
+
+		if srcok && dstok {
+			dst[k] = mergeHelmValues(dstmap, srcmap)
+			continue
+		}
+
+		dst[k] = v
+	}
+
+	return dst
+}
+
+// IsHelmValuesPath checks if the override path, in dotted or JSON pointer form, is the helm values or a field in them
+func IsHelmValuesPath(path string) bool {
+	path = strings.TrimPrefix(strings.Replace(path, "/", ".", -1), ".")
+
+	return path == HelmValuesPath || strings.HasPrefix(path, HelmValuesPath+".")
+}
+
+// takeHelmValuesOverrides splits the spec.values overrides, as helm values layers, from the other overrides
+func takeHelmValuesOverrides(overrides []dplv1alpha1.ClusterOverride) ([]string, []dplv1alpha1.ClusterOverride, error) {
+	var layers []string
+
+	var others []dplv1alpha1.ClusterOverride
+
+	for i, override := range overrides {
+		ov := make(map[string]interface{})
+
+		err := json.Unmarshal(override.RawExtension.Raw, &ov)
+		if err != nil {
+			return nil, nil, errors.New("can not parse override " + strconv.Itoa(i) + ": " + err.Error())
+		}
+
+		path, _ := ov["path"].(string)
+		value, hasvalue := ov["value"]
+
+		if path != HelmValuesPath || !hasvalue {
+			others = append(others, override)
+			continue
+		}
+
+		switch v := value.(type) {
+		case string:
+			layers = append(layers, v)
+		case map[string]interface{}:
+			data, err := yaml.Marshal(v)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			layers = append(layers, string(data))
+		case nil:
+		default:
+			return nil, nil, errors.New("value of override " + strconv.Itoa(i) + " at " + HelmValuesPath + " must be a YAML string or an object")
+		}
+	}
+
+	return layers, others, nil
+}
+
+// getConfigMapHelmValues returns the helm values of the ConfigMap for all packages, then for the package
+func getConfigMapHelmValues(cfg *corev1.ConfigMap, packageName string) []string {
+	var layers []string
+
+	if cfg == nil || cfg.Data == nil {
+		return layers
+	}
+
+	if values, ok := cfg.Data[HelmValuesKey]; ok {
+		layers = append(layers, values)
+	}
+
+	if values, ok := cfg.Data[packageName+"."+HelmValuesKey]; ok {
+		layers = append(layers, values)
+	}
+
+	return layers
+}
+
+// HelmValuesMapper maps a ConfigMap to the subscriptions in its namespace taking their helm values from it
+type HelmValuesMapper struct {
+	client.Client
+}
+
+// Map returns the requests of the subscriptions referring to the ConfigMap in spec.helmValuesRef
+func (mapper *HelmValuesMapper) Map(obj handler.MapObject) []reconcile.Request {
+	sublist := &appv1alpha1.SubscriptionList{}
+
+	err := mapper.List(context.TODO(), sublist, &client.ListOptions{Namespace: obj.Meta.GetNamespace()})
+	if err != nil {
+		klog.Error("Failed to list subscriptions referring to helm values ", obj.Meta.GetNamespace(), "/", obj.Meta.GetName(),
+			" with error: ", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+
+	for _, sub := range sublist.Items {
+		if sub.Spec.HelmValuesRef == nil || sub.Spec.HelmValuesRef.Name != obj.Meta.GetName() {
+			continue
+		}
+
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: sub.Name, Namespace: sub.Namespace}})
+	}
+
+	return requests
+}
@@ -0,0 +1,140 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ghodss/yaml"
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+var valuesHelmRelease = `{
+	"apiVersion": "app.ibm.com/v1alpha1",
+	"kind": "HelmRelease",
+	"metadata": {"name": "nginx-ingress-sub-default"},
+	"spec": {"chartName": "nginx-ingress", "version": "1.26.0"}
+}`
+
+func TestOverrideHelmRelease(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	tpl := &unstructured.Unstructured{}
+	g.Expect(tpl.UnmarshalJSON([]byte(valuesHelmRelease))).To(gomega.Succeed())
+
+	chncfg := &corev1.ConfigMap{Data: map[string]string{
+		"values":               "controller:\n  replicaCount: 1\n  image:\n    tag: 0.26.0\ndefaultBackend:\n  enabled: true\n",
+		"nginx-ingress.values": "controller:\n  replicaCount: 2\n",
+		"mongodb.values":       "persistence:\n  enabled: false\n",
+	}}
+	clustercfg := &corev1.ConfigMap{Data: map[string]string{
+		"nginx-ingress.values": "controller:\n  image:\n    tag: 0.26.1\n",
+	}}
+
+	ovt, err := OverrideHelmRelease(tpl, "nginx-ingress", chncfg, newOverrides(
+		`{"path": "spec.values", "value": "controller:\n  replicaCount: 3\ndefaultBackend: null\n"}`,
+		`{"path": "spec.values", "value": {"rbac": {"create": true}}}`,
+		`{"path": "spec.releaseName", "value": "ingress"}`,
+	), clustercfg)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// the layers are deep merged, the helm values ConfigMap of the cluster has the highest precedence and null removes a key
+	raw, _, _ := unstructured.NestedString(ovt.Object, "spec", "values")
+	values := make(map[string]interface{})
+	g.Expect(yaml.Unmarshal([]byte(raw), &values)).To(gomega.Succeed())
+	g.Expect(values).To(gomega.Equal(map[string]interface{}{
+		"controller": map[string]interface{}{
+			"replicaCount": float64(3),
+			"image":        map[string]interface{}{"tag": "0.26.1"},
+		},
+		"rbac": map[string]interface{}{"create": true},
+	}))
+
+	// the other overrides still apply
+	name, _, _ := unstructured.NestedString(ovt.Object, "spec", "releaseName")
+	g.Expect(name).To(gomega.Equal("ingress"))
+
+	_, hash, err := MergeHelmValues([]string{raw})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(ovt.GetAnnotations()).To(gomega.HaveKeyWithValue(appv1alpha1.AnnotationHelmValuesHash, hash))
+
+	// without any values layer the template is only overridden
+	ovt, err = OverrideHelmRelease(tpl, "nginx-ingress", nil, newOverrides(`{"path": "spec.releaseName", "value": "ingress"}`), nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	_, found, _ := unstructured.NestedString(ovt.Object, "spec", "values")
+	g.Expect(found).To(gomega.BeFalse())
+	g.Expect(ovt.GetAnnotations()).NotTo(gomega.HaveKey(appv1alpha1.AnnotationHelmValuesHash))
+
+	_, err = OverrideHelmRelease(tpl, "nginx-ingress", nil, newOverrides(`{"path": "spec.values", "value": 3}`), nil)
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	_, err = OverrideHelmRelease(tpl, "nginx-ingress", &corev1.ConfigMap{Data: map[string]string{"values": "- a\n- b\n"}}, nil, nil)
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestMergeHelmValuesHash(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	// the hash depends on the merged values, not on how the layers write them
+	merged, hash, err := MergeHelmValues([]string{"b: 1\na:\n  c: 2\n", "a:\n  d: 3\n"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(merged).To(gomega.Equal("a:\n  c: 2\n  d: 3\nb: 1\n"))
+
+	_, samehash, err := MergeHelmValues([]string{"a: {d: 3, c: 2}\nb: 1\n"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(samehash).To(gomega.Equal(hash))
+
+	_, otherhash, err := MergeHelmValues([]string{"a: {d: 4, c: 2}\nb: 1\n"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(otherhash).NotTo(gomega.Equal(hash))
+}
+
+func TestHelmValuesMapper(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	referring := newDependencySubscription("values-referring")
+	referring.Spec.HelmValuesRef = &corev1.LocalObjectReference{Name: "cluster-values"}
+
+	other := newDependencySubscription("values-other")
+
+	for _, sub := range []*appv1alpha1.Subscription{referring, other} {
+		g.Expect(clt.Create(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+
+		defer clt.Delete(context.TODO(), sub)
+	}
+
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cluster-values", Namespace: referring.Namespace}}
+
+	mapper := &HelmValuesMapper{Client: clt}
+	requests := mapper.Map(handler.MapObject{Meta: cm, Object: cm})
+
+	g.Expect(requests).To(gomega.Equal([]reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: referring.Name, Namespace: referring.Namespace}},
+	}))
+}
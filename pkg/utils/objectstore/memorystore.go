@@ -0,0 +1,200 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrBucketNotFound is returned by the in-memory store for a bucket it does not have
+	ErrBucketNotFound = errors.New("bucket not found")
+	// ErrObjectNotFound is returned by the in-memory store for an object it does not have
+	ErrObjectNotFound = errors.New("object not found")
+)
+
+var _ ObjectStore = &MemoryStore{}
+
+// MemoryStore keeps buckets in memory, it stands in for a real object store in unit tests
+type MemoryStore struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string]*memoryObject
+	// Gets counts the objects read from the store
+	Gets int
+	// PresignLifetime caps the expiry of the presigned URLs like temporary credentials do, when it is not zero
+	PresignLifetime time.Duration
+}
+
+type memoryObject struct {
+	content      []byte
+	etag         string
+	lastModified time.Time
+}
+
+// NewMemoryStore returns an in-memory store with the given empty buckets
+func NewMemoryStore(buckets ...string) *MemoryStore {
+	m := &MemoryStore{buckets: make(map[string]map[string]*memoryObject)}
+
+	for _, bucket := range buckets {
+		m.buckets[bucket] = make(map[string]*memoryObject)
+	}
+
+	return m
+}
+
+// Exists checks whether the bucket exists
+func (m *MemoryStore) Exists(bucket string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.buckets[bucket]; !ok {
+		return ErrBucketNotFound
+	}
+
+	return nil
+}
+
+// Create creates the bucket if it does not exist
+func (m *MemoryStore) Create(bucket string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.buckets[bucket]; !ok {
+		m.buckets[bucket] = make(map[string]*memoryObject)
+	}
+
+	return nil
+}
+
+// List returns the objects in the bucket starting with the prefix sorted by key
+func (m *MemoryStore) List(bucket, prefix string) ([]ObjectInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	objects, ok := m.buckets[bucket]
+	if !ok {
+		return nil, ErrBucketNotFound
+	}
+
+	infos := make([]ObjectInfo, 0, len(objects))
+
+	for key, obj := range objects {
+		if strings.HasPrefix(key, prefix) {
+			infos = append(infos, ObjectInfo{Key: key, ETag: obj.etag, LastModified: obj.lastModified})
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+
+	return infos, nil
+}
+
+// Get returns a copy of the object content
+func (m *MemoryStore) Get(bucket, name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	objects, ok := m.buckets[bucket]
+	if !ok {
+		return nil, ErrBucketNotFound
+	}
+
+	obj, ok := objects[name]
+	if !ok {
+		return nil, ErrObjectNotFound
+	}
+
+	m.Gets++
+
+	return append([]byte(nil), obj.content...), nil
+}
+
+// GetStream returns a reader of the object content
+func (m *MemoryStore) GetStream(bucket, name string) (io.ReadCloser, error) {
+	content, err := m.Get(bucket, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(content)), nil
+}
+
+// PresignGet returns a memory:// URL of the object, it is not served and only tells the object and expiry apart
+func (m *MemoryStore) PresignGet(bucket, name string, expiry time.Duration) (string, time.Time, error) {
+	if err := m.Exists(bucket); err != nil {
+		return "", time.Time{}, err
+	}
+
+	if m.PresignLifetime > 0 && m.PresignLifetime < expiry {
+		expiry = m.PresignLifetime
+	}
+
+	return "memory://" + bucket + "/" + name + "?expiry=" + expiry.String(), time.Now().Add(expiry), nil
+}
+
+// Put stores a copy of the content in the bucket, the ETag of the object is the MD5 of the content like S3
+func (m *MemoryStore) Put(bucket, name string, content []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	objects, ok := m.buckets[bucket]
+	if !ok {
+		return ErrBucketNotFound
+	}
+
+	sum := md5.Sum(content)
+
+	objects[name] = &memoryObject{
+		content:      append([]byte(nil), content...),
+		etag:         hex.EncodeToString(sum[:]),
+		lastModified: time.Now(),
+	}
+
+	return nil
+}
+
+// PutStream stores the content of the reader in the bucket
+func (m *MemoryStore) PutStream(bucket, name string, content io.ReadSeeker) error {
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+
+	return m.Put(bucket, name, data)
+}
+
+// Delete deletes the object from the bucket
+func (m *MemoryStore) Delete(bucket, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	objects, ok := m.buckets[bucket]
+	if !ok {
+		return ErrBucketNotFound
+	}
+
+	delete(objects, name)
+
+	return nil
+}
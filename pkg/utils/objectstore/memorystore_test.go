@@ -0,0 +1,103 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+)
+
+func TestMemoryStore(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	memstore := NewMemoryStore("charts")
+
+	var store ObjectStore = memstore
+
+	g.Expect(store.Exists("charts")).To(gomega.Succeed())
+	g.Expect(store.Exists("templates")).To(gomega.Equal(ErrBucketNotFound))
+	g.Expect(store.Put("templates", "cm", []byte("a"))).To(gomega.Equal(ErrBucketNotFound))
+
+	g.Expect(store.Create("templates")).To(gomega.Succeed())
+	g.Expect(store.Put("templates", "svc", []byte("kind: Service"))).To(gomega.Succeed())
+	g.Expect(store.PutStream("templates", "cm", bytes.NewReader([]byte("kind: ConfigMap")))).To(gomega.Succeed())
+
+	g.Expect(store.Put("templates", "dev/cm", []byte("kind: ConfigMap"))).To(gomega.Succeed())
+
+	infos, err := store.List("templates", "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(listedKeys(infos)).To(gomega.Equal([]string{"cm", "dev/cm", "svc"}))
+
+	// the same content has the same ETag
+	g.Expect(infos[0].ETag).To(gomega.Equal(infos[1].ETag))
+	g.Expect(infos[0].ETag).NotTo(gomega.Equal(infos[2].ETag))
+
+	infos, err = store.List("templates", "dev/")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(listedKeys(infos)).To(gomega.Equal([]string{"dev/cm"}))
+
+	content, err := store.Get("templates", "cm")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(content)).To(gomega.Equal("kind: ConfigMap"))
+
+	// the store keeps its own copy of the content
+	content[0] = 'K'
+	reader, err := store.GetStream("templates", "cm")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	content, err = ioutil.ReadAll(reader)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(reader.Close()).To(gomega.Succeed())
+	g.Expect(string(content)).To(gomega.Equal("kind: ConfigMap"))
+
+	presigned, expires, err := store.PresignGet("templates", "cm", time.Hour)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(presigned).To(gomega.Equal("memory://templates/cm?expiry=1h0m0s"))
+	g.Expect(expires).To(gomega.BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+
+	// the lifetime of the credentials caps the expiry
+	memstore.PresignLifetime = 15 * time.Minute
+	presigned, expires, err = store.PresignGet("templates", "cm", time.Hour)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(presigned).To(gomega.Equal("memory://templates/cm?expiry=15m0s"))
+	g.Expect(expires).To(gomega.BeTemporally("~", time.Now().Add(15*time.Minute), time.Minute))
+
+	_, _, err = store.PresignGet("releases", "cm", time.Hour)
+	g.Expect(err).To(gomega.Equal(ErrBucketNotFound))
+
+	g.Expect(store.Delete("templates", "cm")).To(gomega.Succeed())
+
+	_, err = store.Get("templates", "cm")
+	g.Expect(err).To(gomega.Equal(ErrObjectNotFound))
+
+	infos, err = store.List("templates", "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(listedKeys(infos)).To(gomega.Equal([]string{"dev/cm", "svc"}))
+	g.Expect(memstore.Gets).To(gomega.Equal(2))
+}
+
+func listedKeys(infos []ObjectInfo) []string {
+	var keys []string
+
+	for _, info := range infos {
+		keys = append(keys, info.Key)
+	}
+
+	return keys
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package objectstore
+
+import (
+	"io"
+	"time"
+)
+
+// ObjectStore defines the operations of an object storage backend used by object bucket channels
+type ObjectStore interface {
+	// Exists checks whether a bucket exists and is accessible
+	Exists(bucket string) error
+	// Create creates a bucket
+	Create(bucket string) error
+	// List returns all objects in a bucket whose key starts with the prefix, including the objects in sub folders
+	List(bucket, prefix string) ([]ObjectInfo, error)
+	// Get returns the content of an object
+	Get(bucket, name string) ([]byte, error)
+	// GetStream returns a reader of the content of an object, the caller closes it
+	GetStream(bucket, name string) (io.ReadCloser, error)
+	// PresignGet returns a URL reading the object without credentials and the time it expires, which is before
+	// the expiry passes when the credentials signing it expire earlier
+	PresignGet(bucket, name string, expiry time.Duration) (string, time.Time, error)
+	// Put creates or replaces an object
+	Put(bucket, name string, content []byte) error
+	// PutStream creates or replaces an object with the content of the reader
+	PutStream(bucket, name string, content io.ReadSeeker) error
+	// Delete deletes an object
+	Delete(bucket, name string) error
+}
+
+// ObjectInfo describes an object of a listing, the ETag and last modified time change when the object content changes
+type ObjectInfo struct {
+	Key          string
+	ETag         string
+	LastModified time.Time
+}
+
+// Config defines the connection to an object store, backends use their default credentials without an access key
+type Config struct {
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// RoleARN is the role the credentials assume
+	RoleARN string
+	// CACert is the PEM encoded CA certificates verifying the endpoint, in addition to the system ones
+	CACert             []byte
+	InsecureSkipVerify bool
+}
+
+// Factory connects to the object store defined by the config
+type Factory func(cfg *Config) (ObjectStore, error)
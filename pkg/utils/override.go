@@ -15,17 +15,32 @@
 package utils
 
 import (
+	"encoding/json"
 	"errors"
+	"strconv"
 	"strings"
 
+	jsonpatch "github.com/evanphx/json-patch"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/klog"
 
 	appv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
 )
 
+const (
+	// OverrideJSONPatch is the key of an override carrying a RFC 6902 JSON patch, for example
+	// {"jsonPatch": [{"op": "replace", "path": "/spec/template/spec/containers/1/image", "value": "nginx:1.17"}]}
+	OverrideJSONPatch = "jsonPatch"
+	// OverrideStrategicMergePatch is the key of an override carrying a strategic merge patch, for example
+	// {"strategicMergePatch": {"metadata": {"annotations": {"app.ibm.com/foo": "bar"}}}}
+	// resources without a registered type, such as custom resources, are merged by JSON merge patch
+	OverrideStrategicMergePatch = "strategicMergePatch"
+)
+
 // PrepareOverrides returns the overridemap for given deployable instance
 func PrepareOverrides(cluster types.NamespacedName, instance *appv1alpha1.Deployable) ([]appv1alpha1.ClusterOverride, error) {
 	if klog.V(QuiteLogLel) {
@@ -69,7 +84,7 @@ func OverrideTemplate(template *unstructured.Unstructured, overrides []appv1alph
 		return ovt, nil
 	}
 
-	for _, override := range overrides {
+	for i, override := range overrides {
 		ovuobj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&override)
 		klog.V(10).Info("From Instance Converter", ovuobj, "with err:", err, " path: ", ovuobj["path"], " value:", ovuobj["value"])
 
@@ -77,6 +92,33 @@ func OverrideTemplate(template *unstructured.Unstructured, overrides []appv1alph
 			return nil, errors.New("can not parse override")
 		}
 
+		if patch, ok := ovuobj[OverrideJSONPatch]; ok {
+			ovt, err = applyJSONPatch(ovt, patch)
+			if err != nil {
+				return nil, errors.New("failed to apply " + OverrideJSONPatch + " of override " + strconv.Itoa(i) + ": " + err.Error())
+			}
+
+			continue
+		}
+
+		if _, ok := ovuobj[OverrideValueFrom]; ok {
+			ovt, err = addValueFromOverride(ovt, override.RawExtension.Raw)
+			if err != nil {
+				return nil, errors.New("failed to take " + OverrideValueFrom + " of override " + strconv.Itoa(i) + ": " + err.Error())
+			}
+
+			continue
+		}
+
+		if patch, ok := ovuobj[OverrideStrategicMergePatch]; ok {
+			ovt, err = applyStrategicMergePatch(ovt, patch)
+			if err != nil {
+				return nil, errors.New("failed to apply " + OverrideStrategicMergePatch + " of override " + strconv.Itoa(i) + ": " + err.Error())
+			}
+
+			continue
+		}
+
 		path, ok := ovuobj["path"].(string)
 
 		if !ok {
@@ -95,3 +137,107 @@ func OverrideTemplate(template *unstructured.Unstructured, overrides []appv1alph
 
 	return ovt, nil
 }
+
+// IsPatchOverride checks if the override carries a JSON patch or a strategic merge patch instead of a path and value
+func IsPatchOverride(override appv1alpha1.ClusterOverride) bool {
+	ov := make(map[string]interface{})
+
+	if err := json.Unmarshal(override.RawExtension.Raw, &ov); err != nil {
+		return false
+	}
+
+	_, jsonPatch := ov[OverrideJSONPatch]
+	_, mergePatch := ov[OverrideStrategicMergePatch]
+
+	return jsonPatch || mergePatch
+}
+
+// applyJSONPatch applies the RFC 6902 operations to the template
+func applyJSONPatch(template *unstructured.Unstructured, ops interface{}) (*unstructured.Unstructured, error) {
+	pb, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := jsonpatch.DecodePatch(pb)
+	if err != nil {
+		return nil, err
+	}
+
+	tb, err := template.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	tb, err = patch.Apply(tb)
+	if err != nil {
+		return nil, err
+	}
+
+	patched := &unstructured.Unstructured{}
+
+	err = patched.UnmarshalJSON(tb)
+	if err != nil {
+		return nil, err
+	}
+
+	return patched, nil
+}
+
+// applyStrategicMergePatch merges the patch into the template with the patch strategies of the template kind,
+// or by JSON merge patch if the kind is not a registered type
+func applyStrategicMergePatch(template *unstructured.Unstructured, patch interface{}) (*unstructured.Unstructured, error) {
+	patchmap, ok := patch.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("strategic merge patch must be a json object")
+	}
+
+	obj, err := scheme.Scheme.New(template.GroupVersionKind())
+	if err != nil {
+		if !runtime.IsNotRegisteredError(err) {
+			return nil, err
+		}
+
+		klog.V(5).Info("No registered type for ", template.GroupVersionKind(), ", merging override by json merge patch")
+
+		return applyJSONMergePatch(template, patchmap)
+	}
+
+	meta, err := strategicpatch.NewPatchMetaFromStruct(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	merged, err := strategicpatch.StrategicMergeMapPatchUsingLookupPatchMeta(template.Object, patchmap, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return &unstructured.Unstructured{Object: merged}, nil
+}
+
+func applyJSONMergePatch(template *unstructured.Unstructured, patch map[string]interface{}) (*unstructured.Unstructured, error) {
+	pb, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	tb, err := template.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	tb, err = jsonpatch.MergePatch(tb, pb)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &unstructured.Unstructured{}
+
+	err = merged.UnmarshalJSON(tb)
+	if err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+)
+
+var overrideDeployment = `{
+	"apiVersion": "apps/v1",
+	"kind": "Deployment",
+	"metadata": {"name": "nginx", "labels": {"app": "nginx", "tier": "web"}},
+	"spec": {
+		"replicas": 1,
+		"template": {"spec": {"containers": [
+			{"name": "nginx", "image": "nginx:1.16"},
+			{"name": "sidecar", "image": "envoy:1.11"}
+		]}}
+	}
+}`
+
+func newOverrides(raws ...string) []dplv1alpha1.ClusterOverride {
+	var covs []dplv1alpha1.ClusterOverride
+
+	for _, raw := range raws {
+		covs = append(covs, dplv1alpha1.ClusterOverride{RawExtension: runtime.RawExtension{Raw: []byte(raw)}})
+	}
+
+	return covs
+}
+
+func TestOverrideTemplate(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	tpl := &unstructured.Unstructured{}
+	g.Expect(tpl.UnmarshalJSON([]byte(overrideDeployment))).To(gomega.Succeed())
+
+	// overrides are applied in order, a later override sees the result of the former
+	ovt, err := OverrideTemplate(tpl, newOverrides(
+		`{"path": "spec.replicas", "value": 3}`,
+		`{"jsonPatch": [{"op": "replace", "path": "/spec/template/spec/containers/1/image", "value": "envoy:1.12"},
+			{"op": "test", "path": "/spec/replicas", "value": 3}]}`,
+		`{"strategicMergePatch": {"metadata": {"annotations": {"app.ibm.com/foo": "bar"}, "labels": {"tier": null}},
+			"spec": {"template": {"spec": {"containers": [{"name": "nginx", "image": "nginx:1.17"}]}}}}}`,
+	))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	g.Expect(ovt.GetAnnotations()).To(gomega.Equal(map[string]string{"app.ibm.com/foo": "bar"}))
+	g.Expect(ovt.GetLabels()).To(gomega.Equal(map[string]string{"app": "nginx"}))
+
+	replicas, _, _ := unstructured.NestedInt64(ovt.Object, "spec", "replicas")
+	g.Expect(replicas).To(gomega.Equal(int64(3)))
+
+	containers, _, _ := unstructured.NestedSlice(ovt.Object, "spec", "template", "spec", "containers")
+	g.Expect(containers).To(gomega.HaveLen(2))
+	g.Expect(containers[0].(map[string]interface{})["image"]).To(gomega.Equal("nginx:1.17"))
+	g.Expect(containers[1].(map[string]interface{})["image"]).To(gomega.Equal("envoy:1.12"))
+
+	// the template is untouched
+	containers, _, _ = unstructured.NestedSlice(tpl.Object, "spec", "template", "spec", "containers")
+	g.Expect(containers[1].(map[string]interface{})["image"]).To(gomega.Equal("envoy:1.11"))
+
+	// kinds without registered type are merged by json merge patch, lists are replaced
+	cr := &unstructured.Unstructured{}
+	cr.SetAPIVersion("example.com/v1")
+	cr.SetKind("Widget")
+	cr.SetName("nginx")
+	g.Expect(unstructured.SetNestedStringSlice(cr.Object, []string{"a", "b"}, "spec", "urls")).To(gomega.Succeed())
+	g.Expect(unstructured.SetNestedField(cr.Object, "blue", "spec", "color")).To(gomega.Succeed())
+
+	ovt, err = OverrideTemplate(cr, newOverrides(`{"strategicMergePatch": {"spec": {"urls": ["c"], "color": null}}}`))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(ovt.Object["spec"]).To(gomega.Equal(map[string]interface{}{"urls": []interface{}{"c"}}))
+
+	// failed patches tell which override failed
+	_, err = OverrideTemplate(tpl, newOverrides(
+		`{"path": "spec.replicas", "value": 3}`,
+		`{"jsonPatch": [{"op": "remove", "path": "/spec/template/spec/containers/5"}]}`,
+	))
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.Error()).To(gomega.HavePrefix("failed to apply jsonPatch of override 1: "))
+
+	_, err = OverrideTemplate(tpl, newOverrides(`{"strategicMergePatch": ["spec"]}`))
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	g.Expect(IsPatchOverride(newOverrides(`{"jsonPatch": []}`)[0])).To(gomega.BeTrue())
+	g.Expect(IsPatchOverride(newOverrides(`{"path": "spec.replicas", "value": 3}`)[0])).To(gomega.BeFalse())
+}
@@ -0,0 +1,242 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+// OverrideValueFrom is the key of an override taking its value from a ConfigMap or Secret in the namespace of the
+// subscription on the managed cluster, for example
+// {"path": "/spec/template/spec/containers/0/env/0/value", "valueFrom": {"secretKeyRef": {"name": "db", "key": "password"}}}
+// a path starting with "/" is a JSON pointer, otherwise it is a dot separated field path
+const OverrideValueFrom = "valueFrom"
+
+// OverrideValueSource selects the key of a ConfigMap or Secret an override takes its value from
+type OverrideValueSource struct {
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	SecretKeyRef    *corev1.SecretKeySelector    `json:"secretKeyRef,omitempty"`
+}
+
+// ValueFromOverride is an override whose value is read on the managed cluster when the template is applied
+type ValueFromOverride struct {
+	Path      string              `json:"path"`
+	ValueFrom OverrideValueSource `json:"valueFrom"`
+}
+
+// addValueFromOverride keeps the valueFrom override in the template annotation, the synchronizer resolves it on the managed cluster.
+// valueFrom overrides are applied after the other overrides of the package
+func addValueFromOverride(template *unstructured.Unstructured, raw []byte) (*unstructured.Unstructured, error) {
+	ov := ValueFromOverride{}
+
+	err := json.Unmarshal(raw, &ov)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateValueFromOverride(ov)
+	if err != nil {
+		return nil, err
+	}
+
+	ovs, err := GetValueFromOverrides(template)
+	if err != nil {
+		return nil, err
+	}
+
+	ovs = append(ovs, ov)
+
+	ovb, err := json.Marshal(ovs)
+	if err != nil {
+		return nil, err
+	}
+
+	tplanno := template.GetAnnotations()
+	if tplanno == nil {
+		tplanno = make(map[string]string)
+	}
+
+	tplanno[appv1alpha1.AnnotationValueFromOverrides] = string(ovb)
+	template.SetAnnotations(tplanno)
+
+	return template, nil
+}
+
+func validateValueFromOverride(ov ValueFromOverride) error {
+	if strings.TrimSpace(ov.Path) == "" {
+		return errors.New("path is required")
+	}
+
+	// the helm values are merged from their layers when the HelmRelease is built, before the synchronizer resolves valueFrom
+	if IsHelmValuesPath(ov.Path) {
+		return errors.New("helm values can not be taken from a ConfigMap or Secret key, use spec.helmValuesRef of the subscription")
+	}
+
+	cmref, secref := ov.ValueFrom.ConfigMapKeyRef, ov.ValueFrom.SecretKeyRef
+
+	if (cmref == nil) == (secref == nil) {
+		return errors.New("exactly one of configMapKeyRef and secretKeyRef is required")
+	}
+
+	if cmref != nil && (cmref.Name == "" || cmref.Key == "") {
+		return errors.New("configMapKeyRef requires name and key")
+	}
+
+	if secref != nil && (secref.Name == "" || secref.Key == "") {
+		return errors.New("secretKeyRef requires name and key")
+	}
+
+	return nil
+}
+
+// GetValueFromOverrides returns the valueFrom overrides kept in the template annotation
+func GetValueFromOverrides(template *unstructured.Unstructured) ([]ValueFromOverride, error) {
+	var ovs []ValueFromOverride
+
+	ovstr, ok := template.GetAnnotations()[appv1alpha1.AnnotationValueFromOverrides]
+	if !ok {
+		return ovs, nil
+	}
+
+	err := json.Unmarshal([]byte(ovstr), &ovs)
+	if err != nil {
+		return nil, errors.New("invalid annotation " + appv1alpha1.AnnotationValueFromOverrides + ": " + err.Error())
+	}
+
+	return ovs, nil
+}
+
+// TakeValueFromOverrides returns the valueFrom overrides kept in the template annotation and removes the annotation
+func TakeValueFromOverrides(template *unstructured.Unstructured) ([]ValueFromOverride, error) {
+	ovs, err := GetValueFromOverrides(template)
+	if err != nil {
+		return nil, err
+	}
+
+	tplanno := template.GetAnnotations()
+	if _, ok := tplanno[appv1alpha1.AnnotationValueFromOverrides]; ok {
+		delete(tplanno, appv1alpha1.AnnotationValueFromOverrides)
+		template.SetAnnotations(tplanno)
+	}
+
+	return ovs, nil
+}
+
+// ResolveValueFromOverrides returns a copy of the template with the values of the overrides read from the ConfigMaps and Secrets
+// in namespace, and a hash of the values telling when they change.
+// The values may be secrets, they are never logged and errors name the object and key only
+func ResolveValueFromOverrides(clt client.Client, template *unstructured.Unstructured, ovs []ValueFromOverride,
+	namespace string) (*unstructured.Unstructured, string, error) {
+	ovt := template.DeepCopy()
+
+	if len(ovs) == 0 {
+		return ovt, "", nil
+	}
+
+	h := sha256.New()
+
+	for _, ov := range ovs {
+		value, found, err := readOverrideValue(clt, ov.ValueFrom, namespace)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if !found {
+			continue
+		}
+
+		if strings.HasPrefix(ov.Path, "/") {
+			ovt, err = applyJSONPatch(ovt, []interface{}{map[string]interface{}{"op": "add", "path": ov.Path, "value": value}})
+		} else {
+			err = unstructured.SetNestedField(ovt.Object, value, strings.Split(ov.Path, ".")...)
+		}
+
+		if err != nil {
+			return nil, "", errors.New("failed to set " + OverrideValueFrom + " override to " + ov.Path + ": " + err.Error())
+		}
+
+		h.Write([]byte(ov.Path))
+		h.Write([]byte{0})
+		h.Write([]byte(value))
+		h.Write([]byte{0})
+	}
+
+	return ovt, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readOverrideValue reads the key selected by the value source, found is false if an optional object or key is missing
+func readOverrideValue(clt client.Client, src OverrideValueSource, namespace string) (string, bool, error) {
+	if ref := src.ConfigMapKeyRef; ref != nil {
+		objkey := types.NamespacedName{Name: ref.Name, Namespace: namespace}
+		cm := &corev1.ConfigMap{}
+
+		err := clt.Get(context.TODO(), objkey, cm)
+		if err != nil {
+			return optionalOverrideValue(ref.Optional, err, "configmap "+objkey.String())
+		}
+
+		if value, ok := cm.Data[ref.Key]; ok {
+			return value, true, nil
+		}
+
+		return optionalOverrideValue(ref.Optional, nil, "key "+ref.Key+" in configmap "+objkey.String())
+	}
+
+	if ref := src.SecretKeyRef; ref != nil {
+		objkey := types.NamespacedName{Name: ref.Name, Namespace: namespace}
+		sec := &corev1.Secret{}
+
+		err := clt.Get(context.TODO(), objkey, sec)
+		if err != nil {
+			return optionalOverrideValue(ref.Optional, err, "secret "+objkey.String())
+		}
+
+		if value, ok := sec.Data[ref.Key]; ok {
+			return string(value), true, nil
+		}
+
+		return optionalOverrideValue(ref.Optional, nil, "key "+ref.Key+" in secret "+objkey.String())
+	}
+
+	return "", false, errors.New("no configMapKeyRef or secretKeyRef in " + OverrideValueFrom + " override")
+}
+
+func optionalOverrideValue(optional *bool, err error, what string) (string, bool, error) {
+	if err != nil && !kerrors.IsNotFound(err) {
+		klog.Error("Failed to read ", what, " for ", OverrideValueFrom, " override with error: ", err)
+		return "", false, err
+	}
+
+	if optional != nil && *optional {
+		klog.V(5).Info("Skipping ", OverrideValueFrom, " override of optional ", what, " which is not found")
+		return "", false, nil
+	}
+
+	return "", false, errors.New(what + " of " + OverrideValueFrom + " override is not found")
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func TestValueFromOverrides(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-config", Namespace: "default"},
+		Data:       map[string]string{"endpoint": "db.local:5432"},
+	}
+	g.Expect(clt.Create(context.TODO(), cm)).To(gomega.Succeed())
+
+	defer clt.Delete(context.TODO(), cm)
+
+	sec := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-secret", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("s3cr3t")},
+	}
+	g.Expect(clt.Create(context.TODO(), sec)).To(gomega.Succeed())
+
+	defer clt.Delete(context.TODO(), sec)
+
+	tpl := &unstructured.Unstructured{}
+	g.Expect(tpl.UnmarshalJSON([]byte(overrideDeployment))).To(gomega.Succeed())
+
+	ovt, err := OverrideTemplate(tpl, newOverrides(
+		`{"path": "/metadata/annotations/db.ibm.com~1endpoint", "valueFrom": {"configMapKeyRef": {"name": "db-config", "key": "endpoint"}}}`,
+		`{"path": "spec.password", "valueFrom": {"secretKeyRef": {"name": "db-secret", "key": "password"}}}`,
+		`{"path": "spec.replicas", "value": 2}`,
+	))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// the template carries the references only
+	g.Expect(ovt.GetAnnotations()[appv1alpha1.AnnotationValueFromOverrides]).To(gomega.ContainSubstring("db-secret"))
+	g.Expect(ovt.GetAnnotations()[appv1alpha1.AnnotationValueFromOverrides]).NotTo(gomega.ContainSubstring("s3cr3t"))
+
+	ovs, err := TakeValueFromOverrides(ovt)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(ovs).To(gomega.HaveLen(2))
+	g.Expect(ovt.GetAnnotations()).NotTo(gomega.HaveKey(appv1alpha1.AnnotationValueFromOverrides))
+
+	resolved, hash, err := ResolveValueFromOverrides(clt, ovt, ovs, "default")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(hash).NotTo(gomega.BeEmpty())
+	g.Expect(resolved.GetAnnotations()["db.ibm.com/endpoint"]).To(gomega.Equal("db.local:5432"))
+
+	password, _, _ := unstructured.NestedString(resolved.Object, "spec", "password")
+	g.Expect(password).To(gomega.Equal("s3cr3t"))
+
+	replicas, _, _ := unstructured.NestedInt64(resolved.Object, "spec", "replicas")
+	g.Expect(replicas).To(gomega.Equal(int64(2)))
+
+	// the template is untouched
+	g.Expect(ovt.GetAnnotations()).NotTo(gomega.HaveKey("db.ibm.com/endpoint"))
+
+	// the hash tells the values changed
+	sec.Data["password"] = []byte("n3wp4ss")
+	g.Expect(clt.Update(context.TODO(), sec)).To(gomega.Succeed())
+
+	_, newhash, err := ResolveValueFromOverrides(clt, ovt, ovs, "default")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(newhash).NotTo(gomega.Equal(hash))
+
+	// missing references are errors without values, unless optional
+	optional := true
+	missing := []ValueFromOverride{{
+		Path:      "spec.token",
+		ValueFrom: OverrideValueSource{SecretKeyRef: &corev1.SecretKeySelector{Key: "token"}},
+	}}
+	missing[0].ValueFrom.SecretKeyRef.Name = "db-secret"
+
+	_, _, err = ResolveValueFromOverrides(clt, ovt, missing, "default")
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.Error()).To(gomega.ContainSubstring("key token in secret default/db-secret"))
+	g.Expect(err.Error()).NotTo(gomega.ContainSubstring("n3wp4ss"))
+
+	missing[0].ValueFrom.SecretKeyRef.Optional = &optional
+
+	resolved, _, err = ResolveValueFromOverrides(clt, ovt, missing, "default")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(resolved.Object["spec"]).NotTo(gomega.HaveKey("token"))
+
+	_, err = OverrideTemplate(tpl, newOverrides(`{"path": "spec.password", "valueFrom": {"secretKeyRef": {"key": "password"}}}`))
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	// helm values are merged from their layers, they can not be read on the managed cluster
+	for _, path := range []string{"spec.values", "spec.values.db.password", "/spec/values/db~1password"} {
+		_, err = OverrideTemplate(tpl, newOverrides(`{"path": "`+path+`", "valueFrom": {"secretKeyRef": {"name": "db-secret", "key": "password"}}}`))
+		g.Expect(err).To(gomega.HaveOccurred())
+	}
+}
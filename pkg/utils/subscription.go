@@ -208,6 +208,15 @@ func UpdateSubscriptionStatus(statusClient client.Client, templateerr error, tpl
 		return err
 	}
 
+	pkgstatus := sub.Status.Statuses["/"].SubscriptionPackageStatus[dplkey.Name]
+	pkgstatus.ValuesHash = tplunit.GetAnnotations()[appv1alpha1.AnnotationHelmValuesHash]
+
+	// the version policies keep to the version deployed for the package
+	if group := tplunit.GetAnnotations()[appv1alpha1.AnnotationDeployableGroup]; templateerr == nil && group != "" {
+		pkgstatus.Group = group
+		pkgstatus.Version = tplunit.GetAnnotations()[dplv1alpha1.AnnotationDeployableVersion]
+	}
+
 	err = statusClient.Status().Update(context.TODO(), sub)
 	// want to print out the error log before leave
 	if err != nil {
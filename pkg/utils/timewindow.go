@@ -15,6 +15,7 @@
 package utils
 
 import (
+	"errors"
 	"sort"
 	"strings"
 	"time"
@@ -24,6 +25,12 @@ import (
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
 )
 
+// windowSlotHorizon bounds how far the weekdays and hours are expanded to slots
+const windowSlotHorizon = 366 * 24 * time.Hour
+
+// maxCronSlots bounds the slots of a cron schedule collected around a time
+const maxCronSlots = 10000
+
 var CURDAY, _ = time.Parse(time.UnixDate, "Sat Jan  1 00:00:00 UTC 0000")
 var MIDNIGHT, _ = time.Parse(time.UnixDate, "Sun Jan  2 00:00:00 UTC 0000")
 
@@ -38,6 +45,10 @@ type runDays []time.Weekday
 // if hour range is empty and weekday is empty then retrun 0
 // if hour range is empty and weekday is not then return nextday durtion(here the window type will be considered again)
 func NextStartPoint(tw *appv1alpha1.TimeWindow, t time.Time) time.Duration {
+	if len(tw.Crons) != 0 || len(tw.Dates) != 0 {
+		return nextSlotPoint(tw, nil, t)
+	}
+
 	// convert current time to the location time defined within the timewindow
 	uniTime := UnifyTimeZone(tw, t)
 	klog.V(5).Infof("Time window checking at %v", uniTime.String())
@@ -321,3 +332,433 @@ func (rh RunHourRanges) Less(i, j int) bool {
 	return e.After(s)
 }
 func (rh RunHourRanges) Swap(i, j int) { rh[i], rh[j] = rh[j], rh[i] }
+
+// windowSlot is a period of time in the window, the end is excluded
+type windowSlot struct {
+	start time.Time
+	end   time.Time
+}
+
+// NextStartPointWithCalendar evaluates the time window like NextStartPoint, combined with the calendar it refers to
+func NextStartPointWithCalendar(tw *appv1alpha1.TimeWindow, cal *Calendar, t time.Time) time.Duration {
+	if cal == nil {
+		return NextStartPoint(tw, t)
+	}
+
+	return nextSlotPoint(tw, cal, t)
+}
+
+// GetTimeWindowState evaluates the time window combined with its calendar at t, returns whether it is open
+// and when it changes next, zero if it does not change within the horizon. The slots are expanded once
+func GetTimeWindowState(tw *appv1alpha1.TimeWindow, cal *Calendar, t time.Time) (appv1alpha1.TimeWindowState, time.Time) {
+	uniTime := UnifyTimeZone(tw, t)
+
+	if cal == nil && len(tw.Crons) == 0 && len(tw.Dates) == 0 {
+		if nextRun := NextStartPoint(tw, uniTime); nextRun > time.Duration(0) {
+			return appv1alpha1.TimeWindowBlocked, uniTime.Add(nextRun)
+		}
+
+		return appv1alpha1.TimeWindowOpen, weeklyWindowEnd(tw, uniTime)
+	}
+
+	slots, blocked := getWindowSlots(tw, cal, uniTime)
+	limit := uniTime.Add(windowSlotHorizon)
+
+	for _, slot := range slots {
+		if !slot.end.After(uniTime) {
+			continue
+		}
+
+		// t in a slot changes at its end, t out of the slots at the start of the next one
+		state, next := appv1alpha1.TimeWindowBlocked, slot.start
+
+		switch {
+		case !slot.start.After(uniTime) && blocked:
+			next = slot.end
+		case !slot.start.After(uniTime):
+			state, next = appv1alpha1.TimeWindowOpen, slot.end
+		case blocked:
+			state = appv1alpha1.TimeWindowOpen
+		}
+
+		if !next.Before(limit) {
+			return state, time.Time{}
+		}
+
+		return state, next
+	}
+
+	if blocked {
+		return appv1alpha1.TimeWindowOpen, time.Time{}
+	}
+
+	return appv1alpha1.TimeWindowBlocked, time.Time{}
+}
+
+// weeklyWindowEnd returns when the open time window of weekdays and hours closes, zero if it stays open.
+// Its state only changes at midnight or around the start or end of an hour range, which repeat every week
+func weeklyWindowEnd(tw *appv1alpha1.TimeWindow, uniTime time.Time) time.Time {
+	offsets := []time.Duration{0}
+
+	for _, hr := range tw.Hours {
+		for _, str := range []string{hr.Start, hr.End} {
+			if p, err := time.Parse(time.Kitchen, str); err == nil {
+				offsets = append(offsets, p.Sub(CURDAY), p.Sub(CURDAY)+time.Minute)
+			}
+		}
+	}
+
+	var points []time.Time
+
+	for i := 0; i <= 8; i++ {
+		day := time.Date(uniTime.Year(), uniTime.Month(), uniTime.Day()+i, 0, 0, 0, 0, uniTime.Location())
+
+		for _, offset := range offsets {
+			if p := wallClockOfDay(day, offset); p.After(uniTime) {
+				points = append(points, p)
+			}
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i].Before(points[j]) })
+
+	for _, p := range points {
+		if NextStartPoint(tw, p) > time.Duration(0) {
+			return p
+		}
+	}
+
+	return time.Time{}
+}
+
+// nextSlotPoint evaluates the time window as the union of the slots of its weekdays and hours, cron schedules and dates,
+// and of the calendar windows. For an active window, it returns 0 if t is in a slot, or the duration till the next slot.
+// For a blocked window, it returns the duration till the end of the slot t is in, or 0 if t is out of the slots.
+// The calendar blackouts are never in an active window and always in a blocked one.
+// The slots are built with the wall clock of the location, so they follow the daylight saving changes
+func nextSlotPoint(tw *appv1alpha1.TimeWindow, cal *Calendar, t time.Time) time.Duration {
+	uniTime := UnifyTimeZone(tw, t)
+	slots, blocked := getWindowSlots(tw, cal, uniTime)
+
+	for _, slot := range slots {
+		if !slot.end.After(uniTime) {
+			continue
+		}
+
+		if !slot.start.After(uniTime) {
+			if blocked {
+				return slot.end.Sub(uniTime)
+			}
+
+			return time.Duration(0)
+		}
+
+		if blocked {
+			return time.Duration(0)
+		}
+
+		return slot.start.Sub(uniTime)
+	}
+
+	if blocked {
+		return time.Duration(0)
+	}
+
+	klog.Infof("No upcoming slot in time window %v, will check again after %v", tw, windowSlotHorizon)
+
+	return windowSlotHorizon
+}
+
+// getWindowSlots returns the sorted and merged slots of the time window combined with the calendar around t,
+// and whether the slots are blocked rather than active
+func getWindowSlots(tw *appv1alpha1.TimeWindow, cal *Calendar, uniTime time.Time) ([]windowSlot, bool) {
+	var blackouts []windowSlot
+
+	calTime := uniTime
+
+	if cal != nil {
+		if cal.Location != "" {
+			calTime = uniTime.In(getLoc(cal.Location))
+		}
+
+		blackouts = mergeSlots(getDateSlots(cal.Blackouts, calTime.Location()))
+	}
+
+	// the cron slots are expanded past the blackouts, so that a slot is left after them
+	until := uniTime
+	if len(blackouts) != 0 && blackouts[len(blackouts)-1].end.After(until) {
+		until = blackouts[len(blackouts)-1].end
+	}
+
+	slots := getTimeWindowSlots(tw, uniTime, until)
+	hasWindows := hasTimeWindowSlots(tw)
+
+	if cal != nil {
+		for _, w := range cal.GetWindows(tw.Calendar) {
+			slots = append(slots, getTimeWindowSlots(&w.TimeWindow, calTime, until)...)
+			hasWindows = hasWindows || hasTimeWindowSlots(&w.TimeWindow)
+		}
+	}
+
+	blocked := tw.WindowType != "" && tw.WindowType != "active"
+
+	switch {
+	case blocked:
+		slots = append(slots, blackouts...)
+	case !hasWindows:
+		// a calendar of blackouts only leaves the rest of the time open
+		slots = []windowSlot{{start: uniTime.Add(-24 * time.Hour), end: uniTime.Add(windowSlotHorizon)}}
+	}
+
+	slots = mergeSlots(slots)
+
+	if !blocked {
+		slots = subtractSlots(slots, blackouts)
+	}
+
+	return slots, blocked
+}
+
+func hasTimeWindowSlots(tw *appv1alpha1.TimeWindow) bool {
+	return len(tw.Weekdays) != 0 || len(tw.Hours) != 0 || len(tw.Crons) != 0 || len(tw.Dates) != 0
+}
+
+// getTimeWindowSlots expands the weekdays and hours, cron schedules and dates of the time window to slots around t,
+// in the location of t. The cron slots are expanded at least until the given time
+func getTimeWindowSlots(tw *appv1alpha1.TimeWindow, t, until time.Time) []windowSlot {
+	slots := getWeeklySlots(tw, t)
+	slots = append(slots, getCronSlots(tw, t, until)...)
+	slots = append(slots, getDateSlots(tw.Dates, t.Location())...)
+
+	return slots
+}
+
+// getWeeklySlots expands the weekdays and hours to slots from the day before t till the horizon,
+// no weekdays means every day and no hours means the whole day
+func getWeeklySlots(tw *appv1alpha1.TimeWindow, t time.Time) []windowSlot {
+	if len(tw.Weekdays) == 0 && len(tw.Hours) == 0 {
+		return nil
+	}
+
+	days, _ := validateWeekDaysSlice(tw.Weekdays)
+	dayset := make(map[time.Weekday]bool)
+
+	for _, d := range days {
+		dayset[d] = true
+	}
+
+	type dayRange struct {
+		start time.Duration
+		end   time.Duration
+	}
+
+	var ranges []dayRange
+
+	for _, hr := range tw.Hours {
+		s, err := time.Parse(time.Kitchen, hr.Start)
+		if err != nil {
+			klog.Error("Error: ", err, ", while parsing the start of hour range ", hr)
+			continue
+		}
+
+		e, err := time.Parse(time.Kitchen, hr.End)
+		if err != nil {
+			klog.Error("Error: ", err, ", while parsing the end of hour range ", hr)
+			continue
+		}
+
+		rs, re := s.Sub(CURDAY), e.Sub(CURDAY)
+
+		// 12:00AM ends the range at midnight
+		if re == 0 {
+			re = 24 * time.Hour
+		}
+
+		if re < rs {
+			rs, re = re, rs
+		}
+
+		ranges = append(ranges, dayRange{start: rs, end: re})
+	}
+
+	if len(tw.Hours) == 0 {
+		ranges = []dayRange{{start: 0, end: 24 * time.Hour}}
+	}
+
+	var slots []windowSlot
+
+	loc := t.Location()
+
+	for i := -1; i <= int(windowSlotHorizon/(24*time.Hour)); i++ {
+		day := time.Date(t.Year(), t.Month(), t.Day()+i, 0, 0, 0, 0, loc)
+		if len(dayset) != 0 && !dayset[day.Weekday()] {
+			continue
+		}
+
+		for _, r := range ranges {
+			slots = append(slots, windowSlot{
+				start: wallClockOfDay(day, r.start),
+				end:   wallClockOfDay(day, r.end),
+			})
+		}
+	}
+
+	return slots
+}
+
+// wallClockOfDay returns the time of the day at the wall clock offset, instead of the elapsed time since midnight
+func wallClockOfDay(day time.Time, offset time.Duration) time.Time {
+	minutes := int(offset / time.Minute)
+
+	return time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, day.Location())
+}
+
+// getCronSlots collects the slots of the cron schedules covering t and following it without a gap,
+// the ones till the given time, and the next slot
+func getCronSlots(tw *appv1alpha1.TimeWindow, t, until time.Time) []windowSlot {
+	var slots []windowSlot
+
+	for _, cw := range tw.Crons {
+		schedule, err := ParseCronSchedule(cw.Schedule)
+		if err != nil {
+			klog.Error("Error: ", err, ", while parsing the cron schedule of time window")
+			continue
+		}
+
+		if cw.Duration.Duration <= 0 {
+			klog.Error("Skipping cron schedule ", cw.Schedule, " of time window with a non-positive duration")
+			continue
+		}
+
+		end := until.In(t.Location())
+
+		for next, i := schedule.Next(t.Add(-cw.Duration.Duration)), 0; !next.IsZero() && i < maxCronSlots; i++ {
+			slot := windowSlot{start: next, end: next.Add(cw.Duration.Duration)}
+			slots = append(slots, slot)
+
+			if slot.start.After(end) {
+				break
+			}
+
+			if slot.end.After(end) {
+				end = slot.end
+			}
+
+			next = schedule.Next(next.Add(time.Minute))
+		}
+	}
+
+	return slots
+}
+
+func getDateSlots(dates []appv1alpha1.DateRange, loc *time.Location) []windowSlot {
+	var slots []windowSlot
+
+	for _, dr := range dates {
+		start, end, err := ParseDateRange(dr, loc)
+		if err != nil {
+			klog.Error("Error: ", err, ", while parsing the date range of time window")
+			continue
+		}
+
+		slots = append(slots, windowSlot{start: start, end: end})
+	}
+
+	return slots
+}
+
+// ParseDateRange returns the start and the excluded end of the date range in the location,
+// a date without time starts at the beginning of the day and ends at the end of the day
+func ParseDateRange(dr appv1alpha1.DateRange, loc *time.Location) (time.Time, time.Time, error) {
+	start, _, err := parseDate(dr.Start, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	end, dateOnly, err := parseDate(dr.End, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	if dateOnly {
+		end = time.Date(end.Year(), end.Month(), end.Day()+1, 0, 0, 0, 0, loc)
+	}
+
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, errors.New("date range " + dr.Start + " to " + dr.End + " ends before it starts")
+	}
+
+	return start, end, nil
+}
+
+func parseDate(str string, loc *time.Location) (time.Time, bool, error) {
+	if d, err := time.ParseInLocation("2006-01-02", str, loc); err == nil {
+		return d, true, nil
+	}
+
+	d, err := time.ParseInLocation("2006-01-02T15:04", str, loc)
+	if err != nil {
+		return time.Time{}, false, errors.New("date " + str + " must be in 2006-01-02 or 2006-01-02T15:04 format")
+	}
+
+	return d, false, nil
+}
+
+// mergeSlots sorts the slots by start and merges the overlapping or adjacent ones
+func mergeSlots(slots []windowSlot) []windowSlot {
+	if len(slots) == 0 {
+		return slots
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].start.Before(slots[j].start) })
+
+	out := []windowSlot{slots[0]}
+
+	for _, slot := range slots[1:] {
+		last := &out[len(out)-1]
+
+		if slot.start.After(last.end) {
+			out = append(out, slot)
+			continue
+		}
+
+		if slot.end.After(last.end) {
+			last.end = slot.end
+		}
+	}
+
+	return out
+}
+
+// subtractSlots removes the periods of the cuts from the slots, both are sorted and merged
+func subtractSlots(slots, cuts []windowSlot) []windowSlot {
+	if len(cuts) == 0 {
+		return slots
+	}
+
+	var out []windowSlot
+
+	for _, slot := range slots {
+		for _, cut := range cuts {
+			if !cut.end.After(slot.start) || !cut.start.Before(slot.end) {
+				continue
+			}
+
+			if cut.start.After(slot.start) {
+				out = append(out, windowSlot{start: slot.start, end: cut.start})
+			}
+
+			slot.start = cut.end
+
+			if !slot.start.Before(slot.end) {
+				break
+			}
+		}
+
+		if slot.start.Before(slot.end) {
+			out = append(out, slot)
+		}
+	}
+
+	return out
+}
@@ -19,6 +19,8 @@ import (
 	"testing"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
 	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
 )
 
@@ -350,6 +352,133 @@ func TestNextWeekdayToRun(t *testing.T) {
 	}
 }
 
+func TestCronAndDateTimeWindows(t *testing.T) {
+	firstSunday := []appv1alpha1.CronWindow{{Schedule: "0 2 * * SUN#1", Duration: metav1.Duration{Duration: 2 * time.Hour}}}
+	freeze := []appv1alpha1.DateRange{{Start: "2019-12-20", End: "2020-01-03"}}
+
+	testCases := []struct {
+		desc    string
+		curTime string
+		windows *appv1alpha1.TimeWindow
+		want    time.Duration
+	}{
+		{
+			desc:    "cron window, before the first Sunday of next month",
+			curTime: "Wed Nov  6 14:21:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{WindowType: "active", Crons: firstSunday},
+			want:    24*24*time.Hour + 11*time.Hour + 39*time.Minute,
+		},
+		{
+			desc:    "cron window, within the first Sunday window",
+			curTime: "Sun Nov  3 03:00:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{WindowType: "active", Crons: firstSunday},
+			want:    0,
+		},
+		{
+			desc:    "blocked cron window, within the first Sunday window",
+			curTime: "Sun Nov  3 03:00:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{WindowType: "blocked", Crons: firstSunday},
+			want:    time.Hour,
+		},
+		{
+			desc: "cron window, on the day daylight saving ends",
+			// 1:30AM EST, after the clock is set back from 2:00AM EDT
+			curTime: "Sun Nov  3 06:30:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{WindowType: "active", Crons: firstSunday, Location: "America/Toronto"},
+			want:    30 * time.Minute,
+		},
+		{
+			desc: "cron window, in the hour skipped when daylight saving starts",
+			// 1:00AM EST, 2:30AM is skipped on that day
+			curTime: "Sun Mar  8 06:00:00 UTC 2020",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "active",
+				Crons:      []appv1alpha1.CronWindow{{Schedule: "30 2 * * *", Duration: metav1.Duration{Duration: time.Hour}}},
+				Location:   "America/Toronto",
+			},
+			want: 24*time.Hour + 30*time.Minute,
+		},
+		{
+			desc:    "blocked date range, within the change freeze",
+			curTime: "Wed Dec 25 12:00:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{WindowType: "blocked", Dates: freeze},
+			want:    9*24*time.Hour + 12*time.Hour,
+		},
+		{
+			desc:    "blocked date range, after the change freeze",
+			curTime: "Mon Jan  6 12:00:00 UTC 2020",
+			windows: &appv1alpha1.TimeWindow{WindowType: "blocked", Dates: freeze},
+			want:    0,
+		},
+		{
+			desc: "blocked date range, across the day daylight saving starts",
+			// the 2 days are 47 hours long
+			curTime: "Sat Mar  7 05:00:00 UTC 2020",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "blocked",
+				Dates:      []appv1alpha1.DateRange{{Start: "2020-03-07", End: "2020-03-08"}},
+				Location:   "America/Toronto",
+			},
+			want: 47 * time.Hour,
+		},
+		{
+			desc:    "date range with time, with location",
+			curTime: "Fri Dec 20 12:00:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "active",
+				Dates:      []appv1alpha1.DateRange{{Start: "2019-12-20T22:00", End: "2019-12-21T02:00"}},
+				Location:   "America/Toronto",
+			},
+			want: 15 * time.Hour,
+		},
+		{
+			desc:    "weekdays and hours combined with a date range, the hours come first",
+			curTime: "Sun Nov  3 09:00:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "active",
+				Weekdays:   []string{"Monday"},
+				Hours:      []appv1alpha1.HourRange{{Start: "10:00AM", End: "11:00AM"}},
+				Dates:      []appv1alpha1.DateRange{{Start: "2019-11-05", End: "2019-11-05"}},
+			},
+			want: 25 * time.Hour,
+		},
+		{
+			desc:    "weekdays and hours combined with a date range, the date range comes first",
+			curTime: "Mon Nov  4 12:00:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "active",
+				Weekdays:   []string{"Monday"},
+				Hours:      []appv1alpha1.HourRange{{Start: "10:00AM", End: "11:00AM"}},
+				Dates:      []appv1alpha1.DateRange{{Start: "2019-11-05", End: "2019-11-05"}},
+			},
+			want: 12 * time.Hour,
+		},
+		{
+			desc: "blocked hours combined with a past date range, on the day daylight saving ends",
+			// 1:30AM EST, the hours end at 3:00AM EST
+			curTime: "Sun Nov  3 06:30:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "blocked",
+				Hours:      []appv1alpha1.HourRange{{Start: "1:00AM", End: "3:00AM"}},
+				Dates:      []appv1alpha1.DateRange{{Start: "2019-01-01", End: "2019-01-01"}},
+				Location:   "America/Toronto",
+			},
+			want: time.Hour + 30*time.Minute,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			c, _ := time.Parse(time.UnixDate, tC.curTime)
+			got := NextStartPoint(tC.windows, c)
+
+			if got != tC.want {
+				t.Errorf("wanted time.Duration %v, got %v", tC.want, got)
+			}
+		})
+	}
+}
+
 func TestParseTimeWithKicFormat(t *testing.T) {
 	testCases := []struct {
 		desc   string
@@ -0,0 +1,169 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+// GetTimeWindowStatus evaluates the time window of the subscription combined with its calendar at t,
+// returns nil if the subscription has no time window. The pending changes are kept till a subscriber syncs them
+func GetTimeWindowStatus(clt client.Client, sub *appv1alpha1.Subscription, t time.Time) *appv1alpha1.TimeWindowStatus {
+	if sub.Spec.TimeWindow == nil {
+		return nil
+	}
+
+	status, _, _ := getTimeWindowStatus(clt, sub, t)
+
+	return status
+}
+
+// getTimeWindowStatus evaluates the time window of the subscription once, returns its status and when it changes
+// next, zero if it does not change within the horizon, or the error reading the calendar
+func getTimeWindowStatus(clt client.Client, sub *appv1alpha1.Subscription,
+	t time.Time) (*appv1alpha1.TimeWindowStatus, time.Time, error) {
+	// the subscribers hold off as well if the calendar can not be read
+	status := &appv1alpha1.TimeWindowStatus{State: appv1alpha1.TimeWindowBlocked}
+
+	var next time.Time
+
+	cal, err := GetCalendar(clt, sub)
+	if err == nil {
+		status.State, next = GetTimeWindowState(sub.Spec.TimeWindow, cal, t)
+
+		if !next.IsZero() {
+			// the status keeps seconds only
+			nextTransition := metav1.NewTime(next.Truncate(time.Second))
+			status.NextTransitionTime = &nextTransition
+		}
+	}
+
+	if sub.Status.TimeWindow != nil {
+		status.PendingChanges = sub.Status.TimeWindow.PendingChanges
+	}
+
+	return status, next, err
+}
+
+// TimeWindowHoldOff returns how long the subscribers hold off syncing the subscription because of its time window,
+// 0 if the window is open. A held off sync is recorded as pending changes in the subscription status if changed,
+// which checks whether the sync would change anything, returns true or is nil
+func TimeWindowHoldOff(clt client.Client, sub *appv1alpha1.Subscription, changed func() bool) time.Duration {
+	if sub.Spec.TimeWindow == nil {
+		return time.Duration(0)
+	}
+
+	now := time.Now()
+
+	status, next, err := getTimeWindowStatus(clt, sub, now)
+	if status.State == appv1alpha1.TimeWindowOpen {
+		return time.Duration(0)
+	}
+
+	nextRun := windowSlotHorizon
+
+	switch {
+	case err != nil:
+		nextRun = CalendarRequeueInterval
+	case !next.IsZero():
+		nextRun = next.Sub(now)
+	}
+
+	klog.V(1).Infof("Subscription %v/%v will deploy after %v", sub.GetNamespace(), sub.GetName(), nextRun)
+
+	if !status.PendingChanges && (changed == nil || changed()) {
+		status.PendingChanges = true
+
+		_ = setTimeWindowStatus(clt, sub, status)
+	}
+
+	return nextRun
+}
+
+// ClearTimeWindowPending clears the pending changes in the status of the subscription once a subscriber synced it
+func ClearTimeWindowPending(clt client.Client, sub *appv1alpha1.Subscription) error {
+	if sub.Status.TimeWindow == nil || !sub.Status.TimeWindow.PendingChanges {
+		return nil
+	}
+
+	status := sub.Status.TimeWindow.DeepCopy()
+	status.PendingChanges = false
+
+	return setTimeWindowStatus(clt, sub, status)
+}
+
+// SyncUntil calls sync every period until stopch is closed, like wait.Until. When sync holds off for less than
+// the period, e.g. till the time window of the subscription opens, it is called again at the end of the hold-off
+func SyncUntil(sync func() time.Duration, period time.Duration, stopch <-chan struct{}) {
+	for {
+		select {
+		case <-stopch:
+			return
+		default:
+		}
+
+		next := period
+
+		func() {
+			defer utilruntime.HandleCrash()
+
+			if holdoff := sync(); holdoff > time.Duration(0) && holdoff < period {
+				next = holdoff
+			}
+		}()
+
+		timer := time.NewTimer(next)
+
+		select {
+		case <-stopch:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// setTimeWindowStatus patches the time window status of the subscription, and keeps it in the subscription
+func setTimeWindowStatus(clt client.Client, sub *appv1alpha1.Subscription, status *appv1alpha1.TimeWindowStatus) error {
+	if equality.Semantic.DeepEqual(status, sub.Status.TimeWindow) {
+		return nil
+	}
+
+	prev := sub.Status.TimeWindow
+
+	// the patch carries the whole time window status, whatever the subscription kept
+	orig := sub.DeepCopy()
+	orig.Status.TimeWindow = nil
+
+	sub.Status.TimeWindow = status
+
+	err := clt.Status().Patch(context.TODO(), sub, client.MergeFrom(orig))
+	if err != nil {
+		klog.Error("Failed to patch time window status of subscription ", sub.Namespace, "/", sub.Name, ", error: ", err)
+
+		sub.Status.TimeWindow = prev
+	}
+
+	return err
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+func TestTimeWindowState(t *testing.T) {
+	firstSunday := []appv1alpha1.CronWindow{{Schedule: "0 2 * * SUN#1", Duration: metav1.Duration{Duration: 2 * time.Hour}}}
+	nightly := []appv1alpha1.CronWindow{{Schedule: "0 22 * * *", Duration: metav1.Duration{Duration: 2 * time.Hour}}}
+
+	testCases := []struct {
+		desc      string
+		curTime   string
+		windows   *appv1alpha1.TimeWindow
+		cal       *Calendar
+		wantState appv1alpha1.TimeWindowState
+		wantNext  string
+	}{
+		{
+			desc:      "no windows, always open",
+			curTime:   "Wed Nov  6 14:21:00 UTC 2019",
+			windows:   &appv1alpha1.TimeWindow{WindowType: "active"},
+			wantState: appv1alpha1.TimeWindowOpen,
+		},
+		{
+			desc:    "within the hours, closes after the end of the hours",
+			curTime: "Wed Nov  6 14:21:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "active",
+				Hours:      []appv1alpha1.HourRange{{Start: "9:00AM", End: "5:00PM"}},
+			},
+			wantState: appv1alpha1.TimeWindowOpen,
+			wantNext:  "Wed Nov  6 17:01:00 UTC 2019",
+		},
+		{
+			desc:    "before the hours, opens at the start of the hours",
+			curTime: "Wed Nov  6 14:21:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{
+				WindowType: "active",
+				Hours:      []appv1alpha1.HourRange{{Start: "3:00PM", End: "4:00PM"}},
+			},
+			wantState: appv1alpha1.TimeWindowBlocked,
+			wantNext:  "Wed Nov  6 15:00:00 UTC 2019",
+		},
+		{
+			desc:      "blocked weekday, opens the next day",
+			curTime:   "Wed Nov  6 14:21:00 UTC 2019",
+			windows:   &appv1alpha1.TimeWindow{WindowType: "blocked", Weekdays: []string{"Wednesday"}},
+			wantState: appv1alpha1.TimeWindowBlocked,
+			wantNext:  "Thu Nov  7 00:00:00 UTC 2019",
+		},
+		{
+			desc:      "cron window, opens on the first Sunday of next month",
+			curTime:   "Wed Nov  6 14:21:00 UTC 2019",
+			windows:   &appv1alpha1.TimeWindow{WindowType: "active", Crons: firstSunday},
+			wantState: appv1alpha1.TimeWindowBlocked,
+			wantNext:  "Sun Dec  1 02:00:00 UTC 2019",
+		},
+		{
+			desc:      "blocked cron window, closes tonight",
+			curTime:   "Wed Nov  6 14:21:00 UTC 2019",
+			windows:   &appv1alpha1.TimeWindow{WindowType: "blocked", Crons: nightly},
+			wantState: appv1alpha1.TimeWindowOpen,
+			wantNext:  "Wed Nov  6 22:00:00 UTC 2019",
+		},
+		{
+			desc:    "calendar window, closes at midnight",
+			curTime: "Wed Nov  6 23:00:00 UTC 2019",
+			windows: &appv1alpha1.TimeWindow{WindowType: "active", Calendar: &appv1alpha1.CalendarReference{Name: "maintenance"}},
+			cal: &Calendar{
+				Windows: []CalendarWindow{{Name: "nightly", TimeWindow: appv1alpha1.TimeWindow{Crons: nightly}}},
+			},
+			wantState: appv1alpha1.TimeWindowOpen,
+			wantNext:  "Thu Nov  7 00:00:00 UTC 2019",
+		},
+		{
+			desc:      "calendar blackouts only, open after the blackout",
+			curTime:   "Wed Nov  6 14:21:00 UTC 2019",
+			windows:   &appv1alpha1.TimeWindow{WindowType: "active", Calendar: &appv1alpha1.CalendarReference{Name: "maintenance"}},
+			cal:       &Calendar{Blackouts: []appv1alpha1.DateRange{{Start: "2019-11-06", End: "2019-11-06"}}},
+			wantState: appv1alpha1.TimeWindowBlocked,
+			wantNext:  "Thu Nov  7 00:00:00 UTC 2019",
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			c, _ := time.Parse(time.UnixDate, tC.curTime)
+			state, next := GetTimeWindowState(tC.windows, tC.cal, c)
+
+			var want time.Time
+			if tC.wantNext != "" {
+				want, _ = time.Parse(time.UnixDate, tC.wantNext)
+			}
+
+			if state != tC.wantState || !next.Equal(want) {
+				t.Errorf("wanted state %v changing at %v, got %v changing at %v", tC.wantState, want, state, next)
+			}
+		})
+	}
+}
+
+func TestTimeWindowStatus(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	c, _ := time.Parse(time.UnixDate, "Wed Nov  6 14:21:00 UTC 2019")
+
+	sub := newDependencySubscription("timewindow-status")
+	g.Expect(GetTimeWindowStatus(nil, sub, c)).To(gomega.BeNil())
+
+	sub.Spec.TimeWindow = &appv1alpha1.TimeWindow{
+		WindowType: "active",
+		Hours:      []appv1alpha1.HourRange{{Start: "3:00PM", End: "4:00PM"}},
+	}
+	sub.Status.TimeWindow = &appv1alpha1.TimeWindowStatus{State: appv1alpha1.TimeWindowBlocked, PendingChanges: true}
+
+	status := GetTimeWindowStatus(nil, sub, c)
+	g.Expect(status.State).To(gomega.Equal(appv1alpha1.TimeWindowBlocked))
+	g.Expect(status.NextTransitionTime.Time.Equal(c.Add(39 * time.Minute))).To(gomega.BeTrue())
+	g.Expect(status.PendingChanges).To(gomega.BeTrue())
+
+	// the pending changes are kept till a subscriber syncs them
+	status = GetTimeWindowStatus(nil, sub, c.Add(time.Hour))
+	g.Expect(status.State).To(gomega.Equal(appv1alpha1.TimeWindowOpen))
+	g.Expect(status.PendingChanges).To(gomega.BeTrue())
+}
+
+func TestTimeWindowHoldOff(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	now := time.Now().UTC()
+	later := []appv1alpha1.DateRange{{
+		Start: now.Add(2 * time.Hour).Format("2006-01-02T15:04"),
+		End:   now.Add(3 * time.Hour).Format("2006-01-02T15:04"),
+	}}
+
+	sub := newDependencySubscription("timewindow-holdoff")
+	sub.Spec.TimeWindow = &appv1alpha1.TimeWindow{WindowType: "active", Location: "UTC", Dates: later}
+	g.Expect(clt.Create(context.TODO(), sub)).NotTo(gomega.HaveOccurred())
+
+	defer clt.Delete(context.TODO(), sub)
+
+	subkey := types.NamespacedName{Name: sub.Name, Namespace: sub.Namespace}
+	cur := &appv1alpha1.Subscription{}
+
+	// a held off sync that would not change anything is not pending
+	nextRun := TimeWindowHoldOff(clt, sub, func() bool { return false })
+	g.Expect(nextRun > time.Hour && nextRun <= 2*time.Hour).To(gomega.BeTrue())
+	g.Expect(clt.Get(context.TODO(), subkey, cur)).NotTo(gomega.HaveOccurred())
+	g.Expect(cur.Status.TimeWindow).To(gomega.BeNil())
+
+	g.Expect(TimeWindowHoldOff(clt, sub, func() bool { return true })).To(gomega.BeNumerically(">", 0))
+	g.Expect(clt.Get(context.TODO(), subkey, cur)).NotTo(gomega.HaveOccurred())
+	g.Expect(cur.Status.TimeWindow.State).To(gomega.Equal(appv1alpha1.TimeWindowBlocked))
+	g.Expect(cur.Status.TimeWindow.PendingChanges).To(gomega.BeTrue())
+	g.Expect(sub.Status.TimeWindow.PendingChanges).To(gomega.BeTrue())
+
+	// pending changes are not checked again
+	TimeWindowHoldOff(clt, sub, func() bool {
+		t.Error("changes are checked although they are pending")
+		return true
+	})
+
+	g.Expect(ClearTimeWindowPending(clt, sub)).NotTo(gomega.HaveOccurred())
+	g.Expect(clt.Get(context.TODO(), subkey, cur)).NotTo(gomega.HaveOccurred())
+	g.Expect(cur.Status.TimeWindow.PendingChanges).To(gomega.BeFalse())
+}
+
+func TestSetTimeWindowStatusFailure(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	clt, err := client.New(cfg, client.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	// the subscription does not exist, the status kept in it is restored when the patch fails
+	sub := newDependencySubscription("timewindow-missing")
+	prev := &appv1alpha1.TimeWindowStatus{State: appv1alpha1.TimeWindowBlocked, PendingChanges: true}
+	sub.Status.TimeWindow = prev
+
+	status := &appv1alpha1.TimeWindowStatus{State: appv1alpha1.TimeWindowOpen}
+	g.Expect(setTimeWindowStatus(clt, sub, status)).To(gomega.HaveOccurred())
+	g.Expect(sub.Status.TimeWindow).To(gomega.Equal(prev))
+}
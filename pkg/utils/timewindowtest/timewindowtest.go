@@ -0,0 +1,187 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timewindowtest provides the time window cases every subscriber is tested against, and runs them,
+// so the time windows are honored the same way for all channel types
+package timewindowtest
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils"
+)
+
+// Case is a time window and whether the subscribers sync within it at the time the cases are made for
+type Case struct {
+	Desc       string
+	TimeWindow *appv1alpha1.TimeWindow
+	// Calendar is the calendar ConfigMap the time window refers to, nil if it refers to none
+	Calendar *corev1.ConfigMap
+	Open     bool
+}
+
+// Cases returns the time window cases around t
+func Cases(t time.Time) []Case {
+	date := func(d time.Duration) string {
+		return t.UTC().Add(d).Format("2006-01-02T15:04")
+	}
+
+	now := []appv1alpha1.DateRange{{Start: date(-time.Hour), End: date(time.Hour)}}
+	later := []appv1alpha1.DateRange{{Start: date(2 * time.Hour), End: date(3 * time.Hour)}}
+	hourly := []appv1alpha1.CronWindow{{Schedule: "0 * * * *", Duration: metav1.Duration{Duration: time.Hour}}}
+	today := []string{t.UTC().Weekday().String()}
+	tomorrow := []string{t.UTC().Add(24 * time.Hour).Weekday().String()}
+	allDay := []appv1alpha1.HourRange{{Start: "12:00AM", End: "11:59PM"}}
+
+	return []Case{
+		{
+			Desc:       "no windows",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "active"},
+			Open:       true,
+		},
+		{
+			Desc:       "active weekday today",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "active", Location: "UTC", Weekdays: today},
+			Open:       true,
+		},
+		{
+			Desc:       "active weekday tomorrow",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "active", Location: "UTC", Weekdays: tomorrow},
+			Open:       false,
+		},
+		{
+			Desc:       "active hours all day",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "active", Location: "UTC", Hours: allDay},
+			Open:       true,
+		},
+		{
+			Desc:       "blocked hours all day",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "blocked", Location: "UTC", Hours: allDay},
+			Open:       false,
+		},
+		{
+			Desc:       "active window now",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "active", Location: "UTC", Dates: now},
+			Open:       true,
+		},
+		{
+			Desc:       "active window later",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "active", Location: "UTC", Dates: later},
+			Open:       false,
+		},
+		{
+			Desc:       "blocked window now",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "blocked", Location: "UTC", Dates: now},
+			Open:       false,
+		},
+		{
+			Desc:       "blocked window later",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "blocked", Location: "UTC", Dates: later},
+			Open:       true,
+		},
+		{
+			Desc:       "active cron window every hour",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "active", Location: "UTC", Crons: hourly},
+			Open:       true,
+		},
+		{
+			Desc:       "blocked cron window every hour",
+			TimeWindow: &appv1alpha1.TimeWindow{WindowType: "blocked", Location: "UTC", Crons: hourly},
+			Open:       false,
+		},
+		calendarCase("calendar window now", utils.CalendarWindowsKey, now, true),
+		calendarCase("calendar window later", utils.CalendarWindowsKey, later, false),
+		calendarCase("calendar blackout now", utils.CalendarBlackoutsKey, now, false),
+		calendarCase("calendar blackout later", utils.CalendarBlackoutsKey, later, true),
+	}
+}
+
+// calendarCase makes the case of an active time window that only refers to a calendar, which keeps the dates
+// as a window or as blackouts
+func calendarCase(desc, key string, dates []appv1alpha1.DateRange, open bool) Case {
+	var data interface{} = dates
+	if key == utils.CalendarWindowsKey {
+		data = []map[string]interface{}{{"name": "maintenance", "dates": dates}}
+	}
+
+	b, _ := yaml.Marshal(data)
+	name := "calendar-" + strings.ReplaceAll(desc, " ", "-")
+
+	return Case{
+		Desc: desc,
+		TimeWindow: &appv1alpha1.TimeWindow{
+			WindowType: "active",
+			Calendar:   &appv1alpha1.CalendarReference{Name: name},
+		},
+		Calendar: &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Data:       map[string]string{utils.CalendarLocationKey: "UTC", key: string(b)},
+		},
+		Open: open,
+	}
+}
+
+// Run checks that sync honors the time window of every case. sync runs the subscriber once on the subscription,
+// like its sync loop or reconcile, and returns how long it holds off. The subscription is created from sub with
+// the time window of the case, sub must be new to the subscriber so that a held off sync would change something
+func Run(t *testing.T, clt client.Client, sub *appv1alpha1.Subscription,
+	sync func(*appv1alpha1.Subscription) time.Duration) {
+	g := gomega.NewGomegaWithT(t)
+
+	for i, tc := range Cases(time.Now()) {
+		if tc.Calendar != nil {
+			cal := tc.Calendar.DeepCopy()
+			cal.Namespace = sub.Namespace
+			g.Expect(clt.Create(context.TODO(), cal)).NotTo(gomega.HaveOccurred(), tc.Desc)
+		}
+
+		tcsub := sub.DeepCopy()
+		tcsub.Name = "timewindow-" + strconv.Itoa(i)
+		tcsub.ResourceVersion = ""
+		tcsub.Spec.TimeWindow = tc.TimeWindow
+		g.Expect(clt.Create(context.TODO(), tcsub)).NotTo(gomega.HaveOccurred(), tc.Desc)
+
+		// a sync in the window clears the changes held off before
+		if tc.Open {
+			tcsub.Status.TimeWindow = &appv1alpha1.TimeWindowStatus{State: appv1alpha1.TimeWindowBlocked, PendingChanges: true}
+			g.Expect(clt.Status().Update(context.TODO(), tcsub)).NotTo(gomega.HaveOccurred(), tc.Desc)
+		}
+
+		g.Expect(sync(tcsub) == 0).To(gomega.Equal(tc.Open), tc.Desc)
+
+		subkey := types.NamespacedName{Name: tcsub.Name, Namespace: tcsub.Namespace}
+		g.Expect(clt.Get(context.TODO(), subkey, tcsub)).NotTo(gomega.HaveOccurred(), tc.Desc)
+		g.Expect(tcsub.Status.TimeWindow != nil && tcsub.Status.TimeWindow.PendingChanges).To(gomega.Equal(!tc.Open), tc.Desc)
+
+		g.Expect(clt.Delete(context.TODO(), tcsub)).NotTo(gomega.HaveOccurred(), tc.Desc)
+
+		if tc.Calendar != nil {
+			cal := tc.Calendar.DeepCopy()
+			cal.Namespace = sub.Namespace
+			g.Expect(clt.Delete(context.TODO(), cal)).NotTo(gomega.HaveOccurred(), tc.Desc)
+		}
+	}
+}
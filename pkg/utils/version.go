@@ -15,13 +15,20 @@
 package utils
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"time"
 
 	"github.com/blang/semver"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	releasev1alpha1 "github.com/IBM/multicloud-operators-subscription-release/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
 )
 
 // SemverCheck filter Deployable based on the version annotations from Subscription and Deployable.
@@ -68,50 +75,245 @@ type VersionRep struct {
 //GenerateVersionSet produce a map, key: dpl.GetGenerateName(), value: dpl.NamespacedName.String()
 // the value is the largest version which meet the subscription version requirement.
 func GenerateVersionSet(dplPointers []*dplv1alpha1.Deployable, vsub string) map[string]VersionRep {
-	vset := make(map[string]VersionRep)
+	vset, _ := SelectVersionSet(dplPointers, &appv1alpha1.PackageFilter{Version: vsub, IncludePrereleases: true}, nil, time.Now())
+
+	return vset
+}
+
+// DeployedPackage is the package the subscription deployed for a version group, Name is the name of the package
+// in the subscription status
+type DeployedPackage struct {
+	Name    string
+	Version string
+}
+
+// SelectVersionSet produce the same map as GenerateVersionSet, the value is the version picked by the version policies of the filter.
+// deployed holds the packages the subscription deployed keyed by version group, which give the current version of each group.
+// The groups dropped by the version policies are returned keyed by the name of their deployed package
+func SelectVersionSet(dplPointers []*dplv1alpha1.Deployable, filter *appv1alpha1.PackageFilter,
+	deployed map[string]DeployedPackage, now time.Time) (map[string]VersionRep, map[string]error) {
+	groups := make(map[string][]*dplv1alpha1.Deployable)
+	order := []string{}
 
 	for _, curDpl := range dplPointers {
-		vcurDpl := curDpl.GetAnnotations()[dplv1alpha1.AnnotationDeployableVersion]
-		vmatch := SemverCheck(vsub, vcurDpl)
+		DplGroupName := versionGroup(curDpl)
+
+		if _, ok := groups[DplGroupName]; !ok {
+			order = append(order, DplGroupName)
+		}
+
+		groups[DplGroupName] = append(groups[DplGroupName], curDpl)
+	}
+
+	vset := make(map[string]VersionRep)
+	dropped := make(map[string]error)
+
+	for _, group := range order {
+		dpls := groups[group]
+		candidates := make([]VersionCandidate, len(dpls))
+
+		for i, dpl := range dpls {
+			candidates[i] = VersionCandidate{Version: deployableVersion(dpl), Created: dpl.GetCreationTimestamp().Time}
+		}
+
+		// the deployed version is known after its deployable is gone from the channel
+		picked, err := SelectVersion(filter, candidates, deployed[group].Version, now)
+		if err != nil {
+			klog.Info("Dropping package ", group, ": ", err)
+
+			dropped[deployed[group].Name] = err
+
+			continue
+		}
+
+		if picked < 0 {
+			continue
+		}
+
+		vset[group] = VersionRep{
+			DplKey: types.NamespacedName{Name: dpls[picked].Name, Namespace: dpls[picked].Namespace}.String(),
+			vrange: ">" + candidates[picked].Version,
+		}
+	}
+
+	return vset, dropped
+}
+
+// if the dpl doesn't have generateName, then use dpl name as the group key
+func versionGroup(dpl *dplv1alpha1.Deployable) string {
+	if dpl.GetGenerateName() != "" {
+		return dpl.GetGenerateName()
+	}
+
+	return dpl.GetName()
+}
+
+// if the deployable doesn't have a version string, then treat it a the base verion
+func deployableVersion(dpl *dplv1alpha1.Deployable) string {
+	if vdpl := dpl.GetAnnotations()[dplv1alpha1.AnnotationDeployableVersion]; vdpl != "" {
+		return vdpl
+	}
+
+	return "0.0.0"
+}
+
+// SetDeployedVersionAnnotations tells the version group and version of the deployable on the template deployed from it,
+// the package status keeps them once the template is deployed
+func SetDeployedVersionAnnotations(template metav1.Object, dpl *dplv1alpha1.Deployable) {
+	annotations := template.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotations[appv1alpha1.AnnotationDeployableGroup] = versionGroup(dpl)
+	annotations[dplv1alpha1.AnnotationDeployableVersion] = deployableVersion(dpl)
+	template.SetAnnotations(annotations)
+}
+
+// GetDeployedPackages returns the packages the subscription status reports deployed in this cluster keyed by version group,
+// the packages dropped by the version policies keep the version they were deployed with
+func GetDeployedPackages(substatus *appv1alpha1.SubscriptionStatus) map[string]DeployedPackage {
+	pkgs := make(map[string]DeployedPackage)
+
+	if substatus == nil || substatus.Statuses["/"] == nil {
+		return pkgs
+	}
+
+	for name, pkgstatus := range substatus.Statuses["/"].SubscriptionPackageStatus {
+		if pkgstatus == nil || pkgstatus.Group == "" || pkgstatus.Version == "" {
+			continue
+		}
 
-		if !vmatch {
+		if _, ok := pkgs[pkgstatus.Group]; ok && pkgstatus.Phase != appv1alpha1.SubscriptionSubscribed {
 			continue
 		}
 
-		curDplKey := types.NamespacedName{Name: curDpl.Name, Namespace: curDpl.Namespace}.String()
+		pkgs[pkgstatus.Group] = DeployedPackage{Name: name, Version: pkgstatus.Version}
+	}
+
+	return pkgs
+}
+
+// VersionCandidate is a version of a package offered by a channel, Created is zero if the channel doesn't tell
+type VersionCandidate struct {
+	Version string
+	Created time.Time
+}
+
+// SelectVersion returns the index of the candidate picked by the version policies of the filter, -1 if none qualifies.
+// current is the version deployed by the subscription, empty if nothing is deployed yet.
+// The first of equal versions is picked. Once current is gone from the channel, the latest patch policy falls back to
+// the highest version, and the pinned policy returns an error: the package is dropped rather than moved to another version.
+// A pinned version out of the version range of the filter is let go, the range tells to move.
+func SelectVersion(filter *appv1alpha1.PackageFilter, candidates []VersionCandidate, current string, now time.Time) (int, error) {
+	if filter == nil {
+		filter = &appv1alpha1.PackageFilter{}
+	}
+
+	vcur, curerr := semver.ParseTolerant(current)
+	deployed := current != "" && curerr == nil
+
+	highest, patch, pinned := -1, -1, -1
+	offered := false
+
+	var vhighest, vpatch semver.Version
+
+	for i, c := range candidates {
+		v, err := semver.ParseTolerant(c.Version)
+		if err != nil {
+			klog.V(5).Infof("Version string %v is invalid due to %v, skipping", c.Version, err)
+			continue
+		}
+
+		if deployed && v.Equals(vcur) {
+			offered = true
+		}
+
+		if !SemverCheck(filter.Version, c.Version) {
+			continue
+		}
 
-		DplGroupName := curDpl.GetGenerateName()
+		if deployed && v.Equals(vcur) && pinned < 0 {
+			// the deployed version has passed the pre-release and soak checks already
+			pinned = i
+		}
 
-		// if the dpl doesn't have generateName, then use dpl name as the group key
-		if DplGroupName == "" {
-			DplGroupName = curDpl.GetName()
+		if len(v.Pre) > 0 && !filter.IncludePrereleases {
+			klog.V(5).Infof("Skipping pre-release version %v", c.Version)
+			continue
 		}
 
-		r := "%s%s"
-		// if the deployable doesn't have a version string, then treat it a the base verion
-		if len(vcurDpl) == 0 {
-			vcurDpl = "0.0.0"
+		if filter.MinSoakAge != nil && !c.Created.IsZero() && now.Sub(c.Created) < filter.MinSoakAge.Duration {
+			klog.V(5).Infof("Skipping version %v created at %v, still soaking for %v", c.Version, c.Created, filter.MinSoakAge.Duration)
+			continue
 		}
 
-		vrangestr := fmt.Sprintf(r, ">", vcurDpl)
+		if highest < 0 || v.GT(vhighest) {
+			highest, vhighest = i, v
+		}
 
-		if preDpl, ok := vset[DplGroupName]; !ok {
-			vset[DplGroupName] = VersionRep{
-				DplKey: curDplKey,
-				vrange: vrangestr,
-			}
-		} else {
-			preRange := preDpl.vrange
-			if SemverCheck(preRange, vcurDpl) {
-				vset[DplGroupName] = VersionRep{
-					DplKey: curDplKey,
-					vrange: vrangestr,
-				}
-			}
+		if deployed && v.Major == vcur.Major && v.Minor == vcur.Minor && (patch < 0 || v.GT(vpatch)) {
+			patch, vpatch = i, v
 		}
 	}
 
-	return vset
+	switch filter.VersionPolicy {
+	case appv1alpha1.VersionPolicyPinned:
+		if pinned >= 0 {
+			return pinned, nil
+		}
+
+		if deployed && !offered {
+			return -1, errors.New("deployed version " + current + " is no longer offered by the channel, the package is pinned to it")
+		}
+	case appv1alpha1.VersionPolicyLatestPatch:
+		// the deployed version stays if nothing newer qualifies in its minor
+		if patch >= 0 && (pinned < 0 || vpatch.GT(vcur)) {
+			return patch, nil
+		}
+
+		if pinned >= 0 {
+			return pinned, nil
+		}
+
+		if deployed && !offered {
+			klog.Info("Deployed version ", current, " is no longer offered, falling back to the highest version for policy ", filter.VersionPolicy)
+		}
+	}
+
+	return highest, nil
+}
+
+// SetDroppedPackagesStatus reports the packages dropped by the version policies as failed in the subscription status,
+// dropped is keyed by the name of the package in the status. They are added to pkgMap, so that their status is kept
+func SetDroppedPackagesStatus(substatus *appv1alpha1.SubscriptionStatus, dropped map[string]error, pkgMap map[string]bool) {
+	for pkgname, reason := range dropped {
+		if err := SetInClusterPackageStatus(substatus, pkgname, reason, nil); err != nil {
+			klog.Info("error in setting in cluster package status :", err)
+		}
+
+		pkgMap[pkgname] = true
+	}
+}
+
+// GetDeployedChartVersion returns the chart version of the HelmRelease the subscription deployed for the chart,
+// empty if the HelmRelease doesn't exist
+func GetDeployedChartVersion(clt client.Client, sub *appv1alpha1.Subscription, packageName string) (string, error) {
+	helmRelease := &releasev1alpha1.HelmRelease{}
+	helmReleaseName := packageName + "-" + sub.Name + "-" + sub.Namespace
+
+	err := clt.Get(context.TODO(), types.NamespacedName{Name: helmReleaseName, Namespace: sub.Namespace}, helmRelease)
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return "", nil
+		}
+
+		klog.Error("Failed to get helmrelease ", helmReleaseName, " err:", err)
+
+		return "", err
+	}
+
+	return helmRelease.Spec.Version, nil
 }
 
 // DplArrayToDplPointers covert the array to pointer array
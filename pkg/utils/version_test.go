@@ -15,13 +15,16 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
 )
 
 type versionTest struct {
@@ -167,3 +170,156 @@ func TestGenerateVersionSet(t *testing.T) {
 		})
 	}
 }
+
+func TestSelectVersion(t *testing.T) {
+	now := time.Now()
+	soak := &metav1.Duration{Duration: 36 * time.Hour}
+
+	candidates := []VersionCandidate{
+		{Version: "1.1.0", Created: now.Add(-72 * time.Hour)},
+		{Version: "1.1.2", Created: now.Add(-48 * time.Hour)},
+		{Version: "1.2.0", Created: now.Add(-24 * time.Hour)},
+		{Version: "1.3.0-rc1", Created: now.Add(-24 * time.Hour)},
+		{Version: "1.1.3", Created: now.Add(-time.Hour)},
+		{Version: "1.2.1"},
+	}
+
+	cases := []struct {
+		caseName string
+		filter   *appv1alpha1.PackageFilter
+		current  string
+		result   string
+	}{
+		{"no filter takes the highest release", nil, "", "1.2.1"},
+		{"version range", &appv1alpha1.PackageFilter{Version: "<1.2.0"}, "", "1.1.3"},
+		{"pre-releases included", &appv1alpha1.PackageFilter{IncludePrereleases: true}, "", "1.3.0-rc1"},
+		{"version without created time is not held by soak", &appv1alpha1.PackageFilter{MinSoakAge: soak}, "", "1.2.1"},
+		{"soak age", &appv1alpha1.PackageFilter{Version: "<1.2.1", MinSoakAge: soak}, "", "1.1.2"},
+		{"highest ignores the deployed version", &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyHighest}, "1.1.0", "1.2.1"},
+		{"latest patch", &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyLatestPatch}, "1.1.0", "1.1.3"},
+		{"latest patch with soak age", &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyLatestPatch, MinSoakAge: soak}, "1.1.0", "1.1.2"},
+		{"latest patch keeps the deployed version", &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyLatestPatch, MinSoakAge: soak}, "1.1.3", "1.1.3"},
+		{"latest patch without deployed version", &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyLatestPatch}, "", "1.2.1"},
+		{"latest patch of a removed version", &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyLatestPatch}, "1.0.0", "1.2.1"},
+		{"pinned", &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyPinned}, "1.1.2", "1.1.2"},
+		{"pinned pre-release", &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyPinned}, "1.3.0-rc1", "1.3.0-rc1"},
+		{"pinned out of version range", &appv1alpha1.PackageFilter{Version: ">=1.2.0", VersionPolicy: appv1alpha1.VersionPolicyPinned}, "1.1.2", "1.2.1"},
+		{"nothing matches", &appv1alpha1.PackageFilter{Version: ">2.0.0"}, "", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.caseName, func(t *testing.T) {
+			picked, err := SelectVersion(c.filter, candidates, c.current, now)
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			got := ""
+			if picked >= 0 {
+				got = candidates[picked].Version
+			}
+
+			if got != c.result {
+				t.Errorf("wanted %#v, got %#v", c.result, got)
+			}
+		})
+	}
+
+	t.Run("pinned to a removed version is dropped", func(t *testing.T) {
+		filter := &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyPinned}
+
+		picked, err := SelectVersion(filter, candidates, "1.0.0", now)
+		if err == nil || picked >= 0 {
+			t.Errorf("wanted the package dropped with an error, got %v and error %v", picked, err)
+		}
+	})
+}
+
+func TestSelectVersionSet(t *testing.T) {
+	groupA := "A"
+	dpl1 := generateFakeDpl(groupA, "dpl1", "1.0.0")
+	dpl2 := generateFakeDpl(groupA, "dpl2", "1.0.1")
+	dpl3 := generateFakeDpl(groupA, "dpl3", "1.1.0")
+	dpl4 := generateFakeDpl(groupA, "dpl4", "1.2.0-beta")
+
+	dpllist := DplArrayToDplPointers([]dplv1alpha1.Deployable{dpl1, dpl2, dpl3, dpl4})
+
+	deployed := map[string]DeployedPackage{groupA: {Name: "dpl1", Version: "1.0.0"}}
+
+	cases := []struct {
+		caseName string
+		filter   *appv1alpha1.PackageFilter
+		deployed map[string]DeployedPackage
+		result   string
+	}{
+		{"pre-release skipped", nil, nil, "/dpl3"},
+		{"pre-release included", &appv1alpha1.PackageFilter{IncludePrereleases: true}, nil, "/dpl4"},
+		{"latest patch of deployed", &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyLatestPatch}, deployed, "/dpl2"},
+		{"pinned to deployed", &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyPinned}, deployed, "/dpl1"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.caseName, func(t *testing.T) {
+			got, dropped := SelectVersionSet(dpllist, c.filter, c.deployed, time.Now())
+			if !reflect.DeepEqual(got[groupA].DplKey, c.result) || len(dropped) != 0 {
+				t.Errorf("wanted %#v, got %#v dropping %#v", c.result, got, dropped)
+			}
+		})
+	}
+
+	// the deployed version is known from the status after its deployable is gone from the channel
+	t.Run("pinned deployable gone", func(t *testing.T) {
+		filter := &appv1alpha1.PackageFilter{VersionPolicy: appv1alpha1.VersionPolicyPinned}
+
+		got, dropped := SelectVersionSet(dpllist[1:], filter, deployed, time.Now())
+		if _, ok := got[groupA]; ok || dropped["dpl1"] == nil {
+			t.Errorf("wanted group %v dropped, got %#v dropping %#v", groupA, got, dropped)
+		}
+	})
+}
+
+func TestGetDeployedPackages(t *testing.T) {
+	substatus := &appv1alpha1.SubscriptionStatus{
+		Statuses: appv1alpha1.SubscriptionClusterStatusMap{
+			"/": {
+				SubscriptionPackageStatus: map[string]*appv1alpha1.SubscriptionUnitStatus{
+					"dpl1":  {Phase: appv1alpha1.SubscriptionFailed, Group: "A", Version: "1.0.0"},
+					"dpl2":  {Phase: appv1alpha1.SubscriptionSubscribed},
+					"chart": {Phase: appv1alpha1.SubscriptionSubscribed, ValuesHash: "hash"},
+				},
+			},
+		},
+	}
+
+	want := map[string]DeployedPackage{"A": {Name: "dpl1", Version: "1.0.0"}}
+	if got := GetDeployedPackages(substatus); !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted %#v, got %#v", want, got)
+	}
+
+	// the subscribed package wins over the dropped one
+	substatus.Statuses["/"].SubscriptionPackageStatus["dpl2"] = &appv1alpha1.SubscriptionUnitStatus{
+		Phase: appv1alpha1.SubscriptionSubscribed, Group: "A", Version: "1.0.1",
+	}
+
+	want = map[string]DeployedPackage{"A": {Name: "dpl2", Version: "1.0.1"}}
+	if got := GetDeployedPackages(substatus); !reflect.DeepEqual(got, want) {
+		t.Errorf("wanted %#v, got %#v", want, got)
+	}
+}
+
+func TestSetDroppedPackagesStatus(t *testing.T) {
+	substatus := &appv1alpha1.SubscriptionStatus{}
+	pkgMap := map[string]bool{"ch-kept-1.0.0": true}
+	dropped := map[string]error{"ch-pinned-1.0.0": errors.New("deployed version 1.0.0 is no longer offered")}
+
+	SetDroppedPackagesStatus(substatus, dropped, pkgMap)
+
+	if !pkgMap["ch-pinned-1.0.0"] || !pkgMap["ch-kept-1.0.0"] {
+		t.Errorf("wanted the dropped package kept in the package map, got %#v", pkgMap)
+	}
+
+	pkgst := substatus.Statuses["/"].SubscriptionPackageStatus["ch-pinned-1.0.0"]
+	if pkgst == nil || pkgst.Phase != appv1alpha1.SubscriptionFailed || pkgst.Reason != dropped["ch-pinned-1.0.0"].Error() {
+		t.Errorf("wanted the dropped package failed with its reason, got %#v", pkgst)
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+	"github.com/IBM/multicloud-operators-subscription/pkg/utils"
+)
+
+const (
+	windowTypeActive  = "active"
+	windowTypeBlocked = "blocked"
+)
+
+var weekdays = map[string]bool{
+	"sunday":    true,
+	"monday":    true,
+	"tuesday":   true,
+	"wednesday": true,
+	"thursday":  true,
+	"friday":    true,
+	"saturday":  true,
+}
+
+var jsonPatchOps = map[string]bool{
+	"add":     true,
+	"remove":  true,
+	"replace": true,
+	"move":    true,
+	"copy":    true,
+	"test":    true,
+}
+
+// DefaultSubscription sets the defaults of the subscription, returns true if anything is changed
+func DefaultSubscription(sub *appv1alpha1.Subscription) bool {
+	changed := false
+
+	if tw := sub.Spec.TimeWindow; tw != nil && tw.WindowType == "" {
+		tw.WindowType = windowTypeActive
+		changed = true
+	}
+
+	return changed
+}
+
+// ValidateSubscription checks the spec of the subscription, the errors point to the invalid fields
+func ValidateSubscription(sub *appv1alpha1.Subscription) field.ErrorList {
+	allErrs := field.ErrorList{}
+	specPath := field.NewPath("spec")
+
+	allErrs = append(allErrs, validateChannel(sub.Spec.Channel, specPath.Child("channel"))...)
+
+	for i, chn := range sub.Spec.Channels {
+		allErrs = append(allErrs, validateChannel(chn, specPath.Child("channels").Index(i))...)
+	}
+
+	if sub.Spec.PackageFilter != nil {
+		allErrs = append(allErrs, validatePackageFilter(sub.Spec.PackageFilter, specPath.Child("packageFilter"))...)
+	}
+
+	if sub.Spec.TimeWindow != nil {
+		allErrs = append(allErrs, validateTimeWindow(sub.Spec.TimeWindow, specPath.Child("timewindow"))...)
+	}
+
+	for i, ov := range sub.Spec.PackageOverrides {
+		ovPath := specPath.Child("packageOverrides").Index(i)
+
+		if ov == nil {
+			allErrs = append(allErrs, field.Required(ovPath, ""))
+			continue
+		}
+
+		if strings.TrimSpace(ov.PackageName) == "" {
+			allErrs = append(allErrs, field.Required(ovPath.Child("packageName"), ""))
+		}
+
+		for j, pov := range ov.PackageOverrides {
+			allErrs = append(allErrs, validateOverride(pov.RawExtension.Raw, ovPath.Child("packageOverrides").Index(j))...)
+		}
+	}
+
+	for i, ov := range sub.Spec.Overrides {
+		allErrs = append(allErrs, validateClusterOverrides(ov, specPath.Child("overrides").Index(i))...)
+	}
+
+	for i, dep := range sub.Spec.DependsOn {
+		if strings.TrimSpace(dep.Name) == "" {
+			allErrs = append(allErrs, field.Required(specPath.Child("dependsOn").Index(i).Child("name"), ""))
+		}
+	}
+
+	if sub.Spec.RevisionHistoryLimit != nil && *sub.Spec.RevisionHistoryLimit < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("revisionHistoryLimit"), *sub.Spec.RevisionHistoryLimit,
+			"must be greater than or equal to 0"))
+	}
+
+	if sub.Spec.Canary != nil && sub.Spec.Canary.FailureThreshold < 0 {
+		allErrs = append(allErrs, field.Invalid(specPath.Child("canary", "failureThreshold"), sub.Spec.Canary.FailureThreshold,
+			"must be greater than or equal to 0"))
+	}
+
+	return allErrs
+}
+
+// validateChannel checks the channel is in namespace/name format
+func validateChannel(chn string, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if chn == "" {
+		return append(allErrs, field.Required(fldPath, "channel must be in namespace/name format"))
+	}
+
+	strs := strings.Split(chn, "/")
+	if len(strs) != 2 || strs[0] == "" || strs[1] == "" {
+		allErrs = append(allErrs, field.Invalid(fldPath, chn, "channel must be in namespace/name format"))
+	}
+
+	return allErrs
+}
+
+func validatePackageFilter(pf *appv1alpha1.PackageFilter, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if pf.Version != "" {
+		if _, err := semver.ParseRange(pf.Version); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("version"), pf.Version, err.Error()))
+		}
+	}
+
+	switch pf.VersionPolicy {
+	case "", appv1alpha1.VersionPolicyHighest, appv1alpha1.VersionPolicyLatestPatch, appv1alpha1.VersionPolicyPinned:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("versionPolicy"), pf.VersionPolicy, []string{
+			string(appv1alpha1.VersionPolicyHighest), string(appv1alpha1.VersionPolicyLatestPatch), string(appv1alpha1.VersionPolicyPinned)}))
+	}
+
+	if pf.MinSoakAge != nil && pf.MinSoakAge.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("minSoakAge"), pf.MinSoakAge.Duration.String(), "must be greater than or equal to 0"))
+	}
+
+	return allErrs
+}
+
+func validateTimeWindow(tw *appv1alpha1.TimeWindow, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if tw.WindowType != "" && tw.WindowType != windowTypeActive && tw.WindowType != windowTypeBlocked {
+		allErrs = append(allErrs, field.NotSupported(fldPath.Child("windowtype"), tw.WindowType,
+			[]string{windowTypeActive, windowTypeBlocked}))
+	}
+
+	if tw.Location != "" {
+		if _, err := time.LoadLocation(tw.Location); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("location"), tw.Location, err.Error()))
+		}
+	}
+
+	for i, wd := range tw.Weekdays {
+		if !weekdays[strings.ToLower(wd)] {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("weekdays").Index(i), wd, "must be a day of the week, e.g. Monday"))
+		}
+	}
+
+	for i, hr := range tw.Hours {
+		hrPath := fldPath.Child("hours").Index(i)
+
+		if _, err := time.Parse(time.Kitchen, hr.Start); err != nil {
+			allErrs = append(allErrs, field.Invalid(hrPath.Child("start"), hr.Start, "must be in Kitchen format, e.g. 3:04PM"))
+		}
+
+		if _, err := time.Parse(time.Kitchen, hr.End); err != nil {
+			allErrs = append(allErrs, field.Invalid(hrPath.Child("end"), hr.End, "must be in Kitchen format, e.g. 3:04PM"))
+		}
+	}
+
+	for i, cw := range tw.Crons {
+		cwPath := fldPath.Child("crons").Index(i)
+
+		if _, err := utils.ParseCronSchedule(cw.Schedule); err != nil {
+			allErrs = append(allErrs, field.Invalid(cwPath.Child("schedule"), cw.Schedule, err.Error()))
+		}
+
+		if cw.Duration.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(cwPath.Child("duration"), cw.Duration.Duration.String(), "must be greater than 0"))
+		}
+	}
+
+	for i, dr := range tw.Dates {
+		if _, _, err := utils.ParseDateRange(dr, time.UTC); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("dates").Index(i), dr, err.Error()))
+		}
+	}
+
+	if tw.Calendar != nil && strings.TrimSpace(tw.Calendar.Name) == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("calendar", "name"), ""))
+	}
+
+	return allErrs
+}
+
+func validateClusterOverrides(ov dplv1alpha1.Overrides, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	if strings.TrimSpace(ov.ClusterName) == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("clusterName"), ""))
+	}
+
+	for i, cov := range ov.ClusterOverrides {
+		covPath := fldPath.Child("clusterOverrides").Index(i)
+
+		// the values are read on the managed cluster, which only package overrides reach
+		ovobj := make(map[string]interface{})
+		if json.Unmarshal(cov.RawExtension.Raw, &ovobj) == nil {
+			if _, ok := ovobj[utils.OverrideValueFrom]; ok {
+				allErrs = append(allErrs, field.Forbidden(covPath.Child(utils.OverrideValueFrom), "only supported in packageOverrides"))
+				continue
+			}
+		}
+
+		allErrs = append(allErrs, validateOverride(cov.RawExtension.Raw, covPath)...)
+	}
+
+	return allErrs
+}
+
+// validateOverride checks the override has a path to override, or a well formed JSON patch or strategic merge patch
+func validateOverride(raw []byte, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	ov := make(map[string]interface{})
+
+	if err := json.Unmarshal(raw, &ov); err != nil {
+		// templated overrides are valid json only after they are rendered for the cluster on hub
+		if bytes.Contains(raw, []byte("{{")) {
+			return allErrs
+		}
+
+		return append(allErrs, field.Invalid(fldPath, string(raw), "must be a json object with path and value"))
+	}
+
+	if ops, ok := ov[utils.OverrideJSONPatch]; ok {
+		return append(allErrs, validateJSONPatch(ops, fldPath.Child(utils.OverrideJSONPatch))...)
+	}
+
+	if src, ok := ov[utils.OverrideValueFrom]; ok {
+		allErrs = append(allErrs, validateOverrideValueSource(src, fldPath.Child(utils.OverrideValueFrom))...)
+
+		if path, _ := ov["path"].(string); utils.IsHelmValuesPath(path) {
+			allErrs = append(allErrs, field.Forbidden(fldPath.Child("path"),
+				"helm values can not be taken from a ConfigMap or Secret key, use spec.helmValuesRef"))
+		}
+	}
+
+	if patch, ok := ov[utils.OverrideStrategicMergePatch]; ok {
+		if _, ok := patch.(map[string]interface{}); !ok {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child(utils.OverrideStrategicMergePatch), patch, "must be a json object"))
+		}
+
+		return allErrs
+	}
+
+	path, _ := ov["path"].(string)
+	if strings.TrimSpace(path) == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("path"), ""))
+	}
+
+	return allErrs
+}
+
+// validateOverrideValueSource checks the override takes its value from exactly one key of a ConfigMap or Secret
+func validateOverrideValueSource(src interface{}, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	srcb, _ := json.Marshal(src)
+	vs := utils.OverrideValueSource{}
+
+	if err := json.Unmarshal(srcb, &vs); err != nil {
+		return append(allErrs, field.Invalid(fldPath, src, "must have a configMapKeyRef or a secretKeyRef"))
+	}
+
+	if (vs.ConfigMapKeyRef == nil) == (vs.SecretKeyRef == nil) {
+		return append(allErrs, field.Invalid(fldPath, src, "must have exactly one of configMapKeyRef and secretKeyRef"))
+	}
+
+	if ref := vs.ConfigMapKeyRef; ref != nil {
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("configMapKeyRef", "name"), ""))
+		}
+
+		if ref.Key == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("configMapKeyRef", "key"), ""))
+		}
+	}
+
+	if ref := vs.SecretKeyRef; ref != nil {
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("secretKeyRef", "name"), ""))
+		}
+
+		if ref.Key == "" {
+			allErrs = append(allErrs, field.Required(fldPath.Child("secretKeyRef", "key"), ""))
+		}
+	}
+
+	return allErrs
+}
+
+// validateJSONPatch checks the RFC 6902 operations are known and have a path
+func validateJSONPatch(ops interface{}, fldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+
+	oplist, ok := ops.([]interface{})
+	if !ok {
+		return append(allErrs, field.Invalid(fldPath, ops, "must be a list of json patch operations"))
+	}
+
+	for i, op := range oplist {
+		opmap, ok := op.(map[string]interface{})
+		if !ok {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), op, "must be a json patch operation"))
+			continue
+		}
+
+		opname, _ := opmap["op"].(string)
+		if !jsonPatchOps[opname] {
+			allErrs = append(allErrs, field.NotSupported(fldPath.Index(i).Child("op"), opname, []string{"add", "remove", "replace", "move", "copy", "test"}))
+		}
+
+		if path, _ := opmap["path"].(string); !strings.HasPrefix(path, "/") {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i).Child("path"), opmap["path"], "must be a json pointer"))
+		}
+	}
+
+	return allErrs
+}
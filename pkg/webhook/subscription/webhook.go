@@ -0,0 +1,111 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
+
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+const (
+	// ValidatingWebhookPath is the path of the validating webhook of subscriptions
+	ValidatingWebhookPath = "/validate-app-ibm-com-v1alpha1-subscription"
+	// MutatingWebhookPath is the path of the defaulting webhook of subscriptions
+	MutatingWebhookPath = "/mutate-app-ibm-com-v1alpha1-subscription"
+	// ConversionWebhookPath is the path of the webhook converting subscriptions between v1alpha1 and v1beta1
+	ConversionWebhookPath = "/convert"
+)
+
+// Add registers the validating, defaulting and conversion webhooks of subscriptions to the webhook server of the manager
+func Add(mgr manager.Manager) error {
+	srv := mgr.GetWebhookServer()
+
+	srv.Register(ValidatingWebhookPath, &webhook.Admission{Handler: &ValidatingHandler{}})
+	srv.Register(MutatingWebhookPath, &webhook.Admission{Handler: &DefaultingHandler{}})
+	// the versions are converted through the hub version v1alpha1 with the scheme of the manager
+	srv.Register(ConversionWebhookPath, &conversion.Webhook{})
+
+	klog.Info("Registered subscription webhooks at ", ValidatingWebhookPath, ", ", MutatingWebhookPath, " and ", ConversionWebhookPath)
+
+	return nil
+}
+
+// ValidatingHandler rejects the subscriptions with invalid spec
+type ValidatingHandler struct{}
+
+// Handle validates the subscription in the admission request
+func (h *ValidatingHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if req.Operation == admissionv1beta1.Delete {
+		return admission.Allowed("")
+	}
+
+	sub := &appv1alpha1.Subscription{}
+
+	err := json.Unmarshal(req.Object.Raw, sub)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	allErrs := ValidateSubscription(sub)
+	if len(allErrs) == 0 {
+		return admission.Allowed("")
+	}
+
+	klog.Info("Rejecting subscription ", req.Namespace, "/", req.Name, " with errors: ", allErrs)
+
+	invalid := errors.NewInvalid(appv1alpha1.SchemeGroupVersion.WithKind("Subscription").GroupKind(), sub.Name, allErrs)
+
+	return admission.Response{
+		AdmissionResponse: admissionv1beta1.AdmissionResponse{
+			Allowed: false,
+			Result:  &invalid.ErrStatus,
+		},
+	}
+}
+
+// DefaultingHandler sets the defaults of the subscriptions
+type DefaultingHandler struct{}
+
+// Handle defaults the subscription in the admission request
+func (h *DefaultingHandler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	sub := &appv1alpha1.Subscription{}
+
+	err := json.Unmarshal(req.Object.Raw, sub)
+	if err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if !DefaultSubscription(sub) {
+		return admission.Allowed("")
+	}
+
+	defaulted, err := json.Marshal(sub)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	return admission.PatchResponseFromRaw(req.Object.Raw, defaulted)
+}
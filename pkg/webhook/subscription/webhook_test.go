@@ -0,0 +1,253 @@
+// Copyright 2019 The Kubernetes Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subscription
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/cert"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	dplv1alpha1 "github.com/IBM/multicloud-operators-deployable/pkg/apis/app/v1alpha1"
+	appv1alpha1 "github.com/IBM/multicloud-operators-subscription/pkg/apis/app/v1alpha1"
+)
+
+const timeout = time.Second * 10
+
+func TestValidateSubscription(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	sub := &appv1alpha1.Subscription{}
+	sub.Spec.Channel = "ns-ch"
+	sub.Spec.PackageFilter = &appv1alpha1.PackageFilter{
+		Version:       "not-a-range",
+		VersionPolicy: "Newest",
+		MinSoakAge:    &metav1.Duration{Duration: -time.Hour},
+	}
+	sub.Spec.TimeWindow = &appv1alpha1.TimeWindow{
+		Location: "Mars/Olympus_Mons",
+		Weekdays: []string{"Monday", "Funday"},
+		Hours:    []appv1alpha1.HourRange{{Start: "10:00AM", End: "25:00"}},
+		Crons:    []appv1alpha1.CronWindow{{Schedule: "0 2 * * SUN#6"}},
+		Dates:    []appv1alpha1.DateRange{{Start: "2020-01-03", End: "2019-12-20"}},
+		Calendar: &appv1alpha1.CalendarReference{},
+	}
+	sub.Spec.PackageOverrides = []*appv1alpha1.Overrides{
+		{
+			PackageName: "nginx",
+			PackageOverrides: []appv1alpha1.PackageOverride{
+				{RawExtension: runtime.RawExtension{Raw: []byte(`{"path":"","value":"x"}`)}},
+				{RawExtension: runtime.RawExtension{Raw: []byte(`{"jsonPatch":[{"op":"upsert","path":"spec"}]}`)}},
+				{RawExtension: runtime.RawExtension{Raw: []byte(`{"strategicMergePatch":["spec"]}`)}},
+				{RawExtension: runtime.RawExtension{Raw: []byte(`{"path":"spec.values","valueFrom":{"secretKeyRef":{"name":"db"}}}`)}},
+			},
+		},
+	}
+	sub.Spec.Overrides = []dplv1alpha1.Overrides{
+		{
+			ClusterName: "/",
+			ClusterOverrides: []dplv1alpha1.ClusterOverride{
+				{RawExtension: runtime.RawExtension{Raw: []byte(`{"path":"spec.values","valueFrom":{"secretKeyRef":{"name":"db","key":"password"}}}`)}},
+			},
+		},
+	}
+
+	var fields []string
+	for _, err := range ValidateSubscription(sub) {
+		fields = append(fields, err.Field)
+	}
+
+	g.Expect(fields).To(gomega.ConsistOf(
+		"spec.channel",
+		"spec.packageFilter.version",
+		"spec.packageFilter.versionPolicy",
+		"spec.packageFilter.minSoakAge",
+		"spec.timewindow.location",
+		"spec.timewindow.weekdays[1]",
+		"spec.timewindow.hours[0].end",
+		"spec.timewindow.crons[0].schedule",
+		"spec.timewindow.crons[0].duration",
+		"spec.timewindow.dates[0]",
+		"spec.timewindow.calendar.name",
+		"spec.packageOverrides[0].packageOverrides[0].path",
+		"spec.packageOverrides[0].packageOverrides[1].jsonPatch[0].op",
+		"spec.packageOverrides[0].packageOverrides[1].jsonPatch[0].path",
+		"spec.packageOverrides[0].packageOverrides[2].strategicMergePatch",
+		"spec.packageOverrides[0].packageOverrides[3].valueFrom.secretKeyRef.key",
+		"spec.packageOverrides[0].packageOverrides[3].path",
+		"spec.overrides[0].clusterOverrides[0].valueFrom",
+	))
+
+	sub.Spec.Channel = "ns-ch/ch"
+	sub.Spec.PackageFilter = &appv1alpha1.PackageFilter{
+		Version:       ">=1.0.0",
+		VersionPolicy: appv1alpha1.VersionPolicyPinned,
+		MinSoakAge:    &metav1.Duration{Duration: 24 * time.Hour},
+	}
+	sub.Spec.TimeWindow = &appv1alpha1.TimeWindow{
+		Location: "America/Toronto",
+		Weekdays: []string{"Monday"},
+		Hours:    []appv1alpha1.HourRange{{Start: "10:00AM", End: "5:30PM"}},
+		Crons:    []appv1alpha1.CronWindow{{Schedule: "0 2 * * SUN#1", Duration: metav1.Duration{Duration: 2 * time.Hour}}},
+		Dates:    []appv1alpha1.DateRange{{Start: "2019-12-20", End: "2020-01-03"}},
+		Calendar: &appv1alpha1.CalendarReference{Name: "maintenance"},
+	}
+	sub.Spec.PackageOverrides[0].PackageOverrides[0].Raw = []byte(`{"path":"spec.replicas","value":2}`)
+	sub.Spec.PackageOverrides[0].PackageOverrides[1].Raw = []byte(`{"jsonPatch":[{"op":"remove","path":"/spec/replicas"}]}`)
+	sub.Spec.PackageOverrides[0].PackageOverrides[2].Raw = []byte(`{"strategicMergePatch":{"spec":{"replicas":2}}}`)
+	sub.Spec.PackageOverrides[0].PackageOverrides[3].Raw = []byte(`{"path":"spec.password","valueFrom":{"secretKeyRef":{"name":"db","key":"password"}}}`)
+	sub.Spec.Overrides[0].ClusterOverrides[0].Raw = []byte(`{"path":"spec.channel","value":"ns-ch/ch2"}`)
+
+	g.Expect(ValidateSubscription(sub)).To(gomega.BeEmpty())
+}
+
+func TestSubscriptionWebhook(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	certDir, err := ioutil.TempDir("", "subscription-webhook")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	defer os.RemoveAll(certDir)
+
+	crt, key, err := cert.GenerateSelfSignedCertKey("127.0.0.1", []net.IP{net.ParseIP("127.0.0.1")}, nil)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(ioutil.WriteFile(filepath.Join(certDir, "tls.crt"), crt, 0600)).To(gomega.Succeed())
+	g.Expect(ioutil.WriteFile(filepath.Join(certDir, "tls.key"), key, 0600)).To(gomega.Succeed())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	mgr, err := manager.New(cfg, manager.Options{
+		MetricsBindAddress: "0",
+		Host:               "127.0.0.1",
+		Port:               port,
+		CertDir:            certDir,
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(Add(mgr)).To(gomega.Succeed())
+
+	c := mgr.GetClient()
+
+	stopMgr, mgrStopped := StartTestManager(mgr, g)
+
+	defer func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+	}()
+
+	url := func(path string) *string {
+		u := "https://127.0.0.1:" + strconv.Itoa(port) + path
+		return &u
+	}
+
+	failurePolicy := admissionregistrationv1beta1.Fail
+	matchPolicy := admissionregistrationv1beta1.Equivalent
+	rules := []admissionregistrationv1beta1.RuleWithOperations{
+		{
+			Operations: []admissionregistrationv1beta1.OperationType{
+				admissionregistrationv1beta1.Create,
+				admissionregistrationv1beta1.Update,
+			},
+			Rule: admissionregistrationv1beta1.Rule{
+				APIGroups:   []string{appv1alpha1.SchemeGroupVersion.Group},
+				APIVersions: []string{appv1alpha1.SchemeGroupVersion.Version},
+				Resources:   []string{"subscriptions"},
+			},
+		},
+	}
+
+	vwc := &admissionregistrationv1beta1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "subscription-validating-webhook"},
+		Webhooks: []admissionregistrationv1beta1.ValidatingWebhook{
+			{
+				Name:          "validate.subscription.app.ibm.com",
+				ClientConfig:  admissionregistrationv1beta1.WebhookClientConfig{URL: url(ValidatingWebhookPath), CABundle: crt},
+				Rules:         rules,
+				FailurePolicy: &failurePolicy,
+				MatchPolicy:   &matchPolicy,
+			},
+		},
+	}
+	g.Expect(c.Create(context.TODO(), vwc)).To(gomega.Succeed())
+
+	defer c.Delete(context.TODO(), vwc)
+
+	mwc := &admissionregistrationv1beta1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "subscription-mutating-webhook"},
+		Webhooks: []admissionregistrationv1beta1.MutatingWebhook{
+			{
+				Name:          "default.subscription.app.ibm.com",
+				ClientConfig:  admissionregistrationv1beta1.WebhookClientConfig{URL: url(MutatingWebhookPath), CABundle: crt},
+				Rules:         rules,
+				FailurePolicy: &failurePolicy,
+				MatchPolicy:   &matchPolicy,
+			},
+		},
+	}
+	g.Expect(c.Create(context.TODO(), mwc)).To(gomega.Succeed())
+
+	defer c.Delete(context.TODO(), mwc)
+
+	invalid := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: "invalid-sub", Namespace: "default"},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel:    "ns-ch",
+			TimeWindow: &appv1alpha1.TimeWindow{Location: "Mars/Olympus_Mons"},
+		},
+	}
+
+	// wait for the webhook server to serve
+	g.Eventually(func() bool {
+		return errors.IsInvalid(c.Create(context.TODO(), invalid.DeepCopy()))
+	}, timeout).Should(gomega.BeTrue())
+
+	err = c.Create(context.TODO(), invalid)
+	g.Expect(err).To(gomega.HaveOccurred())
+	g.Expect(err.Error()).To(gomega.ContainSubstring("spec.channel"))
+	g.Expect(err.Error()).To(gomega.ContainSubstring("spec.timewindow.location"))
+
+	valid := &appv1alpha1.Subscription{
+		ObjectMeta: metav1.ObjectMeta{Name: "valid-sub", Namespace: "default"},
+		Spec: appv1alpha1.SubscriptionSpec{
+			Channel:    "ns-ch/ch",
+			TimeWindow: &appv1alpha1.TimeWindow{Location: "America/Toronto"},
+		},
+	}
+	g.Expect(c.Create(context.TODO(), valid)).To(gomega.Succeed())
+
+	defer c.Delete(context.TODO(), valid)
+
+	created := &appv1alpha1.Subscription{}
+	g.Eventually(func() error {
+		return c.Get(context.TODO(), types.NamespacedName{Name: valid.Name, Namespace: valid.Namespace}, created)
+	}, timeout).Should(gomega.Succeed())
+	g.Expect(created.Spec.TimeWindow.WindowType).To(gomega.Equal("active"))
+}